@@ -0,0 +1,371 @@
+// Package client provides a client for the currency service which keeps a cache of
+// exchange rates up to date through the SubscribeRates stream
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	protos "github.com/d-vignesh/go-microservice-example/currency/protos/currency"
+	"github.com/hashicorp/go-hclog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrInvalidCurrency is returned when the currency service does not support a currency
+var ErrInvalidCurrency = errors.New("invalid currency")
+
+// Rate is the exchange rate from the base currency to the destination currency
+type Rate struct {
+	Base        string
+	Destination string
+	Value       float64
+	Metadata    *protos.RateMetadata
+}
+
+// Rater returns exchange rates from a base currency, it is implemented by Client
+// and by Fake for tests
+type Rater interface {
+	// Rate returns the exchange rate from the base currency to dest, the code of dest
+	// is not case sensitive and the rate has the upper case code
+	Rate(ctx context.Context, dest string) (Rate, error)
+	// Watch returns a channel which receives every updated rate and a function
+	// which must be called to stop watching
+	Watch() (<-chan Rate, func())
+}
+
+// Backoff defines the delay between reconnection attempts, the delay doubles with
+// every failed attempt up to Max and a random jitter is applied
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+// DefaultBackoff is used when no backoff is configured
+var DefaultBackoff = Backoff{Initial: 250 * time.Millisecond, Max: 30 * time.Second}
+
+// delay returns the jittered delay for the given attempt, the "full jitter" strategy
+// spreads reconnecting clients evenly between zero and the exponential delay
+func (b Backoff) delay(attempt int) time.Duration {
+	d := b.Max
+	if attempt < 30 {
+		if e := b.Initial << uint(attempt); e > 0 && e < b.Max {
+			d = e
+		}
+	}
+
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithBase sets the base currency of the rates, the default is EUR
+func WithBase(base string) Option {
+	return func(c *Client) { c.base = base }
+}
+
+// WithBackoff sets the backoff used when reconnecting the rate subscription
+func WithBackoff(b Backoff) Option {
+	return func(c *Client) { c.backoff = b }
+}
+
+// Client owns the connection to the currency service. Rates are cached and kept up to
+// date through a subscription, when the subscription fails it is re-established with a
+// jittered backoff and all subscriptions are replayed.
+type Client struct {
+	log      hclog.Logger
+	conn     *grpc.ClientConn
+	currency protos.CurrencyClient
+	base     string
+	backoff  Backoff
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu         sync.RWMutex
+	cache      map[string]Rate
+	subscribed map[string]bool
+	stream     protos.Currency_SubscribeRatesClient
+	watchers   map[chan Rate]struct{}
+
+	// sendMu serialises sends on the stream, a stream must not be written concurrently
+	sendMu sync.Mutex
+}
+
+// New connects to the currency service at addr and starts the rate subscription
+func New(addr string, l hclog.Logger, opts ...Option) (*Client, error) {
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to currency service: %w", err)
+	}
+
+	c := newClient(protos.NewCurrencyClient(conn), l, opts...)
+	c.conn = conn
+
+	return c, nil
+}
+
+// newClient creates a client for the given service client and starts the subscription
+func newClient(cc protos.CurrencyClient, l hclog.Logger, opts ...Option) *Client {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c := &Client{
+		log:        l,
+		currency:   cc,
+		base:       "EUR",
+		backoff:    DefaultBackoff,
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+		cache:      map[string]Rate{},
+		subscribed: map[string]bool{},
+		watchers:   map[chan Rate]struct{}{},
+	}
+
+	for _, o := range opts {
+		o(c)
+	}
+
+	go c.run()
+	return c
+}
+
+// Close stops the subscription and closes the connection
+func (c *Client) Close() error {
+	c.cancel()
+	<-c.done
+
+	if c.conn == nil {
+		return nil
+	}
+
+	return c.conn.Close()
+}
+
+// Rate returns the exchange rate from the base currency to dest. Cached rates are returned
+// without calling the service, otherwise the rate is fetched and subscribed to.
+func (c *Client) Rate(ctx context.Context, dest string) (Rate, error) {
+	// the rates are cached by the code the service streams them with
+	dest = normalizeCode(dest)
+	if dest == c.base {
+		return Rate{Base: c.base, Destination: dest, Value: 1}, nil
+	}
+
+	c.mu.RLock()
+	r, ok := c.cache[dest]
+	c.mu.RUnlock()
+
+	if ok {
+		return r, nil
+	}
+
+	r, err := c.fetch(ctx, dest)
+	if err != nil {
+		return Rate{}, err
+	}
+
+	// subscribe for updates, when the stream is not connected the subscription
+	// is sent once it reconnects. A rate received from the stream while the rate was
+	// fetched is newer and is kept.
+	c.mu.Lock()
+	if cached, ok := c.cache[dest]; ok {
+		r = cached
+	} else {
+		c.cache[dest] = r
+	}
+	subscribed := c.subscribed[dest]
+	c.subscribed[dest] = true
+	stream := c.stream
+	c.mu.Unlock()
+
+	if !subscribed && stream != nil {
+		err := c.send(stream, dest)
+		if err != nil {
+			c.log.Error("unable to subscribe for rate", "dest", dest, "error", err)
+		}
+	}
+
+	return r, nil
+}
+
+// Watch returns a channel which receives every updated rate, updates are dropped
+// for watchers which do not keep up
+func (c *Client) Watch() (<-chan Rate, func()) {
+	ch := make(chan Rate, 64)
+
+	c.mu.Lock()
+	c.watchers[ch] = struct{}{}
+	c.mu.Unlock()
+
+	return ch, func() {
+		c.mu.Lock()
+		delete(c.watchers, ch)
+		c.mu.Unlock()
+	}
+}
+
+// fetch calls the service for the rate
+func (c *Client) fetch(ctx context.Context, dest string) (Rate, error) {
+	resp, err := c.currency.GetRate(ctx, &protos.RateRequest{BaseCode: c.base, DestinationCode: dest})
+	if err != nil {
+		// convert the grpc error message
+		grpcError, ok := status.FromError(err)
+		if !ok {
+			return Rate{}, err
+		}
+
+		// if this is an invalid arguments exception santise the message before returning
+		if grpcError.Code() == codes.InvalidArgument {
+			return Rate{}, fmt.Errorf("%w: %s", ErrInvalidCurrency, grpcError.Message())
+		}
+
+		return Rate{}, fmt.Errorf("unable to retrieve exchange rate from currency service: %s", grpcError.Message())
+	}
+
+	return newRate(resp), nil
+}
+
+// send subscribes to updates for dest on the stream
+func (c *Client) send(stream protos.Currency_SubscribeRatesClient, dest string) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	return stream.Send(&protos.RateRequest{BaseCode: c.base, DestinationCode: dest})
+}
+
+// run keeps the subscription connected until the client is closed
+func (c *Client) run() {
+	defer close(c.done)
+
+	attempt := 0
+	for {
+		connected, err := c.subscribe()
+		if c.ctx.Err() != nil {
+			return
+		}
+
+		if connected {
+			attempt = 0
+		}
+
+		d := c.backoff.delay(attempt)
+		attempt++
+
+		c.log.Error("rate subscription failed, reconnecting", "error", err, "attempt", attempt, "delay", d)
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(d):
+		}
+	}
+}
+
+// subscribe opens the stream, replays the subscriptions and handles updates until the
+// stream fails. connected is true when the stream was established.
+func (c *Client) subscribe() (connected bool, err error) {
+	stream, err := c.currency.SubscribeRates(c.ctx)
+	if err != nil {
+		return false, err
+	}
+
+	// the stream and the subscriptions to replay are read under the same lock as Rate
+	// registers new subscriptions so none are lost
+	c.mu.Lock()
+	c.stream = stream
+	dests := make([]string, 0, len(c.subscribed))
+	for d := range c.subscribed {
+		dests = append(dests, d)
+	}
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.stream = nil
+		c.mu.Unlock()
+	}()
+
+	for _, d := range dests {
+		err := c.send(stream, d)
+		if err != nil {
+			return false, err
+		}
+
+		// rates may have changed while disconnected
+		r, err := c.fetch(c.ctx, d)
+		if err != nil {
+			c.log.Error("unable to refresh rate", "dest", d, "error", err)
+			continue
+		}
+
+		c.update(r)
+	}
+
+	for {
+		// Recv returns a StreamingRateResponse which can contain one of two message
+		// RateResponse or an Error.
+		srr, err := stream.Recv()
+		if err != nil {
+			return true, err
+		}
+
+		// handle a returned error message
+		if ge := srr.GetError(); ge != nil {
+			sre := status.FromProto(ge)
+
+			details := ""
+			if d := sre.Details(); len(d) > 0 {
+				if rr, ok := d[0].(*protos.RateRequest); ok {
+					details = fmt.Sprintf("base: %s destination: %s", rr.GetBaseCode(), rr.GetDestinationCode())
+				}
+			}
+
+			c.log.Error("received error from currency service rate subscription", "error", ge.GetMessage(), "details", details)
+			continue
+		}
+
+		// handle the rate response
+		if rr := srr.GetRateResponse(); rr != nil {
+			c.log.Debug("received updated rate from server", "dest", rr.GetDestinationCode())
+			c.update(newRate(rr))
+		}
+	}
+}
+
+// update stores the rate in the cache and notifies the watchers
+func (c *Client) update(r Rate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cache[r.Destination] = r
+
+	for ch := range c.watchers {
+		select {
+		case ch <- r:
+		default:
+		}
+	}
+}
+
+// normalizeCode returns the currency code the way the service returns it, upper case
+// without spaces
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func newRate(rr *protos.RateResponse) Rate {
+	return Rate{
+		Base:        rr.GetBaseCode(),
+		Destination: rr.GetDestinationCode(),
+		Value:       rr.GetRate(),
+		Metadata:    rr.GetMetadata(),
+	}
+}
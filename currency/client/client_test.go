@@ -0,0 +1,289 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	protos "github.com/d-vignesh/go-microservice-example/currency/protos/currency"
+	"github.com/hashicorp/go-hclog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testServer is a currency server which drops the first subscription stream after
+// receiving a request so that the client has to reconnect
+type testServer struct {
+	protos.UnimplementedCurrencyServer
+
+	mu       sync.Mutex
+	rates    map[string]float64
+	streams  int
+	requests chan *protos.RateRequest
+	updates  chan *protos.RateResponse
+	// fetching, when set, is sent a value once GetRate has been called and has to be
+	// sent a value for GetRate to return
+	fetching chan struct{}
+}
+
+func (s *testServer) GetRate(ctx context.Context, rr *protos.RateRequest) (*protos.RateResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fetching != nil {
+		s.fetching <- struct{}{}
+		<-s.fetching
+	}
+
+	r, ok := s.rates[rr.GetDestinationCode()]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "currency %s is not supported", rr.GetDestinationCode())
+	}
+
+	return &protos.RateResponse{BaseCode: rr.GetBaseCode(), DestinationCode: rr.GetDestinationCode(), Rate: r}, nil
+}
+
+func (s *testServer) SubscribeRates(src protos.Currency_SubscribeRatesServer) error {
+	s.mu.Lock()
+	s.streams++
+	first := s.streams == 1
+	s.mu.Unlock()
+
+	if !first {
+		go func() {
+			for rr := range s.updates {
+				src.Send(&protos.StreamingRateResponse{Message: &protos.StreamingRateResponse_RateResponse{RateResponse: rr}})
+			}
+		}()
+	}
+
+	for {
+		rr, err := src.Recv()
+		if err != nil {
+			return err
+		}
+
+		s.requests <- rr
+		if first {
+			return status.Error(codes.Unavailable, "dropping stream")
+		}
+	}
+}
+
+func newTestClient(t *testing.T, s *testServer) *Client {
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	protos.RegisterCurrencyServer(gs, s)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	c := newClient(protos.NewCurrencyClient(conn), hclog.NewNullLogger(), WithBackoff(Backoff{Initial: time.Millisecond, Max: 10 * time.Millisecond}))
+	t.Cleanup(func() { c.Close() })
+
+	return c
+}
+
+func TestClientReplaysSubscriptionsAfterReconnect(t *testing.T) {
+	s := &testServer{
+		rates:    map[string]float64{"USD": 1.1},
+		requests: make(chan *protos.RateRequest, 10),
+		updates:  make(chan *protos.RateResponse, 10),
+	}
+	c := newTestClient(t, s)
+
+	r, err := c.Rate(context.Background(), "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Value != 1.1 {
+		t.Fatalf("expected rate 1.1, got %f", r.Value)
+	}
+
+	// the request is received on the first stream, which is then dropped, and
+	// replayed on the second
+	for i := 0; i < 2; i++ {
+		select {
+		case rr := <-s.requests:
+			if rr.GetDestinationCode() != "USD" {
+				t.Fatalf("expected subscription for USD, got %s", rr.GetDestinationCode())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected subscription %d to be sent", i+1)
+		}
+	}
+
+	updates, stop := c.Watch()
+	defer stop()
+
+	s.updates <- &protos.RateResponse{BaseCode: "EUR", DestinationCode: "USD", Rate: 1.2}
+
+	// the rate refreshed after reconnecting may be received before the update
+	for u := (Rate{}); u.Value != 1.2; {
+		select {
+		case u = <-updates:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected rate update")
+		}
+	}
+
+	r, err = c.Rate(context.Background(), "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Value != 1.2 {
+		t.Fatalf("expected cached rate 1.2, got %f", r.Value)
+	}
+}
+
+func TestClientRefreshesRatesRequestedInLowerCase(t *testing.T) {
+	s := &testServer{
+		rates:    map[string]float64{"USD": 1.1},
+		requests: make(chan *protos.RateRequest, 10),
+		updates:  make(chan *protos.RateResponse, 10),
+	}
+	c := newTestClient(t, s)
+
+	r, err := c.Rate(context.Background(), " usd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Destination != "USD" || r.Value != 1.1 {
+		t.Fatalf("expected rate 1.1 for USD, got %f for %s", r.Value, r.Destination)
+	}
+
+	// the subscription is sent on the first stream and replayed on the second
+	for i := 0; i < 2; i++ {
+		select {
+		case rr := <-s.requests:
+			if rr.GetDestinationCode() != "USD" {
+				t.Fatalf("expected subscription for USD, got %s", rr.GetDestinationCode())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected subscription %d to be sent", i+1)
+		}
+	}
+
+	updates, stop := c.Watch()
+	defer stop()
+
+	// the server streams the updates with the upper case code
+	s.updates <- &protos.RateResponse{BaseCode: "EUR", DestinationCode: "USD", Rate: 1.2}
+
+	for u := (Rate{}); u.Value != 1.2; {
+		select {
+		case u = <-updates:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected rate update")
+		}
+	}
+
+	r, err = c.Rate(context.Background(), "usd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Value != 1.2 {
+		t.Fatalf("expected updated rate 1.2, got %f", r.Value)
+	}
+}
+
+func TestClientKeepsRateStreamedWhileFetching(t *testing.T) {
+	s := &testServer{
+		rates:    map[string]float64{"USD": 1.1},
+		requests: make(chan *protos.RateRequest, 10),
+		updates:  make(chan *protos.RateResponse, 10),
+		fetching: make(chan struct{}),
+	}
+	c := newTestClient(t, s)
+
+	rates := make(chan Rate)
+	go func() {
+		r, err := c.Rate(context.Background(), "USD")
+		if err != nil {
+			t.Error(err)
+		}
+		rates <- r
+	}()
+
+	// the stream delivers a newer rate before the fetched rate is returned
+	<-s.fetching
+	c.update(Rate{Base: "EUR", Destination: "USD", Value: 1.2})
+	s.fetching <- struct{}{}
+
+	if r := <-rates; r.Value != 1.2 {
+		t.Fatalf("expected streamed rate 1.2, got %f", r.Value)
+	}
+
+	r, err := c.Rate(context.Background(), "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Value != 1.2 {
+		t.Fatalf("expected cached rate 1.2, got %f", r.Value)
+	}
+}
+
+func TestClientReturnsInvalidCurrency(t *testing.T) {
+	s := &testServer{
+		rates:    map[string]float64{},
+		requests: make(chan *protos.RateRequest, 10),
+		updates:  make(chan *protos.RateResponse),
+	}
+	c := newTestClient(t, s)
+
+	_, err := c.Rate(context.Background(), "XXX")
+	if !errors.Is(err, ErrInvalidCurrency) {
+		t.Fatalf("expected ErrInvalidCurrency, got %v", err)
+	}
+
+	r, err := c.Rate(context.Background(), "EUR")
+	if err != nil || r.Value != 1 {
+		t.Fatalf("expected a rate of 1 for the base currency, got %f %v", r.Value, err)
+	}
+}
+
+func TestBackoffIsBounded(t *testing.T) {
+	b := Backoff{Initial: time.Millisecond, Max: time.Second}
+
+	for i := 0; i < 100; i++ {
+		d := b.delay(i)
+		if d < 0 || d > time.Second {
+			t.Fatalf("delay %s for attempt %d is outside of the bounds", d, i)
+		}
+	}
+}
+
+func TestFakeNotifiesWatchers(t *testing.T) {
+	f := NewFake()
+	updates, stop := f.Watch()
+	defer stop()
+
+	_, err := f.Rate(context.Background(), "USD")
+	if !errors.Is(err, ErrInvalidCurrency) {
+		t.Fatalf("expected ErrInvalidCurrency, got %v", err)
+	}
+
+	f.SetRate("USD", 1.1)
+
+	u := <-updates
+	if u.Destination != "USD" || u.Value != 1.1 {
+		t.Fatalf("unexpected update %+v", u)
+	}
+}
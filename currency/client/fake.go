@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Fake is an in memory Rater for tests, rates are set with SetRate
+type Fake struct {
+	base string
+
+	mu       sync.Mutex
+	rates    map[string]Rate
+	watchers map[chan Rate]struct{}
+}
+
+// NewFake creates a Fake with EUR as the base currency
+func NewFake() *Fake {
+	return &Fake{base: "EUR", rates: map[string]Rate{}, watchers: map[chan Rate]struct{}{}}
+}
+
+// SetRate sets the rate for dest and notifies the watchers
+func (f *Fake) SetRate(dest string, value float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	r := Rate{Base: f.base, Destination: dest, Value: value}
+	f.rates[dest] = r
+
+	for ch := range f.watchers {
+		select {
+		case ch <- r:
+		default:
+		}
+	}
+}
+
+// Rate returns the rate set for dest, ErrInvalidCurrency is returned for unknown currencies
+func (f *Fake) Rate(ctx context.Context, dest string) (Rate, error) {
+	dest = normalizeCode(dest)
+	if dest == f.base {
+		return Rate{Base: f.base, Destination: dest, Value: 1}, nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	r, ok := f.rates[dest]
+	if !ok {
+		return Rate{}, fmt.Errorf("%w: currency %s is not supported", ErrInvalidCurrency, dest)
+	}
+
+	return r, nil
+}
+
+// Watch returns a channel which receives every rate set with SetRate
+func (f *Fake) Watch() (<-chan Rate, func()) {
+	ch := make(chan Rate, 64)
+
+	f.mu.Lock()
+	f.watchers[ch] = struct{}{}
+	f.mu.Unlock()
+
+	return ch, func() {
+		f.mu.Lock()
+		delete(f.watchers, ch)
+		f.mu.Unlock()
+	}
+}
@@ -0,0 +1,454 @@
+package data
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// ErrAlertNotFound is returned when an alert with the given id does not exist
+var ErrAlertNotFound = errors.New("alert not found")
+
+// ErrInvalidAlert is returned when an alert definition can not be registered
+var ErrInvalidAlert = errors.New("invalid alert")
+
+// DefaultAlertWindow is the window used by percent move alerts when none is given
+const DefaultAlertWindow = 24 * time.Hour
+
+// AlertKind defines the type of condition an alert checks
+type AlertKind string
+
+const (
+	// AlertThreshold triggers when the rate crosses an absolute value
+	AlertThreshold AlertKind = "threshold"
+	// AlertPercentMove triggers when the rate moves by more than a percentage within a window
+	AlertPercentMove AlertKind = "percent_move"
+)
+
+// AlertDirection defines which side of a threshold triggers the alert
+type AlertDirection string
+
+const (
+	// AlertAbove triggers when the rate is at or above the threshold
+	AlertAbove AlertDirection = "above"
+	// AlertBelow triggers when the rate is at or below the threshold
+	AlertBelow AlertDirection = "below"
+)
+
+// Alert is a condition registered on a currency pair
+type Alert struct {
+	ID          string         `json:"id"`
+	Base        string         `json:"base"`
+	Destination string         `json:"destination"`
+	Kind        AlertKind      `json:"kind"`
+	Direction   AlertDirection `json:"direction,omitempty"`
+	Threshold   float64        `json:"threshold,omitempty"`
+	Percent     float64        `json:"percent,omitempty"`
+	Window      time.Duration  `json:"window,omitempty"`
+	// Hysteresis is the distance the rate has to move back from the trigger level
+	// before the alert re-arms, in rate units for thresholds and percentage points
+	// for percent moves
+	Hysteresis float64   `json:"hysteresis"`
+	CreatedAt  time.Time `json:"created_at"`
+	// Triggered is true while the condition holds and the alert has not re-armed
+	Triggered bool `json:"triggered"`
+}
+
+// AlertEvent is published when an alert triggers
+type AlertEvent struct {
+	Alert         Alert
+	Rate          float64
+	ChangePercent float64
+	TriggeredAt   time.Time
+}
+
+// rateSample is a rate observed at a point in time, used by percent move alerts
+type rateSample struct {
+	at   time.Time
+	rate float64
+}
+
+// Alerts stores alert definitions, evaluates them against the current rates and
+// publishes an AlertEvent to the watchers when an alert triggers.
+// Alert definitions are persisted as JSON to the given file.
+type Alerts struct {
+	log   hclog.Logger
+	rates *ExchangeRates
+	path  string
+
+	mu       sync.Mutex
+	alerts   map[string]*Alert
+	samples  map[string][]rateSample
+	watchers map[chan AlertEvent]struct{}
+}
+
+// NewAlerts creates a new Alerts store and loads the alert definitions from the file
+// at path, when path is empty alerts are only kept in memory
+func NewAlerts(er *ExchangeRates, path string, l hclog.Logger) (*Alerts, error) {
+	a := &Alerts{
+		log:      l,
+		rates:    er,
+		path:     path,
+		alerts:   map[string]*Alert{},
+		samples:  map[string][]rateSample{},
+		watchers: map[chan AlertEvent]struct{}{},
+	}
+
+	err := a.load()
+	return a, err
+}
+
+// Create validates and registers a new alert, the stored alert is returned
+func (a *Alerts) Create(al Alert) (Alert, error) {
+	err := a.validate(&al)
+	if err != nil {
+		return Alert{}, err
+	}
+
+	id, err := newAlertID()
+	if err != nil {
+		return Alert{}, err
+	}
+
+	al.ID = id
+	al.CreatedAt = time.Now().UTC()
+	al.Triggered = false
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.alerts[al.ID] = &al
+	err = a.save()
+	if err != nil {
+		delete(a.alerts, al.ID)
+		return Alert{}, err
+	}
+
+	a.log.Info("alert created", "id", al.ID, "base", al.Base, "destination", al.Destination, "kind", al.Kind)
+	return al, nil
+}
+
+// Delete removes the alert with the given id
+func (a *Alerts) Delete(id string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	al, ok := a.alerts[id]
+	if !ok {
+		return ErrAlertNotFound
+	}
+
+	delete(a.alerts, id)
+	delete(a.samples, id)
+
+	err := a.save()
+	if err != nil {
+		a.alerts[id] = al
+		return err
+	}
+
+	a.log.Info("alert deleted", "id", id)
+	return nil
+}
+
+// List returns all registered alerts ordered by creation time
+func (a *Alerts) List() []Alert {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	als := make([]Alert, 0, len(a.alerts))
+	for _, al := range a.alerts {
+		als = append(als, *al)
+	}
+
+	sort.Slice(als, func(i, j int) bool {
+		return als[i].CreatedAt.Before(als[j].CreatedAt)
+	})
+
+	return als
+}
+
+// Watch returns a channel which receives an AlertEvent every time an alert triggers,
+// the returned function must be called to stop watching
+func (a *Alerts) Watch() (<-chan AlertEvent, func()) {
+	ch := make(chan AlertEvent, 16)
+
+	a.mu.Lock()
+	a.watchers[ch] = struct{}{}
+	a.mu.Unlock()
+
+	return ch, func() {
+		a.mu.Lock()
+		delete(a.watchers, ch)
+		a.mu.Unlock()
+	}
+}
+
+// Evaluate checks every alert against the current rates, alerts which trigger are
+// published to the watchers. Once triggered an alert does not trigger again until
+// the rate has moved back past the trigger level by the hysteresis.
+func (a *Alerts) Evaluate(now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	changed := false
+	for _, al := range a.alerts {
+		rate, err := a.rates.GetRate(al.Base, al.Destination)
+		if err != nil {
+			a.log.Error("unable to get rate for alert", "id", al.ID, "error", err)
+			continue
+		}
+
+		var met, rearm bool
+		var move float64
+
+		switch al.Kind {
+		case AlertThreshold:
+			met, rearm = al.checkThreshold(rate)
+		case AlertPercentMove:
+			move = a.percentMove(al, rate, now)
+			met = math.Abs(move) >= al.Percent
+			rearm = math.Abs(move) < al.Percent-al.Hysteresis
+		}
+
+		if al.Triggered {
+			if rearm {
+				al.Triggered = false
+				changed = true
+				a.log.Debug("alert re-armed", "id", al.ID, "rate", rate)
+			}
+			continue
+		}
+
+		if !met {
+			continue
+		}
+
+		al.Triggered = true
+		changed = true
+		a.log.Info("alert triggered", "id", al.ID, "base", al.Base, "destination", al.Destination, "rate", rate)
+
+		a.publish(AlertEvent{Alert: *al, Rate: rate, ChangePercent: move, TriggeredAt: now})
+	}
+
+	if changed {
+		err := a.save()
+		if err != nil {
+			a.log.Error("unable to save alerts", "error", err)
+		}
+	}
+}
+
+// checkThreshold returns whether the threshold condition is met and whether
+// the alert should re-arm for the given rate
+func (al *Alert) checkThreshold(rate float64) (bool, bool) {
+	if al.Direction == AlertBelow {
+		return rate <= al.Threshold, rate > al.Threshold+al.Hysteresis
+	}
+
+	return rate >= al.Threshold, rate < al.Threshold-al.Hysteresis
+}
+
+// percentMove records the rate for the alert and returns the largest percentage move
+// of the rate against the lowest and highest rate seen within the window.
+// Must be called with the lock held.
+func (a *Alerts) percentMove(al *Alert, rate float64, now time.Time) float64 {
+	ss := append(a.samples[al.ID], rateSample{now, rate})
+
+	// drop the samples which are outside of the window
+	cutoff := now.Add(-al.Window)
+	i := 0
+	for i < len(ss) && ss[i].at.Before(cutoff) {
+		i++
+	}
+	ss = ss[i:]
+	a.samples[al.ID] = ss
+
+	low, high := ss[0].rate, ss[0].rate
+	for _, s := range ss {
+		low = math.Min(low, s.rate)
+		high = math.Max(high, s.rate)
+	}
+
+	up := (rate - low) / low * 100
+	down := (rate - high) / high * 100
+
+	if math.Abs(down) > up {
+		return down
+	}
+
+	return up
+}
+
+// publish sends the event to all watchers without blocking, must be called with the lock held
+func (a *Alerts) publish(ev AlertEvent) {
+	for ch := range a.watchers {
+		select {
+		case ch <- ev:
+		default:
+			a.log.Error("alert watcher is not keeping up, dropping event", "id", ev.Alert.ID)
+		}
+	}
+}
+
+// validate checks the alert definition and applies the defaults
+func (a *Alerts) validate(al *Alert) error {
+	if !a.rates.HasCurrency(al.Base) {
+		return fmt.Errorf("%w: currency %s is not supported", ErrInvalidAlert, al.Base)
+	}
+
+	if !a.rates.HasCurrency(al.Destination) {
+		return fmt.Errorf("%w: currency %s is not supported", ErrInvalidAlert, al.Destination)
+	}
+
+	if al.Base == al.Destination {
+		return fmt.Errorf("%w: base and destination currency must differ", ErrInvalidAlert)
+	}
+
+	if al.Hysteresis < 0 {
+		return fmt.Errorf("%w: hysteresis can not be negative", ErrInvalidAlert)
+	}
+
+	switch al.Kind {
+	case AlertThreshold:
+		if al.Threshold <= 0 {
+			return fmt.Errorf("%w: threshold must be greater than zero", ErrInvalidAlert)
+		}
+
+		if al.Direction == "" {
+			al.Direction = AlertAbove
+		}
+
+		if al.Direction != AlertAbove && al.Direction != AlertBelow {
+			return fmt.Errorf("%w: unknown direction %s", ErrInvalidAlert, al.Direction)
+		}
+
+		if al.Hysteresis == 0 {
+			al.Hysteresis = al.Threshold * 0.005
+		}
+
+		// an above alert would never re-arm and a below alert only at twice the threshold
+		if al.Hysteresis >= al.Threshold {
+			return fmt.Errorf("%w: hysteresis must be less than the threshold", ErrInvalidAlert)
+		}
+	case AlertPercentMove:
+		if al.Percent <= 0 {
+			return fmt.Errorf("%w: percent must be greater than zero", ErrInvalidAlert)
+		}
+
+		if al.Window < 0 {
+			return fmt.Errorf("%w: window can not be negative", ErrInvalidAlert)
+		}
+
+		if al.Window == 0 {
+			al.Window = DefaultAlertWindow
+		}
+
+		if al.Hysteresis == 0 {
+			al.Hysteresis = al.Percent * 0.1
+		}
+
+		// the alert would never re-arm as the move can not be below zero
+		if al.Hysteresis >= al.Percent {
+			return fmt.Errorf("%w: hysteresis must be less than the percent", ErrInvalidAlert)
+		}
+	default:
+		return fmt.Errorf("%w: unknown condition %s", ErrInvalidAlert, al.Kind)
+	}
+
+	return nil
+}
+
+// load reads the alert definitions from disk, a missing file is not an error
+func (a *Alerts) load() error {
+	if a.path == "" {
+		return nil
+	}
+
+	d, err := ioutil.ReadFile(a.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to read alerts: %w", err)
+	}
+
+	als := []*Alert{}
+	err = json.Unmarshal(d, &als)
+	if err != nil {
+		return fmt.Errorf("unable to decode alerts: %w", err)
+	}
+
+	for _, al := range als {
+		a.alerts[al.ID] = al
+	}
+
+	a.log.Info("loaded alerts", "count", len(als), "path", a.path)
+	return nil
+}
+
+// save writes the alert definitions to disk, the file is replaced atomically so a
+// crash can not leave a partially written file. Must be called with the lock held.
+func (a *Alerts) save() error {
+	if a.path == "" {
+		return nil
+	}
+
+	als := make([]*Alert, 0, len(a.alerts))
+	for _, al := range a.alerts {
+		als = append(als, al)
+	}
+
+	sort.Slice(als, func(i, j int) bool {
+		return als[i].CreatedAt.Before(als[j].CreatedAt)
+	})
+
+	d, err := json.MarshalIndent(als, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(a.path), ".alerts-*")
+	if err != nil {
+		return fmt.Errorf("unable to save alerts: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(d)
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to save alerts: %w", err)
+	}
+
+	return os.Rename(f.Name(), a.path)
+}
+
+// newAlertID returns a random identifier for an alert
+func newAlertID() (string, error) {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
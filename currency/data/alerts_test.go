@@ -0,0 +1,157 @@
+package data
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func newTestRates(rates map[string]float64) *ExchangeRates {
+	return &ExchangeRates{
+		log:       hclog.Default(),
+		rates:     rates,
+		maxAge:    DefaultMaxAge,
+		overrides: map[string]*Override{},
+		expiries:  map[string]*time.Timer{},
+	}
+}
+
+func TestThresholdAlertUsesHysteresis(t *testing.T) {
+	er := newTestRates(map[string]float64{"EUR": 1, "USD": 1.10})
+	a, err := NewAlerts(er, "", hclog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = a.Create(Alert{Base: "EUR", Destination: "USD", Kind: AlertThreshold, Threshold: 1.2, Hysteresis: 0.05})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, stop := a.Watch()
+	defer stop()
+
+	// crossing the threshold triggers the alert once, small moves around the
+	// threshold do not trigger it again
+	for _, r := range []float64{1.15, 1.21, 1.19, 1.22, 1.16, 1.25} {
+		er.rates["USD"] = r
+		a.Evaluate(time.Now())
+	}
+
+	if got := len(events); got != 1 {
+		t.Fatalf("expected 1 event, got %d", got)
+	}
+
+	// moving back beyond the hysteresis re-arms the alert
+	er.rates["USD"] = 1.14
+	a.Evaluate(time.Now())
+	er.rates["USD"] = 1.2
+	a.Evaluate(time.Now())
+
+	if got := len(events); got != 2 {
+		t.Fatalf("expected 2 events, got %d", got)
+	}
+}
+
+func TestPercentMoveAlertTriggersWithinWindow(t *testing.T) {
+	er := newTestRates(map[string]float64{"EUR": 1, "GBP": 1.0})
+	a, err := NewAlerts(er, "", hclog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = a.Create(Alert{Base: "EUR", Destination: "GBP", Kind: AlertPercentMove, Percent: 2, Window: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, stop := a.Watch()
+	defer stop()
+
+	now := time.Now()
+	er.rates["GBP"] = 1.0
+	a.Evaluate(now)
+
+	// a 3% move outside of the window does not trigger
+	er.rates["GBP"] = 1.03
+	a.Evaluate(now.Add(2 * time.Hour))
+
+	if got := len(events); got != 0 {
+		t.Fatalf("expected no events, got %d", got)
+	}
+
+	er.rates["GBP"] = 1.0
+	a.Evaluate(now.Add(150 * time.Minute))
+
+	ev := <-events
+	if ev.ChangePercent > -2 {
+		t.Fatalf("expected a move of at least -2%%, got %f", ev.ChangePercent)
+	}
+}
+
+func TestAlertsArePersisted(t *testing.T) {
+	er := newTestRates(map[string]float64{"EUR": 1, "USD": 1.10})
+	path := filepath.Join(t.TempDir(), "alerts.json")
+
+	a, err := NewAlerts(er, path, hclog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	al, err := a.Create(Alert{Base: "EUR", Destination: "USD", Kind: AlertThreshold, Threshold: 1.2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err = NewAlerts(er, path, hclog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	als := a.List()
+	if len(als) != 1 || als[0].ID != al.ID || als[0].Hysteresis != al.Hysteresis {
+		t.Fatalf("expected persisted alert %#v, got %#v", al, als)
+	}
+}
+
+func TestCreateAlertWithUnknownCurrencyReturnsErr(t *testing.T) {
+	a, err := NewAlerts(newTestRates(map[string]float64{"EUR": 1}), "", hclog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = a.Create(Alert{Base: "EUR", Destination: "XYZ", Kind: AlertThreshold, Threshold: 1})
+	if !errors.Is(err, ErrInvalidAlert) {
+		t.Fatalf("expected ErrInvalidAlert, got %v", err)
+	}
+}
+
+func TestCreateAlertWithHysteresisPastTriggerReturnsErr(t *testing.T) {
+	a, err := NewAlerts(newTestRates(map[string]float64{"EUR": 1, "USD": 1.10}), "", hclog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = a.Create(Alert{Base: "EUR", Destination: "USD", Kind: AlertPercentMove, Percent: 2, Hysteresis: 2})
+	if !errors.Is(err, ErrInvalidAlert) {
+		t.Fatalf("expected ErrInvalidAlert for a percent alert, got %v", err)
+	}
+
+	_, err = a.Create(Alert{Base: "EUR", Destination: "USD", Kind: AlertThreshold, Direction: AlertBelow, Threshold: 1, Hysteresis: 1.5})
+	if !errors.Is(err, ErrInvalidAlert) {
+		t.Fatalf("expected ErrInvalidAlert for a below alert, got %v", err)
+	}
+
+	_, err = a.Create(Alert{Base: "EUR", Destination: "USD", Kind: AlertThreshold, Direction: AlertAbove, Threshold: 1, Hysteresis: 1})
+	if !errors.Is(err, ErrInvalidAlert) {
+		t.Fatalf("expected ErrInvalidAlert for an above alert, got %v", err)
+	}
+
+	_, err = a.Create(Alert{Base: "EUR", Destination: "USD", Kind: AlertThreshold, Direction: AlertBelow, Threshold: 1, Hysteresis: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
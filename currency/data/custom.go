@@ -0,0 +1,339 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+	"unicode"
+)
+
+// ErrInvalidCustomCurrency is returned when a custom currency definition is not valid
+var ErrInvalidCustomCurrency = errors.New("invalid custom currency")
+
+// customCodePattern defines the allowed codes for custom currencies
+var customCodePattern = regexp.MustCompile(`^[A-Z][A-Z0-9]{2,9}$`)
+
+// CustomCurrency is a non-ISO 4217 currency, such as loyalty points, which is priced
+// against a reference currency. Either a fixed Rate or a Formula must be given.
+//
+// The Rate is the number of units of the custom currency for one unit of the reference
+// currency. A Formula is an arithmetic expression which evaluates to the same, currency
+// codes in the formula evaluate to the rate of that currency against the reference
+// currency, e.g. "100 * USD" with a reference of EUR.
+type CustomCurrency struct {
+	Code      string  `json:"code"`
+	Name      string  `json:"name"`
+	Reference string  `json:"reference"`
+	Rate      float64 `json:"rate,omitempty"`
+	Formula   string  `json:"formula,omitempty"`
+
+	expr expression
+}
+
+// LoadCustomCurrencies reads the custom currency definitions from a JSON file
+func LoadCustomCurrencies(path string) ([]CustomCurrency, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open custom currencies: %w", err)
+	}
+	defer f.Close()
+
+	ccs := []CustomCurrency{}
+	err = json.NewDecoder(f).Decode(&ccs)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode custom currencies: %w", err)
+	}
+
+	return ccs, nil
+}
+
+// AddCustomCurrencies validates the definitions and adds the currencies to the rate table,
+// the rates of custom currencies follow the rates of the currencies they are defined against.
+// No currency is added when any of the definitions is not valid.
+func (er *ExchangeRates) AddCustomCurrencies(ccs []CustomCurrency) error {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+
+	// every definition is validated before the first currency is added
+	added := make([]*CustomCurrency, 0, len(ccs))
+	codes := map[string]bool{}
+	for i := range ccs {
+		cc := ccs[i]
+
+		if !customCodePattern.MatchString(cc.Code) {
+			return fmt.Errorf("%w: code %q must be 3 to 10 upper case letters or digits", ErrInvalidCustomCurrency, cc.Code)
+		}
+
+		if _, ok := er.rates[cc.Code]; ok {
+			return fmt.Errorf("%w: %s is already a provider currency", ErrInvalidCustomCurrency, cc.Code)
+		}
+
+		if _, ok := er.custom[cc.Code]; ok || codes[cc.Code] {
+			return fmt.Errorf("%w: %s is defined more than once", ErrInvalidCustomCurrency, cc.Code)
+		}
+
+		if _, ok := er.rates[cc.Reference]; !ok {
+			return fmt.Errorf("%w: reference currency %q of %s is not a provider currency", ErrInvalidCustomCurrency, cc.Reference, cc.Code)
+		}
+
+		switch {
+		case cc.Formula != "" && cc.Rate != 0:
+			return fmt.Errorf("%w: %s can not have both a rate and a formula", ErrInvalidCustomCurrency, cc.Code)
+		case cc.Formula != "":
+			expr, err := parseFormula(cc.Formula)
+			if err != nil {
+				return fmt.Errorf("%w: formula of %s: %s", ErrInvalidCustomCurrency, cc.Code, err)
+			}
+
+			for _, code := range expr.codes() {
+				if _, ok := er.rates[code]; !ok {
+					return fmt.Errorf("%w: formula of %s uses unknown currency %s", ErrInvalidCustomCurrency, cc.Code, code)
+				}
+			}
+
+			cc.expr = expr
+		case cc.Rate <= 0:
+			return fmt.Errorf("%w: %s requires a positive rate or a formula", ErrInvalidCustomCurrency, cc.Code)
+		}
+
+		codes[cc.Code] = true
+		added = append(added, &cc)
+	}
+
+	if er.custom == nil {
+		er.custom = map[string]*CustomCurrency{}
+	}
+
+	for _, cc := range added {
+		er.custom[cc.Code] = cc
+		er.log.Info("added custom currency", "code", cc.Code, "reference", cc.Reference)
+	}
+
+	er.version++
+	return nil
+}
+
+// isCustom returns true when the code is a custom currency, must be called with the lock held
+func (er *ExchangeRates) isCustom(code string) bool {
+	_, ok := er.custom[code]
+	return ok
+}
+
+// customRate returns the rate of a custom currency against EUR, it follows the overrides of
+// the currencies it is defined against. Must be called with the lock held.
+func (er *ExchangeRates) customRate(cc *CustomCurrency, now time.Time) (float64, error) {
+	ref, _, _ := er.rate(cc.Reference, now)
+
+	if cc.expr == nil {
+		return ref * cc.Rate, nil
+	}
+
+	v, err := cc.expr.eval(func(code string) (float64, error) {
+		r, _, ok := er.rate(code, now)
+		if !ok {
+			return 0, fmt.Errorf("rate not found for currency %s: %w", code, ErrUnknownCurrency)
+		}
+
+		return r / ref, nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	if v <= 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("formula of %s evaluated to invalid rate %f", cc.Code, v)
+	}
+
+	return ref * v, nil
+}
+
+// expression is a parsed custom currency formula
+type expression interface {
+	eval(lookup func(code string) (float64, error)) (float64, error)
+	codes() []string
+}
+
+type number float64
+
+func (n number) eval(func(string) (float64, error)) (float64, error) { return float64(n), nil }
+func (n number) codes() []string                                     { return nil }
+
+type currencyRef string
+
+func (c currencyRef) eval(lookup func(string) (float64, error)) (float64, error) {
+	return lookup(string(c))
+}
+func (c currencyRef) codes() []string { return []string{string(c)} }
+
+type negate struct{ x expression }
+
+func (n negate) eval(lookup func(string) (float64, error)) (float64, error) {
+	v, err := n.x.eval(lookup)
+	return -v, err
+}
+func (n negate) codes() []string { return n.x.codes() }
+
+type binaryOp struct {
+	op   byte
+	l, r expression
+}
+
+func (b binaryOp) eval(lookup func(string) (float64, error)) (float64, error) {
+	l, err := b.l.eval(lookup)
+	if err != nil {
+		return 0, err
+	}
+
+	r, err := b.r.eval(lookup)
+	if err != nil {
+		return 0, err
+	}
+
+	switch b.op {
+	case '+':
+		return l + r, nil
+	case '-':
+		return l - r, nil
+	case '*':
+		return l * r, nil
+	default:
+		if r == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return l / r, nil
+	}
+}
+func (b binaryOp) codes() []string { return append(b.l.codes(), b.r.codes()...) }
+
+// parseFormula parses an arithmetic expression of numbers, currency codes, parentheses
+// and the + - * / operators
+func parseFormula(s string) (expression, error) {
+	p := &formulaParser{s: s}
+
+	e, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+	if p.pos < len(p.s) {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.s[p.pos], p.pos)
+	}
+
+	return e, nil
+}
+
+type formulaParser struct {
+	s   string
+	pos int
+}
+
+func (p *formulaParser) skipSpace() {
+	for p.pos < len(p.s) && unicode.IsSpace(rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *formulaParser) parseSum() (expression, error) {
+	l, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.s) || (p.s[p.pos] != '+' && p.s[p.pos] != '-') {
+			return l, nil
+		}
+
+		op := p.s[p.pos]
+		p.pos++
+
+		r, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+
+		l = binaryOp{op, l, r}
+	}
+}
+
+func (p *formulaParser) parseProduct() (expression, error) {
+	l, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.s) || (p.s[p.pos] != '*' && p.s[p.pos] != '/') {
+			return l, nil
+		}
+
+		op := p.s[p.pos]
+		p.pos++
+
+		r, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+
+		l = binaryOp{op, l, r}
+	}
+}
+
+func (p *formulaParser) parseFactor() (expression, error) {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		return nil, errors.New("unexpected end of formula")
+	}
+
+	c := p.s[p.pos]
+	switch {
+	case c == '-':
+		p.pos++
+		x, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return negate{x}, nil
+	case c == '(':
+		p.pos++
+		e, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+
+		p.skipSpace()
+		if p.pos >= len(p.s) || p.s[p.pos] != ')' {
+			return nil, fmt.Errorf("missing closing parenthesis at position %d", p.pos)
+		}
+		p.pos++
+		return e, nil
+	case c >= 'A' && c <= 'Z':
+		start := p.pos
+		for p.pos < len(p.s) && ((p.s[p.pos] >= 'A' && p.s[p.pos] <= 'Z') || (p.s[p.pos] >= '0' && p.s[p.pos] <= '9')) {
+			p.pos++
+		}
+		return currencyRef(p.s[start:p.pos]), nil
+	case (c >= '0' && c <= '9') || c == '.':
+		start := p.pos
+		for p.pos < len(p.s) && ((p.s[p.pos] >= '0' && p.s[p.pos] <= '9') || p.s[p.pos] == '.') {
+			p.pos++
+		}
+
+		f, err := strconv.ParseFloat(p.s[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", p.s[start:p.pos])
+		}
+		return number(f), nil
+	}
+
+	return nil, fmt.Errorf("unexpected %q at position %d", c, p.pos)
+}
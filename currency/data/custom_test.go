@@ -0,0 +1,113 @@
+package data
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestCustomCurrencyWithFixedRate(t *testing.T) {
+	er := newTestRates(map[string]float64{"EUR": 1, "USD": 1.2})
+
+	err := er.AddCustomCurrencies([]CustomCurrency{{Code: "BEANS", Reference: "USD", Rate: 100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := er.GetRateWithMetadata("USD", "BEANS")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if math.Abs(r.Value-100) > 1e-9 || !r.Metadata.Custom {
+		t.Fatalf("expected 100 BEANS per USD flagged as custom, got %#v", r)
+	}
+
+	// the custom currency follows the rate of its reference currency
+	er.rates["USD"] = 1.5
+
+	r, err = er.GetRateWithMetadata("EUR", "BEANS")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if math.Abs(r.Value-150) > 1e-9 {
+		t.Fatalf("expected 150 BEANS per EUR, got %f", r.Value)
+	}
+}
+
+func TestCustomCurrencyWithFormula(t *testing.T) {
+	er := newTestRates(map[string]float64{"EUR": 1, "USD": 1.2, "GBP": 0.9})
+
+	err := er.AddCustomCurrencies([]CustomCurrency{{Code: "MUGS", Reference: "EUR", Formula: "(USD + GBP) * 10 / 2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := er.GetRate("EUR", "MUGS")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if math.Abs(r-10.5) > 1e-9 {
+		t.Fatalf("expected 10.5 MUGS per EUR, got %f", r)
+	}
+}
+
+func TestInvalidCustomCurrencyReturnsErr(t *testing.T) {
+	tests := map[string]CustomCurrency{
+		"unknown reference":  {Code: "BEANS", Reference: "XYZ", Rate: 1},
+		"iso code":           {Code: "USD", Reference: "EUR", Rate: 1},
+		"missing rate":       {Code: "BEANS", Reference: "EUR"},
+		"bad formula":        {Code: "BEANS", Reference: "EUR", Formula: "USD *"},
+		"unknown in formula": {Code: "BEANS", Reference: "EUR", Formula: "XYZ * 2"},
+	}
+
+	for name, cc := range tests {
+		t.Run(name, func(t *testing.T) {
+			er := newTestRates(map[string]float64{"EUR": 1, "USD": 1.2})
+
+			err := er.AddCustomCurrencies([]CustomCurrency{cc})
+			if !errors.Is(err, ErrInvalidCustomCurrency) {
+				t.Fatalf("expected ErrInvalidCustomCurrency, got %v", err)
+			}
+		})
+	}
+}
+
+func TestInvalidCustomCurrencyAddsNoCurrency(t *testing.T) {
+	er := newTestRates(map[string]float64{"EUR": 1, "USD": 1.2})
+
+	err := er.AddCustomCurrencies([]CustomCurrency{
+		{Code: "BEANS", Reference: "EUR", Rate: 100},
+		{Code: "MILES", Reference: "EUR", Formula: "XYZ * 2"},
+	})
+	if !errors.Is(err, ErrInvalidCustomCurrency) {
+		t.Fatalf("expected ErrInvalidCustomCurrency, got %v", err)
+	}
+
+	if er.HasCurrency("BEANS") {
+		t.Fatal("expected BEANS not to be added when another definition is not valid")
+	}
+
+	// the valid definitions can be added once the configuration is fixed
+	err = er.AddCustomCurrencies([]CustomCurrency{
+		{Code: "BEANS", Reference: "EUR", Rate: 100},
+		{Code: "MILES", Reference: "EUR", Formula: "USD * 2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCustomCurrencyDefinedTwiceReturnsErr(t *testing.T) {
+	er := newTestRates(map[string]float64{"EUR": 1, "USD": 1.2})
+
+	err := er.AddCustomCurrencies([]CustomCurrency{
+		{Code: "BEANS", Reference: "EUR", Rate: 100},
+		{Code: "BEANS", Reference: "EUR", Rate: 200},
+	})
+	if !errors.Is(err, ErrInvalidCustomCurrency) {
+		t.Fatalf("expected ErrInvalidCustomCurrency, got %v", err)
+	}
+}
@@ -0,0 +1,232 @@
+package data
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrInvalidHistoryQuery is returned when a rate history query can not be answered
+var ErrInvalidHistoryQuery = errors.New("invalid history query")
+
+// maxCandles limits the number of candles a single history query can return
+const maxCandles = 10000
+
+var snapshotsBucket = []byte("snapshots")
+
+// RetentionPolicy defines how long rate snapshots are kept. Snapshots younger than Raw are
+// kept as recorded, older snapshots are downsampled to the last snapshot in every Downsample
+// interval and snapshots older than Max are removed. Candles for old periods are therefore
+// built from fewer samples and the high and low are approximate.
+type RetentionPolicy struct {
+	Raw        time.Duration
+	Downsample time.Duration
+	Max        time.Duration
+}
+
+// DefaultRetention keeps every snapshot for a week, hourly snapshots for a year
+var DefaultRetention = RetentionPolicy{
+	Raw:        7 * 24 * time.Hour,
+	Downsample: time.Hour,
+	Max:        365 * 24 * time.Hour,
+}
+
+// Candle contains the open, high, low and close rate over a period
+type Candle struct {
+	Start   time.Time
+	Open    float64
+	High    float64
+	Low     float64
+	Close   float64
+	Samples int
+}
+
+// snapshot is the stored representation of the rate table at a point in time
+type snapshot struct {
+	Version uint64             `json:"v"`
+	Rates   map[string]float64 `json:"r"`
+}
+
+// History records snapshots of the rate table in an embedded, disk backed
+// time series store and builds candles from them
+type History struct {
+	log       hclog.Logger
+	db        *bolt.DB
+	retention RetentionPolicy
+}
+
+// NewHistory opens, or creates, the history store at path
+func NewHistory(path string, rp RetentionPolicy, l hclog.Logger) (*History, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open history store: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(snapshotsBucket)
+		return err
+	})
+
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to create history store: %w", err)
+	}
+
+	return &History{l, db, rp}, nil
+}
+
+// Close closes the underlying store
+func (h *History) Close() error {
+	return h.db.Close()
+}
+
+// Record stores the rates of all currencies against EUR at the given time
+func (h *History) Record(at time.Time, version uint64, rates map[string]float64) error {
+	d, err := json.Marshal(snapshot{version, rates})
+	if err != nil {
+		return err
+	}
+
+	return h.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(snapshotsBucket).Put(timeKey(at), d)
+	})
+}
+
+// Candles returns the candles for the currency pair between from, inclusive, and to,
+// exclusive. Periods without any recorded snapshots are omitted.
+func (h *History) Candles(base, dest string, from, to time.Time, resolution time.Duration) ([]Candle, error) {
+	if resolution <= 0 {
+		return nil, fmt.Errorf("%w: resolution must be positive", ErrInvalidHistoryQuery)
+	}
+
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidHistoryQuery)
+	}
+
+	if to.Sub(from)/resolution > maxCandles {
+		return nil, fmt.Errorf("%w: the query would return more than %d candles", ErrInvalidHistoryQuery, maxCandles)
+	}
+
+	cs := []Candle{}
+	err := h.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(snapshotsBucket).Cursor()
+		end := timeKey(to)
+
+		for k, v := c.Seek(timeKey(from)); k != nil && string(k) < string(end); k, v = c.Next() {
+			s := snapshot{}
+			err := json.Unmarshal(v, &s)
+			if err != nil {
+				return err
+			}
+
+			br, bok := s.Rates[base]
+			dr, dok := s.Rates[dest]
+			if !bok || !dok || br == 0 {
+				continue
+			}
+
+			r := dr / br
+			start := keyTime(k).Truncate(resolution)
+
+			if len(cs) == 0 || !cs[len(cs)-1].Start.Equal(start) {
+				cs = append(cs, Candle{Start: start, Open: r, High: r, Low: r})
+			}
+
+			cd := &cs[len(cs)-1]
+			if r > cd.High {
+				cd.High = r
+			}
+			if r < cd.Low {
+				cd.Low = r
+			}
+			cd.Close = r
+			cd.Samples++
+		}
+
+		return nil
+	})
+
+	return cs, err
+}
+
+// ApplyRetention downsamples and removes the snapshots according to the retention policy
+func (h *History) ApplyRetention(now time.Time) error {
+	removed := 0
+
+	err := h.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(snapshotsBucket)
+		c := b.Cursor()
+
+		expired := timeKey(now.Add(-h.retention.Max))
+		raw := timeKey(now.Add(-h.retention.Raw))
+
+		// collect the keys first, deleting while iterating a cursor skips keys
+		del := [][]byte{}
+		var prev []byte
+		var prevBucket time.Time
+
+		for k, _ := c.First(); k != nil && string(k) < string(raw); k, _ = c.Next() {
+			if string(k) < string(expired) {
+				del = append(del, append([]byte{}, k...))
+				continue
+			}
+
+			// keep the last snapshot of every downsample interval
+			bucket := keyTime(k).Truncate(h.retention.Downsample)
+			if prev != nil && bucket.Equal(prevBucket) {
+				del = append(del, prev)
+			}
+
+			prev = append([]byte{}, k...)
+			prevBucket = bucket
+		}
+
+		for _, k := range del {
+			err := b.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+
+		removed = len(del)
+		return nil
+	})
+
+	if err == nil && removed > 0 {
+		h.log.Info("applied history retention", "removed", removed)
+	}
+
+	return err
+}
+
+// MonitorRetention applies the retention policy every interval
+func (h *History) MonitorRetention(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		for range ticker.C {
+			err := h.ApplyRetention(time.Now())
+			if err != nil {
+				h.log.Error("unable to apply history retention", "error", err)
+			}
+		}
+	}()
+}
+
+// timeKey encodes the time as a big endian key so that keys sort chronologically,
+// times before the unix epoch are stored as the epoch
+func timeKey(t time.Time) []byte {
+	k := make([]byte, 8)
+	if t.After(time.Unix(0, 0)) {
+		binary.BigEndian.PutUint64(k, uint64(t.UnixNano()))
+	}
+	return k
+}
+
+func keyTime(k []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(k))).UTC()
+}
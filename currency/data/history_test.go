@@ -0,0 +1,90 @@
+package data
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func newTestHistory(t *testing.T) *History {
+	h, err := NewHistory(filepath.Join(t.TempDir(), "history.db"), DefaultRetention, hclog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func TestHistoryBuildsCandles(t *testing.T) {
+	h := newTestHistory(t)
+	start := time.Date(2020, 10, 1, 10, 0, 0, 0, time.UTC)
+
+	// three snapshots in the first hour and two in the second
+	for i, usd := range []float64{1.10, 1.20, 1.15, 1.05, 1.12} {
+		at := start.Add(time.Duration(i*25) * time.Minute)
+		err := h.Record(at, uint64(i), map[string]float64{"EUR": 1, "USD": usd})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cs, err := h.Candles("EUR", "USD", start, start.Add(2*time.Hour), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cs) != 2 {
+		t.Fatalf("expected 2 candles, got %d", len(cs))
+	}
+
+	want := Candle{Start: start, Open: 1.10, High: 1.20, Low: 1.10, Close: 1.15, Samples: 3}
+	if cs[0] != want {
+		t.Fatalf("expected %#v, got %#v", want, cs[0])
+	}
+}
+
+func TestHistoryRetentionDownsamplesOldSnapshots(t *testing.T) {
+	h := newTestHistory(t)
+	h.retention = RetentionPolicy{Raw: 24 * time.Hour, Downsample: time.Hour, Max: 72 * time.Hour}
+
+	now := time.Date(2020, 10, 10, 0, 0, 0, 0, time.UTC)
+	record := func(at time.Time, usd float64) {
+		err := h.Record(at, 1, map[string]float64{"EUR": 1, "USD": usd})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// expired, downsampled and raw snapshots
+	record(now.Add(-96*time.Hour), 1.0)
+	record(now.Add(-48*time.Hour), 1.1)
+	record(now.Add(-48*time.Hour+10*time.Minute), 1.2)
+	record(now.Add(-48*time.Hour+20*time.Minute), 1.3)
+	record(now.Add(-time.Hour), 1.4)
+	record(now.Add(-time.Hour+10*time.Minute), 1.5)
+
+	err := h.ApplyRetention(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs, err := h.Candles("EUR", "USD", now.Add(-100*time.Hour), now, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cs) != 2 {
+		t.Fatalf("expected 2 candles, got %#v", cs)
+	}
+
+	if cs[0].Samples != 1 || cs[0].Close != 1.3 {
+		t.Fatalf("expected the last snapshot of the downsampled hour, got %#v", cs[0])
+	}
+
+	if cs[1].Samples != 2 {
+		t.Fatalf("expected the raw snapshots to be kept, got %#v", cs[1])
+	}
+}
@@ -0,0 +1,344 @@
+package data
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// ErrOverrideNotFound is returned when a currency does not have an active override
+var ErrOverrideNotFound = errors.New("override not found")
+
+// ErrInvalidOverride is returned when an override can not be set
+var ErrInvalidOverride = errors.New("invalid override")
+
+// overrideSource is the provider name reported in the metadata for overridden rates
+const overrideSource = "override"
+
+// Override audit actions
+const (
+	OverrideActionSet    = "set"
+	OverrideActionClear  = "clear"
+	OverrideActionExpire = "expire"
+)
+
+// Override replaces the provider rate of a currency against EUR
+type Override struct {
+	Currency  string    `json:"currency"`
+	Rate      float64   `json:"rate"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Actor     string    `json:"actor"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// active returns true when the override has not expired at the given time
+func (o *Override) active(now time.Time) bool {
+	return o.ExpiresAt.IsZero() || now.Before(o.ExpiresAt)
+}
+
+// OverrideAuditEntry records a change made to an override
+type OverrideAuditEntry struct {
+	Action   string    `json:"action"`
+	Override Override  `json:"override"`
+	Actor    string    `json:"actor"`
+	Reason   string    `json:"reason"`
+	At       time.Time `json:"at"`
+}
+
+// OpenAuditLog loads the audit trail of the overrides from the file at path, every
+// following change is appended to the file so the trail is kept across restarts.
+// Overrides which were active when the trail was written are restored, those which
+// expired since are recorded as expired.
+func (er *ExchangeRates) OpenAuditLog(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to open override audit log: %w", err)
+	}
+
+	audit := []OverrideAuditEntry{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		e := OverrideAuditEntry{}
+		err = json.Unmarshal(s.Bytes(), &e)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("unable to decode override audit log: %w", err)
+		}
+
+		audit = append(audit, e)
+	}
+
+	if s.Err() != nil {
+		f.Close()
+		return fmt.Errorf("unable to read override audit log: %w", s.Err())
+	}
+
+	now := time.Now().UTC()
+	active := activeOverrides(audit)
+
+	er.mu.Lock()
+
+	er.audit = append(audit, er.audit...)
+	er.auditFile = f
+
+	restored := 0
+	for _, o := range active {
+		if _, ok := er.overrides[o.Currency]; ok {
+			// an override set since the service started replaces the recorded one
+			continue
+		}
+
+		if !o.active(now) {
+			err = er.recordAudit(OverrideActionExpire, o, "system", "override expired", now)
+			if err != nil {
+				er.log.Error("unable to record override expiry", "currency", o.Currency, "error", err)
+			}
+
+			continue
+		}
+
+		o := o
+		er.overrides[o.Currency] = &o
+		er.startExpiry(&o, now)
+		restored++
+	}
+
+	if restored > 0 {
+		er.version++
+	}
+	er.mu.Unlock()
+
+	if restored > 0 {
+		er.notify()
+	}
+
+	er.log.Info("loaded override audit log", "count", len(audit), "restored", restored, "path", path)
+	return nil
+}
+
+// activeOverrides returns the overrides which were set and neither cleared nor expired
+// in the audit trail, ordered by currency
+func activeOverrides(audit []OverrideAuditEntry) []Override {
+	set := map[string]Override{}
+	for _, e := range audit {
+		switch e.Action {
+		case OverrideActionSet:
+			set[e.Override.Currency] = e.Override
+		case OverrideActionClear, OverrideActionExpire:
+			if o, ok := set[e.Override.Currency]; ok && o.CreatedAt.Equal(e.Override.CreatedAt) {
+				delete(set, e.Override.Currency)
+			}
+		}
+	}
+
+	ovs := []Override{}
+	for _, o := range set {
+		ovs = append(ovs, o)
+	}
+
+	sort.Slice(ovs, func(i, j int) bool { return ovs[i].Currency < ovs[j].Currency })
+	return ovs
+}
+
+// CloseAuditLog closes the file of the audit trail
+func (er *ExchangeRates) CloseAuditLog() error {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+
+	if er.auditFile == nil {
+		return nil
+	}
+
+	err := er.auditFile.Close()
+	er.auditFile = nil
+	return err
+}
+
+// SetOverride replaces the rate of the currency until the override is cleared or expires.
+// When the rate of the override is zero the current rate of the currency is pinned.
+// Subscribers are notified immediately.
+func (er *ExchangeRates) SetOverride(o Override) (Override, error) {
+	now := time.Now().UTC()
+
+	if o.Actor == "" || o.Reason == "" {
+		return Override{}, fmt.Errorf("%w: actor and reason are required", ErrInvalidOverride)
+	}
+
+	if o.Rate < 0 {
+		return Override{}, fmt.Errorf("%w: rate can not be negative", ErrInvalidOverride)
+	}
+
+	if !o.ExpiresAt.IsZero() && !o.ExpiresAt.After(now) {
+		return Override{}, fmt.Errorf("%w: expiry must be in the future", ErrInvalidOverride)
+	}
+
+	er.mu.Lock()
+
+	r, _, ok := er.rate(o.Currency, now)
+	if !ok {
+		er.mu.Unlock()
+		return Override{}, fmt.Errorf("%w: currency %s is not supported", ErrInvalidOverride, o.Currency)
+	}
+
+	if o.Rate == 0 {
+		o.Rate = r
+	}
+
+	o.CreatedAt = now
+
+	// the change is only made once it is recorded
+	err := er.recordAudit(OverrideActionSet, o, o.Actor, o.Reason, now)
+	if err != nil {
+		er.mu.Unlock()
+		return Override{}, err
+	}
+
+	er.overrides[o.Currency] = &o
+	er.stopExpiry(o.Currency)
+	er.startExpiry(&o, now)
+
+	er.version++
+	er.mu.Unlock()
+
+	er.notify()
+	return o, nil
+}
+
+// ClearOverride removes the override of the currency, the provider rate is used again.
+// Subscribers are notified immediately.
+func (er *ExchangeRates) ClearOverride(currency, actor, reason string) error {
+	if actor == "" || reason == "" {
+		return fmt.Errorf("%w: actor and reason are required", ErrInvalidOverride)
+	}
+
+	now := time.Now().UTC()
+
+	er.mu.Lock()
+
+	o, ok := er.overrides[currency]
+	if !ok || !o.active(now) {
+		er.mu.Unlock()
+		return ErrOverrideNotFound
+	}
+
+	err := er.recordAudit(OverrideActionClear, *o, actor, reason, now)
+	if err != nil {
+		er.mu.Unlock()
+		return err
+	}
+
+	delete(er.overrides, currency)
+	er.stopExpiry(currency)
+
+	er.version++
+	er.mu.Unlock()
+
+	er.notify()
+	return nil
+}
+
+// Overrides returns the active overrides
+func (er *ExchangeRates) Overrides() []Override {
+	er.mu.RLock()
+	defer er.mu.RUnlock()
+
+	now := time.Now()
+	ovs := []Override{}
+	for _, o := range er.overrides {
+		if o.active(now) {
+			ovs = append(ovs, *o)
+		}
+	}
+
+	return ovs
+}
+
+// OverrideAuditLog returns every change made to the overrides, oldest first
+func (er *ExchangeRates) OverrideAuditLog() []OverrideAuditEntry {
+	er.mu.RLock()
+	defer er.mu.RUnlock()
+
+	return append([]OverrideAuditEntry{}, er.audit...)
+}
+
+// expireOverride removes the override of the currency when it is still the override
+// created at the given time
+func (er *ExchangeRates) expireOverride(currency string, createdAt time.Time) {
+	er.mu.Lock()
+
+	o, ok := er.overrides[currency]
+	if !ok || !o.CreatedAt.Equal(createdAt) {
+		er.mu.Unlock()
+		return
+	}
+
+	delete(er.overrides, currency)
+	delete(er.expiries, currency)
+
+	// expired overrides are removed even when the expiry can not be recorded
+	err := er.recordAudit(OverrideActionExpire, *o, "system", "override expired", time.Now().UTC())
+	if err != nil {
+		er.log.Error("unable to record override expiry", "currency", currency, "error", err)
+	}
+
+	er.version++
+	er.mu.Unlock()
+
+	er.notify()
+}
+
+// startExpiry removes the override when it expires, must be called with the lock held
+func (er *ExchangeRates) startExpiry(o *Override, now time.Time) {
+	if o.ExpiresAt.IsZero() {
+		return
+	}
+
+	currency, createdAt := o.Currency, o.CreatedAt
+	er.expiries[currency] = time.AfterFunc(o.ExpiresAt.Sub(now), func() {
+		er.expireOverride(currency, createdAt)
+	})
+}
+
+// stopExpiry cancels the pending expiry of the currency override, must be called with the lock held
+func (er *ExchangeRates) stopExpiry(currency string) {
+	if t, ok := er.expiries[currency]; ok {
+		t.Stop()
+		delete(er.expiries, currency)
+	}
+}
+
+// recordAudit appends an entry to the audit trail and its file, must be called with the
+// lock held
+func (er *ExchangeRates) recordAudit(action string, o Override, actor, reason string, at time.Time) error {
+	e := OverrideAuditEntry{Action: action, Override: o, Actor: actor, Reason: reason, At: at}
+
+	if er.auditFile != nil {
+		d, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		_, err = er.auditFile.Write(append(d, '\n'))
+		if err != nil {
+			return fmt.Errorf("unable to record override change: %w", err)
+		}
+	}
+
+	er.audit = append(er.audit, e)
+
+	er.log.Info(
+		"rate override changed",
+		"action", action,
+		"currency", o.Currency,
+		"rate", o.Rate,
+		"actor", actor,
+		"reason", reason,
+	)
+
+	return nil
+}
@@ -0,0 +1,239 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOverrideTakesPrecedenceOverProviderRate(t *testing.T) {
+	er := newTestRates(map[string]float64{"EUR": 1, "USD": 1.2})
+	updates := er.Subscribe()
+
+	_, err := er.SetOverride(Override{Currency: "USD", Rate: 1.5, Actor: "alice", Reason: "bad ECB rate"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-updates:
+	default:
+		t.Fatal("expected subscribers to be notified of the override")
+	}
+
+	r, err := er.GetRateWithMetadata("EUR", "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Value != 1.5 || r.Metadata.Source != overrideSource {
+		t.Fatalf("expected overridden rate 1.5, got %#v", r)
+	}
+
+	err = er.ClearOverride("USD", "alice", "ECB corrected the rate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = er.GetRateWithMetadata("EUR", "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Value != 1.2 {
+		t.Fatalf("expected provider rate 1.2, got %f", r.Value)
+	}
+
+	if got := len(er.OverrideAuditLog()); got != 2 {
+		t.Fatalf("expected 2 audit entries, got %d", got)
+	}
+}
+
+func TestOverrideWithoutRatePinsCurrentRate(t *testing.T) {
+	er := newTestRates(map[string]float64{"EUR": 1, "GBP": 0.9})
+
+	o, err := er.SetOverride(Override{Currency: "GBP", Actor: "bob", Reason: "promotion"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	er.rates["GBP"] = 0.95
+
+	r, err := er.GetRate("EUR", "GBP")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if o.Rate != 0.9 || r != 0.9 {
+		t.Fatalf("expected pinned rate 0.9, got %f", r)
+	}
+}
+
+func TestOverrideExpires(t *testing.T) {
+	er := newTestRates(map[string]float64{"EUR": 1, "USD": 1.2})
+	updates := er.Subscribe()
+
+	_, err := er.SetOverride(Override{
+		Currency:  "USD",
+		Rate:      1.5,
+		ExpiresAt: time.Now().Add(50 * time.Millisecond),
+		Actor:     "alice",
+		Reason:    "flash sale",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-updates
+
+	select {
+	case <-updates:
+	case <-time.After(time.Second):
+		t.Fatal("expected subscribers to be notified when the override expires")
+	}
+
+	if len(er.Overrides()) != 0 {
+		t.Fatal("expected override to be removed")
+	}
+
+	log := er.OverrideAuditLog()
+	if log[len(log)-1].Action != OverrideActionExpire {
+		t.Fatalf("expected expire audit entry, got %#v", log[len(log)-1])
+	}
+}
+
+func TestOverrideRequiresActorAndReason(t *testing.T) {
+	er := newTestRates(map[string]float64{"EUR": 1, "USD": 1.2})
+
+	_, err := er.SetOverride(Override{Currency: "USD", Rate: 1.5})
+	if !errors.Is(err, ErrInvalidOverride) {
+		t.Fatalf("expected ErrInvalidOverride, got %v", err)
+	}
+}
+
+func TestOverrideAuditLogIsKeptAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides.jsonl")
+
+	er := newTestRates(map[string]float64{"EUR": 1, "USD": 1.2})
+	err := er.OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = er.SetOverride(Override{Currency: "USD", Rate: 1.5, Actor: "alice", Reason: "bad ECB rate"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = er.ClearOverride("USD", "bob", "ECB corrected the rate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = er.CloseAuditLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// changes which can not be recorded are not made
+	_, err = er.SetOverride(Override{Currency: "USD", Rate: 1.5, Actor: "alice", Reason: "bad ECB rate"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	er.auditFile, _ = os.Open(path)
+	err = er.ClearOverride("USD", "bob", "not recorded")
+	if err == nil {
+		t.Fatal("expected an error when the change can not be recorded")
+	}
+	if len(er.Overrides()) != 1 {
+		t.Fatal("expected the override to be kept when its clearing can not be recorded")
+	}
+	er.auditFile.Close()
+
+	restarted := newTestRates(map[string]float64{"EUR": 1, "USD": 1.2})
+	err = restarted.OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.CloseAuditLog()
+
+	log := restarted.OverrideAuditLog()
+	if len(log) != 2 {
+		t.Fatalf("expected 2 audit entries, got %d", len(log))
+	}
+
+	if log[0].Action != OverrideActionSet || log[0].Override.Rate != 1.5 || log[1].Action != OverrideActionClear || log[1].Actor != "bob" {
+		t.Fatalf("unexpected audit log %#v", log)
+	}
+}
+
+func TestOverridesAreRestoredFromAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides.jsonl")
+	now := time.Now().UTC()
+
+	usd := Override{Currency: "USD", Rate: 1.5, ExpiresAt: now.Add(time.Hour), Actor: "alice", Reason: "bad ECB rate", CreatedAt: now.Add(-time.Minute)}
+	gbp := Override{Currency: "GBP", Rate: 0.9, ExpiresAt: now.Add(-time.Second), Actor: "alice", Reason: "bad ECB rate", CreatedAt: now.Add(-time.Minute)}
+	jpy := Override{Currency: "JPY", Rate: 130, Actor: "alice", Reason: "bad ECB rate", CreatedAt: now.Add(-time.Minute)}
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := json.NewEncoder(f)
+	for _, e := range []OverrideAuditEntry{
+		{Action: OverrideActionSet, Override: usd, Actor: usd.Actor, Reason: usd.Reason, At: usd.CreatedAt},
+		{Action: OverrideActionSet, Override: gbp, Actor: gbp.Actor, Reason: gbp.Reason, At: gbp.CreatedAt},
+		{Action: OverrideActionSet, Override: jpy, Actor: jpy.Actor, Reason: jpy.Reason, At: jpy.CreatedAt},
+		{Action: OverrideActionClear, Override: jpy, Actor: "bob", Reason: "ECB corrected the rate", At: now},
+	} {
+		err = enc.Encode(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+
+	er := newTestRates(map[string]float64{"EUR": 1, "USD": 1.2, "GBP": 0.8, "JPY": 120})
+	err = er.OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer er.CloseAuditLog()
+
+	ovs := er.Overrides()
+	if len(ovs) != 1 || ovs[0].Currency != "USD" || ovs[0].Rate != 1.5 {
+		t.Fatalf("expected the USD override to be restored, got %#v", ovs)
+	}
+
+	rate, err := er.GetRate("EUR", "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate != 1.5 {
+		t.Fatalf("expected the restored override rate 1.5, got %f", rate)
+	}
+
+	// the override which expired while the service was down is recorded as expired
+	log := er.OverrideAuditLog()
+	if len(log) != 5 {
+		t.Fatalf("expected 5 audit entries, got %d", len(log))
+	}
+	if log[4].Action != OverrideActionExpire || log[4].Override.Currency != "GBP" || log[4].Actor != "system" {
+		t.Fatalf("unexpected expiry entry %#v", log[4])
+	}
+
+	er.CloseAuditLog()
+	restarted := newTestRates(map[string]float64{"EUR": 1, "USD": 1.2, "GBP": 0.8, "JPY": 120})
+	err = restarted.OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.CloseAuditLog()
+
+	if len(restarted.OverrideAuditLog()) != 5 {
+		t.Fatalf("expected the expiry to be recorded once, got %d entries", len(restarted.OverrideAuditLog()))
+	}
+}
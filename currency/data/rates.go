@@ -2,48 +2,222 @@ package data
 
 import (
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
 	"strconv"
+	"sync"
 	"time"
 	"math/rand"
 
 	"github.com/hashicorp/go-hclog"
 )
 
+// ErrUnknownCurrency is returned when a currency code is not present in the rate table
+var ErrUnknownCurrency = errors.New("unknown currency")
+
+// ecbSource is the provider name reported in the metadata for rates fetched from the ECB
+const ecbSource = "ECB"
+
+// DefaultMaxAge is the age after which rates which have not been refreshed from the
+// provider are reported as stale
+const DefaultMaxAge = 48 * time.Hour
+
 type ExchangeRates struct {
 	log		hclog.Logger
+	mu		sync.RWMutex
 	rates	map[string]float64
+
+	effectiveDate	time.Time
+	fetchedAt		time.Time
+	source			string
+	version			uint64
+	maxAge			time.Duration
+
+	subscribers		[]chan struct{}
+
+	custom			map[string]*CustomCurrency
+	overrides		map[string]*Override
+	expiries		map[string]*time.Timer
+	audit			[]OverrideAuditEntry
+	auditFile		*os.File
+}
+
+// Metadata describes the provenance of the rate table snapshot a rate was taken from
+type Metadata struct {
+	// EffectiveDate is the date the provider published the rates for
+	EffectiveDate	time.Time
+	// FetchedAt is the time the rates were fetched from the provider
+	FetchedAt		time.Time
+	// Source is the name of the provider
+	Source			string
+	// Version is incremented every time the rate table changes
+	Version			uint64
+	// Stale is true when the rates are older than the allowed maximum age
+	Stale			bool
+	// Custom is true when either currency is a custom, non-ISO 4217 currency
+	Custom			bool
+}
+
+// Rate is an exchange rate between two currencies along with its provenance
+type Rate struct {
+	Base		string
+	Destination	string
+	Value		float64
+	Metadata	Metadata
 }
 
 func NewRates(l hclog.Logger) (*ExchangeRates, error) {
-	er := &ExchangeRates{log: l, rates: map[string]float64{}}
+	er := &ExchangeRates{
+		log:		l,
+		rates:		map[string]float64{},
+		maxAge:		DefaultMaxAge,
+		custom:		map[string]*CustomCurrency{},
+		overrides:	map[string]*Override{},
+		expiries:	map[string]*time.Timer{},
+	}
 	err := er.getRates()
 	return er, err
 }
 
 func (er *ExchangeRates) GetRate(base, dest string) (float64, error) {
-	br, ok := er.rates[base]
+	r, err := er.GetRateWithMetadata(base, dest)
+	return r.Value, err
+}
+
+// GetRateWithMetadata returns the rate between the base and destination currency
+// together with the metadata of the snapshot the rate was calculated from
+func (er *ExchangeRates) GetRateWithMetadata(base, dest string) (Rate, error) {
+	er.mu.RLock()
+	defer er.mu.RUnlock()
+
+	now := time.Now()
+
+	br, bo, ok := er.rate(base, now)
 	if !ok {
-		return 0, fmt.Errorf("rate not found for currency %s", base)
+		return Rate{}, fmt.Errorf("rate not found for currency %s: %w", base, ErrUnknownCurrency)
 	}
 
-	dr, ok := er.rates[dest]
+	dr, do, ok := er.rate(dest, now)
 	if !ok {
-		return 0, fmt.Errorf("rate not found for currency %s", dest)
+		return Rate{}, fmt.Errorf("rate not found for currency %s: %w", dest, ErrUnknownCurrency)
+	}
+
+	md := er.metadata()
+	if bo || do {
+		md.Source = overrideSource
 	}
+	md.Custom = er.isCustom(base) || er.isCustom(dest)
 
-	return dr / br, nil
+	return Rate{Base: base, Destination: dest, Value: dr / br, Metadata: md}, nil
 }
 
-// MonitorRates checks the rates in the ECB API every interval and sends a message to the 
-// returned channel when there are changes
+// rate returns the rate of the currency against EUR and whether the rate comes
+// from an override, active overrides take precedence over the provider rates.
+// Must be called with the lock held.
+func (er *ExchangeRates) rate(code string, now time.Time) (float64, bool, bool) {
+	if o, ok := er.overrides[code]; ok && o.active(now) {
+		return o.Rate, true, true
+	}
+
+	if cc, ok := er.custom[code]; ok {
+		r, err := er.customRate(cc, now)
+		if err != nil {
+			er.log.Error("unable to calculate custom currency rate", "currency", code, "error", err)
+			return 0, false, false
+		}
+
+		return r, false, true
+	}
+
+	r, ok := er.rates[code]
+	return r, false, ok
+}
+
+// Snapshot returns the rates of all currencies against EUR, including overrides and
+// custom currencies, together with the metadata of the rate table
+func (er *ExchangeRates) Snapshot() (map[string]float64, Metadata) {
+	er.mu.RLock()
+	defer er.mu.RUnlock()
+
+	now := time.Now()
+	rs := make(map[string]float64, len(er.rates)+len(er.custom))
+
+	for code := range er.rates {
+		rs[code], _, _ = er.rate(code, now)
+	}
+
+	for code := range er.custom {
+		if r, _, ok := er.rate(code, now); ok {
+			rs[code] = r
+		}
+	}
+
+	return rs, er.metadata()
+}
+
+// Metadata returns the provenance of the current rate table
+func (er *ExchangeRates) Metadata() Metadata {
+	er.mu.RLock()
+	defer er.mu.RUnlock()
+
+	return er.metadata()
+}
+
+// metadata must be called with the lock held
+func (er *ExchangeRates) metadata() Metadata {
+	return Metadata{
+		EffectiveDate:	er.effectiveDate,
+		FetchedAt:		er.fetchedAt,
+		Source:			er.source,
+		Version:		er.version,
+		Stale:			time.Since(er.fetchedAt) > er.maxAge,
+	}
+}
+
+// HasCurrency returns true when the given currency code is present in the rate table
+func (er *ExchangeRates) HasCurrency(code string) bool {
+	er.mu.RLock()
+	defer er.mu.RUnlock()
+
+	_, ok := er.rates[code]
+	return ok || er.isCustom(code)
+}
+
+// Subscribe returns a channel which receives a message every time the rate table changes.
+// Notifications are coalesced, a slow subscriber only sees that at least one change happened
+// since it last read from the channel.
+func (er *ExchangeRates) Subscribe() <-chan struct{} {
+	ch := make(chan struct{}, 1)
+
+	er.mu.Lock()
+	er.subscribers = append(er.subscribers, ch)
+	er.mu.Unlock()
+
+	return ch
+}
+
+// notify signals all subscribers that the rate table has changed
+func (er *ExchangeRates) notify() {
+	er.mu.RLock()
+	defer er.mu.RUnlock()
+
+	for _, ch := range er.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// a notification is already pending for this subscriber
+		}
+	}
+}
+
+// MonitorRates checks the rates in the ECB API every interval and notifies the
+// subscribers when there are changes
 //
 // Note: the ECB API only returns data once a day, this function only stimulates the changes
 // in rates for demonstration purpose.
-func (er *ExchangeRates) MonitorRates(interval time.Duration) chan struct{} {
-	ret := make(chan struct{})
-
+func (er *ExchangeRates) MonitorRates(interval time.Duration) {
 	go func() {
 		ticker := time.NewTicker(interval)
 		for {
@@ -51,6 +225,7 @@ func (er *ExchangeRates) MonitorRates(interval time.Duration) chan struct{} {
 			case <-ticker.C:
 				// just add a random difference to the rate and return it
 				// this stimulates the fluctuations in currency rates
+				er.mu.Lock()
 				for k, v := range er.rates {
 					change := (rand.Float64() / 10)
 					direction := rand.Intn(1)
@@ -63,13 +238,13 @@ func (er *ExchangeRates) MonitorRates(interval time.Duration) chan struct{} {
 
 					er.rates[k] = v * change
 				}
+				er.version++
+				er.mu.Unlock()
 
-				ret <- struct{}{}
+				er.notify()
 			}
 		}
 	}()
-
-	return ret 
 }
 
 func (er *ExchangeRates) getRates() error {
@@ -84,9 +259,20 @@ func (er *ExchangeRates) getRates() error {
 	}
 
 	md := &Cubes{}
-	xml.NewDecoder(resp.Body).Decode(&md)
+	err = xml.NewDecoder(resp.Body).Decode(&md)
+	if err != nil {
+		return err
+	}
+
+	ed, err := time.Parse("2006-01-02", md.Day.Time)
+	if err != nil {
+		return fmt.Errorf("unable to parse effective date %q: %w", md.Day.Time, err)
+	}
 
-	for _, c := range md.CubeData {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+
+	for _, c := range md.Day.CubeData {
 		r, err := strconv.ParseFloat(c.Rate, 64)
 		if err != nil {
 			return err
@@ -94,11 +280,22 @@ func (er *ExchangeRates) getRates() error {
 		er.rates[c.Currency] = r
 	}
 	er.rates["EUR"] = 1
+
+	er.effectiveDate = ed
+	er.fetchedAt = time.Now().UTC()
+	er.source = ecbSource
+	er.version++
 	return nil
 }
 
 type Cubes struct {
-	CubeData []Cube `xml:"Cube>Cube>Cube"`
+	Day CubeDay `xml:"Cube>Cube"`
+}
+
+// CubeDay contains the rates published by the ECB for a single day
+type CubeDay struct {
+	Time	 string `xml:"time,attr"`
+	CubeData []Cube `xml:"Cube"`
 }
 
 type Cube struct {
@@ -1,8 +1,10 @@
 package data
 
 import (
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
 )
@@ -15,4 +17,46 @@ func TestNewRates(t *testing.T) {
 	}
 
 	fmt.Printf("Rates %#v", tr.rates)
-}
\ No newline at end of file
+}
+
+func TestGetRateUnknownCurrencyReturnsErr(t *testing.T) {
+	er := &ExchangeRates{log: hclog.Default(), rates: map[string]float64{"EUR": 1, "USD": 1.2}}
+
+	_, err := er.GetRate("EUR", "XYZ")
+	if !errors.Is(err, ErrUnknownCurrency) {
+		t.Fatalf("expected ErrUnknownCurrency, got %v", err)
+	}
+
+	r, err := er.GetRate("EUR", "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r != 1.2 {
+		t.Fatalf("expected rate 1.2, got %f", r)
+	}
+}
+
+func TestMetadataReportsStaleRates(t *testing.T) {
+	er := &ExchangeRates{
+		log:       hclog.Default(),
+		rates:     map[string]float64{"EUR": 1, "USD": 1.2},
+		fetchedAt: time.Now().Add(-72 * time.Hour),
+		source:    ecbSource,
+		version:   3,
+		maxAge:    DefaultMaxAge,
+	}
+
+	r, err := er.GetRateWithMetadata("EUR", "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.Metadata.Stale {
+		t.Fatal("expected rates fetched 72 hours ago to be stale")
+	}
+
+	if r.Metadata.Version != 3 || r.Metadata.Source != ecbSource {
+		t.Fatalf("unexpected metadata %#v", r.Metadata)
+	}
+}
@@ -3,8 +3,13 @@ module github.com/d-vignesh/go-microservice-example/currency
 go 1.15
 
 require (
+	github.com/desertbit/timer v0.0.0-20180107155436-c41aec40b27f // indirect
 	github.com/fullstorydev/grpcurl v1.7.0 // indirect
+	github.com/golang/protobuf v1.4.1
 	github.com/hashicorp/go-hclog v0.14.1
+	github.com/improbable-eng/grpc-web v0.13.0
+	github.com/rs/cors v1.7.0 // indirect
+	go.etcd.io/bbolt v1.3.5
 	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013
 	google.golang.org/grpc v1.33.0
 	google.golang.org/protobuf v1.25.0
@@ -1,19 +1,34 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
 	protos "github.com/d-vignesh/go-microservice-example/currency/protos/currency"
 	"github.com/d-vignesh/go-microservice-example/currency/server"
 	"github.com/d-vignesh/go-microservice-example/currency/data"
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 )
 
+var alertsFile = flag.String("alerts-file", "alerts.json", "File the alert definitions are persisted to")
+var customCurrencies = flag.String("custom-currencies", "", "JSON file defining custom currencies such as loyalty points")
+var historyFile = flag.String("history-file", "history.db", "File the rate history is stored in")
+var adminToken = flag.String("admin-token", "", "Bearer token required to call the CurrencyAdmin service, the service is disabled without a token")
+var overrideAuditFile = flag.String("override-audit-file", "overrides.jsonl", "File the audit trail of the rate overrides is appended to")
+var grpcWebAddr = flag.String("grpc-web-addr", ":9093", "Address the gRPC-Web server listens on, empty disables gRPC-Web")
+var corsOrigins = flag.String("cors-origins", "http://localhost:3000", "Comma separated origins allowed to call the gRPC-Web server, * allows any origin")
+
 func main() {
+	flag.Parse()
+
 	log := hclog.Default()
 
 	rates, err := data.NewRates(log)
@@ -22,15 +37,71 @@ func main() {
 		os.Exit(1)
 	}
 
+	// add the custom currencies, they are priced against the provider rates
+	if *customCurrencies != "" {
+		ccs, err := data.LoadCustomCurrencies(*customCurrencies)
+		if err == nil {
+			err = rates.AddCustomCurrencies(ccs)
+		}
+
+		if err != nil {
+			log.Error("unable to add custom currencies", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// simulate changes in the rates, subscribers are notified on every change
+	rates.MonitorRates(20 * time.Second)
+
+	// the admin service can change rates, it is only served with a token
+	opts := []grpc.ServerOption{}
+	if *adminToken != "" {
+		opts = append(opts, grpc.UnaryInterceptor(server.AdminAuthInterceptor(*adminToken)))
+	} else {
+		log.Warn("no admin token configured, the CurrencyAdmin service is disabled")
+	}
+
 	// create a new gRPC server, use WithInsecure to allow http connections
-	gs := grpc.NewServer()
+	gs := grpc.NewServer(opts...)
+
+	// open the rate history, old snapshots are downsampled every hour
+	h, err := data.NewHistory(*historyFile, data.DefaultRetention, log)
+	if err != nil {
+		log.Error("unable to open rate history", "error", err)
+		os.Exit(1)
+	}
+	defer h.Close()
+
+	h.MonitorRetention(time.Hour)
 
 	// create an instance of the currency server
-	c := server.NewCurrency(rates, log)
+	c := server.NewCurrency(rates, h, log)
 
 	// register the currency server
 	protos.RegisterCurrencyServer(gs, c)
 
+	// load the persisted alerts and register the alerts server
+	al, err := data.NewAlerts(rates, *alertsFile, log)
+	if err != nil {
+		log.Error("unable to load alerts", "error", err)
+		os.Exit(1)
+	}
+
+	protos.RegisterAlertsServer(gs, server.NewAlerts(al, rates, log))
+
+	// register the admin server used to override rates, its changes are recorded in the
+	// audit trail which the active overrides are restored from
+	if *adminToken != "" {
+		err = rates.OpenAuditLog(*overrideAuditFile)
+		if err != nil {
+			log.Error("unable to open override audit log", "error", err)
+			os.Exit(1)
+		}
+		defer rates.CloseAuditLog()
+
+		protos.RegisterCurrencyAdminServer(gs, server.NewAdmin(rates, log))
+	}
+
 	// register the reflection service which allow clients to determine the methods
 	// for this gRPC service
 	reflection.Register(gs)
@@ -42,6 +113,47 @@ func main() {
 		os.Exit(1)
 	}
 
+	// serve the Currency service over gRPC-Web so browsers can call it directly, the
+	// alerts and admin services are only served over gRPC
+	if *grpcWebAddr != "" {
+		webGS := grpc.NewServer()
+		protos.RegisterCurrencyServer(webGS, c)
+
+		ws := grpcweb.WrapServer(webGS, grpcweb.WithOriginFunc(allowedOrigin(*corsOrigins)))
+
+		// no write timeout as server streams stay open
+		hs := &http.Server{
+			Addr:		 *grpcWebAddr,
+			Handler:	 ws,
+			ErrorLog:	 log.StandardLogger(&hclog.StandardLoggerOptions{}),
+			ReadTimeout: 5 * time.Second,
+			IdleTimeout: 120 * time.Second,
+		}
+
+		go func() {
+			log.Info("Starting gRPC-Web server", "addr", *grpcWebAddr)
+
+			err := hs.ListenAndServe()
+			if err != nil {
+				log.Error("unable to start gRPC-Web server", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
 	// listen for requests
 	gs.Serve(l)
+}
+
+// allowedOrigin returns a function which reports whether a browser origin may call
+// the gRPC-Web server
+func allowedOrigin(origins string) func(string) bool {
+	allowed := map[string]bool{}
+	for _, o := range strings.Split(origins, ",") {
+		allowed[strings.TrimSpace(o)] = true
+	}
+
+	return func(origin string) bool {
+		return allowed["*"] || allowed[origin]
+	}
 }
\ No newline at end of file
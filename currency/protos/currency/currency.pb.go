@@ -8,6 +8,8 @@ package currency
 
 import (
 	context "context"
+	duration "github.com/golang/protobuf/ptypes/duration"
+	timestamp "github.com/golang/protobuf/ptypes/timestamp"
 	status "google.golang.org/genproto/googleapis/rpc/status"
 	grpc "google.golang.org/grpc"
 	codes "google.golang.org/grpc/codes"
@@ -26,6 +28,8 @@ const (
 )
 
 // Currencies is an enum which represents the allowed currencies for the API.
+// Deprecated: new clients should use the BaseCode and DestinationCode string fields,
+// the enum is kept for wire compatibility with existing clients.
 type Currencies int32
 
 const (
@@ -165,6 +169,53 @@ func (Currencies) EnumDescriptor() ([]byte, []int) {
 	return file_currency_proto_rawDescGZIP(), []int{0}
 }
 
+// Directions defines which side of the threshold triggers the alert
+type ThresholdCondition_Directions int32
+
+const (
+	ThresholdCondition_ABOVE ThresholdCondition_Directions = 0
+	ThresholdCondition_BELOW ThresholdCondition_Directions = 1
+)
+
+// Enum value maps for ThresholdCondition_Directions.
+var (
+	ThresholdCondition_Directions_name = map[int32]string{
+		0: "ABOVE",
+		1: "BELOW",
+	}
+	ThresholdCondition_Directions_value = map[string]int32{
+		"ABOVE": 0,
+		"BELOW": 1,
+	}
+)
+
+func (x ThresholdCondition_Directions) Enum() *ThresholdCondition_Directions {
+	p := new(ThresholdCondition_Directions)
+	*p = x
+	return p
+}
+
+func (x ThresholdCondition_Directions) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ThresholdCondition_Directions) Descriptor() protoreflect.EnumDescriptor {
+	return file_currency_proto_enumTypes[1].Descriptor()
+}
+
+func (ThresholdCondition_Directions) Type() protoreflect.EnumType {
+	return &file_currency_proto_enumTypes[1]
+}
+
+func (x ThresholdCondition_Directions) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ThresholdCondition_Directions.Descriptor instead.
+func (ThresholdCondition_Directions) EnumDescriptor() ([]byte, []int) {
+	return file_currency_proto_rawDescGZIP(), []int{7, 0}
+}
+
 // RateRequest defines the request for a GetRate call
 type RateRequest struct {
 	state         protoimpl.MessageState
@@ -175,6 +226,13 @@ type RateRequest struct {
 	Base Currencies `protobuf:"varint,1,opt,name=Base,proto3,enum=Currencies" json:"Base,omitempty"`
 	// Destination is the destination currency code for the rate
 	Destination Currencies `protobuf:"varint,2,opt,name=Destination,proto3,enum=Currencies" json:"Destination,omitempty"`
+	// BaseCode is the ISO 4217 code of the base currency, when set it takes
+	// precedence over Base and allows currencies outside the Currencies enum,
+	// including custom currencies
+	BaseCode string `protobuf:"bytes,3,opt,name=BaseCode,proto3" json:"BaseCode,omitempty"`
+	// DestinationCode is the ISO 4217 code of the destination currency, when set it
+	// takes precedence over Destination
+	DestinationCode string `protobuf:"bytes,4,opt,name=DestinationCode,proto3" json:"DestinationCode,omitempty"`
 }
 
 func (x *RateRequest) Reset() {
@@ -223,6 +281,20 @@ func (x *RateRequest) GetDestination() Currencies {
 	return Currencies_EUR
 }
 
+func (x *RateRequest) GetBaseCode() string {
+	if x != nil {
+		return x.BaseCode
+	}
+	return ""
+}
+
+func (x *RateRequest) GetDestinationCode() string {
+	if x != nil {
+		return x.DestinationCode
+	}
+	return ""
+}
+
 // RateResponse is the response from a GetRate call, it contains
 // rate which is a floating point number and can be used to convert between the
 // two currencies specified in the request
@@ -237,6 +309,12 @@ type RateResponse struct {
 	Destination Currencies `protobuf:"varint,2,opt,name=Destination,proto3,enum=Currencies" json:"Destination,omitempty"`
 	// Rate is the returned currency rate
 	Rate float64 `protobuf:"fixed64,3,opt,name=Rate,proto3" json:"Rate,omitempty"`
+	// BaseCode is the ISO 4217 code of the base currency for the rate
+	BaseCode string `protobuf:"bytes,4,opt,name=BaseCode,proto3" json:"BaseCode,omitempty"`
+	// DestinationCode is the ISO 4217 code of the destination currency for the rate
+	DestinationCode string `protobuf:"bytes,5,opt,name=DestinationCode,proto3" json:"DestinationCode,omitempty"`
+	// Metadata describes where the rate came from and how old it is
+	Metadata *RateMetadata `protobuf:"bytes,6,opt,name=Metadata,proto3" json:"Metadata,omitempty"`
 }
 
 func (x *RateResponse) Reset() {
@@ -292,19 +370,52 @@ func (x *RateResponse) GetRate() float64 {
 	return 0
 }
 
-type StreamingRateResponse struct {
+func (x *RateResponse) GetBaseCode() string {
+	if x != nil {
+		return x.BaseCode
+	}
+	return ""
+}
+
+func (x *RateResponse) GetDestinationCode() string {
+	if x != nil {
+		return x.DestinationCode
+	}
+	return ""
+}
+
+func (x *RateResponse) GetMetadata() *RateMetadata {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+// RateMetadata describes the provenance of an exchange rate
+type RateMetadata struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	// Types that are assignable to Message:
-	//	*StreamingRateResponse_RateResponse
-	//	*StreamingRateResponse_Error
-	Message isStreamingRateResponse_Message `protobuf_oneof:"message"`
+	// EffectiveDate is the date the provider published the rate for
+	EffectiveDate *timestamp.Timestamp `protobuf:"bytes,1,opt,name=EffectiveDate,proto3" json:"EffectiveDate,omitempty"`
+	// FetchedAt is the time the rates were fetched from the provider
+	FetchedAt *timestamp.Timestamp `protobuf:"bytes,2,opt,name=FetchedAt,proto3" json:"FetchedAt,omitempty"`
+	// Source is the name of the provider the rate was taken from, it is
+	// override when either currency has been overridden by an operator
+	Source string `protobuf:"bytes,3,opt,name=Source,proto3" json:"Source,omitempty"`
+	// SnapshotVersion is incremented every time the rate table changes
+	SnapshotVersion uint64 `protobuf:"varint,4,opt,name=SnapshotVersion,proto3" json:"SnapshotVersion,omitempty"`
+	// Stale is true when the rates have not been refreshed from the provider
+	// within the allowed age
+	Stale bool `protobuf:"varint,5,opt,name=Stale,proto3" json:"Stale,omitempty"`
+	// Custom is true when either currency is a custom currency defined in the
+	// configuration, such as loyalty points, rather than an ISO 4217 currency
+	Custom bool `protobuf:"varint,6,opt,name=Custom,proto3" json:"Custom,omitempty"`
 }
 
-func (x *StreamingRateResponse) Reset() {
-	*x = StreamingRateResponse{}
+func (x *RateMetadata) Reset() {
+	*x = RateMetadata{}
 	if protoimpl.UnsafeEnabled {
 		mi := &file_currency_proto_msgTypes[2]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -312,13 +423,13 @@ func (x *StreamingRateResponse) Reset() {
 	}
 }
 
-func (x *StreamingRateResponse) String() string {
+func (x *RateMetadata) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*StreamingRateResponse) ProtoMessage() {}
+func (*RateMetadata) ProtoMessage() {}
 
-func (x *StreamingRateResponse) ProtoReflect() protoreflect.Message {
+func (x *RateMetadata) ProtoReflect() protoreflect.Message {
 	mi := &file_currency_proto_msgTypes[2]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -330,290 +441,2279 @@ func (x *StreamingRateResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use StreamingRateResponse.ProtoReflect.Descriptor instead.
-func (*StreamingRateResponse) Descriptor() ([]byte, []int) {
+// Deprecated: Use RateMetadata.ProtoReflect.Descriptor instead.
+func (*RateMetadata) Descriptor() ([]byte, []int) {
 	return file_currency_proto_rawDescGZIP(), []int{2}
 }
 
-func (m *StreamingRateResponse) GetMessage() isStreamingRateResponse_Message {
-	if m != nil {
-		return m.Message
+func (x *RateMetadata) GetEffectiveDate() *timestamp.Timestamp {
+	if x != nil {
+		return x.EffectiveDate
 	}
 	return nil
 }
 
-func (x *StreamingRateResponse) GetRateResponse() *RateResponse {
-	if x, ok := x.GetMessage().(*StreamingRateResponse_RateResponse); ok {
-		return x.RateResponse
+func (x *RateMetadata) GetFetchedAt() *timestamp.Timestamp {
+	if x != nil {
+		return x.FetchedAt
 	}
 	return nil
 }
 
-func (x *StreamingRateResponse) GetError() *status.Status {
-	if x, ok := x.GetMessage().(*StreamingRateResponse_Error); ok {
-		return x.Error
+func (x *RateMetadata) GetSource() string {
+	if x != nil {
+		return x.Source
 	}
-	return nil
+	return ""
 }
 
-type isStreamingRateResponse_Message interface {
-	isStreamingRateResponse_Message()
+func (x *RateMetadata) GetSnapshotVersion() uint64 {
+	if x != nil {
+		return x.SnapshotVersion
+	}
+	return 0
 }
 
-type StreamingRateResponse_RateResponse struct {
-	RateResponse *RateResponse `protobuf:"bytes,1,opt,name=rate_response,json=rateResponse,proto3,oneof"`
+func (x *RateMetadata) GetStale() bool {
+	if x != nil {
+		return x.Stale
+	}
+	return false
 }
 
-type StreamingRateResponse_Error struct {
-	Error *status.Status `protobuf:"bytes,2,opt,name=error,proto3,oneof"`
+func (x *RateMetadata) GetCustom() bool {
+	if x != nil {
+		return x.Custom
+	}
+	return false
 }
 
-func (*StreamingRateResponse_RateResponse) isStreamingRateResponse_Message() {}
-
-func (*StreamingRateResponse_Error) isStreamingRateResponse_Message() {}
-
-var File_currency_proto protoreflect.FileDescriptor
+// RateHistoryRequest defines the request for a GetRateHistory call
+type RateHistoryRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
 
-var file_currency_proto_rawDesc = []byte{
-	0x0a, 0x0e, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x63, 0x79, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
-	0x1a, 0x17, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x72, 0x70, 0x63, 0x2f, 0x73, 0x74, 0x61,
-	0x74, 0x75, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x5d, 0x0a, 0x0b, 0x52, 0x61, 0x74,
-	0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1f, 0x0a, 0x04, 0x42, 0x61, 0x73, 0x65,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x0b, 0x2e, 0x43, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x63,
-	0x69, 0x65, 0x73, 0x52, 0x04, 0x42, 0x61, 0x73, 0x65, 0x12, 0x2d, 0x0a, 0x0b, 0x44, 0x65, 0x73,
-	0x74, 0x69, 0x6e, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x0b,
-	0x2e, 0x43, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x63, 0x69, 0x65, 0x73, 0x52, 0x0b, 0x44, 0x65, 0x73,
-	0x74, 0x69, 0x6e, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0x72, 0x0a, 0x0c, 0x52, 0x61, 0x74, 0x65,
-	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1f, 0x0a, 0x04, 0x42, 0x61, 0x73, 0x65,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x0b, 0x2e, 0x43, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x63,
-	0x69, 0x65, 0x73, 0x52, 0x04, 0x42, 0x61, 0x73, 0x65, 0x12, 0x2d, 0x0a, 0x0b, 0x44, 0x65, 0x73,
-	0x74, 0x69, 0x6e, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x0b,
-	0x2e, 0x43, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x63, 0x69, 0x65, 0x73, 0x52, 0x0b, 0x44, 0x65, 0x73,
-	0x74, 0x69, 0x6e, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x12, 0x0a, 0x04, 0x52, 0x61, 0x74, 0x65,
-	0x18, 0x03, 0x20, 0x01, 0x28, 0x01, 0x52, 0x04, 0x52, 0x61, 0x74, 0x65, 0x22, 0x84, 0x01, 0x0a,
-	0x15, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x69, 0x6e, 0x67, 0x52, 0x61, 0x74, 0x65, 0x52, 0x65,
-	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x34, 0x0a, 0x0d, 0x72, 0x61, 0x74, 0x65, 0x5f, 0x72,
-	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0d, 0x2e,
-	0x52, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00, 0x52, 0x0c,
-	0x72, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x2a, 0x0a, 0x05,
-	0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x67, 0x6f,
-	0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x48,
-	0x00, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x42, 0x09, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73,
-	0x61, 0x67, 0x65, 0x2a, 0xb5, 0x02, 0x0a, 0x0a, 0x43, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x63, 0x69,
-	0x65, 0x73, 0x12, 0x07, 0x0a, 0x03, 0x45, 0x55, 0x52, 0x10, 0x00, 0x12, 0x07, 0x0a, 0x03, 0x55,
-	0x53, 0x44, 0x10, 0x01, 0x12, 0x07, 0x0a, 0x03, 0x4a, 0x50, 0x59, 0x10, 0x02, 0x12, 0x07, 0x0a,
-	0x03, 0x42, 0x47, 0x4e, 0x10, 0x03, 0x12, 0x07, 0x0a, 0x03, 0x43, 0x5a, 0x4b, 0x10, 0x04, 0x12,
-	0x07, 0x0a, 0x03, 0x44, 0x4b, 0x4b, 0x10, 0x05, 0x12, 0x07, 0x0a, 0x03, 0x47, 0x42, 0x50, 0x10,
-	0x06, 0x12, 0x07, 0x0a, 0x03, 0x48, 0x55, 0x46, 0x10, 0x07, 0x12, 0x07, 0x0a, 0x03, 0x50, 0x4c,
-	0x4e, 0x10, 0x08, 0x12, 0x07, 0x0a, 0x03, 0x52, 0x4f, 0x4e, 0x10, 0x09, 0x12, 0x07, 0x0a, 0x03,
-	0x53, 0x45, 0x4b, 0x10, 0x0a, 0x12, 0x07, 0x0a, 0x03, 0x43, 0x48, 0x46, 0x10, 0x0b, 0x12, 0x07,
-	0x0a, 0x03, 0x49, 0x53, 0x4b, 0x10, 0x0c, 0x12, 0x07, 0x0a, 0x03, 0x4e, 0x4f, 0x4b, 0x10, 0x0d,
-	0x12, 0x07, 0x0a, 0x03, 0x48, 0x52, 0x4b, 0x10, 0x0e, 0x12, 0x07, 0x0a, 0x03, 0x52, 0x55, 0x42,
-	0x10, 0x0f, 0x12, 0x07, 0x0a, 0x03, 0x54, 0x52, 0x59, 0x10, 0x10, 0x12, 0x07, 0x0a, 0x03, 0x41,
-	0x55, 0x44, 0x10, 0x11, 0x12, 0x07, 0x0a, 0x03, 0x42, 0x52, 0x4c, 0x10, 0x12, 0x12, 0x07, 0x0a,
-	0x03, 0x43, 0x41, 0x44, 0x10, 0x13, 0x12, 0x07, 0x0a, 0x03, 0x43, 0x4e, 0x59, 0x10, 0x14, 0x12,
-	0x07, 0x0a, 0x03, 0x48, 0x4b, 0x44, 0x10, 0x15, 0x12, 0x07, 0x0a, 0x03, 0x49, 0x44, 0x52, 0x10,
-	0x16, 0x12, 0x07, 0x0a, 0x03, 0x49, 0x4c, 0x53, 0x10, 0x17, 0x12, 0x07, 0x0a, 0x03, 0x49, 0x4e,
-	0x52, 0x10, 0x18, 0x12, 0x07, 0x0a, 0x03, 0x4b, 0x52, 0x57, 0x10, 0x19, 0x12, 0x07, 0x0a, 0x03,
-	0x4d, 0x58, 0x4e, 0x10, 0x1a, 0x12, 0x07, 0x0a, 0x03, 0x4d, 0x59, 0x52, 0x10, 0x1b, 0x12, 0x07,
-	0x0a, 0x03, 0x4e, 0x5a, 0x44, 0x10, 0x1c, 0x12, 0x07, 0x0a, 0x03, 0x50, 0x48, 0x50, 0x10, 0x1d,
-	0x12, 0x07, 0x0a, 0x03, 0x53, 0x47, 0x44, 0x10, 0x1e, 0x12, 0x07, 0x0a, 0x03, 0x54, 0x48, 0x42,
-	0x10, 0x1f, 0x12, 0x07, 0x0a, 0x03, 0x5a, 0x41, 0x52, 0x10, 0x20, 0x32, 0x6e, 0x0a, 0x08, 0x43,
-	0x75, 0x72, 0x72, 0x65, 0x6e, 0x63, 0x79, 0x12, 0x26, 0x0a, 0x07, 0x47, 0x65, 0x74, 0x52, 0x61,
-	0x74, 0x65, 0x12, 0x0c, 0x2e, 0x52, 0x61, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
-	0x1a, 0x0d, 0x2e, 0x52, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12,
-	0x3a, 0x0a, 0x0e, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x52, 0x61, 0x74, 0x65,
-	0x73, 0x12, 0x0c, 0x2e, 0x52, 0x61, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
-	0x16, 0x2e, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x69, 0x6e, 0x67, 0x52, 0x61, 0x74, 0x65, 0x52,
-	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x28, 0x01, 0x30, 0x01, 0x62, 0x06, 0x70, 0x72, 0x6f,
-	0x74, 0x6f, 0x33,
+	// Base is the base currency code
+	Base string `protobuf:"bytes,1,opt,name=Base,proto3" json:"Base,omitempty"`
+	// Destination is the destination currency code
+	Destination string `protobuf:"bytes,2,opt,name=Destination,proto3" json:"Destination,omitempty"`
+	// From is the start of the period, inclusive
+	From *timestamp.Timestamp `protobuf:"bytes,3,opt,name=From,proto3" json:"From,omitempty"`
+	// To is the end of the period, exclusive, defaults to now
+	To *timestamp.Timestamp `protobuf:"bytes,4,opt,name=To,proto3" json:"To,omitempty"`
+	// Resolution is the period covered by each candle, defaults to one hour
+	Resolution *duration.Duration `protobuf:"bytes,5,opt,name=Resolution,proto3" json:"Resolution,omitempty"`
 }
 
-var (
-	file_currency_proto_rawDescOnce sync.Once
-	file_currency_proto_rawDescData = file_currency_proto_rawDesc
-)
-
-func file_currency_proto_rawDescGZIP() []byte {
-	file_currency_proto_rawDescOnce.Do(func() {
-		file_currency_proto_rawDescData = protoimpl.X.CompressGZIP(file_currency_proto_rawDescData)
-	})
-	return file_currency_proto_rawDescData
+func (x *RateHistoryRequest) Reset() {
+	*x = RateHistoryRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_currency_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
 }
 
-var file_currency_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_currency_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
-var file_currency_proto_goTypes = []interface{}{
-	(Currencies)(0),               // 0: Currencies
-	(*RateRequest)(nil),           // 1: RateRequest
-	(*RateResponse)(nil),          // 2: RateResponse
-	(*StreamingRateResponse)(nil), // 3: StreamingRateResponse
-	(*status.Status)(nil),         // 4: google.rpc.Status
-}
-var file_currency_proto_depIdxs = []int32{
-	0, // 0: RateRequest.Base:type_name -> Currencies
-	0, // 1: RateRequest.Destination:type_name -> Currencies
-	0, // 2: RateResponse.Base:type_name -> Currencies
-	0, // 3: RateResponse.Destination:type_name -> Currencies
-	2, // 4: StreamingRateResponse.rate_response:type_name -> RateResponse
-	4, // 5: StreamingRateResponse.error:type_name -> google.rpc.Status
-	1, // 6: Currency.GetRate:input_type -> RateRequest
-	1, // 7: Currency.SubscribeRates:input_type -> RateRequest
-	2, // 8: Currency.GetRate:output_type -> RateResponse
-	3, // 9: Currency.SubscribeRates:output_type -> StreamingRateResponse
-	8, // [8:10] is the sub-list for method output_type
-	6, // [6:8] is the sub-list for method input_type
-	6, // [6:6] is the sub-list for extension type_name
-	6, // [6:6] is the sub-list for extension extendee
-	0, // [0:6] is the sub-list for field type_name
+func (x *RateHistoryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
 }
 
-func init() { file_currency_proto_init() }
-func file_currency_proto_init() {
-	if File_currency_proto != nil {
-		return
-	}
-	if !protoimpl.UnsafeEnabled {
-		file_currency_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*RateRequest); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-		file_currency_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*RateResponse); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-		file_currency_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*StreamingRateResponse); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
+func (*RateHistoryRequest) ProtoMessage() {}
+
+func (x *RateHistoryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_currency_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
 		}
+		return ms
 	}
-	file_currency_proto_msgTypes[2].OneofWrappers = []interface{}{
-		(*StreamingRateResponse_RateResponse)(nil),
-		(*StreamingRateResponse_Error)(nil),
-	}
-	type x struct{}
-	out := protoimpl.TypeBuilder{
-		File: protoimpl.DescBuilder{
-			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
-			RawDescriptor: file_currency_proto_rawDesc,
-			NumEnums:      1,
-			NumMessages:   3,
-			NumExtensions: 0,
-			NumServices:   1,
-		},
-		GoTypes:           file_currency_proto_goTypes,
-		DependencyIndexes: file_currency_proto_depIdxs,
-		EnumInfos:         file_currency_proto_enumTypes,
-		MessageInfos:      file_currency_proto_msgTypes,
-	}.Build()
-	File_currency_proto = out.File
-	file_currency_proto_rawDesc = nil
-	file_currency_proto_goTypes = nil
-	file_currency_proto_depIdxs = nil
+	return mi.MessageOf(x)
 }
 
-// Reference imports to suppress errors if they are not otherwise used.
-var _ context.Context
-var _ grpc.ClientConnInterface
-
-// This is a compile-time assertion to ensure that this generated file
-// is compatible with the grpc package it is being compiled against.
-const _ = grpc.SupportPackageIsVersion6
-
-// CurrencyClient is the client API for Currency service.
-//
-// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
-type CurrencyClient interface {
-	// GetRate returns the exchange rate for the two provided currency codes
-	GetRate(ctx context.Context, in *RateRequest, opts ...grpc.CallOption) (*RateResponse, error)
-	// SubscribeRates allow a client to subscribe for changes in an exchange rate
-	// when the rate changes a response will be sent
-	SubscribeRates(ctx context.Context, opts ...grpc.CallOption) (Currency_SubscribeRatesClient, error)
+// Deprecated: Use RateHistoryRequest.ProtoReflect.Descriptor instead.
+func (*RateHistoryRequest) Descriptor() ([]byte, []int) {
+	return file_currency_proto_rawDescGZIP(), []int{3}
 }
 
-type currencyClient struct {
-	cc grpc.ClientConnInterface
+func (x *RateHistoryRequest) GetBase() string {
+	if x != nil {
+		return x.Base
+	}
+	return ""
 }
 
-func NewCurrencyClient(cc grpc.ClientConnInterface) CurrencyClient {
-	return &currencyClient{cc}
+func (x *RateHistoryRequest) GetDestination() string {
+	if x != nil {
+		return x.Destination
+	}
+	return ""
 }
 
-func (c *currencyClient) GetRate(ctx context.Context, in *RateRequest, opts ...grpc.CallOption) (*RateResponse, error) {
-	out := new(RateResponse)
-	err := c.cc.Invoke(ctx, "/Currency/GetRate", in, out, opts...)
-	if err != nil {
-		return nil, err
+func (x *RateHistoryRequest) GetFrom() *timestamp.Timestamp {
+	if x != nil {
+		return x.From
 	}
-	return out, nil
+	return nil
 }
 
-func (c *currencyClient) SubscribeRates(ctx context.Context, opts ...grpc.CallOption) (Currency_SubscribeRatesClient, error) {
-	stream, err := c.cc.NewStream(ctx, &_Currency_serviceDesc.Streams[0], "/Currency/SubscribeRates", opts...)
-	if err != nil {
-		return nil, err
+func (x *RateHistoryRequest) GetTo() *timestamp.Timestamp {
+	if x != nil {
+		return x.To
 	}
-	x := &currencySubscribeRatesClient{stream}
-	return x, nil
+	return nil
 }
 
-type Currency_SubscribeRatesClient interface {
-	Send(*RateRequest) error
-	Recv() (*StreamingRateResponse, error)
-	grpc.ClientStream
+func (x *RateHistoryRequest) GetResolution() *duration.Duration {
+	if x != nil {
+		return x.Resolution
+	}
+	return nil
 }
 
-type currencySubscribeRatesClient struct {
-	grpc.ClientStream
-}
+// Candle contains the open, high, low and close rate over a period
+type Candle struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
 
-func (x *currencySubscribeRatesClient) Send(m *RateRequest) error {
-	return x.ClientStream.SendMsg(m)
+	// Start is the start of the period covered by the candle
+	Start *timestamp.Timestamp `protobuf:"bytes,1,opt,name=Start,proto3" json:"Start,omitempty"`
+	Open  float64              `protobuf:"fixed64,2,opt,name=Open,proto3" json:"Open,omitempty"`
+	High  float64              `protobuf:"fixed64,3,opt,name=High,proto3" json:"High,omitempty"`
+	Low   float64              `protobuf:"fixed64,4,opt,name=Low,proto3" json:"Low,omitempty"`
+	Close float64              `protobuf:"fixed64,5,opt,name=Close,proto3" json:"Close,omitempty"`
+	// Samples is the number of rate snapshots the candle was built from
+	Samples uint32 `protobuf:"varint,6,opt,name=Samples,proto3" json:"Samples,omitempty"`
 }
 
-func (x *currencySubscribeRatesClient) Recv() (*StreamingRateResponse, error) {
-	m := new(StreamingRateResponse)
-	if err := x.ClientStream.RecvMsg(m); err != nil {
-		return nil, err
+func (x *Candle) Reset() {
+	*x = Candle{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_currency_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
 	}
-	return m, nil
 }
 
-// CurrencyServer is the server API for Currency service.
-type CurrencyServer interface {
-	// GetRate returns the exchange rate for the two provided currency codes
-	GetRate(context.Context, *RateRequest) (*RateResponse, error)
-	// SubscribeRates allow a client to subscribe for changes in an exchange rate
-	// when the rate changes a response will be sent
-	SubscribeRates(Currency_SubscribeRatesServer) error
+func (x *Candle) String() string {
+	return protoimpl.X.MessageStringOf(x)
 }
 
-// UnimplementedCurrencyServer can be embedded to have forward compatible implementations.
-type UnimplementedCurrencyServer struct {
+func (*Candle) ProtoMessage() {}
+
+func (x *Candle) ProtoReflect() protoreflect.Message {
+	mi := &file_currency_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Candle.ProtoReflect.Descriptor instead.
+func (*Candle) Descriptor() ([]byte, []int) {
+	return file_currency_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Candle) GetStart() *timestamp.Timestamp {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *Candle) GetOpen() float64 {
+	if x != nil {
+		return x.Open
+	}
+	return 0
+}
+
+func (x *Candle) GetHigh() float64 {
+	if x != nil {
+		return x.High
+	}
+	return 0
+}
+
+func (x *Candle) GetLow() float64 {
+	if x != nil {
+		return x.Low
+	}
+	return 0
+}
+
+func (x *Candle) GetClose() float64 {
+	if x != nil {
+		return x.Close
+	}
+	return 0
+}
+
+func (x *Candle) GetSamples() uint32 {
+	if x != nil {
+		return x.Samples
+	}
+	return 0
+}
+
+// RateHistoryResponse is the response from a GetRateHistory call, periods without
+// any recorded snapshots are omitted
+type RateHistoryResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Base        string             `protobuf:"bytes,1,opt,name=Base,proto3" json:"Base,omitempty"`
+	Destination string             `protobuf:"bytes,2,opt,name=Destination,proto3" json:"Destination,omitempty"`
+	Resolution  *duration.Duration `protobuf:"bytes,3,opt,name=Resolution,proto3" json:"Resolution,omitempty"`
+	Candles     []*Candle          `protobuf:"bytes,4,rep,name=Candles,proto3" json:"Candles,omitempty"`
+}
+
+func (x *RateHistoryResponse) Reset() {
+	*x = RateHistoryResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_currency_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RateHistoryResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RateHistoryResponse) ProtoMessage() {}
+
+func (x *RateHistoryResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_currency_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RateHistoryResponse.ProtoReflect.Descriptor instead.
+func (*RateHistoryResponse) Descriptor() ([]byte, []int) {
+	return file_currency_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *RateHistoryResponse) GetBase() string {
+	if x != nil {
+		return x.Base
+	}
+	return ""
+}
+
+func (x *RateHistoryResponse) GetDestination() string {
+	if x != nil {
+		return x.Destination
+	}
+	return ""
+}
+
+func (x *RateHistoryResponse) GetResolution() *duration.Duration {
+	if x != nil {
+		return x.Resolution
+	}
+	return nil
+}
+
+func (x *RateHistoryResponse) GetCandles() []*Candle {
+	if x != nil {
+		return x.Candles
+	}
+	return nil
+}
+
+type StreamingRateResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Types that are assignable to Message:
+	//	*StreamingRateResponse_RateResponse
+	//	*StreamingRateResponse_Error
+	Message isStreamingRateResponse_Message `protobuf_oneof:"message"`
+}
+
+func (x *StreamingRateResponse) Reset() {
+	*x = StreamingRateResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_currency_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StreamingRateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamingRateResponse) ProtoMessage() {}
+
+func (x *StreamingRateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_currency_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamingRateResponse.ProtoReflect.Descriptor instead.
+func (*StreamingRateResponse) Descriptor() ([]byte, []int) {
+	return file_currency_proto_rawDescGZIP(), []int{6}
+}
+
+func (m *StreamingRateResponse) GetMessage() isStreamingRateResponse_Message {
+	if m != nil {
+		return m.Message
+	}
+	return nil
+}
+
+func (x *StreamingRateResponse) GetRateResponse() *RateResponse {
+	if x, ok := x.GetMessage().(*StreamingRateResponse_RateResponse); ok {
+		return x.RateResponse
+	}
+	return nil
+}
+
+func (x *StreamingRateResponse) GetError() *status.Status {
+	if x, ok := x.GetMessage().(*StreamingRateResponse_Error); ok {
+		return x.Error
+	}
+	return nil
+}
+
+type isStreamingRateResponse_Message interface {
+	isStreamingRateResponse_Message()
+}
+
+type StreamingRateResponse_RateResponse struct {
+	RateResponse *RateResponse `protobuf:"bytes,1,opt,name=rate_response,json=rateResponse,proto3,oneof"`
+}
+
+type StreamingRateResponse_Error struct {
+	Error *status.Status `protobuf:"bytes,2,opt,name=error,proto3,oneof"`
+}
+
+func (*StreamingRateResponse_RateResponse) isStreamingRateResponse_Message() {}
+
+func (*StreamingRateResponse_Error) isStreamingRateResponse_Message() {}
+
+// ThresholdCondition triggers when the rate crosses an absolute value
+type ThresholdCondition struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Direction ThresholdCondition_Directions `protobuf:"varint,1,opt,name=Direction,proto3,enum=ThresholdCondition_Directions" json:"Direction,omitempty"`
+	// Value is the rate the threshold is set at
+	Value float64 `protobuf:"fixed64,2,opt,name=Value,proto3" json:"Value,omitempty"`
+}
+
+func (x *ThresholdCondition) Reset() {
+	*x = ThresholdCondition{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_currency_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ThresholdCondition) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ThresholdCondition) ProtoMessage() {}
+
+func (x *ThresholdCondition) ProtoReflect() protoreflect.Message {
+	mi := &file_currency_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ThresholdCondition.ProtoReflect.Descriptor instead.
+func (*ThresholdCondition) Descriptor() ([]byte, []int) {
+	return file_currency_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ThresholdCondition) GetDirection() ThresholdCondition_Directions {
+	if x != nil {
+		return x.Direction
+	}
+	return ThresholdCondition_ABOVE
+}
+
+func (x *ThresholdCondition) GetValue() float64 {
+	if x != nil {
+		return x.Value
+	}
+	return 0
+}
+
+// PercentMoveCondition triggers when the rate moves by more than the given
+// percentage within the window
+type PercentMoveCondition struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Percent is the absolute percentage move which triggers the alert
+	Percent float64 `protobuf:"fixed64,1,opt,name=Percent,proto3" json:"Percent,omitempty"`
+	// Window is the period the move is measured over, defaults to 24 hours
+	Window *duration.Duration `protobuf:"bytes,2,opt,name=Window,proto3" json:"Window,omitempty"`
+}
+
+func (x *PercentMoveCondition) Reset() {
+	*x = PercentMoveCondition{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_currency_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PercentMoveCondition) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PercentMoveCondition) ProtoMessage() {}
+
+func (x *PercentMoveCondition) ProtoReflect() protoreflect.Message {
+	mi := &file_currency_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PercentMoveCondition.ProtoReflect.Descriptor instead.
+func (*PercentMoveCondition) Descriptor() ([]byte, []int) {
+	return file_currency_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *PercentMoveCondition) GetPercent() float64 {
+	if x != nil {
+		return x.Percent
+	}
+	return 0
+}
+
+func (x *PercentMoveCondition) GetWindow() *duration.Duration {
+	if x != nil {
+		return x.Window
+	}
+	return nil
+}
+
+// Alert is a condition registered on a currency pair
+type Alert struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// ID uniquely identifies the alert
+	ID string `protobuf:"bytes,1,opt,name=ID,proto3" json:"ID,omitempty"`
+	// Base is the base currency code of the pair
+	Base string `protobuf:"bytes,2,opt,name=Base,proto3" json:"Base,omitempty"`
+	// Destination is the destination currency code of the pair
+	Destination string `protobuf:"bytes,3,opt,name=Destination,proto3" json:"Destination,omitempty"`
+	// Types that are assignable to Condition:
+	//	*Alert_Threshold
+	//	*Alert_PercentMove
+	Condition isAlert_Condition `protobuf_oneof:"Condition"`
+	// Hysteresis is the distance the rate must move back from the trigger level before
+	// the alert can trigger again, it is expressed in rate units for threshold conditions
+	// and in percentage points for percent move conditions. When not set a default of
+	// 0.5% of the threshold or 10% of the percentage is used. It must be less than the
+	// threshold or the percentage.
+	Hysteresis float64 `protobuf:"fixed64,6,opt,name=Hysteresis,proto3" json:"Hysteresis,omitempty"`
+	// CreatedAt is the time the alert was registered
+	CreatedAt *timestamp.Timestamp `protobuf:"bytes,7,opt,name=CreatedAt,proto3" json:"CreatedAt,omitempty"`
+	// Triggered is true while the condition holds and the alert has not re-armed
+	Triggered bool `protobuf:"varint,8,opt,name=Triggered,proto3" json:"Triggered,omitempty"`
+}
+
+func (x *Alert) Reset() {
+	*x = Alert{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_currency_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Alert) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Alert) ProtoMessage() {}
+
+func (x *Alert) ProtoReflect() protoreflect.Message {
+	mi := &file_currency_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Alert.ProtoReflect.Descriptor instead.
+func (*Alert) Descriptor() ([]byte, []int) {
+	return file_currency_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Alert) GetID() string {
+	if x != nil {
+		return x.ID
+	}
+	return ""
+}
+
+func (x *Alert) GetBase() string {
+	if x != nil {
+		return x.Base
+	}
+	return ""
+}
+
+func (x *Alert) GetDestination() string {
+	if x != nil {
+		return x.Destination
+	}
+	return ""
+}
+
+func (m *Alert) GetCondition() isAlert_Condition {
+	if m != nil {
+		return m.Condition
+	}
+	return nil
+}
+
+func (x *Alert) GetThreshold() *ThresholdCondition {
+	if x, ok := x.GetCondition().(*Alert_Threshold); ok {
+		return x.Threshold
+	}
+	return nil
+}
+
+func (x *Alert) GetPercentMove() *PercentMoveCondition {
+	if x, ok := x.GetCondition().(*Alert_PercentMove); ok {
+		return x.PercentMove
+	}
+	return nil
+}
+
+func (x *Alert) GetHysteresis() float64 {
+	if x != nil {
+		return x.Hysteresis
+	}
+	return 0
+}
+
+func (x *Alert) GetCreatedAt() *timestamp.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Alert) GetTriggered() bool {
+	if x != nil {
+		return x.Triggered
+	}
+	return false
+}
+
+type isAlert_Condition interface {
+	isAlert_Condition()
+}
+
+type Alert_Threshold struct {
+	Threshold *ThresholdCondition `protobuf:"bytes,4,opt,name=Threshold,proto3,oneof"`
+}
+
+type Alert_PercentMove struct {
+	PercentMove *PercentMoveCondition `protobuf:"bytes,5,opt,name=PercentMove,proto3,oneof"`
+}
+
+func (*Alert_Threshold) isAlert_Condition() {}
+
+func (*Alert_PercentMove) isAlert_Condition() {}
+
+// CreateAlertRequest defines the request for a CreateAlert call, the ID, CreatedAt
+// and Triggered fields of the alert are ignored
+type CreateAlertRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Alert *Alert `protobuf:"bytes,1,opt,name=Alert,proto3" json:"Alert,omitempty"`
+}
+
+func (x *CreateAlertRequest) Reset() {
+	*x = CreateAlertRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_currency_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CreateAlertRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateAlertRequest) ProtoMessage() {}
+
+func (x *CreateAlertRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_currency_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateAlertRequest.ProtoReflect.Descriptor instead.
+func (*CreateAlertRequest) Descriptor() ([]byte, []int) {
+	return file_currency_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *CreateAlertRequest) GetAlert() *Alert {
+	if x != nil {
+		return x.Alert
+	}
+	return nil
+}
+
+// DeleteAlertRequest defines the request for a DeleteAlert call
+type DeleteAlertRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ID string `protobuf:"bytes,1,opt,name=ID,proto3" json:"ID,omitempty"`
+}
+
+func (x *DeleteAlertRequest) Reset() {
+	*x = DeleteAlertRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_currency_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DeleteAlertRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteAlertRequest) ProtoMessage() {}
+
+func (x *DeleteAlertRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_currency_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteAlertRequest.ProtoReflect.Descriptor instead.
+func (*DeleteAlertRequest) Descriptor() ([]byte, []int) {
+	return file_currency_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *DeleteAlertRequest) GetID() string {
+	if x != nil {
+		return x.ID
+	}
+	return ""
+}
+
+type DeleteAlertResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *DeleteAlertResponse) Reset() {
+	*x = DeleteAlertResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_currency_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DeleteAlertResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteAlertResponse) ProtoMessage() {}
+
+func (x *DeleteAlertResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_currency_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteAlertResponse.ProtoReflect.Descriptor instead.
+func (*DeleteAlertResponse) Descriptor() ([]byte, []int) {
+	return file_currency_proto_rawDescGZIP(), []int{12}
+}
+
+type ListAlertsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *ListAlertsRequest) Reset() {
+	*x = ListAlertsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_currency_proto_msgTypes[13]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListAlertsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListAlertsRequest) ProtoMessage() {}
+
+func (x *ListAlertsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_currency_proto_msgTypes[13]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListAlertsRequest.ProtoReflect.Descriptor instead.
+func (*ListAlertsRequest) Descriptor() ([]byte, []int) {
+	return file_currency_proto_rawDescGZIP(), []int{13}
+}
+
+type ListAlertsResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Alerts []*Alert `protobuf:"bytes,1,rep,name=Alerts,proto3" json:"Alerts,omitempty"`
+}
+
+func (x *ListAlertsResponse) Reset() {
+	*x = ListAlertsResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_currency_proto_msgTypes[14]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListAlertsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListAlertsResponse) ProtoMessage() {}
+
+func (x *ListAlertsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_currency_proto_msgTypes[14]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListAlertsResponse.ProtoReflect.Descriptor instead.
+func (*ListAlertsResponse) Descriptor() ([]byte, []int) {
+	return file_currency_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *ListAlertsResponse) GetAlerts() []*Alert {
+	if x != nil {
+		return x.Alerts
+	}
+	return nil
+}
+
+// WatchAlertsRequest defines the request for a WatchAlerts call
+type WatchAlertsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// IDs limits the stream to the given alerts, when empty events for all
+	// alerts are sent
+	IDs []string `protobuf:"bytes,1,rep,name=IDs,proto3" json:"IDs,omitempty"`
+}
+
+func (x *WatchAlertsRequest) Reset() {
+	*x = WatchAlertsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_currency_proto_msgTypes[15]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *WatchAlertsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchAlertsRequest) ProtoMessage() {}
+
+func (x *WatchAlertsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_currency_proto_msgTypes[15]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchAlertsRequest.ProtoReflect.Descriptor instead.
+func (*WatchAlertsRequest) Descriptor() ([]byte, []int) {
+	return file_currency_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *WatchAlertsRequest) GetIDs() []string {
+	if x != nil {
+		return x.IDs
+	}
+	return nil
+}
+
+// AlertEvent is sent when an alert triggers
+type AlertEvent struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Alert is the alert which triggered
+	Alert *Alert `protobuf:"bytes,1,opt,name=Alert,proto3" json:"Alert,omitempty"`
+	// Rate is the rate which caused the alert to trigger
+	Rate float64 `protobuf:"fixed64,2,opt,name=Rate,proto3" json:"Rate,omitempty"`
+	// ChangePercent is the percentage move for percent move conditions
+	ChangePercent float64 `protobuf:"fixed64,3,opt,name=ChangePercent,proto3" json:"ChangePercent,omitempty"`
+	// TriggeredAt is the time the alert triggered
+	TriggeredAt *timestamp.Timestamp `protobuf:"bytes,4,opt,name=TriggeredAt,proto3" json:"TriggeredAt,omitempty"`
+}
+
+func (x *AlertEvent) Reset() {
+	*x = AlertEvent{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_currency_proto_msgTypes[16]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *AlertEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AlertEvent) ProtoMessage() {}
+
+func (x *AlertEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_currency_proto_msgTypes[16]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AlertEvent.ProtoReflect.Descriptor instead.
+func (*AlertEvent) Descriptor() ([]byte, []int) {
+	return file_currency_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *AlertEvent) GetAlert() *Alert {
+	if x != nil {
+		return x.Alert
+	}
+	return nil
+}
+
+func (x *AlertEvent) GetRate() float64 {
+	if x != nil {
+		return x.Rate
+	}
+	return 0
+}
+
+func (x *AlertEvent) GetChangePercent() float64 {
+	if x != nil {
+		return x.ChangePercent
+	}
+	return 0
+}
+
+func (x *AlertEvent) GetTriggeredAt() *timestamp.Timestamp {
+	if x != nil {
+		return x.TriggeredAt
+	}
+	return nil
+}
+
+// Override replaces the provider rate of a currency
+type Override struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Currency is the code of the overridden currency
+	Currency string `protobuf:"bytes,1,opt,name=Currency,proto3" json:"Currency,omitempty"`
+	// Rate is the rate of the currency against EUR
+	Rate float64 `protobuf:"fixed64,2,opt,name=Rate,proto3" json:"Rate,omitempty"`
+	// ExpiresAt is the time the override expires, when not set the override
+	// stays active until it is cleared
+	ExpiresAt *timestamp.Timestamp `protobuf:"bytes,3,opt,name=ExpiresAt,proto3" json:"ExpiresAt,omitempty"`
+	// Actor is the person or system which set the override
+	Actor string `protobuf:"bytes,4,opt,name=Actor,proto3" json:"Actor,omitempty"`
+	// Reason explains why the override was set
+	Reason string `protobuf:"bytes,5,opt,name=Reason,proto3" json:"Reason,omitempty"`
+	// CreatedAt is the time the override was set
+	CreatedAt *timestamp.Timestamp `protobuf:"bytes,6,opt,name=CreatedAt,proto3" json:"CreatedAt,omitempty"`
+}
+
+func (x *Override) Reset() {
+	*x = Override{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_currency_proto_msgTypes[17]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Override) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Override) ProtoMessage() {}
+
+func (x *Override) ProtoReflect() protoreflect.Message {
+	mi := &file_currency_proto_msgTypes[17]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Override.ProtoReflect.Descriptor instead.
+func (*Override) Descriptor() ([]byte, []int) {
+	return file_currency_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *Override) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
+func (x *Override) GetRate() float64 {
+	if x != nil {
+		return x.Rate
+	}
+	return 0
+}
+
+func (x *Override) GetExpiresAt() *timestamp.Timestamp {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return nil
+}
+
+func (x *Override) GetActor() string {
+	if x != nil {
+		return x.Actor
+	}
+	return ""
+}
+
+func (x *Override) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *Override) GetCreatedAt() *timestamp.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+// SetOverrideRequest defines the request for a SetOverride call
+type SetOverrideRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Currency is the code of the currency to override
+	Currency string `protobuf:"bytes,1,opt,name=Currency,proto3" json:"Currency,omitempty"`
+	// Rate is the rate of the currency against EUR, when not set the current
+	// rate is pinned
+	Rate float64 `protobuf:"fixed64,2,opt,name=Rate,proto3" json:"Rate,omitempty"`
+	// ExpiresAt is the optional time the override expires
+	ExpiresAt *timestamp.Timestamp `protobuf:"bytes,3,opt,name=ExpiresAt,proto3" json:"ExpiresAt,omitempty"`
+	// Actor is the person or system setting the override, required
+	Actor string `protobuf:"bytes,4,opt,name=Actor,proto3" json:"Actor,omitempty"`
+	// Reason explains why the override is set, required
+	Reason string `protobuf:"bytes,5,opt,name=Reason,proto3" json:"Reason,omitempty"`
+}
+
+func (x *SetOverrideRequest) Reset() {
+	*x = SetOverrideRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_currency_proto_msgTypes[18]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SetOverrideRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetOverrideRequest) ProtoMessage() {}
+
+func (x *SetOverrideRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_currency_proto_msgTypes[18]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetOverrideRequest.ProtoReflect.Descriptor instead.
+func (*SetOverrideRequest) Descriptor() ([]byte, []int) {
+	return file_currency_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *SetOverrideRequest) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
+func (x *SetOverrideRequest) GetRate() float64 {
+	if x != nil {
+		return x.Rate
+	}
+	return 0
+}
+
+func (x *SetOverrideRequest) GetExpiresAt() *timestamp.Timestamp {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return nil
+}
+
+func (x *SetOverrideRequest) GetActor() string {
+	if x != nil {
+		return x.Actor
+	}
+	return ""
+}
+
+func (x *SetOverrideRequest) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+// ClearOverrideRequest defines the request for a ClearOverride call
+type ClearOverrideRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Currency string `protobuf:"bytes,1,opt,name=Currency,proto3" json:"Currency,omitempty"`
+	// Actor is the person or system clearing the override, required
+	Actor string `protobuf:"bytes,2,opt,name=Actor,proto3" json:"Actor,omitempty"`
+	// Reason explains why the override is cleared, required
+	Reason string `protobuf:"bytes,3,opt,name=Reason,proto3" json:"Reason,omitempty"`
+}
+
+func (x *ClearOverrideRequest) Reset() {
+	*x = ClearOverrideRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_currency_proto_msgTypes[19]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ClearOverrideRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClearOverrideRequest) ProtoMessage() {}
+
+func (x *ClearOverrideRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_currency_proto_msgTypes[19]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClearOverrideRequest.ProtoReflect.Descriptor instead.
+func (*ClearOverrideRequest) Descriptor() ([]byte, []int) {
+	return file_currency_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *ClearOverrideRequest) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
+func (x *ClearOverrideRequest) GetActor() string {
+	if x != nil {
+		return x.Actor
+	}
+	return ""
+}
+
+func (x *ClearOverrideRequest) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type ClearOverrideResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *ClearOverrideResponse) Reset() {
+	*x = ClearOverrideResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_currency_proto_msgTypes[20]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ClearOverrideResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClearOverrideResponse) ProtoMessage() {}
+
+func (x *ClearOverrideResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_currency_proto_msgTypes[20]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClearOverrideResponse.ProtoReflect.Descriptor instead.
+func (*ClearOverrideResponse) Descriptor() ([]byte, []int) {
+	return file_currency_proto_rawDescGZIP(), []int{20}
+}
+
+type ListOverridesRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *ListOverridesRequest) Reset() {
+	*x = ListOverridesRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_currency_proto_msgTypes[21]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListOverridesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListOverridesRequest) ProtoMessage() {}
+
+func (x *ListOverridesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_currency_proto_msgTypes[21]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListOverridesRequest.ProtoReflect.Descriptor instead.
+func (*ListOverridesRequest) Descriptor() ([]byte, []int) {
+	return file_currency_proto_rawDescGZIP(), []int{21}
+}
+
+type ListOverridesResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Overrides are the active overrides
+	Overrides []*Override `protobuf:"bytes,1,rep,name=Overrides,proto3" json:"Overrides,omitempty"`
+	// AuditLog contains every change made to the overrides, oldest first
+	AuditLog []*OverrideAuditEntry `protobuf:"bytes,2,rep,name=AuditLog,proto3" json:"AuditLog,omitempty"`
+}
+
+func (x *ListOverridesResponse) Reset() {
+	*x = ListOverridesResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_currency_proto_msgTypes[22]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListOverridesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListOverridesResponse) ProtoMessage() {}
+
+func (x *ListOverridesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_currency_proto_msgTypes[22]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListOverridesResponse.ProtoReflect.Descriptor instead.
+func (*ListOverridesResponse) Descriptor() ([]byte, []int) {
+	return file_currency_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *ListOverridesResponse) GetOverrides() []*Override {
+	if x != nil {
+		return x.Overrides
+	}
+	return nil
+}
+
+func (x *ListOverridesResponse) GetAuditLog() []*OverrideAuditEntry {
+	if x != nil {
+		return x.AuditLog
+	}
+	return nil
+}
+
+// OverrideAuditEntry records a change made to an override
+type OverrideAuditEntry struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Action is one of set, clear or expire
+	Action string `protobuf:"bytes,1,opt,name=Action,proto3" json:"Action,omitempty"`
+	// Override is the override the action applied to
+	Override *Override `protobuf:"bytes,2,opt,name=Override,proto3" json:"Override,omitempty"`
+	// Actor is the person or system which made the change
+	Actor string `protobuf:"bytes,3,opt,name=Actor,proto3" json:"Actor,omitempty"`
+	// Reason explains why the change was made
+	Reason string `protobuf:"bytes,4,opt,name=Reason,proto3" json:"Reason,omitempty"`
+	// At is the time the change was made
+	At *timestamp.Timestamp `protobuf:"bytes,5,opt,name=At,proto3" json:"At,omitempty"`
+}
+
+func (x *OverrideAuditEntry) Reset() {
+	*x = OverrideAuditEntry{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_currency_proto_msgTypes[23]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *OverrideAuditEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OverrideAuditEntry) ProtoMessage() {}
+
+func (x *OverrideAuditEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_currency_proto_msgTypes[23]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OverrideAuditEntry.ProtoReflect.Descriptor instead.
+func (*OverrideAuditEntry) Descriptor() ([]byte, []int) {
+	return file_currency_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *OverrideAuditEntry) GetAction() string {
+	if x != nil {
+		return x.Action
+	}
+	return ""
+}
+
+func (x *OverrideAuditEntry) GetOverride() *Override {
+	if x != nil {
+		return x.Override
+	}
+	return nil
+}
+
+func (x *OverrideAuditEntry) GetActor() string {
+	if x != nil {
+		return x.Actor
+	}
+	return ""
+}
+
+func (x *OverrideAuditEntry) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *OverrideAuditEntry) GetAt() *timestamp.Timestamp {
+	if x != nil {
+		return x.At
+	}
+	return nil
+}
+
+var File_currency_proto protoreflect.FileDescriptor
+
+var file_currency_proto_rawDesc = []byte{
+	0x0a, 0x0e, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x63, 0x79, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x1a, 0x17, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x72, 0x70, 0x63, 0x2f, 0x73, 0x74, 0x61,
+	0x74, 0x75, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x1f, 0x67, 0x6f, 0x6f, 0x67, 0x6c,
+	0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73,
+	0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x1e, 0x67, 0x6f, 0x6f, 0x67,
+	0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x64, 0x75, 0x72, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xa3, 0x01, 0x0a, 0x0b, 0x52,
+	0x61, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1f, 0x0a, 0x04, 0x42, 0x61,
+	0x73, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x0b, 0x2e, 0x43, 0x75, 0x72, 0x72, 0x65,
+	0x6e, 0x63, 0x69, 0x65, 0x73, 0x52, 0x04, 0x42, 0x61, 0x73, 0x65, 0x12, 0x2d, 0x0a, 0x0b, 0x44,
+	0x65, 0x73, 0x74, 0x69, 0x6e, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e,
+	0x32, 0x0b, 0x2e, 0x43, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x63, 0x69, 0x65, 0x73, 0x52, 0x0b, 0x44,
+	0x65, 0x73, 0x74, 0x69, 0x6e, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x1a, 0x0a, 0x08, 0x42, 0x61,
+	0x73, 0x65, 0x43, 0x6f, 0x64, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x42, 0x61,
+	0x73, 0x65, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x28, 0x0a, 0x0f, 0x44, 0x65, 0x73, 0x74, 0x69, 0x6e,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0f, 0x44, 0x65, 0x73, 0x74, 0x69, 0x6e, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65,
+	0x22, 0xe3, 0x01, 0x0a, 0x0c, 0x52, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x12, 0x1f, 0x0a, 0x04, 0x42, 0x61, 0x73, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32,
+	0x0b, 0x2e, 0x43, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x63, 0x69, 0x65, 0x73, 0x52, 0x04, 0x42, 0x61,
+	0x73, 0x65, 0x12, 0x2d, 0x0a, 0x0b, 0x44, 0x65, 0x73, 0x74, 0x69, 0x6e, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x0b, 0x2e, 0x43, 0x75, 0x72, 0x72, 0x65, 0x6e,
+	0x63, 0x69, 0x65, 0x73, 0x52, 0x0b, 0x44, 0x65, 0x73, 0x74, 0x69, 0x6e, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x12, 0x12, 0x0a, 0x04, 0x52, 0x61, 0x74, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x01, 0x52,
+	0x04, 0x52, 0x61, 0x74, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x42, 0x61, 0x73, 0x65, 0x43, 0x6f, 0x64,
+	0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x42, 0x61, 0x73, 0x65, 0x43, 0x6f, 0x64,
+	0x65, 0x12, 0x28, 0x0a, 0x0f, 0x44, 0x65, 0x73, 0x74, 0x69, 0x6e, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x43, 0x6f, 0x64, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0f, 0x44, 0x65, 0x73, 0x74,
+	0x69, 0x6e, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x29, 0x0a, 0x08, 0x4d,
+	0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0d, 0x2e,
+	0x52, 0x61, 0x74, 0x65, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x52, 0x08, 0x4d, 0x65,
+	0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x22, 0xfa, 0x01, 0x0a, 0x0c, 0x52, 0x61, 0x74, 0x65, 0x4d,
+	0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x12, 0x40, 0x0a, 0x0d, 0x45, 0x66, 0x66, 0x65, 0x63,
+	0x74, 0x69, 0x76, 0x65, 0x44, 0x61, 0x74, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a,
+	0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x0d, 0x45, 0x66, 0x66, 0x65,
+	0x63, 0x74, 0x69, 0x76, 0x65, 0x44, 0x61, 0x74, 0x65, 0x12, 0x38, 0x0a, 0x09, 0x46, 0x65, 0x74,
+	0x63, 0x68, 0x65, 0x64, 0x41, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67,
+	0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54,
+	0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x09, 0x46, 0x65, 0x74, 0x63, 0x68, 0x65,
+	0x64, 0x41, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x53, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x06, 0x53, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x12, 0x28, 0x0a, 0x0f, 0x53,
+	0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x04, 0x52, 0x0f, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x56, 0x65,
+	0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x14, 0x0a, 0x05, 0x53, 0x74, 0x61, 0x6c, 0x65, 0x18, 0x05,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x53, 0x74, 0x61, 0x6c, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x43,
+	0x75, 0x73, 0x74, 0x6f, 0x6d, 0x18, 0x06, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x43, 0x75, 0x73,
+	0x74, 0x6f, 0x6d, 0x22, 0xe1, 0x01, 0x0a, 0x12, 0x52, 0x61, 0x74, 0x65, 0x48, 0x69, 0x73, 0x74,
+	0x6f, 0x72, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x42, 0x61,
+	0x73, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x42, 0x61, 0x73, 0x65, 0x12, 0x20,
+	0x0a, 0x0b, 0x44, 0x65, 0x73, 0x74, 0x69, 0x6e, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x0b, 0x44, 0x65, 0x73, 0x74, 0x69, 0x6e, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x12, 0x2e, 0x0a, 0x04, 0x46, 0x72, 0x6f, 0x6d, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a,
+	0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x04, 0x46, 0x72, 0x6f, 0x6d,
+	0x12, 0x2a, 0x0a, 0x02, 0x54, 0x6f, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67,
+	0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54,
+	0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x02, 0x54, 0x6f, 0x12, 0x39, 0x0a, 0x0a,
+	0x52, 0x65, 0x73, 0x6f, 0x6c, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x19, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62,
+	0x75, 0x66, 0x2e, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x0a, 0x52, 0x65, 0x73,
+	0x6f, 0x6c, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0xa4, 0x01, 0x0a, 0x06, 0x43, 0x61, 0x6e, 0x64,
+	0x6c, 0x65, 0x12, 0x30, 0x0a, 0x05, 0x53, 0x74, 0x61, 0x72, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x05, 0x53,
+	0x74, 0x61, 0x72, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x4f, 0x70, 0x65, 0x6e, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x01, 0x52, 0x04, 0x4f, 0x70, 0x65, 0x6e, 0x12, 0x12, 0x0a, 0x04, 0x48, 0x69, 0x67, 0x68,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x01, 0x52, 0x04, 0x48, 0x69, 0x67, 0x68, 0x12, 0x10, 0x0a, 0x03,
+	0x4c, 0x6f, 0x77, 0x18, 0x04, 0x20, 0x01, 0x28, 0x01, 0x52, 0x03, 0x4c, 0x6f, 0x77, 0x12, 0x14,
+	0x0a, 0x05, 0x43, 0x6c, 0x6f, 0x73, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x01, 0x52, 0x05, 0x43,
+	0x6c, 0x6f, 0x73, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x53, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x73, 0x18,
+	0x06, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x53, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x73, 0x22, 0xa9,
+	0x01, 0x0a, 0x13, 0x52, 0x61, 0x74, 0x65, 0x48, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x42, 0x61, 0x73, 0x65, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x42, 0x61, 0x73, 0x65, 0x12, 0x20, 0x0a, 0x0b, 0x44, 0x65,
+	0x73, 0x74, 0x69, 0x6e, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0b, 0x44, 0x65, 0x73, 0x74, 0x69, 0x6e, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x39, 0x0a, 0x0a,
+	0x52, 0x65, 0x73, 0x6f, 0x6c, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x19, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62,
+	0x75, 0x66, 0x2e, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x0a, 0x52, 0x65, 0x73,
+	0x6f, 0x6c, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x21, 0x0a, 0x07, 0x43, 0x61, 0x6e, 0x64, 0x6c,
+	0x65, 0x73, 0x18, 0x04, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x07, 0x2e, 0x43, 0x61, 0x6e, 0x64, 0x6c,
+	0x65, 0x52, 0x07, 0x43, 0x61, 0x6e, 0x64, 0x6c, 0x65, 0x73, 0x22, 0x84, 0x01, 0x0a, 0x15, 0x53,
+	0x74, 0x72, 0x65, 0x61, 0x6d, 0x69, 0x6e, 0x67, 0x52, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x12, 0x34, 0x0a, 0x0d, 0x72, 0x61, 0x74, 0x65, 0x5f, 0x72, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0d, 0x2e, 0x52, 0x61,
+	0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00, 0x52, 0x0c, 0x72, 0x61,
+	0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x2a, 0x0a, 0x05, 0x65, 0x72,
+	0x72, 0x6f, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x67, 0x6f, 0x6f, 0x67,
+	0x6c, 0x65, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x48, 0x00, 0x52,
+	0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x42, 0x09, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67,
+	0x65, 0x22, 0x8c, 0x01, 0x0a, 0x12, 0x54, 0x68, 0x72, 0x65, 0x73, 0x68, 0x6f, 0x6c, 0x64, 0x43,
+	0x6f, 0x6e, 0x64, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x3c, 0x0a, 0x09, 0x44, 0x69, 0x72, 0x65,
+	0x63, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x1e, 0x2e, 0x54, 0x68,
+	0x72, 0x65, 0x73, 0x68, 0x6f, 0x6c, 0x64, 0x43, 0x6f, 0x6e, 0x64, 0x69, 0x74, 0x69, 0x6f, 0x6e,
+	0x2e, 0x44, 0x69, 0x72, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x52, 0x09, 0x44, 0x69, 0x72,
+	0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x14, 0x0a, 0x05, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x01, 0x52, 0x05, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x22, 0x22, 0x0a, 0x0a,
+	0x44, 0x69, 0x72, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x09, 0x0a, 0x05, 0x41, 0x42,
+	0x4f, 0x56, 0x45, 0x10, 0x00, 0x12, 0x09, 0x0a, 0x05, 0x42, 0x45, 0x4c, 0x4f, 0x57, 0x10, 0x01,
+	0x22, 0x63, 0x0a, 0x14, 0x50, 0x65, 0x72, 0x63, 0x65, 0x6e, 0x74, 0x4d, 0x6f, 0x76, 0x65, 0x43,
+	0x6f, 0x6e, 0x64, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x18, 0x0a, 0x07, 0x50, 0x65, 0x72, 0x63,
+	0x65, 0x6e, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x01, 0x52, 0x07, 0x50, 0x65, 0x72, 0x63, 0x65,
+	0x6e, 0x74, 0x12, 0x31, 0x0a, 0x06, 0x57, 0x69, 0x6e, 0x64, 0x6f, 0x77, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x19, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x62, 0x75, 0x66, 0x2e, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x06, 0x57,
+	0x69, 0x6e, 0x64, 0x6f, 0x77, 0x22, 0xc2, 0x02, 0x0a, 0x05, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x12,
+	0x0e, 0x0a, 0x02, 0x49, 0x44, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x49, 0x44, 0x12,
+	0x12, 0x0a, 0x04, 0x42, 0x61, 0x73, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x42,
+	0x61, 0x73, 0x65, 0x12, 0x20, 0x0a, 0x0b, 0x44, 0x65, 0x73, 0x74, 0x69, 0x6e, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x44, 0x65, 0x73, 0x74, 0x69, 0x6e,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x33, 0x0a, 0x09, 0x54, 0x68, 0x72, 0x65, 0x73, 0x68, 0x6f,
+	0x6c, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x54, 0x68, 0x72, 0x65, 0x73,
+	0x68, 0x6f, 0x6c, 0x64, 0x43, 0x6f, 0x6e, 0x64, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x48, 0x00, 0x52,
+	0x09, 0x54, 0x68, 0x72, 0x65, 0x73, 0x68, 0x6f, 0x6c, 0x64, 0x12, 0x39, 0x0a, 0x0b, 0x50, 0x65,
+	0x72, 0x63, 0x65, 0x6e, 0x74, 0x4d, 0x6f, 0x76, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x15, 0x2e, 0x50, 0x65, 0x72, 0x63, 0x65, 0x6e, 0x74, 0x4d, 0x6f, 0x76, 0x65, 0x43, 0x6f, 0x6e,
+	0x64, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x48, 0x00, 0x52, 0x0b, 0x50, 0x65, 0x72, 0x63, 0x65, 0x6e,
+	0x74, 0x4d, 0x6f, 0x76, 0x65, 0x12, 0x1e, 0x0a, 0x0a, 0x48, 0x79, 0x73, 0x74, 0x65, 0x72, 0x65,
+	0x73, 0x69, 0x73, 0x18, 0x06, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0a, 0x48, 0x79, 0x73, 0x74, 0x65,
+	0x72, 0x65, 0x73, 0x69, 0x73, 0x12, 0x38, 0x0a, 0x09, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64,
+	0x41, 0x74, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c,
+	0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73,
+	0x74, 0x61, 0x6d, 0x70, 0x52, 0x09, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64, 0x41, 0x74, 0x12,
+	0x1c, 0x0a, 0x09, 0x54, 0x72, 0x69, 0x67, 0x67, 0x65, 0x72, 0x65, 0x64, 0x18, 0x08, 0x20, 0x01,
+	0x28, 0x08, 0x52, 0x09, 0x54, 0x72, 0x69, 0x67, 0x67, 0x65, 0x72, 0x65, 0x64, 0x42, 0x0b, 0x0a,
+	0x09, 0x43, 0x6f, 0x6e, 0x64, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0x32, 0x0a, 0x12, 0x43, 0x72,
+	0x65, 0x61, 0x74, 0x65, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x12, 0x1c, 0x0a, 0x05, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x06, 0x2e, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x52, 0x05, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x22, 0x24,
+	0x0a, 0x12, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x12, 0x0e, 0x0a, 0x02, 0x49, 0x44, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x02, 0x49, 0x44, 0x22, 0x15, 0x0a, 0x13, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x41, 0x6c,
+	0x65, 0x72, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x13, 0x0a, 0x11, 0x4c,
+	0x69, 0x73, 0x74, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x22, 0x34, 0x0a, 0x12, 0x4c, 0x69, 0x73, 0x74, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x73, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1e, 0x0a, 0x06, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x73,
+	0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x06, 0x2e, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x52, 0x06,
+	0x41, 0x6c, 0x65, 0x72, 0x74, 0x73, 0x22, 0x26, 0x0a, 0x12, 0x57, 0x61, 0x74, 0x63, 0x68, 0x41,
+	0x6c, 0x65, 0x72, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x10, 0x0a, 0x03,
+	0x49, 0x44, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x03, 0x49, 0x44, 0x73, 0x22, 0xa2,
+	0x01, 0x0a, 0x0a, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x12, 0x1c, 0x0a,
+	0x05, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x06, 0x2e, 0x41,
+	0x6c, 0x65, 0x72, 0x74, 0x52, 0x05, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x52,
+	0x61, 0x74, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01, 0x52, 0x04, 0x52, 0x61, 0x74, 0x65, 0x12,
+	0x24, 0x0a, 0x0d, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x50, 0x65, 0x72, 0x63, 0x65, 0x6e, 0x74,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0d, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x50, 0x65,
+	0x72, 0x63, 0x65, 0x6e, 0x74, 0x12, 0x3c, 0x0a, 0x0b, 0x54, 0x72, 0x69, 0x67, 0x67, 0x65, 0x72,
+	0x65, 0x64, 0x41, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f,
+	0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d,
+	0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x0b, 0x54, 0x72, 0x69, 0x67, 0x67, 0x65, 0x72, 0x65,
+	0x64, 0x41, 0x74, 0x22, 0xdc, 0x01, 0x0a, 0x08, 0x4f, 0x76, 0x65, 0x72, 0x72, 0x69, 0x64, 0x65,
+	0x12, 0x1a, 0x0a, 0x08, 0x43, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x63, 0x79, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x08, 0x43, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x63, 0x79, 0x12, 0x12, 0x0a, 0x04,
+	0x52, 0x61, 0x74, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01, 0x52, 0x04, 0x52, 0x61, 0x74, 0x65,
+	0x12, 0x38, 0x0a, 0x09, 0x45, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x41, 0x74, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52,
+	0x09, 0x45, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x41, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x41, 0x63,
+	0x74, 0x6f, 0x72, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x41, 0x63, 0x74, 0x6f, 0x72,
+	0x12, 0x16, 0x0a, 0x06, 0x52, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x06, 0x52, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x12, 0x38, 0x0a, 0x09, 0x43, 0x72, 0x65, 0x61,
+	0x74, 0x65, 0x64, 0x41, 0x74, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f,
+	0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69,
+	0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x09, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64,
+	0x41, 0x74, 0x22, 0xac, 0x01, 0x0a, 0x12, 0x53, 0x65, 0x74, 0x4f, 0x76, 0x65, 0x72, 0x72, 0x69,
+	0x64, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x43, 0x75, 0x72,
+	0x72, 0x65, 0x6e, 0x63, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x43, 0x75, 0x72,
+	0x72, 0x65, 0x6e, 0x63, 0x79, 0x12, 0x12, 0x0a, 0x04, 0x52, 0x61, 0x74, 0x65, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x01, 0x52, 0x04, 0x52, 0x61, 0x74, 0x65, 0x12, 0x38, 0x0a, 0x09, 0x45, 0x78, 0x70,
+	0x69, 0x72, 0x65, 0x73, 0x41, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67,
+	0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54,
+	0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x09, 0x45, 0x78, 0x70, 0x69, 0x72, 0x65,
+	0x73, 0x41, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x41, 0x63, 0x74, 0x6f, 0x72, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x41, 0x63, 0x74, 0x6f, 0x72, 0x12, 0x16, 0x0a, 0x06, 0x52, 0x65, 0x61,
+	0x73, 0x6f, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x52, 0x65, 0x61, 0x73, 0x6f,
+	0x6e, 0x22, 0x60, 0x0a, 0x14, 0x43, 0x6c, 0x65, 0x61, 0x72, 0x4f, 0x76, 0x65, 0x72, 0x72, 0x69,
+	0x64, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x43, 0x75, 0x72,
+	0x72, 0x65, 0x6e, 0x63, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x43, 0x75, 0x72,
+	0x72, 0x65, 0x6e, 0x63, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x41, 0x63, 0x74, 0x6f, 0x72, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x41, 0x63, 0x74, 0x6f, 0x72, 0x12, 0x16, 0x0a, 0x06, 0x52,
+	0x65, 0x61, 0x73, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x52, 0x65, 0x61,
+	0x73, 0x6f, 0x6e, 0x22, 0x17, 0x0a, 0x15, 0x43, 0x6c, 0x65, 0x61, 0x72, 0x4f, 0x76, 0x65, 0x72,
+	0x72, 0x69, 0x64, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x16, 0x0a, 0x14,
+	0x4c, 0x69, 0x73, 0x74, 0x4f, 0x76, 0x65, 0x72, 0x72, 0x69, 0x64, 0x65, 0x73, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x22, 0x71, 0x0a, 0x15, 0x4c, 0x69, 0x73, 0x74, 0x4f, 0x76, 0x65, 0x72,
+	0x72, 0x69, 0x64, 0x65, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x27, 0x0a,
+	0x09, 0x4f, 0x76, 0x65, 0x72, 0x72, 0x69, 0x64, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x09, 0x2e, 0x4f, 0x76, 0x65, 0x72, 0x72, 0x69, 0x64, 0x65, 0x52, 0x09, 0x4f, 0x76, 0x65,
+	0x72, 0x72, 0x69, 0x64, 0x65, 0x73, 0x12, 0x2f, 0x0a, 0x08, 0x41, 0x75, 0x64, 0x69, 0x74, 0x4c,
+	0x6f, 0x67, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x4f, 0x76, 0x65, 0x72, 0x72,
+	0x69, 0x64, 0x65, 0x41, 0x75, 0x64, 0x69, 0x74, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x08, 0x41,
+	0x75, 0x64, 0x69, 0x74, 0x4c, 0x6f, 0x67, 0x22, 0xad, 0x01, 0x0a, 0x12, 0x4f, 0x76, 0x65, 0x72,
+	0x72, 0x69, 0x64, 0x65, 0x41, 0x75, 0x64, 0x69, 0x74, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x16,
+	0x0a, 0x06, 0x41, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06,
+	0x41, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x25, 0x0a, 0x08, 0x4f, 0x76, 0x65, 0x72, 0x72, 0x69,
+	0x64, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x09, 0x2e, 0x4f, 0x76, 0x65, 0x72, 0x72,
+	0x69, 0x64, 0x65, 0x52, 0x08, 0x4f, 0x76, 0x65, 0x72, 0x72, 0x69, 0x64, 0x65, 0x12, 0x14, 0x0a,
+	0x05, 0x41, 0x63, 0x74, 0x6f, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x41, 0x63,
+	0x74, 0x6f, 0x72, 0x12, 0x16, 0x0a, 0x06, 0x52, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x18, 0x04, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x06, 0x52, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x12, 0x2a, 0x0a, 0x02, 0x41,
+	0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74,
+	0x61, 0x6d, 0x70, 0x52, 0x02, 0x41, 0x74, 0x2a, 0xb5, 0x02, 0x0a, 0x0a, 0x43, 0x75, 0x72, 0x72,
+	0x65, 0x6e, 0x63, 0x69, 0x65, 0x73, 0x12, 0x07, 0x0a, 0x03, 0x45, 0x55, 0x52, 0x10, 0x00, 0x12,
+	0x07, 0x0a, 0x03, 0x55, 0x53, 0x44, 0x10, 0x01, 0x12, 0x07, 0x0a, 0x03, 0x4a, 0x50, 0x59, 0x10,
+	0x02, 0x12, 0x07, 0x0a, 0x03, 0x42, 0x47, 0x4e, 0x10, 0x03, 0x12, 0x07, 0x0a, 0x03, 0x43, 0x5a,
+	0x4b, 0x10, 0x04, 0x12, 0x07, 0x0a, 0x03, 0x44, 0x4b, 0x4b, 0x10, 0x05, 0x12, 0x07, 0x0a, 0x03,
+	0x47, 0x42, 0x50, 0x10, 0x06, 0x12, 0x07, 0x0a, 0x03, 0x48, 0x55, 0x46, 0x10, 0x07, 0x12, 0x07,
+	0x0a, 0x03, 0x50, 0x4c, 0x4e, 0x10, 0x08, 0x12, 0x07, 0x0a, 0x03, 0x52, 0x4f, 0x4e, 0x10, 0x09,
+	0x12, 0x07, 0x0a, 0x03, 0x53, 0x45, 0x4b, 0x10, 0x0a, 0x12, 0x07, 0x0a, 0x03, 0x43, 0x48, 0x46,
+	0x10, 0x0b, 0x12, 0x07, 0x0a, 0x03, 0x49, 0x53, 0x4b, 0x10, 0x0c, 0x12, 0x07, 0x0a, 0x03, 0x4e,
+	0x4f, 0x4b, 0x10, 0x0d, 0x12, 0x07, 0x0a, 0x03, 0x48, 0x52, 0x4b, 0x10, 0x0e, 0x12, 0x07, 0x0a,
+	0x03, 0x52, 0x55, 0x42, 0x10, 0x0f, 0x12, 0x07, 0x0a, 0x03, 0x54, 0x52, 0x59, 0x10, 0x10, 0x12,
+	0x07, 0x0a, 0x03, 0x41, 0x55, 0x44, 0x10, 0x11, 0x12, 0x07, 0x0a, 0x03, 0x42, 0x52, 0x4c, 0x10,
+	0x12, 0x12, 0x07, 0x0a, 0x03, 0x43, 0x41, 0x44, 0x10, 0x13, 0x12, 0x07, 0x0a, 0x03, 0x43, 0x4e,
+	0x59, 0x10, 0x14, 0x12, 0x07, 0x0a, 0x03, 0x48, 0x4b, 0x44, 0x10, 0x15, 0x12, 0x07, 0x0a, 0x03,
+	0x49, 0x44, 0x52, 0x10, 0x16, 0x12, 0x07, 0x0a, 0x03, 0x49, 0x4c, 0x53, 0x10, 0x17, 0x12, 0x07,
+	0x0a, 0x03, 0x49, 0x4e, 0x52, 0x10, 0x18, 0x12, 0x07, 0x0a, 0x03, 0x4b, 0x52, 0x57, 0x10, 0x19,
+	0x12, 0x07, 0x0a, 0x03, 0x4d, 0x58, 0x4e, 0x10, 0x1a, 0x12, 0x07, 0x0a, 0x03, 0x4d, 0x59, 0x52,
+	0x10, 0x1b, 0x12, 0x07, 0x0a, 0x03, 0x4e, 0x5a, 0x44, 0x10, 0x1c, 0x12, 0x07, 0x0a, 0x03, 0x50,
+	0x48, 0x50, 0x10, 0x1d, 0x12, 0x07, 0x0a, 0x03, 0x53, 0x47, 0x44, 0x10, 0x1e, 0x12, 0x07, 0x0a,
+	0x03, 0x54, 0x48, 0x42, 0x10, 0x1f, 0x12, 0x07, 0x0a, 0x03, 0x5a, 0x41, 0x52, 0x10, 0x20, 0x32,
+	0xe1, 0x01, 0x0a, 0x08, 0x43, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x63, 0x79, 0x12, 0x26, 0x0a, 0x07,
+	0x47, 0x65, 0x74, 0x52, 0x61, 0x74, 0x65, 0x12, 0x0c, 0x2e, 0x52, 0x61, 0x74, 0x65, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x0d, 0x2e, 0x52, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x12, 0x3a, 0x0a, 0x0e, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62,
+	0x65, 0x52, 0x61, 0x74, 0x65, 0x73, 0x12, 0x0c, 0x2e, 0x52, 0x61, 0x74, 0x65, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x16, 0x2e, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x69, 0x6e, 0x67,
+	0x52, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x28, 0x01, 0x30, 0x01,
+	0x12, 0x34, 0x0a, 0x0a, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x52, 0x61, 0x74, 0x65, 0x12, 0x0c,
+	0x2e, 0x52, 0x61, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x16, 0x2e, 0x53,
+	0x74, 0x72, 0x65, 0x61, 0x6d, 0x69, 0x6e, 0x67, 0x52, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x30, 0x01, 0x12, 0x3b, 0x0a, 0x0e, 0x47, 0x65, 0x74, 0x52, 0x61, 0x74,
+	0x65, 0x48, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x12, 0x13, 0x2e, 0x52, 0x61, 0x74, 0x65, 0x48,
+	0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x14, 0x2e,
+	0x52, 0x61, 0x74, 0x65, 0x48, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x32, 0xd8, 0x01, 0x0a, 0x06, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x73, 0x12, 0x2a,
+	0x0a, 0x0b, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x12, 0x13, 0x2e,
+	0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x1a, 0x06, 0x2e, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x12, 0x38, 0x0a, 0x0b, 0x44, 0x65,
+	0x6c, 0x65, 0x74, 0x65, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x12, 0x13, 0x2e, 0x44, 0x65, 0x6c, 0x65,
+	0x74, 0x65, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x14,
+	0x2e, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x12, 0x35, 0x0a, 0x0a, 0x4c, 0x69, 0x73, 0x74, 0x41, 0x6c, 0x65, 0x72,
+	0x74, 0x73, 0x12, 0x12, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x73, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x13, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x41, 0x6c, 0x65,
+	0x72, 0x74, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x31, 0x0a, 0x0b, 0x57,
+	0x61, 0x74, 0x63, 0x68, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x73, 0x12, 0x13, 0x2e, 0x57, 0x61, 0x74,
+	0x63, 0x68, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
+	0x0b, 0x2e, 0x41, 0x6c, 0x65, 0x72, 0x74, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x30, 0x01, 0x32, 0xbe,
+	0x01, 0x0a, 0x0d, 0x43, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x63, 0x79, 0x41, 0x64, 0x6d, 0x69, 0x6e,
+	0x12, 0x2d, 0x0a, 0x0b, 0x53, 0x65, 0x74, 0x4f, 0x76, 0x65, 0x72, 0x72, 0x69, 0x64, 0x65, 0x12,
+	0x13, 0x2e, 0x53, 0x65, 0x74, 0x4f, 0x76, 0x65, 0x72, 0x72, 0x69, 0x64, 0x65, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x09, 0x2e, 0x4f, 0x76, 0x65, 0x72, 0x72, 0x69, 0x64, 0x65, 0x12,
+	0x3e, 0x0a, 0x0d, 0x43, 0x6c, 0x65, 0x61, 0x72, 0x4f, 0x76, 0x65, 0x72, 0x72, 0x69, 0x64, 0x65,
+	0x12, 0x15, 0x2e, 0x43, 0x6c, 0x65, 0x61, 0x72, 0x4f, 0x76, 0x65, 0x72, 0x72, 0x69, 0x64, 0x65,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x16, 0x2e, 0x43, 0x6c, 0x65, 0x61, 0x72, 0x4f,
+	0x76, 0x65, 0x72, 0x72, 0x69, 0x64, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12,
+	0x3e, 0x0a, 0x0d, 0x4c, 0x69, 0x73, 0x74, 0x4f, 0x76, 0x65, 0x72, 0x72, 0x69, 0x64, 0x65, 0x73,
+	0x12, 0x15, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x4f, 0x76, 0x65, 0x72, 0x72, 0x69, 0x64, 0x65, 0x73,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x16, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x4f, 0x76,
+	0x65, 0x72, 0x72, 0x69, 0x64, 0x65, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x62,
+	0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_currency_proto_rawDescOnce sync.Once
+	file_currency_proto_rawDescData = file_currency_proto_rawDesc
+)
+
+func file_currency_proto_rawDescGZIP() []byte {
+	file_currency_proto_rawDescOnce.Do(func() {
+		file_currency_proto_rawDescData = protoimpl.X.CompressGZIP(file_currency_proto_rawDescData)
+	})
+	return file_currency_proto_rawDescData
+}
+
+var file_currency_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_currency_proto_msgTypes = make([]protoimpl.MessageInfo, 24)
+var file_currency_proto_goTypes = []interface{}{
+	(Currencies)(0),                    // 0: Currencies
+	(ThresholdCondition_Directions)(0), // 1: ThresholdCondition.Directions
+	(*RateRequest)(nil),                // 2: RateRequest
+	(*RateResponse)(nil),               // 3: RateResponse
+	(*RateMetadata)(nil),               // 4: RateMetadata
+	(*RateHistoryRequest)(nil),         // 5: RateHistoryRequest
+	(*Candle)(nil),                     // 6: Candle
+	(*RateHistoryResponse)(nil),        // 7: RateHistoryResponse
+	(*StreamingRateResponse)(nil),      // 8: StreamingRateResponse
+	(*ThresholdCondition)(nil),         // 9: ThresholdCondition
+	(*PercentMoveCondition)(nil),       // 10: PercentMoveCondition
+	(*Alert)(nil),                      // 11: Alert
+	(*CreateAlertRequest)(nil),         // 12: CreateAlertRequest
+	(*DeleteAlertRequest)(nil),         // 13: DeleteAlertRequest
+	(*DeleteAlertResponse)(nil),        // 14: DeleteAlertResponse
+	(*ListAlertsRequest)(nil),          // 15: ListAlertsRequest
+	(*ListAlertsResponse)(nil),         // 16: ListAlertsResponse
+	(*WatchAlertsRequest)(nil),         // 17: WatchAlertsRequest
+	(*AlertEvent)(nil),                 // 18: AlertEvent
+	(*Override)(nil),                   // 19: Override
+	(*SetOverrideRequest)(nil),         // 20: SetOverrideRequest
+	(*ClearOverrideRequest)(nil),       // 21: ClearOverrideRequest
+	(*ClearOverrideResponse)(nil),      // 22: ClearOverrideResponse
+	(*ListOverridesRequest)(nil),       // 23: ListOverridesRequest
+	(*ListOverridesResponse)(nil),      // 24: ListOverridesResponse
+	(*OverrideAuditEntry)(nil),         // 25: OverrideAuditEntry
+	(*timestamp.Timestamp)(nil),        // 26: google.protobuf.Timestamp
+	(*duration.Duration)(nil),          // 27: google.protobuf.Duration
+	(*status.Status)(nil),              // 28: google.rpc.Status
+}
+var file_currency_proto_depIdxs = []int32{
+	0,  // 0: RateRequest.Base:type_name -> Currencies
+	0,  // 1: RateRequest.Destination:type_name -> Currencies
+	0,  // 2: RateResponse.Base:type_name -> Currencies
+	0,  // 3: RateResponse.Destination:type_name -> Currencies
+	4,  // 4: RateResponse.Metadata:type_name -> RateMetadata
+	26, // 5: RateMetadata.EffectiveDate:type_name -> google.protobuf.Timestamp
+	26, // 6: RateMetadata.FetchedAt:type_name -> google.protobuf.Timestamp
+	26, // 7: RateHistoryRequest.From:type_name -> google.protobuf.Timestamp
+	26, // 8: RateHistoryRequest.To:type_name -> google.protobuf.Timestamp
+	27, // 9: RateHistoryRequest.Resolution:type_name -> google.protobuf.Duration
+	26, // 10: Candle.Start:type_name -> google.protobuf.Timestamp
+	27, // 11: RateHistoryResponse.Resolution:type_name -> google.protobuf.Duration
+	6,  // 12: RateHistoryResponse.Candles:type_name -> Candle
+	3,  // 13: StreamingRateResponse.rate_response:type_name -> RateResponse
+	28, // 14: StreamingRateResponse.error:type_name -> google.rpc.Status
+	1,  // 15: ThresholdCondition.Direction:type_name -> ThresholdCondition.Directions
+	27, // 16: PercentMoveCondition.Window:type_name -> google.protobuf.Duration
+	9,  // 17: Alert.Threshold:type_name -> ThresholdCondition
+	10, // 18: Alert.PercentMove:type_name -> PercentMoveCondition
+	26, // 19: Alert.CreatedAt:type_name -> google.protobuf.Timestamp
+	11, // 20: CreateAlertRequest.Alert:type_name -> Alert
+	11, // 21: ListAlertsResponse.Alerts:type_name -> Alert
+	11, // 22: AlertEvent.Alert:type_name -> Alert
+	26, // 23: AlertEvent.TriggeredAt:type_name -> google.protobuf.Timestamp
+	26, // 24: Override.ExpiresAt:type_name -> google.protobuf.Timestamp
+	26, // 25: Override.CreatedAt:type_name -> google.protobuf.Timestamp
+	26, // 26: SetOverrideRequest.ExpiresAt:type_name -> google.protobuf.Timestamp
+	19, // 27: ListOverridesResponse.Overrides:type_name -> Override
+	25, // 28: ListOverridesResponse.AuditLog:type_name -> OverrideAuditEntry
+	19, // 29: OverrideAuditEntry.Override:type_name -> Override
+	26, // 30: OverrideAuditEntry.At:type_name -> google.protobuf.Timestamp
+	2,  // 31: Currency.GetRate:input_type -> RateRequest
+	2,  // 32: Currency.SubscribeRates:input_type -> RateRequest
+	2,  // 33: Currency.StreamRate:input_type -> RateRequest
+	5,  // 34: Currency.GetRateHistory:input_type -> RateHistoryRequest
+	12, // 35: Alerts.CreateAlert:input_type -> CreateAlertRequest
+	13, // 36: Alerts.DeleteAlert:input_type -> DeleteAlertRequest
+	15, // 37: Alerts.ListAlerts:input_type -> ListAlertsRequest
+	17, // 38: Alerts.WatchAlerts:input_type -> WatchAlertsRequest
+	20, // 39: CurrencyAdmin.SetOverride:input_type -> SetOverrideRequest
+	21, // 40: CurrencyAdmin.ClearOverride:input_type -> ClearOverrideRequest
+	23, // 41: CurrencyAdmin.ListOverrides:input_type -> ListOverridesRequest
+	3,  // 42: Currency.GetRate:output_type -> RateResponse
+	8,  // 43: Currency.SubscribeRates:output_type -> StreamingRateResponse
+	8,  // 44: Currency.StreamRate:output_type -> StreamingRateResponse
+	7,  // 45: Currency.GetRateHistory:output_type -> RateHistoryResponse
+	11, // 46: Alerts.CreateAlert:output_type -> Alert
+	14, // 47: Alerts.DeleteAlert:output_type -> DeleteAlertResponse
+	16, // 48: Alerts.ListAlerts:output_type -> ListAlertsResponse
+	18, // 49: Alerts.WatchAlerts:output_type -> AlertEvent
+	19, // 50: CurrencyAdmin.SetOverride:output_type -> Override
+	22, // 51: CurrencyAdmin.ClearOverride:output_type -> ClearOverrideResponse
+	24, // 52: CurrencyAdmin.ListOverrides:output_type -> ListOverridesResponse
+	42, // [42:53] is the sub-list for method output_type
+	31, // [31:42] is the sub-list for method input_type
+	31, // [31:31] is the sub-list for extension type_name
+	31, // [31:31] is the sub-list for extension extendee
+	0,  // [0:31] is the sub-list for field type_name
+}
+
+func init() { file_currency_proto_init() }
+func file_currency_proto_init() {
+	if File_currency_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_currency_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RateRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_currency_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RateResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_currency_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RateMetadata); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_currency_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RateHistoryRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_currency_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Candle); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_currency_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RateHistoryResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_currency_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StreamingRateResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_currency_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ThresholdCondition); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_currency_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PercentMoveCondition); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_currency_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Alert); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_currency_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CreateAlertRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_currency_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DeleteAlertRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_currency_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DeleteAlertResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_currency_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListAlertsRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_currency_proto_msgTypes[14].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListAlertsResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_currency_proto_msgTypes[15].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*WatchAlertsRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_currency_proto_msgTypes[16].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*AlertEvent); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_currency_proto_msgTypes[17].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Override); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_currency_proto_msgTypes[18].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SetOverrideRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_currency_proto_msgTypes[19].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ClearOverrideRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_currency_proto_msgTypes[20].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ClearOverrideResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_currency_proto_msgTypes[21].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListOverridesRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_currency_proto_msgTypes[22].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListOverridesResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_currency_proto_msgTypes[23].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*OverrideAuditEntry); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_currency_proto_msgTypes[6].OneofWrappers = []interface{}{
+		(*StreamingRateResponse_RateResponse)(nil),
+		(*StreamingRateResponse_Error)(nil),
+	}
+	file_currency_proto_msgTypes[9].OneofWrappers = []interface{}{
+		(*Alert_Threshold)(nil),
+		(*Alert_PercentMove)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_currency_proto_rawDesc,
+			NumEnums:      2,
+			NumMessages:   24,
+			NumExtensions: 0,
+			NumServices:   3,
+		},
+		GoTypes:           file_currency_proto_goTypes,
+		DependencyIndexes: file_currency_proto_depIdxs,
+		EnumInfos:         file_currency_proto_enumTypes,
+		MessageInfos:      file_currency_proto_msgTypes,
+	}.Build()
+	File_currency_proto = out.File
+	file_currency_proto_rawDesc = nil
+	file_currency_proto_goTypes = nil
+	file_currency_proto_depIdxs = nil
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// CurrencyClient is the client API for Currency service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type CurrencyClient interface {
+	// GetRate returns the exchange rate for the two provided currency codes
+	GetRate(ctx context.Context, in *RateRequest, opts ...grpc.CallOption) (*RateResponse, error)
+	// SubscribeRates allow a client to subscribe for changes in an exchange rate
+	// when the rate changes a response will be sent
+	SubscribeRates(ctx context.Context, opts ...grpc.CallOption) (Currency_SubscribeRatesClient, error)
+	// StreamRate sends the current rate for the two provided currency codes followed by
+	// a response every time the rate changes. Unlike SubscribeRates it only streams from
+	// the server so it can be used by gRPC-Web clients such as browsers
+	StreamRate(ctx context.Context, in *RateRequest, opts ...grpc.CallOption) (Currency_StreamRateClient, error)
+	// GetRateHistory returns open, high, low and close candles for the two provided
+	// currency codes built from the recorded rate snapshots
+	GetRateHistory(ctx context.Context, in *RateHistoryRequest, opts ...grpc.CallOption) (*RateHistoryResponse, error)
+}
+
+type currencyClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCurrencyClient(cc grpc.ClientConnInterface) CurrencyClient {
+	return &currencyClient{cc}
+}
+
+func (c *currencyClient) GetRate(ctx context.Context, in *RateRequest, opts ...grpc.CallOption) (*RateResponse, error) {
+	out := new(RateResponse)
+	err := c.cc.Invoke(ctx, "/Currency/GetRate", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *currencyClient) SubscribeRates(ctx context.Context, opts ...grpc.CallOption) (Currency_SubscribeRatesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Currency_serviceDesc.Streams[0], "/Currency/SubscribeRates", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &currencySubscribeRatesClient{stream}
+	return x, nil
+}
+
+type Currency_SubscribeRatesClient interface {
+	Send(*RateRequest) error
+	Recv() (*StreamingRateResponse, error)
+	grpc.ClientStream
+}
+
+type currencySubscribeRatesClient struct {
+	grpc.ClientStream
+}
+
+func (x *currencySubscribeRatesClient) Send(m *RateRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *currencySubscribeRatesClient) Recv() (*StreamingRateResponse, error) {
+	m := new(StreamingRateResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *currencyClient) StreamRate(ctx context.Context, in *RateRequest, opts ...grpc.CallOption) (Currency_StreamRateClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Currency_serviceDesc.Streams[1], "/Currency/StreamRate", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &currencyStreamRateClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Currency_StreamRateClient interface {
+	Recv() (*StreamingRateResponse, error)
+	grpc.ClientStream
+}
+
+type currencyStreamRateClient struct {
+	grpc.ClientStream
+}
+
+func (x *currencyStreamRateClient) Recv() (*StreamingRateResponse, error) {
+	m := new(StreamingRateResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *currencyClient) GetRateHistory(ctx context.Context, in *RateHistoryRequest, opts ...grpc.CallOption) (*RateHistoryResponse, error) {
+	out := new(RateHistoryResponse)
+	err := c.cc.Invoke(ctx, "/Currency/GetRateHistory", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CurrencyServer is the server API for Currency service.
+type CurrencyServer interface {
+	// GetRate returns the exchange rate for the two provided currency codes
+	GetRate(context.Context, *RateRequest) (*RateResponse, error)
+	// SubscribeRates allow a client to subscribe for changes in an exchange rate
+	// when the rate changes a response will be sent
+	SubscribeRates(Currency_SubscribeRatesServer) error
+	// StreamRate sends the current rate for the two provided currency codes followed by
+	// a response every time the rate changes. Unlike SubscribeRates it only streams from
+	// the server so it can be used by gRPC-Web clients such as browsers
+	StreamRate(*RateRequest, Currency_StreamRateServer) error
+	// GetRateHistory returns open, high, low and close candles for the two provided
+	// currency codes built from the recorded rate snapshots
+	GetRateHistory(context.Context, *RateHistoryRequest) (*RateHistoryResponse, error)
+}
+
+// UnimplementedCurrencyServer can be embedded to have forward compatible implementations.
+type UnimplementedCurrencyServer struct {
 }
 
 func (*UnimplementedCurrencyServer) GetRate(context.Context, *RateRequest) (*RateResponse, error) {
@@ -622,6 +2722,12 @@ func (*UnimplementedCurrencyServer) GetRate(context.Context, *RateRequest) (*Rat
 func (*UnimplementedCurrencyServer) SubscribeRates(Currency_SubscribeRatesServer) error {
 	return status1.Errorf(codes.Unimplemented, "method SubscribeRates not implemented")
 }
+func (*UnimplementedCurrencyServer) StreamRate(*RateRequest, Currency_StreamRateServer) error {
+	return status1.Errorf(codes.Unimplemented, "method StreamRate not implemented")
+}
+func (*UnimplementedCurrencyServer) GetRateHistory(context.Context, *RateHistoryRequest) (*RateHistoryResponse, error) {
+	return nil, status1.Errorf(codes.Unimplemented, "method GetRateHistory not implemented")
+}
 
 func RegisterCurrencyServer(s *grpc.Server, srv CurrencyServer) {
 	s.RegisterService(&_Currency_serviceDesc, srv)
@@ -671,6 +2777,45 @@ func (x *currencySubscribeRatesServer) Recv() (*RateRequest, error) {
 	return m, nil
 }
 
+func _Currency_StreamRate_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RateRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CurrencyServer).StreamRate(m, &currencyStreamRateServer{stream})
+}
+
+type Currency_StreamRateServer interface {
+	Send(*StreamingRateResponse) error
+	grpc.ServerStream
+}
+
+type currencyStreamRateServer struct {
+	grpc.ServerStream
+}
+
+func (x *currencyStreamRateServer) Send(m *StreamingRateResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Currency_GetRateHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RateHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CurrencyServer).GetRateHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Currency/GetRateHistory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CurrencyServer).GetRateHistory(ctx, req.(*RateHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Currency_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "Currency",
 	HandlerType: (*CurrencyServer)(nil),
@@ -679,6 +2824,10 @@ var _Currency_serviceDesc = grpc.ServiceDesc{
 			MethodName: "GetRate",
 			Handler:    _Currency_GetRate_Handler,
 		},
+		{
+			MethodName: "GetRateHistory",
+			Handler:    _Currency_GetRateHistory_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -687,6 +2836,381 @@ var _Currency_serviceDesc = grpc.ServiceDesc{
 			ServerStreams: true,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "StreamRate",
+			Handler:       _Currency_StreamRate_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "currency.proto",
+}
+
+// AlertsClient is the client API for Alerts service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type AlertsClient interface {
+	// CreateAlert registers a new alert condition, the alert is persisted and
+	// survives a restart of the currency service
+	CreateAlert(ctx context.Context, in *CreateAlertRequest, opts ...grpc.CallOption) (*Alert, error)
+	// DeleteAlert removes a previously registered alert
+	DeleteAlert(ctx context.Context, in *DeleteAlertRequest, opts ...grpc.CallOption) (*DeleteAlertResponse, error)
+	// ListAlerts returns all registered alerts
+	ListAlerts(ctx context.Context, in *ListAlertsRequest, opts ...grpc.CallOption) (*ListAlertsResponse, error)
+	// WatchAlerts streams an AlertEvent every time an alert triggers
+	WatchAlerts(ctx context.Context, in *WatchAlertsRequest, opts ...grpc.CallOption) (Alerts_WatchAlertsClient, error)
+}
+
+type alertsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAlertsClient(cc grpc.ClientConnInterface) AlertsClient {
+	return &alertsClient{cc}
+}
+
+func (c *alertsClient) CreateAlert(ctx context.Context, in *CreateAlertRequest, opts ...grpc.CallOption) (*Alert, error) {
+	out := new(Alert)
+	err := c.cc.Invoke(ctx, "/Alerts/CreateAlert", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *alertsClient) DeleteAlert(ctx context.Context, in *DeleteAlertRequest, opts ...grpc.CallOption) (*DeleteAlertResponse, error) {
+	out := new(DeleteAlertResponse)
+	err := c.cc.Invoke(ctx, "/Alerts/DeleteAlert", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *alertsClient) ListAlerts(ctx context.Context, in *ListAlertsRequest, opts ...grpc.CallOption) (*ListAlertsResponse, error) {
+	out := new(ListAlertsResponse)
+	err := c.cc.Invoke(ctx, "/Alerts/ListAlerts", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *alertsClient) WatchAlerts(ctx context.Context, in *WatchAlertsRequest, opts ...grpc.CallOption) (Alerts_WatchAlertsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Alerts_serviceDesc.Streams[0], "/Alerts/WatchAlerts", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &alertsWatchAlertsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Alerts_WatchAlertsClient interface {
+	Recv() (*AlertEvent, error)
+	grpc.ClientStream
+}
+
+type alertsWatchAlertsClient struct {
+	grpc.ClientStream
+}
+
+func (x *alertsWatchAlertsClient) Recv() (*AlertEvent, error) {
+	m := new(AlertEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// AlertsServer is the server API for Alerts service.
+type AlertsServer interface {
+	// CreateAlert registers a new alert condition, the alert is persisted and
+	// survives a restart of the currency service
+	CreateAlert(context.Context, *CreateAlertRequest) (*Alert, error)
+	// DeleteAlert removes a previously registered alert
+	DeleteAlert(context.Context, *DeleteAlertRequest) (*DeleteAlertResponse, error)
+	// ListAlerts returns all registered alerts
+	ListAlerts(context.Context, *ListAlertsRequest) (*ListAlertsResponse, error)
+	// WatchAlerts streams an AlertEvent every time an alert triggers
+	WatchAlerts(*WatchAlertsRequest, Alerts_WatchAlertsServer) error
+}
+
+// UnimplementedAlertsServer can be embedded to have forward compatible implementations.
+type UnimplementedAlertsServer struct {
+}
+
+func (*UnimplementedAlertsServer) CreateAlert(context.Context, *CreateAlertRequest) (*Alert, error) {
+	return nil, status1.Errorf(codes.Unimplemented, "method CreateAlert not implemented")
+}
+func (*UnimplementedAlertsServer) DeleteAlert(context.Context, *DeleteAlertRequest) (*DeleteAlertResponse, error) {
+	return nil, status1.Errorf(codes.Unimplemented, "method DeleteAlert not implemented")
+}
+func (*UnimplementedAlertsServer) ListAlerts(context.Context, *ListAlertsRequest) (*ListAlertsResponse, error) {
+	return nil, status1.Errorf(codes.Unimplemented, "method ListAlerts not implemented")
+}
+func (*UnimplementedAlertsServer) WatchAlerts(*WatchAlertsRequest, Alerts_WatchAlertsServer) error {
+	return status1.Errorf(codes.Unimplemented, "method WatchAlerts not implemented")
+}
+
+func RegisterAlertsServer(s *grpc.Server, srv AlertsServer) {
+	s.RegisterService(&_Alerts_serviceDesc, srv)
+}
+
+func _Alerts_CreateAlert_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateAlertRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AlertsServer).CreateAlert(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Alerts/CreateAlert",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AlertsServer).CreateAlert(ctx, req.(*CreateAlertRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Alerts_DeleteAlert_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteAlertRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AlertsServer).DeleteAlert(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Alerts/DeleteAlert",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AlertsServer).DeleteAlert(ctx, req.(*DeleteAlertRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Alerts_ListAlerts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAlertsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AlertsServer).ListAlerts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Alerts/ListAlerts",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AlertsServer).ListAlerts(ctx, req.(*ListAlertsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Alerts_WatchAlerts_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchAlertsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AlertsServer).WatchAlerts(m, &alertsWatchAlertsServer{stream})
+}
+
+type Alerts_WatchAlertsServer interface {
+	Send(*AlertEvent) error
+	grpc.ServerStream
+}
+
+type alertsWatchAlertsServer struct {
+	grpc.ServerStream
+}
+
+func (x *alertsWatchAlertsServer) Send(m *AlertEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _Alerts_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "Alerts",
+	HandlerType: (*AlertsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateAlert",
+			Handler:    _Alerts_CreateAlert_Handler,
+		},
+		{
+			MethodName: "DeleteAlert",
+			Handler:    _Alerts_DeleteAlert_Handler,
+		},
+		{
+			MethodName: "ListAlerts",
+			Handler:    _Alerts_ListAlerts_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchAlerts",
+			Handler:       _Alerts_WatchAlerts_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "currency.proto",
+}
+
+// CurrencyAdminClient is the client API for CurrencyAdmin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type CurrencyAdminClient interface {
+	// SetOverride replaces the provider rate of a currency until the override is
+	// cleared or expires
+	SetOverride(ctx context.Context, in *SetOverrideRequest, opts ...grpc.CallOption) (*Override, error)
+	// ClearOverride removes the override of a currency, the provider rate is used again
+	ClearOverride(ctx context.Context, in *ClearOverrideRequest, opts ...grpc.CallOption) (*ClearOverrideResponse, error)
+	// ListOverrides returns the active overrides and the audit trail
+	ListOverrides(ctx context.Context, in *ListOverridesRequest, opts ...grpc.CallOption) (*ListOverridesResponse, error)
+}
+
+type currencyAdminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCurrencyAdminClient(cc grpc.ClientConnInterface) CurrencyAdminClient {
+	return &currencyAdminClient{cc}
+}
+
+func (c *currencyAdminClient) SetOverride(ctx context.Context, in *SetOverrideRequest, opts ...grpc.CallOption) (*Override, error) {
+	out := new(Override)
+	err := c.cc.Invoke(ctx, "/CurrencyAdmin/SetOverride", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *currencyAdminClient) ClearOverride(ctx context.Context, in *ClearOverrideRequest, opts ...grpc.CallOption) (*ClearOverrideResponse, error) {
+	out := new(ClearOverrideResponse)
+	err := c.cc.Invoke(ctx, "/CurrencyAdmin/ClearOverride", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *currencyAdminClient) ListOverrides(ctx context.Context, in *ListOverridesRequest, opts ...grpc.CallOption) (*ListOverridesResponse, error) {
+	out := new(ListOverridesResponse)
+	err := c.cc.Invoke(ctx, "/CurrencyAdmin/ListOverrides", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CurrencyAdminServer is the server API for CurrencyAdmin service.
+type CurrencyAdminServer interface {
+	// SetOverride replaces the provider rate of a currency until the override is
+	// cleared or expires
+	SetOverride(context.Context, *SetOverrideRequest) (*Override, error)
+	// ClearOverride removes the override of a currency, the provider rate is used again
+	ClearOverride(context.Context, *ClearOverrideRequest) (*ClearOverrideResponse, error)
+	// ListOverrides returns the active overrides and the audit trail
+	ListOverrides(context.Context, *ListOverridesRequest) (*ListOverridesResponse, error)
+}
+
+// UnimplementedCurrencyAdminServer can be embedded to have forward compatible implementations.
+type UnimplementedCurrencyAdminServer struct {
+}
+
+func (*UnimplementedCurrencyAdminServer) SetOverride(context.Context, *SetOverrideRequest) (*Override, error) {
+	return nil, status1.Errorf(codes.Unimplemented, "method SetOverride not implemented")
+}
+func (*UnimplementedCurrencyAdminServer) ClearOverride(context.Context, *ClearOverrideRequest) (*ClearOverrideResponse, error) {
+	return nil, status1.Errorf(codes.Unimplemented, "method ClearOverride not implemented")
+}
+func (*UnimplementedCurrencyAdminServer) ListOverrides(context.Context, *ListOverridesRequest) (*ListOverridesResponse, error) {
+	return nil, status1.Errorf(codes.Unimplemented, "method ListOverrides not implemented")
+}
+
+func RegisterCurrencyAdminServer(s *grpc.Server, srv CurrencyAdminServer) {
+	s.RegisterService(&_CurrencyAdmin_serviceDesc, srv)
+}
+
+func _CurrencyAdmin_SetOverride_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetOverrideRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CurrencyAdminServer).SetOverride(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/CurrencyAdmin/SetOverride",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CurrencyAdminServer).SetOverride(ctx, req.(*SetOverrideRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CurrencyAdmin_ClearOverride_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ClearOverrideRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CurrencyAdminServer).ClearOverride(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/CurrencyAdmin/ClearOverride",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CurrencyAdminServer).ClearOverride(ctx, req.(*ClearOverrideRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CurrencyAdmin_ListOverrides_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListOverridesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CurrencyAdminServer).ListOverrides(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/CurrencyAdmin/ListOverrides",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CurrencyAdminServer).ListOverrides(ctx, req.(*ListOverridesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _CurrencyAdmin_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "CurrencyAdmin",
+	HandlerType: (*CurrencyAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SetOverride",
+			Handler:    _CurrencyAdmin_SetOverride_Handler,
+		},
+		{
+			MethodName: "ClearOverride",
+			Handler:    _CurrencyAdmin_ClearOverride_Handler,
+		},
+		{
+			MethodName: "ListOverrides",
+			Handler:    _CurrencyAdmin_ListOverrides_Handler,
+		},
 	},
+	Streams:  []grpc.StreamDesc{},
 	Metadata: "currency.proto",
 }
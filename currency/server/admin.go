@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	"github.com/d-vignesh/go-microservice-example/currency/data"
+	protos "github.com/d-vignesh/go-microservice-example/currency/protos/currency"
+	"github.com/hashicorp/go-hclog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// adminServicePrefix is the prefix of the full method names of the CurrencyAdmin service
+const adminServicePrefix = "/CurrencyAdmin/"
+
+// Admin is a gRPC server it implements the methods defined by the CurrencyAdminServer interface
+type Admin struct {
+	rates *data.ExchangeRates
+	log   hclog.Logger
+}
+
+// NewAdmin creates a new Admin server
+func NewAdmin(er *data.ExchangeRates, l hclog.Logger) *Admin {
+	return &Admin{er, l}
+}
+
+// SetOverride implements the CurrencyAdminServer SetOverride method and overrides the rate
+// of a currency, subscribers receive the new rate immediately
+func (a *Admin) SetOverride(ctx context.Context, req *protos.SetOverrideRequest) (*protos.Override, error) {
+	o := data.Override{
+		Currency: strings.ToUpper(strings.TrimSpace(req.GetCurrency())),
+		Rate:     req.GetRate(),
+		Actor:    req.GetActor(),
+		Reason:   req.GetReason(),
+	}
+
+	if req.GetExpiresAt() != nil {
+		o.ExpiresAt = req.GetExpiresAt().AsTime()
+	}
+
+	a.log.Info("handle request for SetOverride", "currency", o.Currency, "rate", o.Rate, "actor", o.Actor)
+
+	o, err := a.rates.SetOverride(o)
+	if errors.Is(err, data.ErrInvalidOverride) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err != nil {
+		a.log.Error("unable to set override", "error", err)
+		return nil, status.Error(codes.Internal, "unable to set override")
+	}
+
+	return newOverride(o), nil
+}
+
+// ClearOverride implements the CurrencyAdminServer ClearOverride method and removes the
+// override of a currency
+func (a *Admin) ClearOverride(ctx context.Context, req *protos.ClearOverrideRequest) (*protos.ClearOverrideResponse, error) {
+	cur := strings.ToUpper(strings.TrimSpace(req.GetCurrency()))
+	a.log.Info("handle request for ClearOverride", "currency", cur, "actor", req.GetActor())
+
+	err := a.rates.ClearOverride(cur, req.GetActor(), req.GetReason())
+	if errors.Is(err, data.ErrInvalidOverride) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err == data.ErrOverrideNotFound {
+		return nil, status.Errorf(codes.NotFound, "no active override for currency %s", cur)
+	}
+
+	if err != nil {
+		a.log.Error("unable to clear override", "error", err)
+		return nil, status.Error(codes.Internal, "unable to clear override")
+	}
+
+	return &protos.ClearOverrideResponse{}, nil
+}
+
+// ListOverrides implements the CurrencyAdminServer ListOverrides method and returns the
+// active overrides along with the audit trail
+func (a *Admin) ListOverrides(ctx context.Context, req *protos.ListOverridesRequest) (*protos.ListOverridesResponse, error) {
+	resp := &protos.ListOverridesResponse{}
+
+	for _, o := range a.rates.Overrides() {
+		resp.Overrides = append(resp.Overrides, newOverride(o))
+	}
+
+	for _, e := range a.rates.OverrideAuditLog() {
+		resp.AuditLog = append(resp.AuditLog, &protos.OverrideAuditEntry{
+			Action:   e.Action,
+			Override: newOverride(e.Override),
+			Actor:    e.Actor,
+			Reason:   e.Reason,
+			At:       timestamppb.New(e.At),
+		})
+	}
+
+	return resp, nil
+}
+
+// AdminAuthInterceptor returns a unary interceptor which requires the given token in the
+// authorization metadata for calls to the CurrencyAdmin service, other services are not affected
+func AdminAuthInterceptor(token string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !strings.HasPrefix(info.FullMethod, adminServicePrefix) {
+			return handler(ctx, req)
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, v := range md.Get("authorization") {
+			if subtle.ConstantTimeCompare([]byte(v), []byte("Bearer "+token)) == 1 {
+				return handler(ctx, req)
+			}
+		}
+
+		return nil, status.Error(codes.Unauthenticated, "a valid admin token is required")
+	}
+}
+
+// newOverride converts an override into its protobuf representation
+func newOverride(o data.Override) *protos.Override {
+	po := &protos.Override{
+		Currency:  o.Currency,
+		Rate:      o.Rate,
+		Actor:     o.Actor,
+		Reason:    o.Reason,
+		CreatedAt: timestamppb.New(o.CreatedAt),
+	}
+
+	if !o.ExpiresAt.IsZero() {
+		po.ExpiresAt = timestamppb.New(o.ExpiresAt)
+	}
+
+	return po
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/d-vignesh/go-microservice-example/currency/data"
+	protos "github.com/d-vignesh/go-microservice-example/currency/protos/currency"
+	"github.com/hashicorp/go-hclog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Alerts is a gRPC server it implements the methods defined by the AlertsServer interface
+type Alerts struct {
+	alerts *data.Alerts
+	rates  *data.ExchangeRates
+	log    hclog.Logger
+}
+
+// NewAlerts creates a new Alerts server, the alerts are evaluated every time the rates change
+func NewAlerts(a *data.Alerts, er *data.ExchangeRates, l hclog.Logger) *Alerts {
+	s := &Alerts{a, er, l}
+	go s.handleUpdates()
+	return s
+}
+
+func (s *Alerts) handleUpdates() {
+	ru := s.rates.Subscribe()
+	for range ru {
+		s.alerts.Evaluate(time.Now())
+	}
+}
+
+// CreateAlert implements the AlertsServer CreateAlert method and registers a new alert
+func (s *Alerts) CreateAlert(ctx context.Context, req *protos.CreateAlertRequest) (*protos.Alert, error) {
+	pa := req.GetAlert()
+	if pa == nil {
+		return nil, status.Error(codes.InvalidArgument, "alert is required")
+	}
+
+	al := data.Alert{
+		Base:        strings.ToUpper(strings.TrimSpace(pa.GetBase())),
+		Destination: strings.ToUpper(strings.TrimSpace(pa.GetDestination())),
+		Hysteresis:  pa.GetHysteresis(),
+	}
+
+	switch c := pa.GetCondition().(type) {
+	case *protos.Alert_Threshold:
+		al.Kind = data.AlertThreshold
+		al.Threshold = c.Threshold.GetValue()
+		al.Direction = data.AlertAbove
+		if c.Threshold.GetDirection() == protos.ThresholdCondition_BELOW {
+			al.Direction = data.AlertBelow
+		}
+	case *protos.Alert_PercentMove:
+		al.Kind = data.AlertPercentMove
+		al.Percent = c.PercentMove.GetPercent()
+		if w := c.PercentMove.GetWindow(); w != nil {
+			al.Window = w.AsDuration()
+		}
+	default:
+		return nil, status.Error(codes.InvalidArgument, "alert condition is required")
+	}
+
+	s.log.Info("handle request for CreateAlert", "base", al.Base, "dest", al.Destination, "kind", al.Kind)
+
+	al, err := s.alerts.Create(al)
+	if errors.Is(err, data.ErrInvalidAlert) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err != nil {
+		s.log.Error("unable to create alert", "error", err)
+		return nil, status.Error(codes.Internal, "unable to create alert")
+	}
+
+	return newAlert(al), nil
+}
+
+// DeleteAlert implements the AlertsServer DeleteAlert method and removes an alert
+func (s *Alerts) DeleteAlert(ctx context.Context, req *protos.DeleteAlertRequest) (*protos.DeleteAlertResponse, error) {
+	err := s.alerts.Delete(req.GetID())
+	if err == data.ErrAlertNotFound {
+		return nil, status.Errorf(codes.NotFound, "alert %s not found", req.GetID())
+	}
+
+	if err != nil {
+		s.log.Error("unable to delete alert", "id", req.GetID(), "error", err)
+		return nil, status.Error(codes.Internal, "unable to delete alert")
+	}
+
+	return &protos.DeleteAlertResponse{}, nil
+}
+
+// ListAlerts implements the AlertsServer ListAlerts method and returns all registered alerts
+func (s *Alerts) ListAlerts(ctx context.Context, req *protos.ListAlertsRequest) (*protos.ListAlertsResponse, error) {
+	resp := &protos.ListAlertsResponse{}
+	for _, al := range s.alerts.List() {
+		resp.Alerts = append(resp.Alerts, newAlert(al))
+	}
+
+	return resp, nil
+}
+
+// WatchAlerts implements the gRPC server streaming method and sends an event
+// every time one of the requested alerts triggers
+func (s *Alerts) WatchAlerts(req *protos.WatchAlertsRequest, src protos.Alerts_WatchAlertsServer) error {
+	ids := map[string]bool{}
+	for _, id := range req.GetIDs() {
+		ids[id] = true
+	}
+
+	events, stop := s.alerts.Watch()
+	defer stop()
+
+	for {
+		select {
+		case <-src.Context().Done():
+			s.log.Info("client has closed alert stream")
+			return nil
+		case ev := <-events:
+			if len(ids) > 0 && !ids[ev.Alert.ID] {
+				continue
+			}
+
+			err := src.Send(&protos.AlertEvent{
+				Alert:         newAlert(ev.Alert),
+				Rate:          ev.Rate,
+				ChangePercent: ev.ChangePercent,
+				TriggeredAt:   timestamppb.New(ev.TriggeredAt),
+			})
+
+			if err != nil {
+				s.log.Error("unable to send alert event", "id", ev.Alert.ID, "error", err)
+				return err
+			}
+		}
+	}
+}
+
+// newAlert converts an alert into its protobuf representation
+func newAlert(al data.Alert) *protos.Alert {
+	pa := &protos.Alert{
+		ID:          al.ID,
+		Base:        al.Base,
+		Destination: al.Destination,
+		Hysteresis:  al.Hysteresis,
+		CreatedAt:   timestamppb.New(al.CreatedAt),
+		Triggered:   al.Triggered,
+	}
+
+	switch al.Kind {
+	case data.AlertThreshold:
+		dir := protos.ThresholdCondition_ABOVE
+		if al.Direction == data.AlertBelow {
+			dir = protos.ThresholdCondition_BELOW
+		}
+
+		pa.Condition = &protos.Alert_Threshold{
+			Threshold: &protos.ThresholdCondition{Direction: dir, Value: al.Threshold},
+		}
+	case data.AlertPercentMove:
+		pa.Condition = &protos.Alert_PercentMove{
+			PercentMove: &protos.PercentMoveCondition{Percent: al.Percent, Window: durationpb.New(al.Window)},
+		}
+	}
+
+	return pa
+}
@@ -2,7 +2,10 @@ package server
 
 import (
 	"context"
+	"errors"
 	"io"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/go-hclog"
@@ -10,47 +13,73 @@ import (
 	"github.com/d-vignesh/go-microservice-example/currency/data"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// rateStream is a stream rate updates are sent to, it is implemented by both the
+// SubscribeRates and the StreamRate server streams
+type rateStream interface {
+	Send(*protos.StreamingRateResponse) error
+}
+
 // Currency is a gRPC server it implements the methods defined by the CurrencyServer interface
 type Currency struct {
 	rates *data.ExchangeRates
+	history *data.History
 	log hclog.Logger
-	subscriptions map[protos.Currency_SubscribeRatesServer][]*protos.RateRequest
+	mu sync.Mutex
+	subscriptions map[rateStream]*subscription
+}
+
+// subscription is a rate stream with the rates subscribed on it, the messages for the
+// stream are queued in its outbox
+type subscription struct {
+	requests []*protos.RateRequest
+	out      *outbox
 }
 
-// NewCurrency create a new Currency server
-func NewCurrency(er *data.ExchangeRates, l hclog.Logger) *Currency {
-	c := &Currency{er, l, make(map[protos.Currency_SubscribeRatesServer][]*protos.RateRequest)}
+// NewCurrency create a new Currency server, every published rate snapshot is recorded in the history
+func NewCurrency(er *data.ExchangeRates, h *data.History, l hclog.Logger) *Currency {
+	c := &Currency{rates: er, history: h, log: l, subscriptions: make(map[rateStream]*subscription)}
+	c.recordSnapshot()
 	go c.handleUpdates()
 	return c 
 }
 
 func (c *Currency) handleUpdates() {
-	ru := c.rates.MonitorRates(20 * time.Second)
+	ru := c.rates.Subscribe()
 	for range ru {
 		c.log.Info("got updated rates")
+		c.recordSnapshot()
+
+		// copy the subscriptions so that the lock is not held while the updates are queued
+		c.mu.Lock()
+		subs := make([]subscription, 0, len(c.subscriptions))
+		for _, s := range c.subscriptions {
+			subs = append(subs, *s)
+		}
+		c.mu.Unlock()
 
 		// loop over subscribed clients
-		for k, v := range c.subscriptions {
+		for _, s := range subs {
 
 			// loop over subscribed rates
-			for _, rr := range v {
-				r, err := c.rates.GetRate(rr.GetBase().String(), rr.GetDestination().String())
+			for _, rr := range s.requests {
+				base, dest := rateCodes(rr)
+
+				r, err := c.rates.GetRateWithMetadata(base, dest)
 				if err != nil {
-					c.log.Error("unable to get updated rate", "base", rr.GetBase().String(), "destination", rr.GetDestination().String())
+					c.log.Error("unable to get updated rate", "base", base, "destination", dest)
+					continue
 				}
 
-				// create the response and sent to the client
-				err = k.Send(&protos.StreamingRateResponse{
+				// queue the response, it is sent by the goroutine delivering to the client
+				s.out.push(rateKey(base, dest), &protos.StreamingRateResponse{
 					Message: &protos.StreamingRateResponse_RateResponse{
-						RateResponse: &protos.RateResponse{Base: rr.Base, Destination: rr.Destination, Rate: r},
+						RateResponse: newRateResponse(r),
 					},
 				})
-
-				if err != nil {
-					c.log.Error("unable to send updated rate", "base", rr.GetBase().String(), "destination", rr.GetDestination().String())
-				}
 			}
 		}
 	}
@@ -60,30 +89,139 @@ func (c *Currency) handleUpdates() {
 // GetRate implements the CurrencyServer GetRate method and returns the currency exchange rate
 // for the given currencies.
 func (c *Currency) GetRate(ctx context.Context, rr *protos.RateRequest) (*protos.RateResponse, error) {
-	c.log.Info("handle request for GetRate", "base", rr.GetBase(), "dest", rr.GetDestination())
+	base, dest := rateCodes(rr)
+	c.log.Info("handle request for GetRate", "base", base, "dest", dest)
 
-	// Validate that base and destination currency are different
-	if rr.Base == rr.Destination {
-		// create the grpc error and return to the client
-		err := status.Errorf(
-			codes.InvalidArgument,
-			"Base currency %s can not be same as destination currency %s",
-			rr.Base.String(),
-			rr.Destination.String(),
-		)
+	err := c.validateRateRequest(base, dest)
+	if err != nil {
 		return nil, err
 	}
 
-	rate, err := c.rates.GetRate(rr.GetBase().String(), rr.GetDestination().String())
+	rate, err := c.rates.GetRateWithMetadata(base, dest)
 	if err != nil {
 		return nil, err
 	}
 
-	return &protos.RateResponse{Base: rr.Base, Destination: rr.Destination, Rate: rate}, nil
+	return newRateResponse(rate), nil
+}
+
+// GetRateHistory implements the CurrencyServer GetRateHistory method and returns the candles
+// for the given currencies built from the recorded rate snapshots
+func (c *Currency) GetRateHistory(ctx context.Context, req *protos.RateHistoryRequest) (*protos.RateHistoryResponse, error) {
+	base := strings.ToUpper(strings.TrimSpace(req.GetBase()))
+	dest := strings.ToUpper(strings.TrimSpace(req.GetDestination()))
+	c.log.Info("handle request for GetRateHistory", "base", base, "dest", dest)
+
+	err := c.validateRateRequest(base, dest)
+	if err != nil {
+		return nil, err
+	}
+
+	to := time.Now()
+	if req.GetTo() != nil {
+		to = req.GetTo().AsTime()
+	}
+
+	from := to.Add(-24 * time.Hour)
+	if req.GetFrom() != nil {
+		from = req.GetFrom().AsTime()
+	}
+
+	res := time.Hour
+	if req.GetResolution() != nil {
+		res = req.GetResolution().AsDuration()
+	}
+
+	cs, err := c.history.Candles(base, dest, from, to, res)
+	if errors.Is(err, data.ErrInvalidHistoryQuery) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err != nil {
+		c.log.Error("unable to read rate history", "error", err)
+		return nil, status.Error(codes.Internal, "unable to read rate history")
+	}
+
+	resp := &protos.RateHistoryResponse{Base: base, Destination: dest, Resolution: durationpb.New(res)}
+	for _, cd := range cs {
+		resp.Candles = append(resp.Candles, &protos.Candle{
+			Start:   timestamppb.New(cd.Start),
+			Open:    cd.Open,
+			High:    cd.High,
+			Low:     cd.Low,
+			Close:   cd.Close,
+			Samples: uint32(cd.Samples),
+		})
+	}
+
+	return resp, nil
+}
+
+// StreamRate implements the gRPC server streaming method for the server, the current rate is
+// sent immediately and an update is sent every time the rate changes until the client goes away
+func (c *Currency) StreamRate(rr *protos.RateRequest, src protos.Currency_StreamRateServer) error {
+	base, dest := rateCodes(rr)
+	c.log.Info("handle request for StreamRate", "base", base, "dest", dest)
+
+	err := c.validateRateRequest(base, dest)
+	if err != nil {
+		return err
+	}
+
+	// register the subscription before reading the rate so that no update is missed,
+	// a queued update replaces the current rate when it has not been sent yet
+	out := newOutbox()
+	c.mu.Lock()
+	c.subscriptions[src] = &subscription{requests: []*protos.RateRequest{rr}, out: out}
+	r, err := c.rates.GetRateWithMetadata(base, dest)
+	if err == nil {
+		out.push(rateKey(base, dest), &protos.StreamingRateResponse{
+			Message: &protos.StreamingRateResponse_RateResponse{RateResponse: newRateResponse(r)},
+		})
+	}
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.subscriptions, src)
+		c.mu.Unlock()
+	}()
+
+	if err != nil {
+		return err
+	}
+
+	err = out.deliver(src.Context(), src, c.log)
+	if err != nil {
+		return err
+	}
+
+	c.log.Info("client has closed rate stream")
+	return nil
 }
 
 // SubscribeRates implements the gRPC bidirectional streaming method for the server
 func (c *Currency) SubscribeRates(src protos.Currency_SubscribeRatesServer) error {
+	// the messages are sent by their own goroutine, so that a slow client does not block
+	// the rate updates of the other clients
+	out := newOutbox()
+	ctx, cancel := context.WithCancel(src.Context())
+	delivered := make(chan struct{})
+	go func() {
+		out.deliver(ctx, src, c.log)
+		close(delivered)
+	}()
+
+	// remove the subscriptions once the client goes away, nothing must be sent on the
+	// stream once the method returns
+	defer func() {
+		c.mu.Lock()
+		delete(c.subscriptions, src)
+		c.mu.Unlock()
+
+		cancel()
+		<-delivered
+	}()
 
 	// handle client messages
 	for {
@@ -100,36 +238,140 @@ func (c *Currency) SubscribeRates(src protos.Currency_SubscribeRatesServer) erro
 			return err
 		}
 
-		c.log.Info("handle client request", "request_base", rr.GetBase(), "request_dest", rr.GetDestination())
+		base, dest := rateCodes(rr)
+		c.log.Info("handle client request", "request_base", base, "request_dest", dest)
+
+		// reject unknown currencies, the error is sent on the stream so that the
+		// connection stays open for other subscriptions
+		if err := c.validateRateRequest(base, dest); err != nil {
+			c.log.Error("invalid subscription", "base", base, "dest", dest, "error", err)
+			c.sendError(out, status.Convert(err), rr)
+			continue
+		}
 
-		rrs, ok := c.subscriptions[src]
+		c.mu.Lock()
+		s, ok := c.subscriptions[src]
 		if !ok {
-			rrs = []*protos.RateRequest{}
+			s = &subscription{requests: []*protos.RateRequest{}, out: out}
 		}
 
 		// check if already in the subscribe list and return a custom gRPC error
-		for _, r := range rrs {
+		active := false
+		for _, r := range s.requests {
+			rb, rd := rateCodes(r)
+
 			// if we already have subscribed to this currency return an error
-			if r.Base == rr.Base && r.Destination == rr.Destination {
-				c.log.Error("subscription already active", "base", rr.Base.String(), "dest", rr.Destination.String())
+			if rb == base && rd == dest {
+				c.log.Error("subscription already active", "base", base, "dest", dest)
+				active = true
+			}
+		}
 
-				grpcError := status.New(codes.InvalidArgument, "subscription already active for rate")
-				grpcError, err = grpcError.WithDetails(rr)
-				if err != nil {
-					c.log.Error("unable to add metadate to error message", "error", err)
-					continue
-				}
+		if !active {
+			s.requests = append(s.requests, rr)
+			c.subscriptions[src] = s
+		}
+		c.mu.Unlock()
 
-				// can't return error as that will terminate the connection, instead must send an error which
-				// can be handled by the client recv stream
-				srr := &protos.StreamingRateResponse_Error{Error: grpcError.Proto()}
-				src.Send(&protos.StreamingRateResponse{Message: srr})
-			}
+		if active {
+			c.sendError(out, status.New(codes.InvalidArgument, "subscription already active for rate"), rr)
 		}
+	}
 
-		rrs = append(rrs , rr)
-		c.subscriptions[src] = rrs
+	return nil
+}
+
+// sendError queues the error with the request as details for the stream. We can't return an error
+// as that will terminate the connection, instead must send an error which can be handled by
+// the client recv stream
+func (c *Currency) sendError(out *outbox, grpcError *status.Status, rr *protos.RateRequest) {
+	grpcError, err := grpcError.WithDetails(rr)
+	if err != nil {
+		c.log.Error("unable to add metadate to error message", "error", err)
+		return
+	}
+
+	srr := &protos.StreamingRateResponse_Error{Error: grpcError.Proto()}
+	out.push("", &protos.StreamingRateResponse{Message: srr})
+}
+
+// recordSnapshot stores the current rate table in the history
+func (c *Currency) recordSnapshot() {
+	rs, md := c.rates.Snapshot()
+
+	err := c.history.Record(time.Now(), md.Version, rs)
+	if err != nil {
+		c.log.Error("unable to record rate snapshot", "error", err)
+	}
+}
+
+// validateRateRequest checks that both currencies are known and that they differ,
+// it returns a gRPC InvalidArgument error when the request can not be served
+func (c *Currency) validateRateRequest(base, dest string) error {
+	for _, code := range []string{base, dest} {
+		if !c.rates.HasCurrency(code) {
+			return status.Errorf(codes.InvalidArgument, "Currency %s is not supported", code)
+		}
+	}
+
+	// Validate that base and destination currency are different
+	if base == dest {
+		return status.Errorf(
+			codes.InvalidArgument,
+			"Base currency %s can not be same as destination currency %s",
+			base,
+			dest,
+		)
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// rateCodes returns the base and destination currency codes for a request,
+// the string codes take precedence over the legacy Currencies enum fields
+func rateCodes(rr *protos.RateRequest) (string, string) {
+	base := strings.ToUpper(strings.TrimSpace(rr.GetBaseCode()))
+	if base == "" {
+		base = rr.GetBase().String()
+	}
+
+	dest := strings.ToUpper(strings.TrimSpace(rr.GetDestinationCode()))
+	if dest == "" {
+		dest = rr.GetDestination().String()
+	}
+
+	return base, dest
+}
+
+// newRateResponse creates a RateResponse for the given rate, the enum fields
+// are only populated when the code is part of the Currencies enum
+func newRateResponse(r data.Rate) *protos.RateResponse {
+	resp := &protos.RateResponse{
+		Rate:            r.Value,
+		BaseCode:        r.Base,
+		DestinationCode: r.Destination,
+		Metadata:        newRateMetadata(r.Metadata),
+	}
+
+	if v, ok := protos.Currencies_value[r.Base]; ok {
+		resp.Base = protos.Currencies(v)
+	}
+
+	if v, ok := protos.Currencies_value[r.Destination]; ok {
+		resp.Destination = protos.Currencies(v)
+	}
+
+	return resp
+}
+
+// newRateMetadata converts the rate table metadata into its protobuf representation
+func newRateMetadata(md data.Metadata) *protos.RateMetadata {
+	return &protos.RateMetadata{
+		EffectiveDate:   timestamppb.New(md.EffectiveDate),
+		FetchedAt:       timestamppb.New(md.FetchedAt),
+		Source:          md.Source,
+		SnapshotVersion: md.Version,
+		Stale:           md.Stale,
+		Custom:          md.Custom,
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"sync"
+
+	protos "github.com/d-vignesh/go-microservice-example/currency/protos/currency"
+	"github.com/hashicorp/go-hclog"
+)
+
+// outbox queues the messages for a rate stream so that they are sent by the goroutine
+// delivering them rather than by the goroutine producing them, a slow client only
+// delays its own messages. A queued rate is replaced by a newer rate of the same
+// currencies, so the queue of a slow client does not grow with every update.
+type outbox struct {
+	mu    sync.Mutex
+	queue []*protos.StreamingRateResponse
+	// rates is the index in the queue of the queued rate of the currencies
+	rates map[string]int
+	wake  chan struct{}
+}
+
+func newOutbox() *outbox {
+	return &outbox{rates: map[string]int{}, wake: make(chan struct{}, 1)}
+}
+
+// push queues the message, key identifies the currencies of a rate and is empty for
+// messages which must not be replaced such as errors
+func (o *outbox) push(key string, m *protos.StreamingRateResponse) {
+	o.mu.Lock()
+	if i, ok := o.rates[key]; ok && key != "" {
+		o.queue[i] = m
+		o.mu.Unlock()
+		return
+	}
+
+	if key != "" {
+		o.rates[key] = len(o.queue)
+	}
+	o.queue = append(o.queue, m)
+	o.mu.Unlock()
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// take removes the queued messages and returns them in order
+func (o *outbox) take() []*protos.StreamingRateResponse {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	q := o.queue
+	o.queue = nil
+	o.rates = map[string]int{}
+	return q
+}
+
+// deliver sends the queued messages on the stream until the context is done or a send
+// fails, it must be the only goroutine sending on the stream
+func (o *outbox) deliver(ctx context.Context, src rateStream, log hclog.Logger) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-o.wake:
+		}
+
+		for _, m := range o.take() {
+			err := src.Send(m)
+			if err != nil {
+				log.Error("unable to send on rate stream", "error", err)
+				return err
+			}
+		}
+	}
+}
+
+// rateKey returns the key of the rates between the currencies in an outbox
+func rateKey(base, dest string) string {
+	return base + "/" + dest
+}
@@ -0,0 +1,223 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// ErrCategoryNotFound is an error raised when a category cannot be found in the database
+var ErrCategoryNotFound = fmt.Errorf("category not found")
+
+// ErrCategoryConflict is an error raised when a category conflicts with the existing
+// categories, such as a duplicate name within the same parent
+var ErrCategoryConflict = fmt.Errorf("category conflict")
+
+// ErrInvalidCategory is an error raised when the parent of a category does not exist
+// or would make the category its own ancestor
+var ErrInvalidCategory = fmt.Errorf("invalid category")
+
+// Category defines the structure for an API category, categories form a tree such
+// as "Coffee > Espresso drinks"
+// swagger: model
+type Category struct {
+	// id for the category
+	//
+	// required: false
+	// min: 1
+	ID int `json:"id"`
+
+	// name for the category, unique within the parent category
+	//
+	// required: true
+	// max length: 255
+	Name string `json:"name" validate:"required,max=255"`
+
+	// id of the parent category, top level categories have no parent
+	//
+	// required: false
+	ParentID int `json:"parentId,omitempty" validate:"gte=0"`
+
+	// number of products tagged with the category or one of its descendants
+	//
+	// read only: true
+	ProductCount int `json:"productCount"`
+}
+
+// Categories defines a slice of Category
+type Categories []*Category
+
+// Tag is the assignment of a product to a category, a product can be tagged with
+// any number of categories
+type Tag struct {
+	ProductID  int
+	CategoryID int
+}
+
+// descendants returns the ids of the category with the given id and of all the
+// categories below it
+func (cs Categories) descendants(id int) []int {
+	children := map[int][]int{}
+	for _, c := range cs {
+		children[c.ParentID] = append(children[c.ParentID], c.ID)
+	}
+
+	ids := []int{id}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+
+	return ids
+}
+
+// find returns the category with the given id or nil
+func (cs Categories) find(id int) *Category {
+	for _, c := range cs {
+		if c.ID == id {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// countProducts sets the ProductCount of the categories to the number of distinct
+// products tagged with the category or one of its descendants
+func (cs Categories) countProducts(tags []Tag) {
+	direct := map[int][]int{}
+	for _, t := range tags {
+		direct[t.CategoryID] = append(direct[t.CategoryID], t.ProductID)
+	}
+
+	for _, c := range cs {
+		prods := map[int]bool{}
+		for _, id := range cs.descendants(c.ID) {
+			for _, p := range direct[id] {
+				prods[p] = true
+			}
+		}
+
+		c.ProductCount = len(prods)
+	}
+}
+
+// GetCategories returns all categories ordered by id, with the number of products in
+// each category for faceted navigation
+func (p *ProductsDB) GetCategories(ctx context.Context) (Categories, error) {
+	cs, err := p.store.ListCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := p.store.ListTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cs.countProducts(tags)
+	return cs, nil
+}
+
+// GetCategoryByID returns the category with the given id and its number of products
+func (p *ProductsDB) GetCategoryByID(ctx context.Context, id int) (*Category, error) {
+	cs, err := p.GetCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c := cs.find(id)
+	if c == nil {
+		return nil, ErrCategoryNotFound
+	}
+
+	return c, nil
+}
+
+// AddCategory adds a new category to the store, the added category is returned
+func (p *ProductsDB) AddCategory(ctx context.Context, c Category) (*Category, error) {
+	err := p.store.CreateCategory(ctx, &c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// UpdateCategory renames or moves a category, the updated category is returned
+func (p *ProductsDB) UpdateCategory(ctx context.Context, c Category) (*Category, error) {
+	err := p.store.UpdateCategory(ctx, &c)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.GetCategoryByID(ctx, c.ID)
+}
+
+// DeleteCategory deletes a category without subcategories, the products tagged with
+// it are untagged
+func (p *ProductsDB) DeleteCategory(ctx context.Context, id int) error {
+	return p.store.DeleteCategory(ctx, id)
+}
+
+// TagProduct tags the product with the category
+func (p *ProductsDB) TagProduct(ctx context.Context, productID, categoryID int) error {
+	return p.store.TagProduct(ctx, productID, categoryID)
+}
+
+// UntagProduct removes the category from the product
+func (p *ProductsDB) UntagProduct(ctx context.Context, productID, categoryID int) error {
+	return p.store.UntagProduct(ctx, productID, categoryID)
+}
+
+// GetProductCategories returns the categories the product is tagged with
+func (p *ProductsDB) GetProductCategories(ctx context.Context, productID int) (Categories, error) {
+	_, err := p.store.Get(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	cs, err := p.GetCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := p.store.ListTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := Categories{}
+	for _, t := range tags {
+		if t.ProductID == productID {
+			res = append(res, cs.find(t.CategoryID))
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res, nil
+}
+
+// expandCategories replaces the categories of the options with the categories and
+// all their descendants, ErrCategoryNotFound is returned for an unknown category
+func (p *ProductsDB) expandCategories(ctx context.Context, opts *ListOptions) error {
+	if len(opts.Categories) == 0 {
+		return nil
+	}
+
+	cs, err := p.store.ListCategories(ctx)
+	if err != nil {
+		return err
+	}
+
+	ids := []int{}
+	for _, id := range opts.Categories {
+		if cs.find(id) == nil {
+			return fmt.Errorf("%w: %d", ErrCategoryNotFound, id)
+		}
+
+		ids = append(ids, cs.descendants(id)...)
+	}
+
+	opts.Categories = ids
+	return nil
+}
@@ -0,0 +1,71 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/d-vignesh/go-microservice-example/currency/client"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCategoriesCountProductsOfDescendants(t *testing.T) {
+	db := NewProductsDB(NewMemoryStore(ExampleProducts()), client.NewFake(), hclog.NewNullLogger())
+	ctx := context.Background()
+
+	coffee, err := db.AddCategory(ctx, Category{Name: "Coffee"})
+	assert.NoError(t, err)
+	espresso, err := db.AddCategory(ctx, Category{Name: "Espresso drinks", ParentID: coffee.ID})
+	assert.NoError(t, err)
+	milk, err := db.AddCategory(ctx, Category{Name: "Milk drinks", ParentID: espresso.ID})
+	assert.NoError(t, err)
+	tea, err := db.AddCategory(ctx, Category{Name: "Tea"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, db.TagProduct(ctx, 1, milk.ID))
+	assert.NoError(t, db.TagProduct(ctx, 1, coffee.ID))
+	assert.NoError(t, db.TagProduct(ctx, 2, espresso.ID))
+
+	// a product tagged with a category and one of its descendants is counted once
+	cs, err := db.GetCategories(ctx)
+	assert.NoError(t, err)
+
+	counts := map[string]int{}
+	for _, c := range cs {
+		counts[c.Name] = c.ProductCount
+	}
+	assert.Equal(t, map[string]int{"Coffee": 2, "Espresso drinks": 2, "Milk drinks": 1, "Tea": 0}, counts)
+
+	prods, _, err := db.GetProducts(ctx, "", ListOptions{Categories: []int{coffee.ID}})
+	assert.NoError(t, err)
+	assert.Len(t, prods, 2)
+
+	prods, _, err = db.GetProducts(ctx, "", ListOptions{Categories: []int{milk.ID, tea.ID}})
+	assert.NoError(t, err)
+	assert.Len(t, prods, 1)
+	assert.Equal(t, "Latte", prods[0].Name)
+
+	_, _, err = db.GetProducts(ctx, "", ListOptions{Categories: []int{99}})
+	assert.True(t, errors.Is(err, ErrCategoryNotFound))
+
+	pcs, err := db.GetProductCategories(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, pcs, 2)
+	assert.Equal(t, "Coffee", pcs[0].Name)
+	assert.Equal(t, "Milk drinks", pcs[1].Name)
+
+	// deleted products are not counted
+	assert.NoError(t, db.DeleteProduct(ctx, 1, 0))
+
+	c, err := db.GetCategoryByID(ctx, coffee.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, c.ProductCount)
+
+	c, err = db.UpdateCategory(ctx, Category{ID: milk.ID, Name: "Milk drinks", ParentID: tea.ID})
+	assert.NoError(t, err)
+	assert.Equal(t, tea.ID, c.ParentID)
+
+	_, err = db.GetCategoryByID(ctx, 99)
+	assert.Equal(t, ErrCategoryNotFound, err)
+}
@@ -0,0 +1,117 @@
+package data
+
+import (
+	"sync"
+)
+
+// EventType defines the kind of change an Event describes
+type EventType string
+
+const (
+	// EventRateChanged is published when the exchange rate of a currency changes
+	EventRateChanged EventType = "rate_changed"
+	// EventProductCreated is published when a product is added
+	EventProductCreated EventType = "product_created"
+	// EventProductUpdated is published when a product is changed
+	EventProductUpdated EventType = "product_updated"
+	// EventProductDeleted is published when a product is removed
+	EventProductDeleted EventType = "product_deleted"
+	// EventProductRestored is published when a deleted product is restored
+	EventProductRestored EventType = "product_restored"
+	// EventStockChanged is published when the stock of a product or a variant changes
+	EventStockChanged EventType = "stock_changed"
+	// EventLowStock is published when the available stock of a product or a variant
+	// drops to the low stock threshold
+	EventLowStock EventType = "low_stock"
+)
+
+// Event describes a change which affects the products returned to clients
+type Event struct {
+	// ID increases with every published event
+	ID        uint64
+	Type      EventType
+	Currency  string
+	ProductID int
+	// VariantSKU and Available describe the item of stock events
+	VariantSKU string
+	Available  int
+}
+
+// Events distributes events to subscribers and keeps a bounded history of recent
+// events so that subscribers can resume after a disconnect
+type Events struct {
+	mu      sync.Mutex
+	seq     uint64
+	history []Event
+	size    int
+	subs    map[chan Event]struct{}
+}
+
+// NewEvents creates an event broker which keeps the last size events for resuming subscribers
+func NewEvents(size int) *Events {
+	return &Events{size: size, subs: map[chan Event]struct{}{}}
+}
+
+// Publish assigns the next ID to the event and sends it to all subscribers, the channel
+// of a subscriber which is not keeping up is closed instead as it would miss the event
+func (e *Events) Publish(ev Event) Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.seq++
+	ev.ID = e.seq
+
+	e.history = append(e.history, ev)
+	if len(e.history) > e.size {
+		e.history = e.history[len(e.history)-e.size:]
+	}
+
+	for ch := range e.subs {
+		select {
+		case ch <- ev:
+		default:
+			close(ch)
+			delete(e.subs, ch)
+		}
+	}
+
+	return ev
+}
+
+// Subscribe returns a channel which receives all events published from now on and a
+// function which must be called to unsubscribe. The channel is closed when the subscriber
+// falls behind, it must subscribe again with the ID of the last event it received. When lastID is not zero the events published
+// after lastID are returned for replay, ok is false when those events are no longer kept
+// and the subscriber must start from the current state. The ID of the latest event is
+// returned so subscribers starting from the current state can report their position.
+func (e *Events) Subscribe(lastID uint64) (replay []Event, ok bool, latest uint64, ch <-chan Event, cancel func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	c := make(chan Event, 64)
+	e.subs[c] = struct{}{}
+
+	cancel = func() {
+		e.mu.Lock()
+		delete(e.subs, c)
+		e.mu.Unlock()
+	}
+
+	ok = lastID != 0 && lastID <= e.seq
+	if ok && lastID < e.seq {
+		// the oldest kept event must directly follow lastID otherwise events were dropped
+		if len(e.history) == 0 || e.history[0].ID > lastID+1 {
+			ok = false
+		}
+	}
+
+	if ok {
+		for _, ev := range e.history {
+			if ev.ID > lastID {
+				replay = append(replay, ev)
+			}
+		}
+	}
+
+	return replay, ok, e.seq, c, cancel
+}
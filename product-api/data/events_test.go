@@ -0,0 +1,77 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventsSubscribeReceivesPublishedEvents(t *testing.T) {
+	e := NewEvents(10)
+
+	_, ok, latest, ch, cancel := e.Subscribe(0)
+	defer cancel()
+
+	assert.False(t, ok)
+	assert.Equal(t, uint64(0), latest)
+
+	e.Publish(Event{Type: EventProductCreated, ProductID: 3})
+
+	ev := <-ch
+	assert.Equal(t, uint64(1), ev.ID)
+	assert.Equal(t, 3, ev.ProductID)
+}
+
+func TestEventsSubscribeReplaysMissedEvents(t *testing.T) {
+	e := NewEvents(10)
+	for i := 1; i <= 5; i++ {
+		e.Publish(Event{Type: EventProductUpdated, ProductID: i})
+	}
+
+	replay, ok, latest, _, cancel := e.Subscribe(3)
+	defer cancel()
+
+	assert.True(t, ok)
+	assert.Equal(t, uint64(5), latest)
+	assert.Len(t, replay, 2)
+	assert.Equal(t, 4, replay[0].ProductID)
+}
+
+func TestEventsSubscribeCanNotResumeExpiredEvents(t *testing.T) {
+	e := NewEvents(2)
+	for i := 1; i <= 5; i++ {
+		e.Publish(Event{Type: EventProductUpdated, ProductID: i})
+	}
+
+	_, ok, _, _, cancel := e.Subscribe(1)
+	defer cancel()
+
+	assert.False(t, ok)
+}
+
+func TestEventsCloseSubscribersWhichFallBehind(t *testing.T) {
+	e := NewEvents(100)
+
+	_, _, _, ch, cancel := e.Subscribe(0)
+	defer cancel()
+
+	for i := 1; i <= 65; i++ {
+		e.Publish(Event{Type: EventProductUpdated, ProductID: i})
+	}
+
+	// the buffered events are received before the channel is closed
+	var last uint64
+	for ev := range ch {
+		last = ev.ID
+	}
+	assert.Equal(t, uint64(64), last)
+
+	// the missed event is replayed after subscribing again
+	replay, ok, _, _, cancel := e.Subscribe(last)
+	defer cancel()
+
+	assert.True(t, ok)
+	if assert.Len(t, replay, 1) {
+		assert.Equal(t, 65, replay[0].ProductID)
+	}
+}
@@ -0,0 +1,283 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// types of the revisions of a product
+const (
+	// RevisionCreated is the revision of a created product
+	RevisionCreated = "created"
+	// RevisionUpdated is the revision of an updated product
+	RevisionUpdated = "updated"
+	// RevisionDeleted is the revision of a deleted product
+	RevisionDeleted = "deleted"
+	// RevisionRestored is the revision of a restored product
+	RevisionRestored = "restored"
+)
+
+// actors recorded when the context of a change does not name one
+const (
+	// AnonymousActor is recorded for changes whose context has no actor
+	AnonymousActor = "anonymous"
+	// SystemActor is recorded for the products which exist when the history starts,
+	// such as the products a store is created with
+	SystemActor = "system"
+)
+
+// Revision records a change of a product, revisions are never changed
+// swagger: model
+type Revision struct {
+	// id for the revision, later revisions have greater ids
+	//
+	// read only: true
+	ID int `json:"id"`
+
+	// id of the changed product
+	//
+	// read only: true
+	ProductID int `json:"productId"`
+
+	// the change made to the product
+	//
+	// read only: true
+	// enum: created,updated,deleted,restored
+	Type string `json:"type"`
+
+	// who made the change, taken from the X-Actor header of requests with the admin
+	// token, admin without the header and anonymous for requests without the token
+	//
+	// read only: true
+	Actor string `json:"actor"`
+
+	// time the change was made
+	//
+	// read only: true
+	RevisedOn time.Time `json:"revisedOn"`
+
+	// fields changed by the revision, in the order of their names
+	//
+	// read only: true
+	Changes []Change `json:"changes"`
+
+	// the product after the change
+	//
+	// read only: true
+	Product *Product `json:"product"`
+}
+
+// clone returns a copy of the revision which shares no memory with r
+func (r *Revision) clone() *Revision {
+	nr := *r
+	nr.Changes = append([]Change{}, r.Changes...)
+	nr.Product = r.Product.clone()
+	return &nr
+}
+
+// Change is the change of a single field of a product
+// swagger: model
+type Change struct {
+	// JSON name of the field
+	//
+	// read only: true
+	Field string `json:"field"`
+
+	// value of the field before the change, not set when the field had no value
+	//
+	// read only: true
+	Old json.RawMessage `json:"old,omitempty"`
+
+	// value of the field after the change, not set when the field has no value
+	//
+	// read only: true
+	New json.RawMessage `json:"new,omitempty"`
+}
+
+// actorKey is the context key of the actor of a change
+type actorKey struct{}
+
+// WithActor returns a copy of ctx which records actor as the author of the changes
+// made with it
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor of ctx or AnonymousActor when ctx has none
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	if actor == "" {
+		return AnonymousActor
+	}
+
+	return actor
+}
+
+// newRevision returns the revision of a change of type typ from old to p, old is nil
+// for created products. The revision is made at the time p was updated.
+func newRevision(ctx context.Context, typ string, old, p *Product) *Revision {
+	return &Revision{
+		ProductID: p.ID,
+		Type:      typ,
+		Actor:     ActorFromContext(ctx),
+		RevisedOn: p.UpdatedOn,
+		Changes:   diffProducts(old, p),
+		Product:   snapshot(p),
+	}
+}
+
+// snapshot returns a copy of the product without the fields which are only set in
+// responses
+func snapshot(p *Product) *Product {
+	np := p.clone()
+	np.Currency, np.PriceSource, np.Available = "", "", false
+
+	for i := range np.Variants {
+		np.Variants[i].Available = false
+	}
+
+	return np
+}
+
+// unrevisedFields are the fields of a product which are not compared between revisions,
+// as they change with every revision or are only set in responses
+var unrevisedFields = map[string]bool{
+	"id":        true,
+	"available": true,
+	"createdOn": true,
+	"updatedOn": true,
+	"version":   true,
+}
+
+// diffProducts returns the changes of the fields of the JSON representation of the
+// products ordered by field name, old is nil for created products
+func diffProducts(old, p *Product) []Change {
+	before, after := productFields(old), productFields(p)
+
+	names := []string{}
+	for n := range before {
+		names = append(names, n)
+	}
+	for n := range after {
+		if _, ok := before[n]; !ok {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	changes := []Change{}
+	for _, n := range names {
+		if unrevisedFields[n] || string(before[n]) == string(after[n]) {
+			continue
+		}
+
+		changes = append(changes, Change{Field: n, Old: before[n], New: after[n]})
+	}
+
+	return changes
+}
+
+// productFields returns the JSON encoded fields of the snapshot of the product by name,
+// fields without a value are left out
+func productFields(p *Product) map[string]json.RawMessage {
+	fields := map[string]json.RawMessage{}
+	if p == nil {
+		return fields
+	}
+
+	d, _ := json.Marshal(snapshot(p))
+	json.Unmarshal(d, &fields)
+
+	return fields
+}
+
+// GetHistory returns the revisions of the product ordered from the oldest to the latest,
+// the history of deleted and purged products is kept
+func (p *ProductsDB) GetHistory(ctx context.Context, productID int) ([]*Revision, error) {
+	return p.store.ListRevisions(ctx, productID)
+}
+
+// GetProductAsOf returns the product as it was at the given time, with the price in the
+// requested currency. The product is returned with its current availability and
+// converted with the current rates and native prices, as these are not revised.
+// ErrProductNotFound is returned when the product did not exist or was deleted at the time.
+func (p *ProductsDB) GetProductAsOf(ctx context.Context, id int, at time.Time, currency string) (*Product, error) {
+	revs, err := p.store.ListRevisions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var prod *Product
+	for _, r := range revs {
+		if r.RevisedOn.After(at) {
+			break
+		}
+
+		prod = r.Product
+	}
+
+	if prod == nil || prod.DeletedOn != nil {
+		return nil, ErrProductNotFound
+	}
+
+	rate := 1.0
+	if currency != "" {
+		rate, err = p.getRate(ctx, currency)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = p.setAvailability(ctx, prod)
+	if err != nil {
+		return nil, err
+	}
+
+	prods, err := p.priced(ctx, Products{prod}, currency, rate, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return prods[0], nil
+}
+
+// listAsOf returns the products selected by the options as they were at the time of
+// the AsOf option, the categories of the products are their current categories
+func (p *ProductsDB) listAsOf(ctx context.Context, opts ListOptions) (Products, error) {
+	revs, err := p.store.ListRevisionsAsOf(ctx, opts.AsOf)
+	if err != nil {
+		return nil, err
+	}
+
+	tagged := map[int]bool{}
+	if len(opts.Categories) > 0 {
+		tags, err := p.store.ListTags(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		categories := map[int]bool{}
+		for _, c := range opts.Categories {
+			categories[c] = true
+		}
+
+		for _, t := range tags {
+			if categories[t.CategoryID] {
+				tagged[t.ProductID] = true
+			}
+		}
+	}
+
+	prods := Products{}
+	for _, r := range revs {
+		if len(opts.Categories) > 0 && !tagged[r.ProductID] {
+			continue
+		}
+
+		prods = append(prods, r.Product)
+	}
+
+	return filterProducts(prods, opts)
+}
@@ -0,0 +1,86 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/d-vignesh/go-microservice-example/currency/client"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffProducts(t *testing.T) {
+	old := &Product{ID: 1, Name: "Latte", Price: 2.45, SKU: "lat-te-one", Available: true}
+	p := &Product{ID: 1, Name: "Latte", Description: "Milky", Price: 2.45, SKU: "lat-te-one", UpdatedOn: storeTime()}
+	p.Variants = []Variant{{Name: "Large", SKU: "lat-te-lrg", Price: 2.9, Available: true}}
+
+	assert.Equal(t, []Change{
+		{Field: "description", Old: json.RawMessage(`""`), New: json.RawMessage(`"Milky"`)},
+		{Field: "variants", New: json.RawMessage(`[{"name":"Large","sku":"lat-te-lrg","price":2.9,"available":false}]`)},
+	}, diffProducts(old, p))
+
+	assert.Empty(t, diffProducts(p, p))
+	assert.Len(t, diffProducts(nil, p), 5)
+}
+
+func TestProductsCanBeReadAsOfATime(t *testing.T) {
+	f := client.NewFake()
+	f.SetRate("USD", 2)
+
+	db := NewProductsDB(NewMemoryStore(ExampleProducts()), f, hclog.NewNullLogger())
+	ctx := WithActor(context.Background(), "alice")
+
+	time.Sleep(time.Millisecond)
+	before := storeTime()
+	time.Sleep(time.Millisecond)
+
+	p, err := db.GetProductByID(ctx, 1, "")
+	assert.NoError(t, err)
+	p.Price = 3
+	assert.NoError(t, db.UpdateProduct(ctx, p))
+	assert.NoError(t, db.DeleteProduct(ctx, 2, 0))
+	assert.NoError(t, db.AddProduct(ctx, Product{Name: "Mocha", Price: 3.2, SKU: "abc-def-ghi"}))
+
+	prods, _, err := db.GetProducts(ctx, "USD", ListOptions{AsOf: before})
+	assert.NoError(t, err)
+	if assert.Len(t, prods, 2) {
+		assert.Equal(t, "Latte", prods[0].Name)
+		assert.Equal(t, 4.9, prods[0].Price)
+		assert.Equal(t, "Espresso", prods[1].Name)
+	}
+
+	// the options apply to the products as they were
+	prods, next, err := db.GetProducts(ctx, "", ListOptions{AsOf: before, Sort: SortByPrice, Descending: true, Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, prods, 1)
+	assert.Equal(t, 2.45, prods[0].Price)
+	assert.NotEmpty(t, next)
+
+	prods, _, err = db.GetProducts(ctx, "", ListOptions{AsOf: storeTime()})
+	assert.NoError(t, err)
+	if assert.Len(t, prods, 2) {
+		assert.Equal(t, 3.0, prods[0].Price)
+		assert.Equal(t, "Mocha", prods[1].Name)
+	}
+
+	p, err = db.GetProductAsOf(ctx, 1, before, "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, 4.9, p.Price)
+	assert.Equal(t, PriceConverted, p.PriceSource)
+
+	_, err = db.GetProductAsOf(ctx, 2, storeTime(), "")
+	assert.True(t, errors.Is(err, ErrProductNotFound), "expected not found, got %v", err)
+
+	_, err = db.GetProductAsOf(ctx, 3, before, "")
+	assert.True(t, errors.Is(err, ErrProductNotFound), "expected not found, got %v", err)
+
+	revs, err := db.GetHistory(ctx, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, revs, 2) {
+		assert.Equal(t, "alice", revs[1].Actor)
+		assert.Equal(t, "price", revs[1].Changes[0].Field)
+	}
+}
@@ -0,0 +1,49 @@
+package data
+
+import (
+	"context"
+	"errors"
+)
+
+// actions taken for the rows of an import
+const (
+	// ImportCreated is the action of a row whose SKU is not used by a product
+	ImportCreated = "created"
+	// ImportUpdated is the action of a row which changes the product with its SKU
+	ImportUpdated = "updated"
+	// ImportUnchanged is the action of a row which is equal to the product with its SKU
+	ImportUnchanged = "unchanged"
+	// ImportFailed is the action of a row which could not be imported
+	ImportFailed = "failed"
+)
+
+// ImportProduct creates the product or, when a product with its SKU exists, replaces
+// that product with it. Products which would not be changed are not updated, so that
+// importing a catalogue again does not add revisions. With dryRun nothing is changed
+// and the action which would be taken is returned.
+func (p *ProductsDB) ImportProduct(ctx context.Context, pr Product, dryRun bool) (string, error) {
+	old, err := p.store.GetBySKU(ctx, pr.SKU)
+	if errors.Is(err, ErrProductNotFound) {
+		if dryRun {
+			return ImportCreated, nil
+		}
+
+		return ImportCreated, p.AddProduct(ctx, pr)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(diffProducts(old, &pr)) == 0 {
+		return ImportUnchanged, nil
+	}
+
+	if dryRun {
+		return ImportUpdated, nil
+	}
+
+	// the product is replaced at the version it was compared with
+	pr.ID, pr.Version = old.ID, old.Version
+	return ImportUpdated, p.UpdateProduct(ctx, &pr)
+}
@@ -0,0 +1,57 @@
+package data
+
+import (
+	"context"
+	"testing"
+
+	"github.com/d-vignesh/go-microservice-example/currency/client"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportProductUpsertsBySKU(t *testing.T) {
+	db := NewProductsDB(NewMemoryStore(ExampleProducts()), client.NewFake(), hclog.NewNullLogger())
+	ctx := context.Background()
+
+	latte, err := db.GetProductByID(ctx, 1, "")
+	assert.NoError(t, err)
+
+	mocha := Product{Name: "Mocha", Price: 3.2, SKU: "abc-def-ghi"}
+
+	// a dry run changes nothing
+	action, err := db.ImportProduct(ctx, mocha, true)
+	assert.NoError(t, err)
+	assert.Equal(t, ImportCreated, action)
+
+	prods, _, err := db.GetProducts(ctx, "", ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, prods, 2)
+
+	action, err = db.ImportProduct(ctx, mocha, false)
+	assert.NoError(t, err)
+	assert.Equal(t, ImportCreated, action)
+
+	// the product with the SKU is replaced, whatever its id and version
+	changed := Product{Name: "Latte", Description: "Frothy milky coffee", Price: 2.6, SKU: latte.SKU}
+	action, err = db.ImportProduct(ctx, changed, true)
+	assert.NoError(t, err)
+	assert.Equal(t, ImportUpdated, action)
+
+	action, err = db.ImportProduct(ctx, changed, false)
+	assert.NoError(t, err)
+	assert.Equal(t, ImportUpdated, action)
+
+	got, err := db.GetProductByID(ctx, 1, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 2.6, got.Price)
+	assert.Equal(t, 2, got.Version)
+
+	// importing the same product again does not add a revision
+	action, err = db.ImportProduct(ctx, changed, false)
+	assert.NoError(t, err)
+	assert.Equal(t, ImportUnchanged, action)
+
+	revs, err := db.GetHistory(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, revs, 2)
+}
@@ -0,0 +1,401 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrInsufficientStock is an error raised when an item does not have enough stock
+// for a reservation or a decrease of its stock
+var ErrInsufficientStock = fmt.Errorf("insufficient stock")
+
+// ErrInvalidStock is an error raised when a stock change or reservation names an item
+// which can not be stocked, such as an unknown variant, or has an invalid quantity
+var ErrInvalidStock = fmt.Errorf("invalid stock")
+
+// ErrReservationNotFound is an error raised when a reservation does not exist, has
+// expired or has already been committed or released
+var ErrReservationNotFound = fmt.Errorf("reservation not found")
+
+// DefaultReservationTTL is the time a reservation holds its stock when no time is requested
+const DefaultReservationTTL = 15 * time.Minute
+
+// MaxReservationTTL is the longest time a reservation can hold its stock
+const MaxReservationTTL = 24 * time.Hour
+
+// DefaultLowStockThreshold is the available stock at or below which an item is low on stock
+const DefaultLowStockThreshold = 5
+
+// StockLevel defines the stock of a product or of one of its variants
+// swagger: model
+type StockLevel struct {
+	// id of the product
+	//
+	// read only: true
+	ProductID int `json:"productId"`
+
+	// SKU of the variant, empty for products without variants
+	//
+	// read only: true
+	VariantSKU string `json:"variantSku,omitempty"`
+
+	// number of items in stock, including the reserved items
+	//
+	// read only: true
+	OnHand int `json:"onHand"`
+
+	// number of items held by reservations
+	//
+	// read only: true
+	Reserved int `json:"reserved"`
+
+	// number of items which can be reserved
+	//
+	// read only: true
+	Available int `json:"available"`
+
+	// true when the available stock is at or below the low stock threshold
+	//
+	// read only: true
+	LowStock bool `json:"lowStock"`
+}
+
+// StockLevels defines a slice of StockLevel
+type StockLevels []*StockLevel
+
+// StockAdjustment is a change of the stock on hand of a product or one of its variants
+// swagger: model
+type StockAdjustment struct {
+	// SKU of the variant, required for products with variants
+	//
+	// required: false
+	VariantSKU string `json:"variantSku,omitempty"`
+
+	// number of items added to the stock, negative to remove items
+	//
+	// required: true
+	Delta int `json:"delta" validate:"required"`
+}
+
+// StockItem is a quantity of a product or of one of its variants
+// swagger: model
+type StockItem struct {
+	// id of the product
+	//
+	// required: true
+	ProductID int `json:"productId" validate:"required"`
+
+	// SKU of the variant, required for products with variants
+	//
+	// required: false
+	VariantSKU string `json:"variantSku,omitempty"`
+
+	// number of items
+	//
+	// required: true
+	// min: 1
+	Quantity int `json:"quantity" validate:"gt=0"`
+}
+
+// Reservation holds stock for a customer until it is committed, released or expires
+// swagger: model
+type Reservation struct {
+	// id for the reservation
+	//
+	// read only: true
+	ID int `json:"id"`
+
+	// reserved items
+	//
+	// required: true
+	Items []StockItem `json:"items" validate:"required,min=1,dive"`
+
+	// time the reserved stock is released when the reservation is not committed
+	//
+	// read only: true
+	ExpiresOn time.Time `json:"expiresOn"`
+}
+
+// clone returns a copy of the reservation which shares no memory with r
+func (r *Reservation) clone() *Reservation {
+	nr := *r
+	nr.Items = append([]StockItem{}, r.Items...)
+	return &nr
+}
+
+// stockKey identifies the stock level of a product or a variant
+type stockKey struct {
+	productID  int
+	variantSKU string
+}
+
+// GetStock returns the stock levels of the product
+func (p *ProductsDB) GetStock(ctx context.Context, productID int) (StockLevels, error) {
+	_, err := p.store.Get(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	levels, err := p.store.ListStock(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, l := range levels {
+		l.LowStock = l.Available <= p.lowStock
+	}
+
+	return levels, nil
+}
+
+// AdjustStock adds delta, which is negative for a decrease, to the stock on hand of the
+// product or of its variant with the given SKU and returns the new stock level
+func (p *ProductsDB) AdjustStock(ctx context.Context, productID int, variantSKU string, delta int) (*StockLevel, error) {
+	if delta == 0 {
+		return nil, fmt.Errorf("%w: the stock must change", ErrInvalidStock)
+	}
+
+	prod, err := p.store.Get(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkStockItem(prod, variantSKU)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := p.store.AdjustStock(ctx, productID, variantSKU, delta)
+	if err != nil {
+		return nil, err
+	}
+
+	p.stockChanged(l, delta)
+	return l, nil
+}
+
+// ReserveStock reserves the items for the given time, a ttl of zero reserves them for
+// DefaultReservationTTL. Either all items are reserved or none.
+func (p *ProductsDB) ReserveStock(ctx context.Context, items []StockItem, ttl time.Duration) (*Reservation, error) {
+	if ttl == 0 {
+		ttl = DefaultReservationTTL
+	}
+
+	if ttl < 0 || ttl > MaxReservationTTL {
+		return nil, fmt.Errorf("%w: a reservation must expire within %s", ErrInvalidStock, MaxReservationTTL)
+	}
+
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%w: nothing to reserve", ErrInvalidStock)
+	}
+
+	// items for the same product or variant are merged, the items are reserved in
+	// order so that concurrent reservations lock the stock levels in the same order
+	quantities := map[stockKey]int{}
+	for _, it := range items {
+		if it.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: the quantity of product %d must be positive", ErrInvalidStock, it.ProductID)
+		}
+
+		prod, err := p.store.Get(ctx, it.ProductID)
+		if errors.Is(err, ErrProductNotFound) {
+			return nil, fmt.Errorf("%w: product %d not found", ErrInvalidStock, it.ProductID)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = checkStockItem(prod, it.VariantSKU)
+		if err != nil {
+			return nil, err
+		}
+
+		quantities[stockKey{it.ProductID, it.VariantSKU}] += it.Quantity
+	}
+
+	r := &Reservation{}
+	for k, q := range quantities {
+		r.Items = append(r.Items, StockItem{ProductID: k.productID, VariantSKU: k.variantSKU, Quantity: q})
+	}
+	sortStockItems(r.Items)
+
+	// release the expired reservations first so that their stock can be reserved
+	p.expireReservations(ctx)
+
+	r.ExpiresOn = storeTime().Add(ttl)
+	levels, err := p.store.Reserve(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, l := range levels {
+		p.stockChanged(l, -r.Items[i].Quantity)
+	}
+
+	return r, nil
+}
+
+// GetReservation returns the reservation with the given id
+func (p *ProductsDB) GetReservation(ctx context.Context, id int) (*Reservation, error) {
+	return p.store.GetReservation(ctx, id, storeTime())
+}
+
+// CommitReservation removes the reserved items from the stock, the reservation can
+// not be used afterwards
+func (p *ProductsDB) CommitReservation(ctx context.Context, id int) error {
+	r, err := p.store.CommitReservation(ctx, id, storeTime())
+	if err != nil {
+		return err
+	}
+
+	p.reservationEnded(r)
+	return nil
+}
+
+// ReleaseReservation makes the reserved items available again, the reservation can
+// not be used afterwards
+func (p *ProductsDB) ReleaseReservation(ctx context.Context, id int) error {
+	r, err := p.store.ReleaseReservation(ctx, id, storeTime())
+	if err != nil {
+		return err
+	}
+
+	p.reservationEnded(r)
+	return nil
+}
+
+// MonitorReservations releases the reservations which have expired, the store is
+// checked every interval
+func (p *ProductsDB) MonitorReservations(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		for range ticker.C {
+			p.expireReservations(context.Background())
+		}
+	}()
+}
+
+// SetLowStockThreshold sets the available stock at or below which an item is low on
+// stock, it must be called before the ProductsDB is used
+func (p *ProductsDB) SetLowStockThreshold(n int) {
+	p.lowStock = n
+}
+
+// expireReservations releases the expired reservations of the store
+func (p *ProductsDB) expireReservations(ctx context.Context) {
+	rs, err := p.store.ExpireReservations(ctx, storeTime())
+	if err != nil {
+		p.log.Error("unable to release expired reservations", "error", err)
+		return
+	}
+
+	for _, r := range rs {
+		p.reservationEnded(r)
+	}
+
+	if len(rs) > 0 {
+		p.log.Info("released expired reservations", "count", len(rs))
+	}
+}
+
+// reservationEnded publishes the stock changes of a committed or released reservation
+func (p *ProductsDB) reservationEnded(r *Reservation) {
+	for _, it := range r.Items {
+		p.events.Publish(Event{Type: EventStockChanged, ProductID: it.ProductID, VariantSKU: it.VariantSKU})
+	}
+}
+
+// stockChanged publishes the change of the available stock of an item by change and
+// reports the item when the change takes its available stock to the low stock threshold
+func (p *ProductsDB) stockChanged(l *StockLevel, change int) {
+	l.LowStock = l.Available <= p.lowStock
+	p.events.Publish(Event{Type: EventStockChanged, ProductID: l.ProductID, VariantSKU: l.VariantSKU})
+
+	if l.LowStock && l.Available-change > p.lowStock {
+		p.log.Warn("product is low on stock", "id", l.ProductID, "variant", l.VariantSKU, "available", l.Available)
+		p.events.Publish(Event{Type: EventLowStock, ProductID: l.ProductID, VariantSKU: l.VariantSKU, Available: l.Available})
+	}
+}
+
+// setAvailability sets whether the products and their variants are in stock, items
+// without a stock level are not tracked and always available
+func (p *ProductsDB) setAvailability(ctx context.Context, prods ...*Product) error {
+	if len(prods) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(prods))
+	for i, prod := range prods {
+		ids[i] = prod.ID
+	}
+
+	levels, err := p.store.ListStock(ctx, ids...)
+	if err != nil {
+		return err
+	}
+
+	available := map[stockKey]bool{}
+	for _, l := range levels {
+		available[stockKey{l.ProductID, l.VariantSKU}] = l.Available > 0
+	}
+
+	isAvailable := func(k stockKey) bool {
+		a, ok := available[k]
+		return !ok || a
+	}
+
+	for _, prod := range prods {
+		if len(prod.Variants) == 0 {
+			prod.Available = isAvailable(stockKey{prod.ID, ""})
+			continue
+		}
+
+		// a product with variants is available when one of its variants is
+		prod.Available = false
+		for i := range prod.Variants {
+			v := &prod.Variants[i]
+			v.Available = isAvailable(stockKey{prod.ID, v.SKU})
+			prod.Available = prod.Available || v.Available
+		}
+	}
+
+	return nil
+}
+
+// checkStockItem returns ErrInvalidStock when the product does not have a stock level
+// for the variant SKU, products with variants are stocked per variant
+func checkStockItem(prod *Product, variantSKU string) error {
+	if len(prod.Variants) == 0 {
+		if variantSKU != "" {
+			return fmt.Errorf("%w: product %d has no variants", ErrInvalidStock, prod.ID)
+		}
+
+		return nil
+	}
+
+	for _, v := range prod.Variants {
+		if v.SKU == variantSKU {
+			return nil
+		}
+	}
+
+	if variantSKU == "" {
+		return fmt.Errorf("%w: product %d is stocked per variant, a variant SKU is required", ErrInvalidStock, prod.ID)
+	}
+
+	return fmt.Errorf("%w: product %d has no variant %s", ErrInvalidStock, prod.ID, variantSKU)
+}
+
+// sortStockItems orders the items by product id and variant SKU
+func sortStockItems(items []StockItem) {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].ProductID != items[j].ProductID {
+			return items[i].ProductID < items[j].ProductID
+		}
+		return items[i].VariantSKU < items[j].VariantSKU
+	})
+}
@@ -0,0 +1,159 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/d-vignesh/go-microservice-example/currency/client"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProductsAreAvailableWhileInStock(t *testing.T) {
+	db := NewProductsDB(NewMemoryStore(ExampleProducts()), client.NewFake(), hclog.NewNullLogger())
+	ctx := context.Background()
+
+	// products without stock levels are not tracked
+	prods, _, err := db.GetProducts(ctx, "", ListOptions{})
+	assert.NoError(t, err)
+	assert.True(t, prods[0].Available)
+	assert.True(t, prods[1].Available)
+
+	_, err = db.AdjustStock(ctx, 1, "", 2)
+	assert.NoError(t, err)
+	_, err = db.AdjustStock(ctx, 2, "", 1)
+	assert.NoError(t, err)
+
+	r, err := db.ReserveStock(ctx, []StockItem{{ProductID: 2, Quantity: 1}}, 0)
+	assert.NoError(t, err)
+
+	prods, _, err = db.GetProducts(ctx, "", ListOptions{})
+	assert.NoError(t, err)
+	assert.True(t, prods[0].Available)
+	assert.False(t, prods[1].Available)
+
+	assert.NoError(t, db.ReleaseReservation(ctx, r.ID))
+
+	p, err := db.GetProductByID(ctx, 2, "")
+	assert.NoError(t, err)
+	assert.True(t, p.Available)
+}
+
+func TestProductsWithVariantsAreStockedPerVariant(t *testing.T) {
+	db := NewProductsDB(NewMemoryStore(nil), client.NewFake(), hclog.NewNullLogger())
+	ctx := context.Background()
+
+	assert.NoError(t, db.AddProduct(ctx, Product{
+		Name:     "Americano",
+		Price:    2.1,
+		SKU:      "ame-ric-ano",
+		Variants: []Variant{{Name: "Small", SKU: "ame-ric-sml", Price: 1.9}, {Name: "Large", SKU: "ame-ric-lrg", Price: 2.5}},
+	}))
+
+	_, err := db.AdjustStock(ctx, 1, "", 5)
+	assert.True(t, errors.Is(err, ErrInvalidStock), "expected invalid stock, got %v", err)
+	_, err = db.AdjustStock(ctx, 1, "ame-ric-med", 5)
+	assert.True(t, errors.Is(err, ErrInvalidStock), "expected invalid stock, got %v", err)
+
+	_, err = db.AdjustStock(ctx, 1, "ame-ric-sml", 0)
+	assert.True(t, errors.Is(err, ErrInvalidStock), "expected invalid stock, got %v", err)
+	_, err = db.AdjustStock(ctx, 1, "ame-ric-sml", 1)
+	assert.NoError(t, err)
+	_, err = db.AdjustStock(ctx, 1, "ame-ric-lrg", 1)
+	assert.NoError(t, err)
+
+	// items for the same variant are merged
+	_, err = db.ReserveStock(ctx, []StockItem{{ProductID: 1, VariantSKU: "ame-ric-lrg", Quantity: 1}, {ProductID: 1, VariantSKU: "ame-ric-lrg", Quantity: 1}}, 0)
+	assert.True(t, errors.Is(err, ErrInsufficientStock), "expected insufficient stock, got %v", err)
+
+	r, err := db.ReserveStock(ctx, []StockItem{{ProductID: 1, VariantSKU: "ame-ric-lrg", Quantity: 1}}, 0)
+	assert.NoError(t, err)
+
+	p, err := db.GetProductByID(ctx, 1, "")
+	assert.NoError(t, err)
+	assert.True(t, p.Available)
+	assert.True(t, p.Variants[0].Available)
+	assert.False(t, p.Variants[1].Available)
+
+	assert.NoError(t, db.CommitReservation(ctx, r.ID))
+	assert.True(t, errors.Is(db.CommitReservation(ctx, r.ID), ErrReservationNotFound))
+
+	levels, err := db.GetStock(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, StockLevels{
+		{ProductID: 1, VariantSKU: "ame-ric-lrg", OnHand: 0, Available: 0, LowStock: true},
+		{ProductID: 1, VariantSKU: "ame-ric-sml", OnHand: 1, Available: 1, LowStock: true},
+	}, levels)
+}
+
+func TestLowStockIsPublishedWhenCrossingTheThreshold(t *testing.T) {
+	db := NewProductsDB(NewMemoryStore(ExampleProducts()), client.NewFake(), hclog.NewNullLogger())
+	db.SetLowStockThreshold(3)
+	ctx := context.Background()
+
+	_, _, _, events, cancel := db.Events().Subscribe(0)
+	defer cancel()
+
+	lowStock := func() []Event {
+		evs := []Event{}
+		for {
+			select {
+			case ev := <-events:
+				if ev.Type == EventLowStock {
+					evs = append(evs, ev)
+				}
+			default:
+				return evs
+			}
+		}
+	}
+
+	_, err := db.AdjustStock(ctx, 1, "", 5)
+	assert.NoError(t, err)
+	assert.Empty(t, lowStock())
+
+	_, err = db.ReserveStock(ctx, []StockItem{{ProductID: 1, Quantity: 2}}, 0)
+	assert.NoError(t, err)
+
+	evs := lowStock()
+	if assert.Len(t, evs, 1) {
+		assert.Equal(t, 1, evs[0].ProductID)
+		assert.Equal(t, 3, evs[0].Available)
+	}
+
+	// the item is only reported again after it has been restocked
+	_, err = db.AdjustStock(ctx, 1, "", -1)
+	assert.NoError(t, err)
+	assert.Empty(t, lowStock())
+
+	_, err = db.AdjustStock(ctx, 1, "", 10)
+	assert.NoError(t, err)
+	_, err = db.AdjustStock(ctx, 1, "", -10)
+	assert.NoError(t, err)
+	assert.Len(t, lowStock(), 1)
+}
+
+func TestExpiredReservationsReleaseTheirStock(t *testing.T) {
+	db := NewProductsDB(NewMemoryStore(ExampleProducts()), client.NewFake(), hclog.NewNullLogger())
+	ctx := context.Background()
+
+	_, err := db.AdjustStock(ctx, 1, "", 1)
+	assert.NoError(t, err)
+
+	_, err = db.ReserveStock(ctx, []StockItem{{ProductID: 1, Quantity: 1}}, MaxReservationTTL+time.Second)
+	assert.True(t, errors.Is(err, ErrInvalidStock), "expected invalid stock, got %v", err)
+
+	_, err = db.ReserveStock(ctx, []StockItem{{ProductID: 1, Quantity: 1}}, time.Millisecond)
+	assert.NoError(t, err)
+
+	time.Sleep(2 * time.Millisecond)
+
+	// the expired reservation is released before reserving
+	r, err := db.ReserveStock(ctx, []StockItem{{ProductID: 1, Quantity: 1}}, 0)
+	assert.NoError(t, err)
+
+	_, err = db.GetReservation(ctx, r.ID)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,281 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidListOptions is returned when the options of a product listing are not valid
+var ErrInvalidListOptions = fmt.Errorf("invalid list options")
+
+// MaxListLimit is the largest number of products returned in a single page
+const MaxListLimit = 100
+
+// SortField defines the order products are listed in
+type SortField string
+
+const (
+	// SortByID orders products by id, the default
+	SortByID SortField = "id"
+	// SortByName orders products by name
+	SortByName SortField = "name"
+	// SortByPrice orders products by price
+	SortByPrice SortField = "price"
+	// SortByCreated orders products by the time they were created
+	SortByCreated SortField = "created"
+	// SortBySKU orders products by SKU
+	SortBySKU SortField = "sku"
+)
+
+// ListOptions controls which products are returned by List
+type ListOptions struct {
+	// IncludeDeleted returns the soft deleted products as well
+	IncludeDeleted bool
+
+	// Sort is the field the products are ordered by, products with the same value
+	// are ordered by id
+	Sort SortField
+	// Descending reverses the order
+	Descending bool
+
+	// NamePrefix only returns the products whose name starts with the prefix,
+	// ignoring case
+	NamePrefix string
+	// MinPrice and MaxPrice only return the products within the price range, zero
+	// does not limit the price. Stores compare the prices in the base currency, so
+	// native prices are not used by the range or by sorting by price.
+	MinPrice float64
+	MaxPrice float64
+
+	// Categories only returns the products tagged with any of the categories, the
+	// ProductsDB adds the descendants of the categories before listing the store
+	Categories []int
+
+	// Limit is the maximum number of products returned, zero returns all products
+	Limit int
+	// Cursor returns the products following the product the cursor was created for,
+	// the cursor must have been created with the same order
+	Cursor string
+
+	// AsOf returns the products as they were at the time, zero returns the current
+	// products. The ProductsDB lists the revisions of the products instead of the store.
+	AsOf time.Time
+}
+
+// validate checks the options and applies the default order
+func (o *ListOptions) validate() error {
+	if o.Sort == "" {
+		o.Sort = SortByID
+	}
+
+	switch o.Sort {
+	case SortByID, SortByName, SortByPrice, SortByCreated, SortBySKU:
+	default:
+		return fmt.Errorf("%w: unknown sort field %q", ErrInvalidListOptions, o.Sort)
+	}
+
+	if o.MinPrice < 0 || o.MaxPrice < 0 {
+		return fmt.Errorf("%w: prices can not be negative", ErrInvalidListOptions)
+	}
+
+	if o.MaxPrice > 0 && o.MinPrice > o.MaxPrice {
+		return fmt.Errorf("%w: min price is greater than max price", ErrInvalidListOptions)
+	}
+
+	if o.Limit < 0 {
+		return fmt.Errorf("%w: limit can not be negative", ErrInvalidListOptions)
+	}
+
+	_, err := o.cursor()
+	return err
+}
+
+// cursor is the position of a product in a listing, it holds the value of the sort
+// field and the id of the product
+type cursor struct {
+	Sort       SortField `json:"s"`
+	Descending bool      `json:"d,omitempty"`
+	Value      string    `json:"v"`
+	ID         int       `json:"id"`
+}
+
+// newCursor returns the encoded cursor for the position of p in a listing with the options
+func newCursor(o ListOptions, p *Product) string {
+	c := cursor{Sort: o.Sort, Descending: o.Descending, ID: p.ID}
+
+	switch o.Sort {
+	case SortByName:
+		c.Value = p.Name
+	case SortByPrice:
+		c.Value = strconv.FormatFloat(p.Price, 'g', -1, 64)
+	case SortByCreated:
+		c.Value = p.CreatedOn.UTC().Format(time.RFC3339Nano)
+	case SortBySKU:
+		c.Value = p.SKU
+	}
+
+	d, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(d)
+}
+
+// cursor decodes the cursor of the options, nil is returned when no cursor is set
+func (o ListOptions) cursor() (*cursor, error) {
+	if o.Cursor == "" {
+		return nil, nil
+	}
+
+	d, err := base64.RawURLEncoding.DecodeString(o.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+	}
+
+	c := &cursor{}
+	err = json.Unmarshal(d, c)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+	}
+
+	sort := o.Sort
+	if sort == "" {
+		sort = SortByID
+	}
+
+	if c.Sort != sort || c.Descending != o.Descending {
+		return nil, fmt.Errorf("%w: cursor was created for a different order", ErrInvalidListOptions)
+	}
+
+	_, err = c.sortValue()
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+	}
+
+	return c, nil
+}
+
+// sortValue returns the value of the sort field of the cursor in its Go type,
+// int for id, string for name and sku, float64 for price and time.Time for created
+func (c *cursor) sortValue() (interface{}, error) {
+	switch c.Sort {
+	case SortByID:
+		return c.ID, nil
+	case SortByPrice:
+		return strconv.ParseFloat(c.Value, 64)
+	case SortByCreated:
+		return time.Parse(time.RFC3339Nano, c.Value)
+	}
+
+	return c.Value, nil
+}
+
+// compareProducts orders a before b for the sort field, returning a negative number
+// when a comes first, products with the same value are ordered by id
+func compareProducts(sort SortField, a, b *Product) int {
+	c := 0
+
+	switch sort {
+	case SortByName:
+		c = strings.Compare(a.Name, b.Name)
+	case SortByPrice:
+		c = compareFloat(a.Price, b.Price)
+	case SortByCreated:
+		switch {
+		case a.CreatedOn.Before(b.CreatedOn):
+			c = -1
+		case a.CreatedOn.After(b.CreatedOn):
+			c = 1
+		}
+	case SortBySKU:
+		c = strings.Compare(a.SKU, b.SKU)
+	}
+
+	if c != 0 {
+		return c
+	}
+
+	return a.ID - b.ID
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
+
+// filterProducts applies the options to the products in memory
+func filterProducts(prods Products, o ListOptions) (Products, error) {
+	err := o.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	c, _ := o.cursor()
+
+	// the cursor is the position of a product which may have been deleted since, it
+	// is compared to the products as a product with the values of the cursor
+	var after *Product
+	if c != nil {
+		after = &Product{ID: c.ID}
+		v, _ := c.sortValue()
+
+		switch c.Sort {
+		case SortByName:
+			after.Name = v.(string)
+		case SortByPrice:
+			after.Price = v.(float64)
+		case SortByCreated:
+			after.CreatedOn = v.(time.Time)
+		case SortBySKU:
+			after.SKU = v.(string)
+		}
+	}
+
+	prefix := strings.ToLower(o.NamePrefix)
+
+	res := Products{}
+	for _, p := range prods {
+		if p.DeletedOn != nil && !o.IncludeDeleted {
+			continue
+		}
+
+		if prefix != "" && !strings.HasPrefix(strings.ToLower(p.Name), prefix) {
+			continue
+		}
+
+		if (o.MinPrice > 0 && p.Price < o.MinPrice) || (o.MaxPrice > 0 && p.Price > o.MaxPrice) {
+			continue
+		}
+
+		if after != nil {
+			c := compareProducts(o.Sort, p, after)
+			if (!o.Descending && c <= 0) || (o.Descending && c >= 0) {
+				continue
+			}
+		}
+
+		res = append(res, p)
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		c := compareProducts(o.Sort, res[i], res[j])
+		if o.Descending {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	if o.Limit > 0 && len(res) > o.Limit {
+		res = res[:o.Limit]
+	}
+
+	return res, nil
+}
@@ -0,0 +1,839 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a ProductStore which keeps the products in memory, it is safe for
+// concurrent use. Products are copied when they are stored and when they are returned
+// so callers can not change the stored products.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	products Products
+	// nextID is the id given to the next product, ids are never reused
+	nextID int
+
+	categories     Categories
+	nextCategoryID int
+	// tags holds the ids of the categories of each product by product id
+	tags map[int]map[int]bool
+
+	stock             map[stockKey]*StockLevel
+	reservations      map[int]*Reservation
+	nextReservationID int
+
+	// prices holds the explicit prices of each product by product id and currency
+	prices map[int]map[string]float64
+
+	revisions      []*Revision
+	nextRevisionID int
+}
+
+// NewMemoryStore creates a MemoryStore containing the given products, their history
+// starts with a revision by SystemActor
+func NewMemoryStore(prods Products) *MemoryStore {
+	m := &MemoryStore{
+		nextID:            1,
+		nextCategoryID:    1,
+		tags:              map[int]map[int]bool{},
+		stock:             map[stockKey]*StockLevel{},
+		reservations:      map[int]*Reservation{},
+		nextReservationID: 1,
+		prices:            map[int]map[string]float64{},
+		nextRevisionID:    1,
+	}
+
+	ctx := WithActor(context.Background(), SystemActor)
+	for _, p := range prods {
+		np := p.clone()
+		if np.Version == 0 {
+			np.Version = 1
+		}
+		m.products = append(m.products, np)
+
+		typ := RevisionCreated
+		if p.DeletedOn != nil {
+			typ = RevisionDeleted
+		}
+		m.record(newRevision(ctx, typ, nil, np))
+
+		if p.ID >= m.nextID {
+			m.nextID = p.ID + 1
+		}
+	}
+
+	return m
+}
+
+// List returns the products selected by the options
+func (m *MemoryStore) List(ctx context.Context, opts ListOptions) (Products, error) {
+	m.mu.RLock()
+	prods := m.products
+	if len(opts.Categories) > 0 {
+		prods = m.tagged(opts.Categories)
+	}
+
+	prods, err := filterProducts(prods, opts)
+	m.mu.RUnlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(Products, 0, len(prods))
+	for _, p := range prods {
+		res = append(res, p.clone())
+	}
+
+	return res, nil
+}
+
+// Get returns the product with the given id
+func (m *MemoryStore) Get(ctx context.Context, id int) (*Product, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i := m.findIndexByProductID(id)
+	if i == -1 || m.products[i].DeletedOn != nil {
+		return nil, ErrProductNotFound
+	}
+
+	return m.products[i].clone(), nil
+}
+
+// GetBySKU returns the product with the given SKU
+func (m *MemoryStore) GetBySKU(ctx context.Context, sku string) (*Product, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, p := range m.products {
+		if p.SKU == sku && p.DeletedOn == nil {
+			return p.clone(), nil
+		}
+	}
+
+	return nil, ErrProductNotFound
+}
+
+// Create adds the product with the next id in sequence
+func (m *MemoryStore) Create(ctx context.Context, p *Product) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.skuUsed(p.SKU, 0) {
+		return ErrProductConflict
+	}
+
+	m.add(p)
+	m.record(newRevision(ctx, RevisionCreated, nil, p))
+	return nil
+}
+
+// CreateMany adds the products with the next ids in sequence
+func (m *MemoryStore) CreateMany(ctx context.Context, prods Products) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// check all products first so that either all or none are added
+	skus := map[string]bool{}
+	for _, p := range prods {
+		if skus[p.SKU] || m.skuUsed(p.SKU, 0) {
+			return ErrProductConflict
+		}
+		skus[p.SKU] = true
+	}
+
+	for _, p := range prods {
+		m.add(p)
+		m.record(newRevision(ctx, RevisionCreated, nil, p))
+	}
+
+	return nil
+}
+
+// Update replaces the product with the id of p
+func (m *MemoryStore) Update(ctx context.Context, p *Product) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.findIndexByProductID(p.ID)
+	if i == -1 || m.products[i].DeletedOn != nil {
+		return ErrProductNotFound
+	}
+
+	if p.Version != 0 && p.Version != m.products[i].Version {
+		return ErrVersionMismatch
+	}
+
+	if m.skuUsed(p.SKU, p.ID) {
+		return ErrProductConflict
+	}
+
+	p.CreatedOn = m.products[i].CreatedOn
+	p.UpdatedOn = storeTime()
+	p.DeletedOn = nil
+	p.Version = m.products[i].Version + 1
+
+	m.record(newRevision(ctx, RevisionUpdated, m.products[i], p))
+	m.products[i] = p.clone()
+	return nil
+}
+
+// Delete soft deletes the product with the given id
+func (m *MemoryStore) Delete(ctx context.Context, id, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.findIndexByProductID(id)
+	if i == -1 || m.products[i].DeletedOn != nil {
+		return ErrProductNotFound
+	}
+
+	if version != 0 && version != m.products[i].Version {
+		return ErrVersionMismatch
+	}
+
+	// stored products are replaced rather than changed as copies may be read concurrently
+	now := storeTime()
+	np := m.products[i].clone()
+	np.UpdatedOn = now
+	np.DeletedOn = &now
+	np.Version++
+
+	m.record(newRevision(ctx, RevisionDeleted, m.products[i], np))
+	m.products[i] = np
+
+	return nil
+}
+
+// Restore undoes the soft delete of the product with the given id
+func (m *MemoryStore) Restore(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.findIndexByProductID(id)
+	if i == -1 || m.products[i].DeletedOn == nil {
+		return ErrProductNotFound
+	}
+
+	if m.skuUsed(m.products[i].SKU, id) {
+		return ErrProductConflict
+	}
+
+	np := m.products[i].clone()
+	np.UpdatedOn = storeTime()
+	np.DeletedOn = nil
+	np.Version++
+
+	m.record(newRevision(ctx, RevisionRestored, m.products[i], np))
+	m.products[i] = np
+
+	return nil
+}
+
+// Purge removes the products deleted before the given time
+func (m *MemoryStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// build a new slice rather than shifting the elements of the existing one
+	prods := make(Products, 0, len(m.products))
+	for _, p := range m.products {
+		if p.DeletedOn == nil || !p.DeletedOn.Before(before) {
+			prods = append(prods, p)
+			continue
+		}
+
+		delete(m.tags, p.ID)
+		delete(m.prices, p.ID)
+		for k := range m.stock {
+			if k.productID == p.ID {
+				delete(m.stock, k)
+			}
+		}
+	}
+
+	n := len(m.products) - len(prods)
+	m.products = prods
+
+	return n, nil
+}
+
+// ListCategories returns all categories ordered by id
+func (m *MemoryStore) ListCategories(ctx context.Context) (Categories, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	res := make(Categories, 0, len(m.categories))
+	for _, c := range m.categories {
+		nc := *c
+		res = append(res, &nc)
+	}
+
+	return res, nil
+}
+
+// GetCategory returns the category with the given id
+func (m *MemoryStore) GetCategory(ctx context.Context, id int) (*Category, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c := m.categories.find(id)
+	if c == nil {
+		return nil, ErrCategoryNotFound
+	}
+
+	nc := *c
+	return &nc, nil
+}
+
+// CreateCategory adds the category with the next id in sequence
+func (m *MemoryStore) CreateCategory(ctx context.Context, c *Category) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err := m.checkCategory(c, 0)
+	if err != nil {
+		return err
+	}
+
+	c.ID = m.nextCategoryID
+	m.nextCategoryID++
+
+	nc := *c
+	m.categories = append(m.categories, &nc)
+	return nil
+}
+
+// UpdateCategory replaces the category with the id of c
+func (m *MemoryStore) UpdateCategory(ctx context.Context, c *Category) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, old := range m.categories {
+		if old.ID != c.ID {
+			continue
+		}
+
+		err := m.checkCategory(c, c.ID)
+		if err != nil {
+			return err
+		}
+
+		nc := *c
+		m.categories[i] = &nc
+		return nil
+	}
+
+	return ErrCategoryNotFound
+}
+
+// DeleteCategory removes the category with the given id and its tags
+func (m *MemoryStore) DeleteCategory(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cs := make(Categories, 0, len(m.categories))
+	for _, c := range m.categories {
+		if c.ParentID == id {
+			return fmt.Errorf("%w: the category has subcategories", ErrCategoryConflict)
+		}
+
+		if c.ID != id {
+			cs = append(cs, c)
+		}
+	}
+
+	if len(cs) == len(m.categories) {
+		return ErrCategoryNotFound
+	}
+
+	m.categories = cs
+	for _, tags := range m.tags {
+		delete(tags, id)
+	}
+
+	return nil
+}
+
+// TagProduct tags the product with the category
+func (m *MemoryStore) TagProduct(ctx context.Context, productID, categoryID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err := m.checkTag(productID, categoryID)
+	if err != nil {
+		return err
+	}
+
+	if m.tags[productID] == nil {
+		m.tags[productID] = map[int]bool{}
+	}
+	m.tags[productID][categoryID] = true
+
+	return nil
+}
+
+// UntagProduct removes the tag of the product
+func (m *MemoryStore) UntagProduct(ctx context.Context, productID, categoryID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err := m.checkTag(productID, categoryID)
+	if err != nil {
+		return err
+	}
+
+	delete(m.tags[productID], categoryID)
+	return nil
+}
+
+// ListTags returns the tags of the products which are not deleted
+func (m *MemoryStore) ListTags(ctx context.Context) ([]Tag, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tags := []Tag{}
+	for _, p := range m.products {
+		if p.DeletedOn != nil {
+			continue
+		}
+
+		for c := range m.tags[p.ID] {
+			tags = append(tags, Tag{ProductID: p.ID, CategoryID: c})
+		}
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].ProductID != tags[j].ProductID {
+			return tags[i].ProductID < tags[j].ProductID
+		}
+		return tags[i].CategoryID < tags[j].CategoryID
+	})
+
+	return tags, nil
+}
+
+// ListStock returns the stock levels of the given products which are not deleted
+func (m *MemoryStore) ListStock(ctx context.Context, productIDs ...int) (StockLevels, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	include := idSet(productIDs)
+
+	levels := StockLevels{}
+	for _, l := range m.stock {
+		if !include(l.ProductID) {
+			continue
+		}
+
+		i := m.findIndexByProductID(l.ProductID)
+		if i != -1 && m.products[i].DeletedOn == nil {
+			nl := *l
+			levels = append(levels, &nl)
+		}
+	}
+
+	sort.Slice(levels, func(i, j int) bool {
+		if levels[i].ProductID != levels[j].ProductID {
+			return levels[i].ProductID < levels[j].ProductID
+		}
+		return levels[i].VariantSKU < levels[j].VariantSKU
+	})
+
+	return levels, nil
+}
+
+// AdjustStock adds delta to the stock on hand of the item
+func (m *MemoryStore) AdjustStock(ctx context.Context, productID int, variantSKU string, delta int) (*StockLevel, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.findIndexByProductID(productID)
+	if i == -1 || m.products[i].DeletedOn != nil {
+		return nil, ErrProductNotFound
+	}
+
+	k := stockKey{productID, variantSKU}
+	l, ok := m.stock[k]
+	if !ok {
+		l = &StockLevel{ProductID: productID, VariantSKU: variantSKU}
+	}
+
+	if l.OnHand+delta < l.Reserved {
+		return nil, fmt.Errorf("%w: %d of %d items are reserved", ErrInsufficientStock, l.Reserved, l.OnHand)
+	}
+
+	l.OnHand += delta
+	l.Available = l.OnHand - l.Reserved
+	m.stock[k] = l
+
+	nl := *l
+	return &nl, nil
+}
+
+// Reserve reserves the stock of the items of the reservation
+func (m *MemoryStore) Reserve(ctx context.Context, r *Reservation) (StockLevels, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// check all items first so that either all or none are reserved
+	for _, it := range r.Items {
+		l, ok := m.stock[stockKey{it.ProductID, it.VariantSKU}]
+		if !ok {
+			return nil, fmt.Errorf("%w: product %d %s is not stocked", ErrInvalidStock, it.ProductID, it.VariantSKU)
+		}
+
+		if l.Available < it.Quantity {
+			return nil, fmt.Errorf("%w: %d of product %d %s available", ErrInsufficientStock, l.Available, it.ProductID, it.VariantSKU)
+		}
+	}
+
+	levels := StockLevels{}
+	for _, it := range r.Items {
+		l := m.stock[stockKey{it.ProductID, it.VariantSKU}]
+		l.Reserved += it.Quantity
+		l.Available = l.OnHand - l.Reserved
+
+		nl := *l
+		levels = append(levels, &nl)
+	}
+
+	r.ID = m.nextReservationID
+	m.nextReservationID++
+	m.reservations[r.ID] = r.clone()
+
+	return levels, nil
+}
+
+// GetReservation returns the reservation with the given id which has not expired
+func (m *MemoryStore) GetReservation(ctx context.Context, id int, now time.Time) (*Reservation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	r, ok := m.reservations[id]
+	if !ok || !r.ExpiresOn.After(now) {
+		return nil, ErrReservationNotFound
+	}
+
+	return r.clone(), nil
+}
+
+// CommitReservation removes the reserved items from the stock on hand
+func (m *MemoryStore) CommitReservation(ctx context.Context, id int, now time.Time) (*Reservation, error) {
+	return m.endReservation(id, now, true)
+}
+
+// ReleaseReservation makes the reserved items available again
+func (m *MemoryStore) ReleaseReservation(ctx context.Context, id int, now time.Time) (*Reservation, error) {
+	return m.endReservation(id, now, false)
+}
+
+// ExpireReservations releases the reservations which expired at or before the given time
+func (m *MemoryStore) ExpireReservations(ctx context.Context, before time.Time) ([]*Reservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rs := []*Reservation{}
+	for id, r := range m.reservations {
+		if r.ExpiresOn.After(before) {
+			continue
+		}
+
+		m.unreserve(r, false)
+		delete(m.reservations, id)
+		rs = append(rs, r)
+	}
+
+	sort.Slice(rs, func(i, j int) bool { return rs[i].ID < rs[j].ID })
+	return rs, nil
+}
+
+// endReservation commits or releases the reservation with the given id
+func (m *MemoryStore) endReservation(id int, now time.Time, commit bool) (*Reservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.reservations[id]
+	if !ok || !r.ExpiresOn.After(now) {
+		return nil, ErrReservationNotFound
+	}
+
+	m.unreserve(r, commit)
+	delete(m.reservations, id)
+
+	return r, nil
+}
+
+// unreserve removes the reserved items of r from the reserved stock, and from the stock
+// on hand when the reservation is committed. Must be called with the lock held.
+func (m *MemoryStore) unreserve(r *Reservation, commit bool) {
+	for _, it := range r.Items {
+		// the stock of purged products is removed
+		l, ok := m.stock[stockKey{it.ProductID, it.VariantSKU}]
+		if !ok {
+			continue
+		}
+
+		l.Reserved -= it.Quantity
+		if commit {
+			l.OnHand -= it.Quantity
+		}
+		l.Available = l.OnHand - l.Reserved
+	}
+}
+
+// ListPrices returns the prices of the given products which are not deleted
+func (m *MemoryStore) ListPrices(ctx context.Context, productIDs ...int) ([]Price, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	include := idSet(productIDs)
+
+	prices := []Price{}
+	for _, p := range m.products {
+		if p.DeletedOn != nil || !include(p.ID) {
+			continue
+		}
+
+		for c, price := range m.prices[p.ID] {
+			prices = append(prices, Price{ProductID: p.ID, Currency: c, Price: price})
+		}
+	}
+
+	sort.Slice(prices, func(i, j int) bool {
+		if prices[i].ProductID != prices[j].ProductID {
+			return prices[i].ProductID < prices[j].ProductID
+		}
+		return prices[i].Currency < prices[j].Currency
+	})
+
+	return prices, nil
+}
+
+// SetPrice sets the price of the product in the currency
+func (m *MemoryStore) SetPrice(ctx context.Context, productID int, currency string, price float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.findIndexByProductID(productID)
+	if i == -1 || m.products[i].DeletedOn != nil {
+		return ErrProductNotFound
+	}
+
+	if m.prices[productID] == nil {
+		m.prices[productID] = map[string]float64{}
+	}
+	m.prices[productID][currency] = price
+
+	return nil
+}
+
+// DeletePrice removes the price of the product in the currency
+func (m *MemoryStore) DeletePrice(ctx context.Context, productID int, currency string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.findIndexByProductID(productID)
+	if i == -1 || m.products[i].DeletedOn != nil {
+		return ErrProductNotFound
+	}
+
+	if _, ok := m.prices[productID][currency]; !ok {
+		return ErrPriceNotFound
+	}
+
+	delete(m.prices[productID], currency)
+	return nil
+}
+
+// ListRevisions returns the revisions of the product ordered by id
+func (m *MemoryStore) ListRevisions(ctx context.Context, productID int) ([]*Revision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	revs := []*Revision{}
+	for _, r := range m.revisions {
+		if r.ProductID == productID {
+			revs = append(revs, r.clone())
+		}
+	}
+
+	if len(revs) == 0 {
+		return nil, ErrProductNotFound
+	}
+
+	return revs, nil
+}
+
+// ListRevisionsAsOf returns the latest revision of every product made at or before
+// the given time
+func (m *MemoryStore) ListRevisionsAsOf(ctx context.Context, at time.Time) ([]*Revision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// revisions are kept in the order they were made
+	latest := map[int]*Revision{}
+	for _, r := range m.revisions {
+		if !r.RevisedOn.After(at) {
+			latest[r.ProductID] = r
+		}
+	}
+
+	revs := make([]*Revision, 0, len(latest))
+	for _, r := range latest {
+		revs = append(revs, r.clone())
+	}
+
+	sort.Slice(revs, func(i, j int) bool {
+		return revs[i].ProductID < revs[j].ProductID
+	})
+
+	return revs, nil
+}
+
+// checkCategory checks that the parent of c exists and is not c or one of its
+// descendants, and that the name is not used by another category with the same parent.
+// id is the id of c when it is updated. Must be called with the lock held.
+func (m *MemoryStore) checkCategory(c *Category, id int) error {
+	for p := c.ParentID; p != 0; {
+		if p == id {
+			return fmt.Errorf("%w: a category can not be moved below itself", ErrInvalidCategory)
+		}
+
+		parent := m.categories.find(p)
+		if parent == nil {
+			return fmt.Errorf("%w: parent category %d not found", ErrInvalidCategory, p)
+		}
+
+		p = parent.ParentID
+	}
+
+	for _, o := range m.categories {
+		if o.ID != id && o.ParentID == c.ParentID && o.Name == c.Name {
+			return fmt.Errorf("%w: a category with the same name already exists in the parent", ErrCategoryConflict)
+		}
+	}
+
+	return nil
+}
+
+// checkTag checks that the product and the category of a tag exist, must be called
+// with the lock held
+func (m *MemoryStore) checkTag(productID, categoryID int) error {
+	i := m.findIndexByProductID(productID)
+	if i == -1 || m.products[i].DeletedOn != nil {
+		return ErrProductNotFound
+	}
+
+	if m.categories.find(categoryID) == nil {
+		return ErrCategoryNotFound
+	}
+
+	return nil
+}
+
+// tagged returns the products tagged with any of the categories, must be called
+// with the lock held
+func (m *MemoryStore) tagged(categories []int) Products {
+	prods := Products{}
+	for _, p := range m.products {
+		for _, c := range categories {
+			if m.tags[p.ID][c] {
+				prods = append(prods, p)
+				break
+			}
+		}
+	}
+
+	return prods
+}
+
+// add stores a copy of the product with the next id and sets the id and timestamps
+// of p, must be called with the lock held
+func (m *MemoryStore) add(p *Product) {
+	p.ID = m.nextID
+	m.nextID++
+
+	p.CreatedOn = storeTime()
+	p.UpdatedOn = p.CreatedOn
+	p.DeletedOn = nil
+	p.Version = 1
+
+	m.products = append(m.products, p.clone())
+}
+
+// record stores the revision with the next id in sequence, must be called with the
+// lock held
+func (m *MemoryStore) record(r *Revision) {
+	r.ID = m.nextRevisionID
+	m.nextRevisionID++
+
+	m.revisions = append(m.revisions, r)
+}
+
+// idSet returns whether an id is one of the ids, every id is when there are none
+func idSet(ids []int) func(int) bool {
+	if len(ids) == 0 {
+		return func(int) bool { return true }
+	}
+
+	set := map[int]bool{}
+	for _, id := range ids {
+		set[id] = true
+	}
+
+	return func(id int) bool { return set[id] }
+}
+
+// findIndexByProductID finds the index of a product in the store
+// returns -1 when no product can be found. Must be called with the lock held.
+func (m *MemoryStore) findIndexByProductID(id int) int {
+	for i, p := range m.products {
+		if p.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// skuUsed returns true when a product other than the one with the given id has the sku,
+// deleted products do not hold their sku. Must be called with the lock held.
+func (m *MemoryStore) skuUsed(sku string, id int) bool {
+	for _, p := range m.products {
+		if p.SKU == sku && p.ID != id && p.DeletedOn == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ExampleProducts returns the hard coded products the example data source starts with
+func ExampleProducts() Products {
+	return Products{
+		&Product{
+			ID:          1,
+			Name:        "Latte",
+			Description: "Frothy milky coffee",
+			Price:       2.45,
+			SKU:         "abc323",
+			CreatedOn:   storeTime(),
+			UpdatedOn:   storeTime(),
+		},
+		&Product{
+			ID:          2,
+			Name:        "Espresso",
+			Description: "Short and strong coffee withoud milk",
+			Price:       1.99,
+			SKU:         "fjd34",
+			CreatedOn:   storeTime(),
+			UpdatedOn:   storeTime(),
+		},
+	}
+}
@@ -0,0 +1,130 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStoreCreateOnEmptyStore(t *testing.T) {
+	m := NewMemoryStore(nil)
+
+	p := &Product{Name: "Mocha", SKU: "abc-def-ghi"}
+	assert.NoError(t, m.Create(context.Background(), p))
+	assert.Equal(t, 1, p.ID)
+}
+
+func TestMemoryStoreDoesNotReuseIDs(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryStore(ExampleProducts())
+
+	assert.NoError(t, m.Delete(ctx, 2, 0))
+
+	p := &Product{Name: "Mocha", SKU: "abc-def-ghi"}
+	assert.NoError(t, m.Create(ctx, p))
+	assert.Equal(t, 3, p.ID)
+}
+
+func TestMemoryStoreReturnsCopies(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryStore(ExampleProducts())
+
+	prods, err := m.List(ctx, ListOptions{})
+	assert.NoError(t, err)
+	prods[0].Name = "changed"
+
+	p, err := m.Get(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "Latte", p.Name)
+
+	p.Name = "changed"
+	p, err = m.Get(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "Latte", p.Name)
+
+	// a list returned before a delete is not changed by it
+	assert.NoError(t, m.Delete(ctx, 1, 0))
+	assert.Len(t, prods, 2)
+	assert.Equal(t, 2, prods[1].ID)
+}
+
+func TestMemoryStoreConcurrentCreateGivesUniqueIDs(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryStore(nil)
+
+	const n = 100
+	ids := make([]int, n)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			p := &Product{Name: "Mocha", SKU: fmt.Sprintf("sku-%d", i)}
+			assert.NoError(t, m.Create(ctx, p))
+			ids[i] = p.ID
+		}(i)
+	}
+	wg.Wait()
+
+	seen := map[int]bool{}
+	for _, id := range ids {
+		assert.False(t, seen[id], "id %d was given out twice", id)
+		seen[id] = true
+	}
+
+	prods, err := m.List(ctx, ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, prods, n)
+}
+
+func TestMemoryStoreConcurrentCRUD(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryStore(ExampleProducts())
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(4)
+
+		go func(i int) {
+			defer wg.Done()
+
+			p := &Product{Name: "Mocha", Price: 1, SKU: fmt.Sprintf("sku-%d", i)}
+			assert.NoError(t, m.Create(ctx, p))
+			assert.NoError(t, m.Delete(ctx, p.ID, 0))
+		}(i)
+
+		go func() {
+			defer wg.Done()
+
+			prods, err := m.List(ctx, ListOptions{})
+			assert.NoError(t, err)
+			for _, p := range prods {
+				_ = p.Name
+			}
+		}()
+
+		go func(i int) {
+			defer wg.Done()
+
+			err := m.Update(ctx, &Product{ID: 1, Name: "Latte", Price: float64(i), SKU: "abc323"})
+			assert.NoError(t, err)
+		}(i)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := m.Get(ctx, 2)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	prods, err := m.List(ctx, ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, prods, 2)
+}
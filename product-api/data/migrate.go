@@ -0,0 +1,128 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrations contains the versioned schema migrations of the SQL stores, one
+// directory per database
+//
+//go:embed migrations
+var migrations embed.FS
+
+// migration is a single versioned schema change
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// loadMigrations reads the migrations from dir, files are named NNNN_description.sql
+// where NNNN is the version of the schema after the migration
+func loadMigrations(fsys fs.FS, dir string) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read migrations: %w", err)
+	}
+
+	ms := []migration{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+
+		v, err := strconv.Atoi(strings.SplitN(e.Name(), "_", 2)[0])
+		if err != nil {
+			return nil, fmt.Errorf("migration %s does not start with a version: %w", e.Name(), err)
+		}
+
+		d, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read migration %s: %w", e.Name(), err)
+		}
+
+		ms = append(ms, migration{v, e.Name(), string(d)})
+	}
+
+	sort.Slice(ms, func(i, j int) bool { return ms[i].version < ms[j].version })
+
+	for i := 1; i < len(ms); i++ {
+		if ms[i].version == ms[i-1].version {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", ms[i-1].name, ms[i].name)
+		}
+	}
+
+	return ms, nil
+}
+
+// migrate applies the migrations in dir which have not been applied yet, each migration
+// runs in its own transaction together with recording its version in schema_migrations.
+// The number of applied migrations is returned.
+func migrate(ctx context.Context, db *sql.DB, dir string) (int, error) {
+	ms, err := loadMigrations(migrations, dir)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+	if err != nil {
+		return 0, fmt.Errorf("unable to create schema_migrations: %w", err)
+	}
+
+	var current int
+	err = db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read schema version: %w", err)
+	}
+
+	applied := 0
+	for _, m := range ms {
+		if m.version <= current {
+			continue
+		}
+
+		err := withTx(ctx, db, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, m.sql)
+			if err != nil {
+				return err
+			}
+
+			// the version is an integer so it is safe to format into the statement,
+			// which avoids the differences in placeholders between databases
+			_, err = tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO schema_migrations (version) VALUES (%d)`, m.version))
+			return err
+		})
+
+		if err != nil {
+			return applied, fmt.Errorf("unable to apply migration %s: %w", m.name, err)
+		}
+
+		applied++
+	}
+
+	return applied, nil
+}
+
+// withTx runs fn in a transaction which is committed when fn succeeds and rolled back otherwise
+func withTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,11 @@
+CREATE TABLE products (
+	id          SERIAL PRIMARY KEY,
+	name        TEXT             NOT NULL,
+	description TEXT             NOT NULL DEFAULT '',
+	price       DOUBLE PRECISION NOT NULL,
+	sku         TEXT             NOT NULL,
+	created_on  TEXT             NOT NULL DEFAULT '',
+	updated_on  TEXT             NOT NULL DEFAULT '',
+	deleted_on  TEXT             NOT NULL DEFAULT '',
+	CONSTRAINT products_sku UNIQUE (sku)
+);
@@ -0,0 +1,14 @@
+ALTER TABLE products
+	ALTER COLUMN created_on DROP DEFAULT,
+	ALTER COLUMN updated_on DROP DEFAULT,
+	ALTER COLUMN deleted_on DROP DEFAULT,
+	ALTER COLUMN deleted_on DROP NOT NULL;
+
+ALTER TABLE products
+	ALTER COLUMN created_on TYPE TIMESTAMPTZ USING COALESCE(NULLIF(created_on, '')::timestamptz, now()),
+	ALTER COLUMN updated_on TYPE TIMESTAMPTZ USING COALESCE(NULLIF(updated_on, '')::timestamptz, now()),
+	ALTER COLUMN deleted_on TYPE TIMESTAMPTZ USING NULLIF(deleted_on, '')::timestamptz;
+
+-- deleted products do not hold their SKU
+ALTER TABLE products DROP CONSTRAINT products_sku;
+CREATE UNIQUE INDEX products_sku ON products (sku) WHERE deleted_on IS NULL;
@@ -0,0 +1,4 @@
+-- variants and option groups are stored as JSON arrays, they are always read and
+-- written together with their product
+ALTER TABLE products ADD COLUMN variants      TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE products ADD COLUMN option_groups TEXT NOT NULL DEFAULT '[]';
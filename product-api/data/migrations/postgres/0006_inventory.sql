@@ -0,0 +1,27 @@
+-- stock is tracked per product, or per variant for products with variants, the
+-- variant SKU is empty for the stock of the product itself
+CREATE TABLE stock (
+	product_id  INTEGER NOT NULL REFERENCES products (id),
+	variant_sku TEXT    NOT NULL DEFAULT '',
+	on_hand     INTEGER NOT NULL,
+	reserved    INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (product_id, variant_sku),
+	CHECK (reserved >= 0 AND reserved <= on_hand)
+);
+
+CREATE TABLE reservations (
+	id         SERIAL      PRIMARY KEY,
+	expires_on TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX reservations_expires_on ON reservations (expires_on);
+
+-- the items are removed after their reservation, which is removed first so that
+-- committing or releasing it twice concurrently is detected
+CREATE TABLE reservation_items (
+	reservation_id INTEGER NOT NULL,
+	product_id     INTEGER NOT NULL,
+	variant_sku    TEXT    NOT NULL DEFAULT '',
+	quantity       INTEGER NOT NULL CHECK (quantity > 0),
+	PRIMARY KEY (reservation_id, product_id, variant_sku)
+);
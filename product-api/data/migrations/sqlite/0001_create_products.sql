@@ -0,0 +1,10 @@
+CREATE TABLE products (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	name        TEXT    NOT NULL,
+	description TEXT    NOT NULL DEFAULT '',
+	price       REAL    NOT NULL,
+	sku         TEXT    NOT NULL,
+	created_on  TEXT    NOT NULL DEFAULT '',
+	updated_on  TEXT    NOT NULL DEFAULT '',
+	deleted_on  TEXT    NOT NULL DEFAULT ''
+);
@@ -0,0 +1,3 @@
+INSERT INTO products (name, description, price, sku, created_on, updated_on) VALUES
+	('Latte', 'Frothy milky coffee', 2.45, 'abc323', datetime('now'), datetime('now')),
+	('Espresso', 'Short and strong coffee withoud milk', 1.99, 'fjd34', datetime('now'), datetime('now'));
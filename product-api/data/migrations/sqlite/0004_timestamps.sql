@@ -0,0 +1,31 @@
+-- SQLite can not change the type of a column, the table is rebuilt with the
+-- timestamps stored as TIMESTAMP and deleted_on NULL for products which are not deleted
+CREATE TABLE products_new (
+	id          INTEGER   PRIMARY KEY AUTOINCREMENT,
+	name        TEXT      NOT NULL,
+	description TEXT      NOT NULL DEFAULT '',
+	price       REAL      NOT NULL,
+	sku         TEXT      NOT NULL,
+	created_on  TIMESTAMP NOT NULL,
+	updated_on  TIMESTAMP NOT NULL,
+	deleted_on  TIMESTAMP
+);
+
+INSERT INTO products_new (id, name, description, price, sku, created_on, updated_on, deleted_on)
+SELECT
+	id, name, description, price, sku,
+	COALESCE(NULLIF(created_on, ''), datetime('now')),
+	COALESCE(NULLIF(updated_on, ''), datetime('now')),
+	NULLIF(deleted_on, '')
+FROM products;
+
+-- keep the id sequence so ids of removed products are not given out again
+UPDATE sqlite_sequence
+SET seq = max(seq, COALESCE((SELECT seq FROM sqlite_sequence WHERE name = 'products'), 0))
+WHERE name = 'products_new';
+
+DROP TABLE products;
+ALTER TABLE products_new RENAME TO products;
+
+-- deleted products do not hold their SKU
+CREATE UNIQUE INDEX products_sku ON products (sku) WHERE deleted_on IS NULL;
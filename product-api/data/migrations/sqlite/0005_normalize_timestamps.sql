@@ -0,0 +1,6 @@
+-- the driver writes times as 2006-01-02 15:04:05.999999999-07:00 and SQLite compares
+-- them as text, times copied from datetime('now') are given the same UTC offset so
+-- that they compare correctly with the times written by the driver
+UPDATE products SET created_on = created_on || '+00:00' WHERE length(created_on) = 19;
+UPDATE products SET updated_on = updated_on || '+00:00' WHERE length(updated_on) = 19;
+UPDATE products SET deleted_on = deleted_on || '+00:00' WHERE length(deleted_on) = 19;
@@ -0,0 +1,17 @@
+CREATE TABLE categories (
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	name      TEXT    NOT NULL,
+	parent_id INTEGER REFERENCES categories (id)
+);
+
+-- the names of the subcategories of a category are unique, top level categories
+-- have no parent so it is compared as 0
+CREATE UNIQUE INDEX categories_parent_name ON categories (COALESCE(parent_id, 0), name);
+
+CREATE TABLE product_categories (
+	product_id  INTEGER NOT NULL REFERENCES products (id),
+	category_id INTEGER NOT NULL REFERENCES categories (id),
+	PRIMARY KEY (product_id, category_id)
+);
+
+CREATE INDEX product_categories_category ON product_categories (category_id);
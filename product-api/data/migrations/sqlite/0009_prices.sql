@@ -0,0 +1,8 @@
+-- explicit prices of products in other currencies, they are used instead of
+-- converting the price of the product
+CREATE TABLE product_prices (
+	product_id INTEGER NOT NULL REFERENCES products (id),
+	currency   TEXT    NOT NULL,
+	price      REAL    NOT NULL CHECK (price > 0),
+	PRIMARY KEY (product_id, currency)
+);
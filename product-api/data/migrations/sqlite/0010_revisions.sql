@@ -0,0 +1,30 @@
+-- every change of a product is recorded as a revision holding the product after the
+-- change, revisions are kept when their product is purged
+CREATE TABLE product_revisions (
+	id            INTEGER   PRIMARY KEY AUTOINCREMENT,
+	product_id    INTEGER   NOT NULL,
+	type          TEXT      NOT NULL,
+	actor         TEXT      NOT NULL,
+	revised_on    TIMESTAMP NOT NULL,
+	changes       TEXT      NOT NULL,
+	name          TEXT      NOT NULL,
+	description   TEXT      NOT NULL,
+	price         REAL      NOT NULL,
+	sku           TEXT      NOT NULL,
+	variants      TEXT      NOT NULL,
+	option_groups TEXT      NOT NULL,
+	created_on    TIMESTAMP NOT NULL,
+	updated_on    TIMESTAMP NOT NULL,
+	deleted_on    TIMESTAMP
+);
+
+CREATE INDEX product_revisions_product_id ON product_revisions (product_id, id);
+CREATE INDEX product_revisions_revised_on ON product_revisions (revised_on);
+
+-- the history of the existing products starts with their current state
+INSERT INTO product_revisions (product_id, type, actor, revised_on, changes, name, description, price, sku, variants, option_groups, created_on, updated_on, deleted_on)
+SELECT
+	id, CASE WHEN deleted_on IS NULL THEN 'created' ELSE 'deleted' END, 'system', updated_on, '[]',
+	name, description, price, sku, variants, option_groups, created_on, updated_on, deleted_on
+FROM products
+ORDER BY id;
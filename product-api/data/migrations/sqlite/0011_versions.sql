@@ -0,0 +1,14 @@
+-- products are versioned for optimistic concurrency, the version is the number of
+-- revisions of the product and is incremented by every change
+ALTER TABLE products ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE product_revisions ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+UPDATE product_revisions SET version = (
+	SELECT COUNT(*) FROM product_revisions r
+	WHERE r.product_id = product_revisions.product_id AND r.id <= product_revisions.id
+);
+
+UPDATE products SET version = (
+	SELECT COUNT(*) FROM product_revisions r WHERE r.product_id = products.id
+)
+WHERE EXISTS (SELECT 1 FROM product_revisions r WHERE r.product_id = products.id);
@@ -0,0 +1,63 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/jackc/pgconn"
+
+	// registers the pgx driver with database/sql
+	_ "github.com/jackc/pgx/v4/stdlib"
+)
+
+// PostgresStore is a ProductStore which persists the products in a PostgreSQL database
+type PostgresStore struct {
+	sqlStore
+}
+
+// PoolConfig configures the connection pool of the PostgresStore
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// DefaultPoolConfig is a pool suitable for a single product-api instance
+var DefaultPoolConfig = PoolConfig{MaxOpenConns: 20, MaxIdleConns: 5, ConnMaxLifetime: 30 * time.Minute}
+
+// NewPostgresStore connects to the database at dsn and applies the pending schema migrations
+func NewPostgresStore(ctx context.Context, dsn string, pc PoolConfig, l hclog.Logger) (*PostgresStore, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open product database: %w", err)
+	}
+
+	db.SetMaxOpenConns(pc.MaxOpenConns)
+	db.SetMaxIdleConns(pc.MaxIdleConns)
+	db.SetConnMaxLifetime(pc.ConnMaxLifetime)
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to connect to product database: %w", err)
+	}
+
+	n, err := migrate(ctx, db, "migrations/postgres")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	l.Info("connected to product database", "migrations_applied", n)
+	return &PostgresStore{sqlStore{db, dialect{numbered: true, returning: true, like: "ILIKE", binaryCollation: ` COLLATE "C"`, isConflict: isPostgresConflict, forUpdate: ` FOR UPDATE`}}}, nil
+}
+
+// isPostgresConflict returns true when the error is a unique constraint violation
+func isPostgresConflict(err error) bool {
+	var pe *pgconn.PgError
+	return errors.As(err, &pe) && pe.Code == "23505"
+}
@@ -0,0 +1,98 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+// postgresDSN returns the connection string of the database the Postgres tests run
+// against. PRODUCT_API_POSTGRES_DSN selects a locally started database, otherwise an
+// embedded Postgres is started, the test is skipped when neither is available.
+func postgresDSN(t *testing.T) string {
+	if dsn := os.Getenv("PRODUCT_API_POSTGRES_DSN"); dsn != "" {
+		return dsn
+	}
+
+	if testing.Short() {
+		t.Skip("skipping embedded Postgres in short mode")
+	}
+
+	port, err := freePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the log file of the embedded Postgres is created in the temp directory
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+
+	pg := embeddedpostgres.NewDatabase(
+		embeddedpostgres.DefaultConfig().
+			Port(port).
+			RuntimePath(dir + "/runtime").
+			Logger(io.Discard),
+	)
+
+	err = pg.Start()
+	if err != nil {
+		t.Skipf("set PRODUCT_API_POSTGRES_DSN to run the Postgres tests, unable to start embedded Postgres: %s", err)
+	}
+	t.Cleanup(func() { pg.Stop() })
+
+	return fmt.Sprintf("host=localhost port=%d user=postgres password=postgres dbname=postgres sslmode=disable", port)
+}
+
+// resetPostgres drops the tables of the store and the migrations, so that a new store
+// starts with the example products
+func resetPostgres(t *testing.T, dsn string) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`DROP TABLE IF EXISTS product_revisions, product_prices, reservation_items, reservations, stock, product_categories, categories, products, schema_migrations`)
+	if err != nil {
+		t.Fatalf("unable to reset database: %s", err)
+	}
+}
+
+// freePort returns a TCP port which is not in use
+func freePort() (uint32, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+
+	return uint32(l.Addr().(*net.TCPAddr).Port), nil
+}
+
+func TestPostgresStore(t *testing.T) {
+	dsn := postgresDSN(t)
+
+	for _, suite := range storeSuites {
+		suite := suite
+		t.Run(suite.name, func(t *testing.T) {
+			resetPostgres(t, dsn)
+
+			s, err := NewPostgresStore(context.Background(), dsn, DefaultPoolConfig, hclog.NewNullLogger())
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer s.Close()
+
+			// the example products are seeded by the migrations
+			suite.test(t, s)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package data
+
+import (
+	"context"
+	"fmt"
+)
+
+// ErrPriceNotFound is an error raised when a product has no price in a currency
+var ErrPriceNotFound = fmt.Errorf("price not found")
+
+// ErrPriceHasVariants is an error raised when a native price is set for a product with
+// variants or options, their prices are always converted
+var ErrPriceHasVariants = fmt.Errorf("native prices can not be set for products with variants or options")
+
+// sources of the price of a product in a requested currency
+const (
+	// PriceNative is the source of a price set for the currency
+	PriceNative = "native"
+	// PriceConverted is the source of a price converted from the base price
+	PriceConverted = "converted"
+)
+
+// Price defines the explicit price of a product in a currency, it is returned instead
+// of converting the price of the product
+// swagger: model
+type Price struct {
+	// id of the product
+	//
+	// read only: true
+	ProductID int `json:"productId"`
+
+	// currency of the price, an ISO 4217 code or the code of a custom currency
+	//
+	// read only: true
+	// pattern: [A-Z][A-Z0-9]{2,9}
+	Currency string `json:"currency"`
+
+	// price of the product in the currency
+	//
+	// required: true
+	// min: 0.01
+	Price float64 `json:"price" validate:"gt=0"`
+}
+
+// GetPrices returns the explicit prices of the product ordered by currency
+func (p *ProductsDB) GetPrices(ctx context.Context, productID int) ([]Price, error) {
+	_, err := p.store.Get(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.store.ListPrices(ctx, productID)
+}
+
+// SetPrice sets the price of the product in the currency, the currency must be
+// supported by the currency service. Products with variants or options can not have
+// native prices.
+func (p *ProductsDB) SetPrice(ctx context.Context, productID int, currency string, price float64) (*Price, error) {
+	_, err := p.getRate(ctx, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	prod, err := p.store.Get(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !prod.hasNativePrices() {
+		return nil, ErrPriceHasVariants
+	}
+
+	err = p.store.SetPrice(ctx, productID, currency, price)
+	if err != nil {
+		return nil, err
+	}
+
+	p.events.Publish(Event{Type: EventProductUpdated, ProductID: productID})
+	return &Price{ProductID: productID, Currency: currency, Price: price}, nil
+}
+
+// DeletePrice removes the price of the product in the currency, afterwards the price
+// of the product is converted into the currency
+func (p *ProductsDB) DeletePrice(ctx context.Context, productID int, currency string) error {
+	err := p.store.DeletePrice(ctx, productID, currency)
+	if err != nil {
+		return err
+	}
+
+	p.events.Publish(Event{Type: EventProductUpdated, ProductID: productID})
+	return nil
+}
+
+// hasNativePrices returns whether the product can have native prices, the prices of
+// variants and options are converted so they can not be mixed with a native price
+func (p *Product) hasNativePrices() bool {
+	return len(p.Variants) == 0 && len(p.OptionGroups) == 0
+}
+
+// priced returns copies of the products with the prices in the currency, the explicit
+// price of a product in the currency is used when it has one and the price is converted
+// with the rate otherwise. Native prices are ignored for products which gained variants
+// or options after the price was set. round rounds the converted prices to one decimal.
+func (p *ProductsDB) priced(ctx context.Context, prods Products, currency string, rate float64, round bool) (Products, error) {
+	if currency == "" || len(prods) == 0 {
+		return prods, nil
+	}
+
+	ids := make([]int, len(prods))
+	for i, prod := range prods {
+		ids[i] = prod.ID
+	}
+
+	prices, err := p.store.ListPrices(ctx, ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	native := map[int]float64{}
+	for _, pr := range prices {
+		if pr.Currency == currency {
+			native[pr.ProductID] = pr.Price
+		}
+	}
+
+	res := Products{}
+	for _, prod := range prods {
+		np := prod.converted(rate, round)
+		np.Currency = currency
+		np.PriceSource = PriceConverted
+
+		if price, ok := native[prod.ID]; ok && prod.hasNativePrices() {
+			np.Price = price
+			np.PriceSource = PriceNative
+		}
+
+		res = append(res, np)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,120 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/d-vignesh/go-microservice-example/currency/client"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNativePricesOverrideConversion(t *testing.T) {
+	f := client.NewFake()
+	f.SetRate("USD", 2)
+	f.SetRate("EUR", 1.5)
+
+	db := NewProductsDB(NewMemoryStore(ExampleProducts()), f, hclog.NewNullLogger())
+	ctx := context.Background()
+
+	_, err := db.SetPrice(ctx, 1, "XXX", 3)
+	assert.True(t, errors.Is(err, ErrInvalidCurrency), "expected invalid currency, got %v", err)
+
+	pr, err := db.SetPrice(ctx, 1, "USD", 4.5)
+	assert.NoError(t, err)
+	assert.Equal(t, &Price{ProductID: 1, Currency: "USD", Price: 4.5}, pr)
+
+	prods, _, err := db.GetProducts(ctx, "USD", ListOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 4.5, prods[0].Price)
+	assert.Equal(t, PriceNative, prods[0].PriceSource)
+	assert.Equal(t, 4.0, prods[1].Price)
+	assert.Equal(t, PriceConverted, prods[1].PriceSource)
+	assert.Equal(t, "USD", prods[1].Currency)
+
+	// the native price only applies to its currency
+	p, err := db.GetProductByID(ctx, 1, "EUR")
+	assert.NoError(t, err)
+	assert.Equal(t, PriceConverted, p.PriceSource)
+
+	// prices in the base currency have no source
+	p, err = db.GetProductByID(ctx, 1, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 2.45, p.Price)
+	assert.Empty(t, p.Currency)
+	assert.Empty(t, p.PriceSource)
+
+	prices, err := db.GetPrices(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []Price{{ProductID: 1, Currency: "USD", Price: 4.5}}, prices)
+
+	assert.NoError(t, db.DeletePrice(ctx, 1, "USD"))
+
+	p, err = db.GetProductByID(ctx, 1, "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, 4.9, p.Price)
+	assert.Equal(t, PriceConverted, p.PriceSource)
+}
+
+func TestPriceRangesAndSortingUseConvertedPrices(t *testing.T) {
+	f := client.NewFake()
+	f.SetRate("USD", 2)
+
+	db := NewProductsDB(NewMemoryStore(ExampleProducts()), f, hclog.NewNullLogger())
+	ctx := context.Background()
+
+	// the Latte costs 4.9 USD converted, but 3.5 USD natively
+	_, err := db.SetPrice(ctx, 1, "USD", 3.5)
+	assert.NoError(t, err)
+
+	prods, _, err := db.GetProducts(ctx, "USD", ListOptions{MaxPrice: 4.5})
+	assert.NoError(t, err)
+	if assert.Len(t, prods, 1) {
+		assert.Equal(t, 2, prods[0].ID)
+	}
+
+	// the Espresso converted to 4.0 USD is sorted before the Latte with its native price
+	prods, _, err = db.GetProducts(ctx, "USD", ListOptions{Sort: SortByPrice})
+	assert.NoError(t, err)
+	if assert.Len(t, prods, 2) {
+		assert.Equal(t, 4.0, prods[0].Price)
+		assert.Equal(t, 3.5, prods[1].Price)
+		assert.Equal(t, PriceNative, prods[1].PriceSource)
+	}
+}
+
+func TestNativePricesAreRejectedForVariants(t *testing.T) {
+	f := client.NewFake()
+	f.SetRate("USD", 2)
+
+	db := NewProductsDB(NewMemoryStore(ExampleProducts()), f, hclog.NewNullLogger())
+	ctx := context.Background()
+
+	p := Product{
+		Name:     "Americano",
+		Price:    2.1,
+		SKU:      "ame-ric-ano",
+		Variants: []Variant{{Name: "Large", SKU: "ame-ric-lrg", Price: 2.55}},
+	}
+	assert.NoError(t, db.AddProduct(ctx, p))
+
+	prods, _, err := db.GetProducts(ctx, "", ListOptions{NamePrefix: "Americano"})
+	assert.NoError(t, err)
+	_, err = db.SetPrice(ctx, prods[0].ID, "USD", 4)
+	assert.Equal(t, ErrPriceHasVariants, err)
+
+	// a native price is ignored once the product gains options
+	_, err = db.SetPrice(ctx, 1, "USD", 3.5)
+	assert.NoError(t, err)
+
+	latte, err := db.GetProductByID(ctx, 1, "")
+	assert.NoError(t, err)
+	latte.OptionGroups = []OptionGroup{{Name: "Milk", Options: []Option{{Name: "Oat", PriceDelta: 0.4}}}}
+	assert.NoError(t, db.UpdateProduct(ctx, latte))
+
+	latte, err = db.GetProductByID(ctx, 1, "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, 4.9, latte.Price)
+	assert.Equal(t, PriceConverted, latte.PriceSource)
+}
@@ -1,20 +1,33 @@
 package data
 
 import (
+	"errors"
 	"fmt"
-	"time"
 	"context"
 	"math"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/d-vignesh/go-microservice-example/currency/client"
 	protos "github.com/d-vignesh/go-microservice-example/currency/protos/currency"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 )
 
 // ErrProductNotFound is an error raised when a product cannot be found in the database
 var ErrProductNotFound = fmt.Errorf("product not found")
 
+// ErrProductConflict is an error raised when a product conflicts with an existing
+// product, such as a duplicate SKU
+var ErrProductConflict = fmt.Errorf("product conflict")
+
+// ErrInvalidCurrency is an error raised when the currency service does not support
+// the requested currency
+var ErrInvalidCurrency = fmt.Errorf("invalid currency")
+
+// ErrVersionMismatch is an error raised when a product is changed while it is not at
+// the expected version, because it was changed since the version was read
+var ErrVersionMismatch = fmt.Errorf("product version mismatch")
+
 // Product defines the structure for an API product
 // swagger: model
 type Product struct {
@@ -42,227 +55,501 @@ type Product struct {
 	// min: 0.01
 	Price		float64		`json:"price" validate:"gt=0"`
 
+	// currency of the price, only set when a currency is requested
+	//
+	// read only: true
+	Currency	string		`json:"currency,omitempty"`
+
+	// whether the price is the native price of the product in the currency or was
+	// converted from the base price, only set when a currency is requested
+	//
+	// read only: true
+	// enum: native,converted
+	PriceSource	string		`json:"priceSource,omitempty"`
+
 	// SKU for the product
 	//
 	// required: true
 	// pattern: [a-z]+-[a-z]+-[a-z]+
 	SKU			string		`json:"sku" validate:"required,sku"`
 
-	CreatedOn	string		`json:"-"`
-	UpdatedOn	string		`json:"-"`
-	DeletedOn	string		`json:"-"`
+	// variants of the product such as its sizes, each with its own SKU and price
+	//
+	// required: false
+	Variants	[]Variant	`json:"variants,omitempty" validate:"unique=SKU,dive"`
+
+	// groups of options which change the price of the product, such as the milk
+	//
+	// required: false
+	OptionGroups	[]OptionGroup	`json:"optionGroups,omitempty" validate:"unique=Name,dive"`
+
+	// whether the product, or one of its variants, is in stock
+	//
+	// read only: true
+	Available	bool		`json:"available"`
+
+	// time the product was created, set by the store
+	//
+	// read only: true
+	CreatedOn	time.Time	`json:"createdOn"`
+
+	// time the product was last changed, set by the store
+	//
+	// read only: true
+	UpdatedOn	time.Time	`json:"updatedOn"`
+
+	// time the product was deleted, only set for deleted products
+	//
+	// read only: true
+	DeletedOn	*time.Time	`json:"deletedOn,omitempty"`
+
+	// version of the product, set to 1 by the store when the product is created and
+	// incremented with every change. It is returned as the ETag of the product.
+	//
+	// read only: true
+	Version		int			`json:"version"`
 }
 
 // Products defines a slice of Product
 type Products []*Product
 
+// Variant defines a variant of a product, such as a size
+// swagger: model
+type Variant struct {
+	// name for the variant
+	//
+	// required: true
+	// max length: 255
+	Name		string		`json:"name" validate:"required,max=255"`
+
+	// SKU for the variant, unique within the product
+	//
+	// required: true
+	// pattern: [a-z]+-[a-z]+-[a-z]+
+	SKU			string		`json:"sku" validate:"required,sku"`
+
+	// price of the variant, replaces the price of the product
+	//
+	// required: true
+	// min: 0.01
+	Price		float64		`json:"price" validate:"gt=0"`
+
+	// whether the variant is in stock
+	//
+	// read only: true
+	Available	bool		`json:"available"`
+}
+
+// OptionGroup defines a group of options a customer chooses from, such as the milk
+// swagger: model
+type OptionGroup struct {
+	// name for the option group
+	//
+	// required: true
+	// max length: 255
+	Name		string		`json:"name" validate:"required,max=255"`
+
+	// options of the group, unique by name
+	//
+	// required: true
+	Options		[]Option	`json:"options" validate:"required,min=1,unique=Name,dive"`
+}
+
+// Option defines an option of an option group, such as oat milk
+// swagger: model
+type Option struct {
+	// name for the option
+	//
+	// required: true
+	// max length: 255
+	Name		string		`json:"name" validate:"required,max=255"`
+
+	// amount the option adds to the price, negative for a discount
+	//
+	// required: false
+	PriceDelta	float64		`json:"priceDelta"`
+}
+
+// clone returns a copy of the product which shares no memory with p
+func (p *Product) clone() *Product {
+	np := *p
+
+	if p.Variants != nil {
+		np.Variants = append([]Variant{}, p.Variants...)
+	}
+
+	if p.OptionGroups != nil {
+		np.OptionGroups = make([]OptionGroup, len(p.OptionGroups))
+		for i, g := range p.OptionGroups {
+			np.OptionGroups[i] = OptionGroup{Name: g.Name, Options: append([]Option{}, g.Options...)}
+		}
+	}
+
+	if p.DeletedOn != nil {
+		t := *p.DeletedOn
+		np.DeletedOn = &t
+	}
+
+	return &np
+}
+
+// converted returns a copy of the product with the price, the variant prices and
+// the option price deltas converted with the rate, round rounds them to one decimal
+func (p *Product) converted(rate float64, round bool) *Product {
+	conv := func(v float64) float64 {
+		if round {
+			return math.Round(v * rate * 10) / 10
+		}
+		return v * rate
+	}
+
+	np := p.clone()
+	np.Price = conv(np.Price)
+
+	for i := range np.Variants {
+		np.Variants[i].Price = conv(np.Variants[i].Price)
+	}
+
+	for _, g := range np.OptionGroups {
+		for i := range g.Options {
+			g.Options[i].PriceDelta = conv(g.Options[i].PriceDelta)
+		}
+	}
+
+	return np
+}
+
+// ProductsDB is the pricing layer on top of a ProductStore, it converts the prices of
+// the stored products into the requested currency and publishes an event every time
+// a product or an exchange rate changes. It keeps a search index of the products up
+// to date with the changes made through it.
 type ProductsDB struct {
-	currency protos.CurrencyClient
+	store	 ProductStore
+	rates	 client.Rater
 	log 	 hclog.Logger
-	rates	 map[string]float64
-	client   protos.Currency_SubscribeRatesClient
+	events	 *Events
+	index	 *Index
+	lowStock int
 }
 
-func NewProductsDB(c protos.CurrencyClient, l hclog.Logger) *ProductsDB {
-	pb := &ProductsDB{c, l, make(map[string]float64), nil}
+// NewProductsDB creates a ProductsDB which converts the prices of the products in s
+// with the rates returned by r
+func NewProductsDB(s ProductStore, r client.Rater, l hclog.Logger) *ProductsDB {
+	pb := &ProductsDB{s, r, l, NewEvents(1000), NewIndex(), DefaultLowStockThreshold}
 
+	pb.buildIndex()
 	go pb.handleUpdates()
 
 	return pb
 }
 
+// buildIndex adds the products of the store to the search index
+func (p *ProductsDB) buildIndex() {
+	prods, err := p.store.List(context.Background(), ListOptions{})
+	if err != nil {
+		p.log.Error("unable to build the search index", "error", err)
+		return
+	}
+
+	for _, prod := range prods {
+		p.index.Add(prod)
+	}
+}
+
+// handleUpdates publishes an event every time the client receives an updated rate
 func (p *ProductsDB) handleUpdates() {
-	sub, err := p.currency.SubscribeRates(context.Background())
+	updates, _ := p.rates.Watch()
+
+	for r := range updates {
+		p.log.Info("received updated rate from server", "dest", r.Destination)
+		p.events.Publish(Event{Type: EventRateChanged, Currency: r.Destination})
+	}
+}
+
+// GetProducts returns the products from the store selected by the options, the price
+// range of the options is in the requested currency and the categories include their
+// descendants. Products with a native price in the currency are returned with it, the
+// price range and the price order compare the converted prices. When the options have
+// a limit and more products follow, the cursor for the next page is returned. With an
+// AsOf time the products are returned as they were at the time, see GetProductAsOf.
+func (p *ProductsDB) GetProducts(ctx context.Context, currency string, opts ListOptions) (Products, string, error) {
+	err := opts.validate()
 	if err != nil {
-		p.log.Error("unable to subscribe for rates", "error", err)
+		return nil, "", err
+	}
+
+	if opts.Limit > MaxListLimit {
+		return nil, "", fmt.Errorf("%w: limit can not be greater than %d", ErrInvalidListOptions, MaxListLimit)
 	}
-	p.client = sub
 
-	for {
-		// Recv returns a StreamingRateResponse which can contain one of two message
-		// RateResponse or an Error.
-		// We need to handle each case separately
-		srr, err := sub.Recv()
+	err = p.expandCategories(ctx, &opts)
+	if err != nil {
+		return nil, "", err
+	}
 
-		// handle connection errors
-		// this is normally terminal required a reconnect
+	rate := 1.0
+	if currency != "" {
+		r, err := p.getRate(ctx, currency)
 		if err != nil {
-			p.log.Error("error receiving message", "error", err)
-			return
+			p.log.Error("unable to get rate", "currency", currency, "error", err)
+			return nil, "", err
 		}
 
-		// handle a returned error message
-		if ge := srr.GetError(); ge != nil {
-			sre := status.FromProto(ge)
+		rate = r
+	}
 
-			if sre.Code() == codes.InvalidArgument {
-				errDetails := ""
-				if d := sre.Details(); len(d) > 0 {
-					p.log.Error("Deets", "d", d)
-					if rr, ok := d[0].(*protos.RateRequest); ok {
-						errDetails = fmt.Sprintf("base: %s destination: %s", rr.GetBase().String(), rr.GetDestination().String())
-					}
-				}
+	// the store compares prices in the base currency
+	opts.MinPrice /= rate
+	opts.MaxPrice /= rate
 
-				p.log.Error("received error from currency service rate subscription", "error", ge.GetMessage(), "details", errDetails)
-			}
-		}
+	// fetch one more product than requested to find out whether a next page exists
+	limit := opts.Limit
+	if limit > 0 {
+		opts.Limit++
+	}
 
-		// handle the rate response
-		if rr := srr.GetRateResponse(); rr != nil {
-			p.log.Info("received updated rate from server", "dest", rr.GetDestination().String())
-			p.rates[rr.Destination.String()] = rr.Rate
-		}
+	var prods Products
+	if opts.AsOf.IsZero() {
+		prods, err = p.store.List(ctx, opts)
+	} else {
+		prods, err = p.listAsOf(ctx, opts)
+	}
+	if err != nil {
+		return nil, "", err
 	}
-}
 
-// GetProducts returns all products from the database
-func (p *ProductsDB) GetProducts(currency string) (Products, error) {
-	if currency == "" {
-		return productList, nil
+	next := ""
+	if limit > 0 && len(prods) > limit {
+		prods = prods[:limit]
+		next = newCursor(opts, prods[limit-1])
 	}
 
-	rate, err := p.getRate(currency)
+	err = p.setAvailability(ctx, prods...)
 	if err != nil {
-		p.log.Error("unable to get rate", "currency", currency, "error", err)
-		return nil, err
+		return nil, "", err
+	}
+
+	prods, err = p.priced(ctx, prods, currency, rate, true)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return prods, next, nil
+}
+
+// SearchProducts returns at most limit products matching the query ordered by relevance,
+// with the prices in the requested currency. A limit of zero returns DefaultSearchLimit
+// products.
+func (p *ProductsDB) SearchProducts(ctx context.Context, query, currency string, limit int) (Products, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("%w: query can not be empty", ErrInvalidSearch)
+	}
+
+	if limit < 0 || limit > MaxListLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidSearch, MaxListLimit)
+	}
+
+	if limit == 0 {
+		limit = DefaultSearchLimit
 	}
 
+	rate := 1.0
+	if currency != "" {
+		r, err := p.getRate(ctx, currency)
+		if err != nil {
+			p.log.Error("unable to get rate", "currency", currency, "error", err)
+			return nil, err
+		}
+
+		rate = r
+	}
+
+	// all matches are read as products deleted since they were indexed are skipped,
+	// the results are only limited once limit products have been found
 	pr := Products{}
-	for _, prod := range productList {
-		np := *prod
-		np.Price = math.Round(np.Price * rate * 10) / 10
-		pr = append(pr, &np)
+	for _, res := range p.index.Search(query, 0) {
+		prod, err := p.store.Get(ctx, res.ID)
+		if errors.Is(err, ErrProductNotFound) {
+			// the product has been deleted since it was found
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		pr = append(pr, prod)
+		if len(pr) == limit {
+			break
+		}
 	}
-	return pr, nil
+
+	err := p.setAvailability(ctx, pr...)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.priced(ctx, pr, currency, rate, true)
 }
 
-// GetProductByID returns a single product which matches the id from the database.
+// GetProductByID returns a single product which matches the id from the store.
 // if a product is not found this function returns a ProductNotFound error
-func (p *ProductsDB) GetProductByID(id int, currency string) (*Product, error) {
-	i := findIndexByProductID(id)
-	if i == -1 {
-		return nil, ErrProductNotFound
+func (p *ProductsDB) GetProductByID(ctx context.Context, id int, currency string) (*Product, error) {
+	prod, err := p.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
 	}
 
-	if currency == "" {
-		return productList[i], nil
+	err = p.setAvailability(ctx, prod)
+	if err != nil {
+		return nil, err
 	}
 
-	rate, err := p.getRate(currency)
+	rate := 1.0
+	if currency != "" {
+		rate, err = p.getRate(ctx, currency)
+		if err != nil {
+			p.log.Error("unable to get rate", "currency", currency, "error", err)
+			return nil, err
+		}
+	}
+
+	prods, err := p.priced(ctx, Products{prod}, currency, rate, false)
 	if err != nil {
-		p.log.Error("unable to get rate", "currency", currency, "error", err)
 		return nil, err
 	}
 
-	np := *productList[i]
-	np.Price = np.Price * rate 
-
-	return &np, nil
+	return prods[0], nil
 }
 
-// AddProduct adds a new product to the database
-func (p *ProductsDB) AddProduct(pr Product) {
-	// get the next id in sequence
-	maxID := productList[len(productList)-1].ID
-	pr.ID = maxID + 1
-	productList = append(productList, &pr)
+// AddProduct adds a new product to the store
+func (p *ProductsDB) AddProduct(ctx context.Context, pr Product) error {
+	// the currency of the price is only set in responses
+	pr.Currency, pr.PriceSource = "", ""
+
+	err := p.store.Create(ctx, &pr)
+	if err != nil {
+		return err
+	}
+
+	p.index.Add(&pr)
+	p.events.Publish(Event{Type: EventProductCreated, ProductID: pr.ID})
+	return nil
 } 
 
-// UpdateProduct replaces a product in the database with the given item
-// If a product with the given id does not exists in the database
+// UpdateProduct replaces a product in the store with the given item
+// If a product with the given id does not exists in the store
 // this function returns a ProductNotFound error
-func (p *ProductsDB) UpdateProduct(pr Product) error {
-	i := findIndexByProductID(pr.ID)
-	if i == -1 {
-		return ErrProductNotFound
+// When the version of the item is not zero ErrVersionMismatch is returned unless the
+// stored product is at the version, the item is set to the new version once it is stored
+func (p *ProductsDB) UpdateProduct(ctx context.Context, pr *Product) error {
+	pr.Currency, pr.PriceSource = "", ""
+
+	err := p.store.Update(ctx, pr)
+	if err != nil {
+		return err
 	}
 
-	// update the product in the DB
-	productList[i] = &pr
+	p.index.Add(pr)
+	p.events.Publish(Event{Type: EventProductUpdated, ProductID: pr.ID})
 
 	return nil
 }
 
-// DeleteProduct deletes a product from the database
-func (p *ProductsDB) DeleteProduct(id int) error {
-	i := findIndexByProductID(id)
-	if i == -1 {
-		return ErrProductNotFound
-	}
-	if i == len(productList) - 1 {
-		productList = productList[:i]
-	} else {
-		productList = append(productList[:i], productList[(i+1):]...)
+// DeleteProduct soft deletes a product in the store, it can be restored with RestoreProduct
+// until it is purged. When version is not zero ErrVersionMismatch is returned unless the
+// product is at the version.
+func (p *ProductsDB) DeleteProduct(ctx context.Context, id, version int) error {
+	err := p.store.Delete(ctx, id, version)
+	if err != nil {
+		return err
 	}
 
+	p.index.Remove(id)
+	p.events.Publish(Event{Type: EventProductDeleted, ProductID: id})
+
 	return nil
 }
 
-// findIndex finds the index of a product in the database
-// returns -1 when no product can be found
-func findIndexByProductID(id int) int {
-	for i, p := range productList {
-		if p.ID == id {
-			return i
-		}
+// RestoreProduct restores a deleted product, the restored product is returned
+func (p *ProductsDB) RestoreProduct(ctx context.Context, id int) (*Product, error) {
+	err := p.store.Restore(ctx, id)
+	if err != nil {
+		return nil, err
 	}
 
-	return -1
-}
-
-func (p *ProductsDB) getRate(destination string) (float64, error) {
-	// if cached return
-	if r, ok := p.rates[destination]; ok {
-		return r, nil
+	prod, err := p.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
 	}
 
-	rr := &protos.RateRequest {
-		Base:			protos.Currencies(protos.Currencies_value["EUR"]),
-		Destination:	protos.Currencies(protos.Currencies_value[destination]),
+	err = p.setAvailability(ctx, prod)
+	if err != nil {
+		return nil, err
 	}
 
-	resp, err := p.currency.GetRate(context.Background(), rr)
-	if err != nil {
-		// convert the grpc error message
-		grpcError, ok := status.FromError(err)
-		if !ok {
-			return -1, err
-		}
+	p.index.Add(prod)
+	p.events.Publish(Event{Type: EventProductRestored, ProductID: id})
+
+	return prod, nil
+}
+
+// MonitorPurge permanently removes the products which have been deleted for longer
+// than the retention, the store is checked every interval
+func (p *ProductsDB) MonitorPurge(retention, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		for range ticker.C {
+			n, err := p.store.Purge(context.Background(), time.Now().Add(-retention))
+			if err != nil {
+				p.log.Error("unable to purge deleted products", "error", err)
+				continue
+			}
 
-		// if this is an invalid arguments exception santise the message before returning
-		if grpcError.Code() == codes.InvalidArgument {
-			return -1, fmt.Errorf("unable to retrieve exchange rate from currency service: %s", grpcError.Message())
+			if n > 0 {
+				p.log.Info("purged deleted products", "count", n)
+			}
 		}
-	}
-	
-	p.rates[destination] = resp.Rate
+	}()
+}
 
-	// subscribe for updates
-	p.client.Send(rr)
+// Events returns the broker which publishes an event every time a product or an
+// exchange rate changes
+func (p *ProductsDB) Events() *Events {
+	return p.events
+}
 
-	return resp.Rate, err
+// RateMetadata returns the provenance of the exchange rate for the given currency,
+// nil is returned when the rate is not available
+func (p *ProductsDB) RateMetadata(ctx context.Context, currency string) *protos.RateMetadata {
+	r, err := p.rates.Rate(ctx, currency)
+	if err != nil {
+		return nil
+	}
+
+	return r.Metadata
 }
 
-// productList is a hard coded list of products for this example data source
-var productList = []*Product{
-	&Product{
-		ID: 		 1,
-		Name:		 "Latte",
-		Description: "Frothy milky coffee",
-		Price:		 2.45,
-		SKU:		 "abc323",
-		CreatedOn:	 time.Now().UTC().String(),
-		UpdatedOn:	 time.Now().UTC().String(),
-	},
-	&Product{
-		ID:			 2,
-		Name:		 "Espresso",
-		Description: "Short and strong coffee withoud milk",
-		Price:		 1.99,
-		SKU:		 "fjd34",
-		CreatedOn:	 time.Now().UTC().String(),
-		UpdatedOn:	 time.Now().UTC().String(),
-	},
+// CheckCurrency returns ErrInvalidCurrency when the currency service does not support
+// the currency, no currency is the base currency and is always supported
+func (p *ProductsDB) CheckCurrency(ctx context.Context, currency string) error {
+	if currency == "" {
+		return nil
+	}
+
+	_, err := p.getRate(ctx, currency)
+	return err
 }
 
+func (p *ProductsDB) getRate(ctx context.Context, destination string) (float64, error) {
+	r, err := p.rates.Rate(ctx, destination)
+	if errors.Is(err, client.ErrInvalidCurrency) {
+		return -1, fmt.Errorf("%w: %s", ErrInvalidCurrency, err)
+	}
+
+	if err != nil {
+		return -1, err
+	}
+
+	return r.Value, nil
+}
@@ -2,8 +2,13 @@ package data
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/d-vignesh/go-microservice-example/currency/client"
+	"github.com/hashicorp/go-hclog"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -52,6 +57,36 @@ func TestValidProductDoesNotReturnsErr(t *testing.T) {
 	assert.Len(t, err, 0)
 }
 
+func TestProductVariantsAreValidated(t *testing.T) {
+	p := Product {
+		Name: "abc",
+		Price: 1.22,
+		SKU: "abc-abc-abc",
+		Variants: []Variant{
+			{Name: "small", SKU: "abc-abc-sml", Price: 1},
+			{Name: "large", SKU: "abc", Price: 2},
+		},
+	}
+
+	v := NewValidation()
+	err := v.Validate(p)
+	assert.Len(t, err, 1)
+
+	// variant SKUs are unique within the product
+	p.Variants[1].SKU = "abc-abc-sml"
+	err = v.Validate(p)
+	assert.Len(t, err, 1)
+
+	p.Variants[1].SKU = "abc-abc-lrg"
+	p.OptionGroups = []OptionGroup{{Name: "milk"}}
+	err = v.Validate(p)
+	assert.Len(t, err, 1)
+
+	p.OptionGroups[0].Options = []Option{{Name: "oat", PriceDelta: 0.4}, {Name: "soy", PriceDelta: -0.1}}
+	err = v.Validate(p)
+	assert.Len(t, err, 0)
+}
+
 func TestProductsToJSON(t *testing.T) {
 	ps := []*Product{
 		&Product {
@@ -62,4 +97,106 @@ func TestProductsToJSON(t *testing.T) {
 	b := bytes.NewBufferString("")
 	err := ToJSON(ps, b)
 	assert.NoError(t, err)
-}
\ No newline at end of file
+}
+
+func TestGetProductsConvertsPrices(t *testing.T) {
+	f := client.NewFake()
+	f.SetRate("USD", 2)
+
+	db := NewProductsDB(NewMemoryStore(ExampleProducts()), f, hclog.NewNullLogger())
+
+	prods, _, err := db.GetProducts(context.Background(), "USD", ListOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 4.9, prods[0].Price)
+
+	_, _, err = db.GetProducts(context.Background(), "XXX", ListOptions{})
+	assert.True(t, errors.Is(err, ErrInvalidCurrency))
+}
+
+func TestVariantsAreConvertedToRequestedCurrency(t *testing.T) {
+	f := client.NewFake()
+	f.SetRate("USD", 2)
+
+	db := NewProductsDB(NewMemoryStore(nil), f, hclog.NewNullLogger())
+	ctx := context.Background()
+
+	p := Product{
+		Name: "Americano",
+		Price: 2.1,
+		SKU: "ame-ric-ano",
+		Variants: []Variant{{Name: "Large", SKU: "ame-ric-lrg", Price: 2.55}},
+		OptionGroups: []OptionGroup{{Name: "Milk", Options: []Option{{Name: "Oat", PriceDelta: 0.4}}}},
+	}
+	assert.NoError(t, db.AddProduct(ctx, p))
+
+	prods, _, err := db.GetProducts(ctx, "USD", ListOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 4.2, prods[0].Price)
+	assert.Equal(t, 5.1, prods[0].Variants[0].Price)
+	assert.Equal(t, 0.8, prods[0].OptionGroups[0].Options[0].PriceDelta)
+
+	got, err := db.GetProductByID(ctx, prods[0].ID, "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, 5.1, got.Variants[0].Price)
+
+	// converting returns copies, the stored prices are unchanged
+	got, err = db.GetProductByID(ctx, prods[0].ID, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 2.55, got.Variants[0].Price)
+	assert.Equal(t, 0.4, got.OptionGroups[0].Options[0].PriceDelta)
+
+	prods, err = db.SearchProducts(ctx, "oat", "USD", 0)
+	assert.NoError(t, err)
+	assert.Len(t, prods, 1)
+	assert.Equal(t, 0.8, prods[0].OptionGroups[0].Options[0].PriceDelta)
+}
+
+func TestGetProductsPagesInRequestedCurrency(t *testing.T) {
+	f := client.NewFake()
+	f.SetRate("USD", 2)
+
+	db := NewProductsDB(NewMemoryStore(ExampleProducts()), f, hclog.NewNullLogger())
+	ctx := context.Background()
+
+	// the price range is in the requested currency
+	prods, next, err := db.GetProducts(ctx, "USD", ListOptions{MinPrice: 4.5})
+	assert.NoError(t, err)
+	assert.Len(t, prods, 1)
+	assert.Equal(t, "Latte", prods[0].Name)
+	assert.Empty(t, next)
+
+	prods, next, err = db.GetProducts(ctx, "USD", ListOptions{Sort: SortByPrice, Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, prods, 1)
+	assert.Equal(t, "Espresso", prods[0].Name)
+	assert.NotEmpty(t, next)
+
+	prods, next, err = db.GetProducts(ctx, "USD", ListOptions{Sort: SortByPrice, Limit: 1, Cursor: next})
+	assert.NoError(t, err)
+	assert.Len(t, prods, 1)
+	assert.Equal(t, "Latte", prods[0].Name)
+	assert.Empty(t, next)
+
+	_, _, err = db.GetProducts(ctx, "", ListOptions{Limit: MaxListLimit + 1})
+	assert.True(t, errors.Is(err, ErrInvalidListOptions))
+}
+
+func TestRateUpdatesArePublished(t *testing.T) {
+	f := client.NewFake()
+	db := NewProductsDB(NewMemoryStore(ExampleProducts()), f, hclog.NewNullLogger())
+
+	_, _, _, ch, cancel := db.Events().Subscribe(0)
+	defer cancel()
+
+	// the update is only published once the ProductsDB is watching the rates
+	assert.Eventually(t, func() bool {
+		f.SetRate("USD", 1.5)
+
+		select {
+		case ev := <-ch:
+			return ev.Type == EventRateChanged && ev.Currency == "USD"
+		default:
+			return false
+		}
+	}, time.Second, 10*time.Millisecond)
+}
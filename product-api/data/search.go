@@ -0,0 +1,403 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ErrInvalidSearch is returned when a search query or its options are not valid
+var ErrInvalidSearch = fmt.Errorf("invalid search")
+
+// DefaultSearchLimit is the number of results returned when a search has no limit
+const DefaultSearchLimit = 20
+
+// weights of the fields of a product, a term in the name counts more than a term
+// in the description
+const (
+	nameWeight        = 2
+	descriptionWeight = 1
+)
+
+// weights of the ways a query term matches an indexed term
+const (
+	exactMatch  = 1.0
+	prefixMatch = 0.7
+	typoMatch   = 0.5
+)
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// SearchResult is a product matching a search with its relevance score
+type SearchResult struct {
+	ID    int
+	Score float64
+}
+
+// posting is the number of times a term occurs in the fields of a product
+type posting struct {
+	name        int
+	description int
+}
+
+// indexedProduct holds the terms of an indexed product so it can be removed
+type indexedProduct struct {
+	terms  []string
+	length int
+}
+
+// Index is an in-process inverted index over the name, description, variants and
+// options of products.
+// Terms are lower cased and stemmed, a query term matches the indexed terms which are
+// equal, start with it or are within a small edit distance of it.
+// It is safe for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	postings map[string]map[int]*posting
+	products map[int]*indexedProduct
+	length   int
+
+	// terms is the sorted vocabulary, the terms starting with a query term follow it
+	terms []string
+	// lengths has the terms by their number of characters, only the terms with about
+	// the length of a query term can be within its edit distance
+	lengths map[int]map[string]bool
+}
+
+// NewIndex creates an empty Index
+func NewIndex() *Index {
+	return &Index{
+		postings: map[string]map[int]*posting{},
+		products: map[int]*indexedProduct{},
+		lengths:  map[int]map[string]bool{},
+	}
+}
+
+// Add indexes the product, a product which is already indexed is replaced
+func (ix *Index) Add(p *Product) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(p.ID)
+
+	ip := &indexedProduct{}
+	add := func(text string, name bool) {
+		for _, t := range tokenize(text) {
+			t = stem(t)
+
+			ps, ok := ix.postings[t]
+			if !ok {
+				ps = map[int]*posting{}
+				ix.postings[t] = ps
+				ix.addTerm(t)
+			}
+
+			pt, ok := ps[p.ID]
+			if !ok {
+				pt = &posting{}
+				ps[p.ID] = pt
+				ip.terms = append(ip.terms, t)
+			}
+
+			if name {
+				pt.name++
+				ip.length += nameWeight
+			} else {
+				pt.description++
+				ip.length += descriptionWeight
+			}
+		}
+	}
+
+	add(p.Name, true)
+	add(p.Description, false)
+
+	// variants and options are found like words of the description
+	for _, v := range p.Variants {
+		add(v.Name, false)
+	}
+	for _, g := range p.OptionGroups {
+		add(g.Name, false)
+		for _, o := range g.Options {
+			add(o.Name, false)
+		}
+	}
+
+	ix.products[p.ID] = ip
+	ix.length += ip.length
+}
+
+// Remove removes the product with the given id from the index
+func (ix *Index) Remove(id int) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(id)
+}
+
+func (ix *Index) remove(id int) {
+	ip, ok := ix.products[id]
+	if !ok {
+		return
+	}
+
+	for _, t := range ip.terms {
+		delete(ix.postings[t], id)
+		if len(ix.postings[t]) == 0 {
+			delete(ix.postings, t)
+			ix.removeTerm(t)
+		}
+	}
+
+	delete(ix.products, id)
+	ix.length -= ip.length
+}
+
+// addTerm adds a new term to the vocabulary
+func (ix *Index) addTerm(t string) {
+	i := sort.SearchStrings(ix.terms, t)
+	ix.terms = append(ix.terms, "")
+	copy(ix.terms[i+1:], ix.terms[i:])
+	ix.terms[i] = t
+
+	n := len([]rune(t))
+	if ix.lengths[n] == nil {
+		ix.lengths[n] = map[string]bool{}
+	}
+	ix.lengths[n][t] = true
+}
+
+// removeTerm removes a term which no product has anymore from the vocabulary
+func (ix *Index) removeTerm(t string) {
+	i := sort.SearchStrings(ix.terms, t)
+	if i < len(ix.terms) && ix.terms[i] == t {
+		ix.terms = append(ix.terms[:i], ix.terms[i+1:]...)
+	}
+
+	n := len([]rune(t))
+	delete(ix.lengths[n], t)
+	if len(ix.lengths[n]) == 0 {
+		delete(ix.lengths, n)
+	}
+}
+
+// candidates returns the indexed terms which may match the query term q: its stem,
+// the terms starting with q or its stem and the terms with a length within the edit
+// distance tolerated for q. Whether they match is decided by matchWeight.
+func (ix *Index) candidates(q string) map[string]bool {
+	s := stem(q)
+	c := map[string]bool{}
+
+	if _, ok := ix.postings[s]; ok {
+		c[s] = true
+	}
+
+	if len([]rune(q)) >= 2 {
+		for _, prefix := range []string{q, s} {
+			for i := sort.SearchStrings(ix.terms, prefix); i < len(ix.terms) && strings.HasPrefix(ix.terms[i], prefix); i++ {
+				c[ix.terms[i]] = true
+			}
+		}
+	}
+
+	if max := maxEdits(s); max > 0 {
+		n := len([]rune(s))
+		for l := n - max; l <= n+max; l++ {
+			for t := range ix.lengths[l] {
+				c[t] = true
+			}
+		}
+	}
+
+	return c
+}
+
+// Search returns at most limit products matching any of the terms of the query,
+// ordered by their BM25 score. Exact matches score higher than prefix matches,
+// which score higher than matches with a typo.
+func (ix *Index) Search(query string, limit int) []SearchResult {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	if len(ix.products) == 0 {
+		return []SearchResult{}
+	}
+
+	n := float64(len(ix.products))
+	avg := float64(ix.length) / n
+
+	scores := map[int]float64{}
+	for _, q := range tokenize(query) {
+		// a product scores for the best match of each query term, the rarity of the
+		// query term is the number of products it matches in any way
+		best := map[int]float64{}
+
+		for t := range ix.candidates(q) {
+			w := matchWeight(q, t)
+			if w == 0 {
+				continue
+			}
+
+			for id, pt := range ix.postings[t] {
+				tf := float64(pt.name*nameWeight + pt.description*descriptionWeight)
+				l := float64(ix.products[id].length)
+
+				s := w * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*l/avg))
+				if s > best[id] {
+					best[id] = s
+				}
+			}
+		}
+
+		df := float64(len(best))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+		for id, s := range best {
+			scores[id] += idf * s
+		}
+	}
+
+	res := []SearchResult{}
+	for id, s := range scores {
+		res = append(res, SearchResult{ID: id, Score: s})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		return res[i].ID < res[j].ID
+	})
+
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+
+	return res
+}
+
+// matchWeight returns how well the query term q matches the indexed term t, zero
+// is returned when it does not match
+func matchWeight(q, t string) float64 {
+	s := stem(q)
+
+	switch {
+	case s == t:
+		return exactMatch
+	case len([]rune(q)) >= 2 && (strings.HasPrefix(t, q) || strings.HasPrefix(t, s)):
+		return prefixMatch
+	}
+
+	max := maxEdits(s)
+	if max > 0 && editDistance(s, t, max) <= max {
+		return typoMatch
+	}
+
+	return 0
+}
+
+// maxEdits is the number of typos tolerated in a term, short terms must match exactly
+func maxEdits(t string) int {
+	switch n := len([]rune(t)); {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
+	}
+
+	return 0
+}
+
+// editDistance returns the Levenshtein distance between a and b, counting a swap of
+// two adjacent characters as one edit. Distances greater than max are returned as max+1.
+func editDistance(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > max || -d > max {
+		return max + 1
+	}
+
+	// rows of the distance matrix, two rows back are needed for swaps
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = minInt(cur[j], prev2[j-2]+1)
+			}
+
+			rowMin = minInt(rowMin, cur[j])
+		}
+
+		if rowMin > max {
+			return max + 1
+		}
+
+		prev2, prev, cur = prev, cur, prev2
+	}
+
+	return minInt(prev[len(rb)], max+1)
+}
+
+// tokenize splits text into lower cased words of letters and digits
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// stem removes the common English inflections from a lower cased word so that
+// for example "lattes" and "latte" or "steamed" and "steam" are the same term
+func stem(t string) string {
+	if len(t) <= 3 {
+		return t
+	}
+
+	switch {
+	case strings.HasSuffix(t, "sses"):
+		t = t[:len(t)-2]
+	case strings.HasSuffix(t, "ies"):
+		t = t[:len(t)-3] + "y"
+	case strings.HasSuffix(t, "ss"), strings.HasSuffix(t, "us"):
+	case strings.HasSuffix(t, "s"):
+		t = t[:len(t)-1]
+	}
+
+	for _, suffix := range []string{"ing", "ed", "ly"} {
+		if strings.HasSuffix(t, suffix) && len(t)-len(suffix) >= 3 {
+			return t[:len(t)-len(suffix)]
+		}
+	}
+
+	return t
+}
+
+func minInt(v ...int) int {
+	m := v[0]
+	for _, i := range v[1:] {
+		if i < m {
+			m = i
+		}
+	}
+	return m
+}
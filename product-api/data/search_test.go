@@ -0,0 +1,115 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/d-vignesh/go-microservice-example/currency/client"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func searchIDs(ix *Index, q string) []int {
+	ids := []int{}
+	for _, r := range ix.Search(q, 0) {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func TestStem(t *testing.T) {
+	for w, s := range map[string]string{
+		"lattes":   "latte",
+		"berries":  "berry",
+		"glasses":  "glass",
+		"steamed":  "steam",
+		"frothing": "froth",
+		"strong":   "strong",
+		"milk":     "milk",
+		"bus":      "bus",
+	} {
+		assert.Equal(t, s, stem(w), w)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("latte", "latte", 2))
+	assert.Equal(t, 1, editDistance("late", "latte", 2))
+	assert.Equal(t, 1, editDistance("ltate", "latte", 2))
+	assert.Equal(t, 2, editDistance("espreso", "expresso", 2))
+	assert.Equal(t, 2, editDistance("mocha", "latte", 1))
+}
+
+func TestIndexSearch(t *testing.T) {
+	ix := NewIndex()
+	for _, p := range ExampleProducts() {
+		ix.Add(p)
+	}
+	ix.Add(&Product{ID: 3, Name: "Steamed milk", Description: "Milk steamed until it is frothing"})
+
+	// the milk products rank before the Latte, which only mentions milky
+	assert.Equal(t, []int{3, 2, 1}, searchIDs(ix, "milk"))
+	assert.Equal(t, 1, ix.Search("milky", 0)[0].ID)
+
+	// matches in the name rank higher than in the description
+	assert.Equal(t, []int{1}, searchIDs(ix, "LATTES"))
+	assert.Equal(t, []int{3, 1}, searchIDs(ix, "froth"))
+	assert.Equal(t, []int{2}, searchIDs(ix, "espr"))
+	assert.Equal(t, []int{2}, searchIDs(ix, "expresso"))
+	assert.Equal(t, []int{}, searchIDs(ix, "tea"))
+
+	assert.Len(t, ix.Search("coffee", 1), 1)
+
+	ix.Add(&Product{ID: 2, Name: "Ristretto", Description: "Very short coffee"})
+	assert.Equal(t, []int{}, searchIDs(ix, "espresso"))
+	assert.Equal(t, []int{}, searchIDs(ix, "espr"))
+	assert.Equal(t, []int{2}, searchIDs(ix, "ristretto"))
+	assert.Equal(t, []int{2}, searchIDs(ix, "ristreto"))
+
+	ix.Remove(3)
+	assert.Equal(t, []int{1}, searchIDs(ix, "milk"))
+}
+
+func TestSearchProductsFollowsChanges(t *testing.T) {
+	f := client.NewFake()
+	f.SetRate("USD", 2)
+
+	db := NewProductsDB(NewMemoryStore(ExampleProducts()), f, hclog.NewNullLogger())
+	ctx := context.Background()
+
+	prods, err := db.SearchProducts(ctx, "milky", "USD", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "Latte", prods[0].Name)
+	assert.Equal(t, 4.9, prods[0].Price)
+
+	assert.NoError(t, db.AddProduct(ctx, Product{Name: "Mocha", Description: "Chocolate and coffee", Price: 3, SKU: "moc-cha-one"}))
+
+	prods, err = db.SearchProducts(ctx, "chocolate", "", 0)
+	assert.NoError(t, err)
+	assert.Len(t, prods, 1)
+	assert.Equal(t, "Mocha", prods[0].Name)
+
+	assert.NoError(t, db.DeleteProduct(ctx, prods[0].ID, 0))
+
+	prods, err = db.SearchProducts(ctx, "chocolate", "", 0)
+	assert.NoError(t, err)
+	assert.Len(t, prods, 0)
+
+	// products deleted in the store without updating the index do not use up the limit
+	s := NewMemoryStore(ExampleProducts())
+	db = NewProductsDB(s, f, hclog.NewNullLogger())
+	assert.NoError(t, s.Delete(ctx, 1, 0))
+
+	prods, err = db.SearchProducts(ctx, "coffee", "", 1)
+	assert.NoError(t, err)
+	if assert.Len(t, prods, 1) {
+		assert.Equal(t, "Espresso", prods[0].Name)
+	}
+
+	_, err = db.SearchProducts(ctx, " ", "", 0)
+	assert.True(t, errors.Is(err, ErrInvalidSearch))
+
+	_, err = db.SearchProducts(ctx, "latte", "XXX", 0)
+	assert.True(t, errors.Is(err, ErrInvalidCurrency))
+}
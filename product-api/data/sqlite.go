@@ -0,0 +1,46 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/go-hclog"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLiteStore is a ProductStore which persists the products in a SQLite database,
+// the pure Go driver is used so no cgo is required
+type SQLiteStore struct {
+	sqlStore
+}
+
+// NewSQLiteStore opens the SQLite database at path, creating it when it does not exist,
+// and applies the pending schema migrations
+func NewSQLiteStore(ctx context.Context, path string, l hclog.Logger) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_time_format=sqlite")
+	if err != nil {
+		return nil, fmt.Errorf("unable to open product database: %w", err)
+	}
+
+	// SQLite allows a single writer, a single connection avoids busy errors
+	// between concurrent requests
+	db.SetMaxOpenConns(1)
+
+	n, err := migrate(ctx, db, "migrations/sqlite")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	l.Info("opened product database", "path", path, "migrations_applied", n)
+	return &SQLiteStore{sqlStore{db, dialect{like: "LIKE", isConflict: isSQLiteConflict}}}, nil
+}
+
+// isSQLiteConflict returns true when the error is a unique constraint violation
+func isSQLiteConflict(err error) bool {
+	var se *sqlite.Error
+	return errors.As(err, &se) && se.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
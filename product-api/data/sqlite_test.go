@@ -0,0 +1,46 @@
+package data
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	for _, suite := range storeSuites {
+		suite := suite
+		t.Run(suite.name, func(t *testing.T) {
+			s, err := NewSQLiteStore(context.Background(), filepath.Join(t.TempDir(), "products.db"), hclog.NewNullLogger())
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer s.Close()
+
+			// the example products are seeded by the migrations
+			suite.test(t, s)
+		})
+	}
+}
+
+func TestSQLiteStorePersistsAcrossRestarts(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "products.db")
+
+	s, err := NewSQLiteStore(ctx, path, hclog.NewNullLogger())
+	assert.NoError(t, err)
+	assert.NoError(t, s.Create(ctx, &Product{Name: "Mocha", Price: 3.2, SKU: "abc-def-ghi"}))
+	assert.NoError(t, s.Close())
+
+	// reopening must not apply the migrations again
+	s, err = NewSQLiteStore(ctx, path, hclog.NewNullLogger())
+	assert.NoError(t, err)
+	defer s.Close()
+
+	prods, err := s.List(ctx, ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, prods, 3)
+	assert.Equal(t, "Mocha", prods[2].Name)
+}
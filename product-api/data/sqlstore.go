@@ -0,0 +1,1405 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// productColumns are the columns read into a Product, in the order of scanProduct
+const productColumns = `id, name, description, price, sku, variants, option_groups, created_on, updated_on, deleted_on, version`
+
+// categoryColumns are the columns read into a Category, in the order of scanCategory
+const categoryColumns = `id, name, parent_id`
+
+// stockColumns are the columns read into a StockLevel, in the order of scanStock
+const stockColumns = `product_id, variant_sku, on_hand, reserved`
+
+// revisionColumns are the columns read into a Revision, in the order of scanRevision
+const revisionColumns = `id, product_id, type, actor, revised_on, changes, name, description, price, sku, variants, option_groups, created_on, updated_on, deleted_on, version`
+
+// dialect describes the differences between the databases supported by sqlStore
+type dialect struct {
+	// numbered placeholders are written as $1, $2 instead of ?
+	numbered bool
+	// returning is true when INSERT supports RETURNING id, otherwise the id is
+	// read with LastInsertId
+	returning bool
+	// like is the operator for case insensitive LIKE
+	like string
+	// binaryCollation is appended to text columns to order them by bytes
+	binaryCollation string
+	// isConflict returns true when the error is a violation of a unique constraint
+	isConflict func(error) bool
+	// forUpdate is appended to a SELECT to lock the selected rows until the end of the
+	// transaction, it is empty when transactions do not run concurrently
+	forUpdate string
+}
+
+// sqlStore implements the ProductStore methods on a database/sql database, the statements
+// are written with ? placeholders and rewritten for the dialect
+type sqlStore struct {
+	db *sql.DB
+	d  dialect
+}
+
+// Close closes the database
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+// List returns the products selected by the options
+func (s *sqlStore) List(ctx context.Context, opts ListOptions) (Products, error) {
+	q, args, err := s.listQuery(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list products: %w", err)
+	}
+	defer rows.Close()
+
+	prods := Products{}
+	for rows.Next() {
+		p, err := scanProduct(rows)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list products: %w", err)
+		}
+
+		prods = append(prods, p)
+	}
+
+	return prods, rows.Err()
+}
+
+// sortColumns are the columns of the sort fields
+var sortColumns = map[SortField]string{
+	SortByID:      "id",
+	SortByName:    "name",
+	SortByPrice:   "price",
+	SortByCreated: "created_on",
+	SortBySKU:     "sku",
+}
+
+// listQuery builds the query for the list options, the products following the cursor
+// are selected by comparing the sort column and id with the values of the cursor
+func (s *sqlStore) listQuery(opts ListOptions) (string, []interface{}, error) {
+	err := opts.validate()
+	if err != nil {
+		return "", nil, err
+	}
+
+	where := []string{}
+	args := []interface{}{}
+
+	if !opts.IncludeDeleted {
+		where = append(where, `deleted_on IS NULL`)
+	}
+
+	if opts.NamePrefix != "" {
+		where = append(where, `name `+s.d.like+` ? ESCAPE '\'`)
+		args = append(args, escapeLike(opts.NamePrefix)+"%")
+	}
+
+	if opts.MinPrice > 0 {
+		where = append(where, `price >= ?`)
+		args = append(args, opts.MinPrice)
+	}
+
+	if opts.MaxPrice > 0 {
+		where = append(where, `price <= ?`)
+		args = append(args, opts.MaxPrice)
+	}
+
+	if len(opts.Categories) > 0 {
+		where = append(where, `id IN (SELECT product_id FROM product_categories WHERE category_id IN (`+placeholders(len(opts.Categories))+`))`)
+		for _, c := range opts.Categories {
+			args = append(args, c)
+		}
+	}
+
+	col := sortColumns[opts.Sort]
+	if opts.Sort == SortByName || opts.Sort == SortBySKU {
+		// text is ordered by bytes in every store
+		col += s.d.binaryCollation
+	}
+
+	op, dir := ">", "ASC"
+	if opts.Descending {
+		op, dir = "<", "DESC"
+	}
+
+	c, _ := opts.cursor()
+	if c != nil {
+		v, _ := c.sortValue()
+
+		if opts.Sort == SortByID {
+			where = append(where, `id `+op+` ?`)
+			args = append(args, c.ID)
+		} else {
+			where = append(where, `(`+col+` `+op+` ? OR (`+col+` = ? AND id `+op+` ?))`)
+			args = append(args, v, v, c.ID)
+		}
+	}
+
+	q := `SELECT ` + productColumns + ` FROM products`
+	if len(where) > 0 {
+		q += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+
+	q += ` ORDER BY ` + col + ` ` + dir
+	if opts.Sort != SortByID {
+		q += `, id ` + dir
+	}
+
+	if opts.Limit > 0 {
+		q += ` LIMIT ?`
+		args = append(args, opts.Limit)
+	}
+
+	return s.rebind(q), args, nil
+}
+
+// placeholders returns n comma separated placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// productIDsIn returns the condition, starting with AND, which restricts the column to
+// the product ids and its arguments, no condition is returned without ids
+func productIDsIn(column string, productIDs []int) (string, []interface{}) {
+	if len(productIDs) == 0 {
+		return "", nil
+	}
+
+	args := make([]interface{}, len(productIDs))
+	for i, id := range productIDs {
+		args[i] = id
+	}
+
+	return ` AND ` + column + ` IN (` + placeholders(len(productIDs)) + `)`, args
+}
+
+// escapeLike escapes the LIKE wildcards in s
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// Get returns the product with the given id
+func (s *sqlStore) Get(ctx context.Context, id int) (*Product, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+productColumns+` FROM products WHERE id = ? AND deleted_on IS NULL`), id)
+
+	p, err := scanProduct(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrProductNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to get product %d: %w", id, err)
+	}
+
+	return p, nil
+}
+
+// GetBySKU returns the product with the given SKU
+func (s *sqlStore) GetBySKU(ctx context.Context, sku string) (*Product, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+productColumns+` FROM products WHERE sku = ? AND deleted_on IS NULL`), sku)
+
+	p, err := scanProduct(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrProductNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to get product %s: %w", sku, err)
+	}
+
+	return p, nil
+}
+
+// Create inserts the product and sets its id
+func (s *sqlStore) Create(ctx context.Context, p *Product) error {
+	return s.CreateMany(ctx, Products{p})
+}
+
+// CreateMany inserts the products in a single transaction, either all products are
+// created or none
+func (s *sqlStore) CreateMany(ctx context.Context, prods Products) error {
+	created := make(Products, len(prods))
+
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		for i, p := range prods {
+			np := *p
+			err := s.create(ctx, tx, &np)
+			if err != nil {
+				return err
+			}
+
+			created[i] = &np
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// the ids are only set once the transaction has been committed
+	for i, p := range prods {
+		*p = *created[i]
+	}
+
+	return nil
+}
+
+// Update replaces the product with the id of p
+func (s *sqlStore) Update(ctx context.Context, p *Product) error {
+	now := storeTime()
+
+	variants, groups, err := marshalVariants(p)
+	if err != nil {
+		return err
+	}
+
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		old, err := s.lockProduct(ctx, tx, p.ID, `deleted_on IS NULL`)
+		if err != nil {
+			return err
+		}
+
+		if p.Version != 0 && p.Version != old.Version {
+			return ErrVersionMismatch
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			s.rebind(`UPDATE products SET name = ?, description = ?, price = ?, sku = ?, variants = ?, option_groups = ?, updated_on = ?, version = ? WHERE id = ?`),
+			p.Name, p.Description, p.Price, p.SKU, variants, groups, now, old.Version+1, p.ID,
+		)
+		if err != nil {
+			return s.mapError(fmt.Errorf("unable to update product %d: %w", p.ID, err))
+		}
+
+		p.CreatedOn, p.UpdatedOn, p.DeletedOn, p.Version = old.CreatedOn, now, nil, old.Version+1
+		return s.record(ctx, tx, newRevision(ctx, RevisionUpdated, old, p))
+	})
+}
+
+// Delete soft deletes the product with the given id
+func (s *sqlStore) Delete(ctx context.Context, id, version int) error {
+	now := storeTime()
+
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		old, err := s.lockProduct(ctx, tx, id, `deleted_on IS NULL`)
+		if err != nil {
+			return err
+		}
+
+		if version != 0 && version != old.Version {
+			return ErrVersionMismatch
+		}
+
+		_, err = tx.ExecContext(ctx, s.rebind(`UPDATE products SET deleted_on = ?, updated_on = ?, version = version + 1 WHERE id = ?`), now, now, id)
+		if err != nil {
+			return fmt.Errorf("unable to delete product %d: %w", id, err)
+		}
+
+		np := old.clone()
+		np.UpdatedOn, np.DeletedOn, np.Version = now, &now, old.Version+1
+		return s.record(ctx, tx, newRevision(ctx, RevisionDeleted, old, np))
+	})
+}
+
+// Restore undoes the soft delete of the product with the given id
+func (s *sqlStore) Restore(ctx context.Context, id int) error {
+	now := storeTime()
+
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		old, err := s.lockProduct(ctx, tx, id, `deleted_on IS NOT NULL`)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, s.rebind(`UPDATE products SET deleted_on = NULL, updated_on = ?, version = version + 1 WHERE id = ?`), now, id)
+		if err != nil {
+			return s.mapError(fmt.Errorf("unable to restore product %d: %w", id, err))
+		}
+
+		np := old.clone()
+		np.UpdatedOn, np.DeletedOn, np.Version = now, nil, old.Version+1
+		return s.record(ctx, tx, newRevision(ctx, RevisionRestored, old, np))
+	})
+}
+
+// Purge removes the products deleted before the given time, their tags, stock and
+// prices, the revisions of the products are kept
+func (s *sqlStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	n := int64(0)
+
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(
+			ctx,
+			s.rebind(`DELETE FROM product_categories WHERE product_id IN (SELECT id FROM products WHERE deleted_on IS NOT NULL AND deleted_on < ?)`),
+			before.UTC(),
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			s.rebind(`DELETE FROM stock WHERE product_id IN (SELECT id FROM products WHERE deleted_on IS NOT NULL AND deleted_on < ?)`),
+			before.UTC(),
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			s.rebind(`DELETE FROM product_prices WHERE product_id IN (SELECT id FROM products WHERE deleted_on IS NOT NULL AND deleted_on < ?)`),
+			before.UTC(),
+		)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM products WHERE deleted_on IS NOT NULL AND deleted_on < ?`), before.UTC())
+		if err != nil {
+			return err
+		}
+
+		n, err = res.RowsAffected()
+		return err
+	})
+
+	if err != nil {
+		return 0, fmt.Errorf("unable to purge products: %w", err)
+	}
+
+	return int(n), nil
+}
+
+// ListCategories returns all categories ordered by id
+func (s *sqlStore) ListCategories(ctx context.Context) (Categories, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+categoryColumns+` FROM categories ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list categories: %w", err)
+	}
+	defer rows.Close()
+
+	cs := Categories{}
+	for rows.Next() {
+		c, err := scanCategory(rows)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list categories: %w", err)
+		}
+
+		cs = append(cs, c)
+	}
+
+	return cs, rows.Err()
+}
+
+// GetCategory returns the category with the given id
+func (s *sqlStore) GetCategory(ctx context.Context, id int) (*Category, error) {
+	c, err := scanCategory(s.db.QueryRowContext(ctx, s.rebind(`SELECT `+categoryColumns+` FROM categories WHERE id = ?`), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCategoryNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to get category %d: %w", id, err)
+	}
+
+	return c, nil
+}
+
+// CreateCategory inserts the category and sets its id
+func (s *sqlStore) CreateCategory(ctx context.Context, c *Category) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		err := s.checkParent(ctx, tx, c, 0)
+		if err != nil {
+			return err
+		}
+
+		id, err := s.insert(ctx, tx, `INSERT INTO categories (name, parent_id) VALUES (?, ?)`, c.Name, nullID(c.ParentID))
+		if err != nil {
+			return s.mapCategoryError(fmt.Errorf("unable to create category: %w", err))
+		}
+
+		c.ID = id
+		return nil
+	})
+}
+
+// UpdateCategory renames the category with the id of c and moves it to its parent
+func (s *sqlStore) UpdateCategory(ctx context.Context, c *Category) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		err := s.checkParent(ctx, tx, c, c.ID)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, s.rebind(`UPDATE categories SET name = ?, parent_id = ? WHERE id = ?`), c.Name, nullID(c.ParentID), c.ID)
+		if err != nil {
+			return s.mapCategoryError(fmt.Errorf("unable to update category %d: %w", c.ID, err))
+		}
+
+		return checkCategoryAffected(res)
+	})
+}
+
+// DeleteCategory removes the category with the given id and its tags
+func (s *sqlStore) DeleteCategory(ctx context.Context, id int) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		n := 0
+		err := tx.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM categories WHERE parent_id = ?`), id).Scan(&n)
+		if err != nil {
+			return fmt.Errorf("unable to delete category %d: %w", id, err)
+		}
+
+		if n > 0 {
+			return fmt.Errorf("%w: the category has subcategories", ErrCategoryConflict)
+		}
+
+		_, err = tx.ExecContext(ctx, s.rebind(`DELETE FROM product_categories WHERE category_id = ?`), id)
+		if err != nil {
+			return fmt.Errorf("unable to delete category %d: %w", id, err)
+		}
+
+		res, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM categories WHERE id = ?`), id)
+		if err != nil {
+			return fmt.Errorf("unable to delete category %d: %w", id, err)
+		}
+
+		return checkCategoryAffected(res)
+	})
+}
+
+// TagProduct tags the product with the category
+func (s *sqlStore) TagProduct(ctx context.Context, productID, categoryID int) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		err := s.checkTag(ctx, tx, productID, categoryID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			s.rebind(`INSERT INTO product_categories (product_id, category_id) VALUES (?, ?) ON CONFLICT DO NOTHING`),
+			productID, categoryID,
+		)
+		if err != nil {
+			return fmt.Errorf("unable to tag product %d: %w", productID, err)
+		}
+
+		return nil
+	})
+}
+
+// UntagProduct removes the tag of the product
+func (s *sqlStore) UntagProduct(ctx context.Context, productID, categoryID int) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		err := s.checkTag(ctx, tx, productID, categoryID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, s.rebind(`DELETE FROM product_categories WHERE product_id = ? AND category_id = ?`), productID, categoryID)
+		if err != nil {
+			return fmt.Errorf("unable to untag product %d: %w", productID, err)
+		}
+
+		return nil
+	})
+}
+
+// ListTags returns the tags of the products which are not deleted
+func (s *sqlStore) ListTags(ctx context.Context) ([]Tag, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT pc.product_id, pc.category_id FROM product_categories pc
+		JOIN products p ON p.id = pc.product_id
+		WHERE p.deleted_on IS NULL
+		ORDER BY pc.product_id, pc.category_id`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		t := Tag{}
+		err := rows.Scan(&t.ProductID, &t.CategoryID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list tags: %w", err)
+		}
+
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
+
+// ListStock returns the stock levels of the given products which are not deleted
+func (s *sqlStore) ListStock(ctx context.Context, productIDs ...int) (StockLevels, error) {
+	where, args := productIDsIn("s.product_id", productIDs)
+	rows, err := s.db.QueryContext(
+		ctx,
+		s.rebind(`SELECT s.product_id, s.variant_sku, s.on_hand, s.reserved FROM stock s
+		JOIN products p ON p.id = s.product_id
+		WHERE p.deleted_on IS NULL`+where+`
+		ORDER BY s.product_id, s.variant_sku`+s.d.binaryCollation),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list stock: %w", err)
+	}
+	defer rows.Close()
+
+	levels := StockLevels{}
+	for rows.Next() {
+		l, err := scanStock(rows)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list stock: %w", err)
+		}
+
+		levels = append(levels, l)
+	}
+
+	return levels, rows.Err()
+}
+
+// AdjustStock adds delta to the stock on hand of the item, the update only applies
+// when the stock on hand stays at or above the reserved stock so concurrent changes
+// can not oversell the item
+func (s *sqlStore) AdjustStock(ctx context.Context, productID int, variantSKU string, delta int) (*StockLevel, error) {
+	var l *StockLevel
+
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		err := s.checkProduct(ctx, tx, productID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			s.rebind(`INSERT INTO stock (product_id, variant_sku, on_hand, reserved) VALUES (?, ?, 0, 0) ON CONFLICT DO NOTHING`),
+			productID, variantSKU,
+		)
+		if err != nil {
+			return fmt.Errorf("unable to create the stock of product %d: %w", productID, err)
+		}
+
+		res, err := tx.ExecContext(
+			ctx,
+			s.rebind(`UPDATE stock SET on_hand = on_hand + ? WHERE product_id = ? AND variant_sku = ? AND on_hand + ? >= reserved`),
+			delta, productID, variantSKU, delta,
+		)
+		if err != nil {
+			return fmt.Errorf("unable to adjust the stock of product %d: %w", productID, err)
+		}
+
+		l, err = s.getStock(ctx, tx, productID, variantSKU)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return fmt.Errorf("%w: %d of %d items are reserved", ErrInsufficientStock, l.Reserved, l.OnHand)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Reserve reserves the stock of the items of the reservation in a single transaction,
+// an item is only reserved when enough of it is available
+func (s *sqlStore) Reserve(ctx context.Context, r *Reservation) (StockLevels, error) {
+	levels := StockLevels{}
+
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		id, err := s.insert(ctx, tx, `INSERT INTO reservations (expires_on) VALUES (?)`, r.ExpiresOn.UTC())
+		if err != nil {
+			return fmt.Errorf("unable to create reservation: %w", err)
+		}
+
+		for _, it := range r.Items {
+			res, err := tx.ExecContext(
+				ctx,
+				s.rebind(`UPDATE stock SET reserved = reserved + ? WHERE product_id = ? AND variant_sku = ? AND on_hand - reserved >= ?`),
+				it.Quantity, it.ProductID, it.VariantSKU, it.Quantity,
+			)
+			if err != nil {
+				return fmt.Errorf("unable to reserve the stock of product %d: %w", it.ProductID, err)
+			}
+
+			l, err := s.getStock(ctx, tx, it.ProductID, it.VariantSKU)
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%w: product %d %s is not stocked", ErrInvalidStock, it.ProductID, it.VariantSKU)
+			}
+
+			if err != nil {
+				return err
+			}
+
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+
+			if n == 0 {
+				return fmt.Errorf("%w: %d of product %d %s available", ErrInsufficientStock, l.Available, it.ProductID, it.VariantSKU)
+			}
+
+			_, err = tx.ExecContext(
+				ctx,
+				s.rebind(`INSERT INTO reservation_items (reservation_id, product_id, variant_sku, quantity) VALUES (?, ?, ?, ?)`),
+				id, it.ProductID, it.VariantSKU, it.Quantity,
+			)
+			if err != nil {
+				return fmt.Errorf("unable to create reservation: %w", err)
+			}
+
+			levels = append(levels, l)
+		}
+
+		r.ID = id
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return levels, nil
+}
+
+// GetReservation returns the reservation with the given id which has not expired
+func (s *sqlStore) GetReservation(ctx context.Context, id int, now time.Time) (*Reservation, error) {
+	r := &Reservation{ID: id}
+
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, s.rebind(`SELECT expires_on FROM reservations WHERE id = ? AND expires_on > ?`), id, now.UTC()).Scan(&r.ExpiresOn)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrReservationNotFound
+		}
+
+		if err != nil {
+			return err
+		}
+
+		r.ExpiresOn = r.ExpiresOn.UTC()
+		r.Items, err = s.reservationItems(ctx, tx, id)
+		return err
+	})
+
+	if errors.Is(err, ErrReservationNotFound) {
+		return nil, err
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to get reservation %d: %w", id, err)
+	}
+
+	return r, nil
+}
+
+// CommitReservation removes the reserved items from the stock on hand
+func (s *sqlStore) CommitReservation(ctx context.Context, id int, now time.Time) (*Reservation, error) {
+	var r *Reservation
+
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		var err error
+		r, err = s.endReservation(ctx, tx, id, `expires_on > ?`, now, true)
+		return err
+	})
+
+	if errors.Is(err, ErrReservationNotFound) {
+		return nil, err
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to commit reservation %d: %w", id, err)
+	}
+
+	return r, nil
+}
+
+// ReleaseReservation makes the reserved items available again
+func (s *sqlStore) ReleaseReservation(ctx context.Context, id int, now time.Time) (*Reservation, error) {
+	var r *Reservation
+
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		var err error
+		r, err = s.endReservation(ctx, tx, id, `expires_on > ?`, now, false)
+		return err
+	})
+
+	if errors.Is(err, ErrReservationNotFound) {
+		return nil, err
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to release reservation %d: %w", id, err)
+	}
+
+	return r, nil
+}
+
+// ExpireReservations releases the reservations which expired at or before the given time
+func (s *sqlStore) ExpireReservations(ctx context.Context, before time.Time) ([]*Reservation, error) {
+	rs := []*Reservation{}
+
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		ids, err := s.expiredReservations(ctx, tx, before)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			r, err := s.endReservation(ctx, tx, id, `expires_on <= ?`, before, false)
+			if errors.Is(err, ErrReservationNotFound) {
+				// released concurrently
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+
+			rs = append(rs, r)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to expire reservations: %w", err)
+	}
+
+	return rs, nil
+}
+
+// expiredReservations returns the ids of the reservations which expired at or before
+// the given time
+func (s *sqlStore) expiredReservations(ctx context.Context, tx *sql.Tx, before time.Time) ([]int, error) {
+	rows, err := tx.QueryContext(ctx, s.rebind(`SELECT id FROM reservations WHERE expires_on <= ? ORDER BY id`), before.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		id := 0
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// endReservation removes the reservation with the given id when it matches the
+// condition on expires_on, and removes its items from the reserved stock and from the
+// stock on hand when it is committed. The reservation is removed before the stock is
+// changed so that a reservation which is ended concurrently is only ended once.
+func (s *sqlStore) endReservation(ctx context.Context, tx *sql.Tx, id int, cond string, t time.Time, commit bool) (*Reservation, error) {
+	r := &Reservation{ID: id}
+
+	err := tx.QueryRowContext(ctx, s.rebind(`SELECT expires_on FROM reservations WHERE id = ?`), id).Scan(&r.ExpiresOn)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrReservationNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	r.ExpiresOn = r.ExpiresOn.UTC()
+
+	res, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM reservations WHERE id = ? AND `+cond), id, t.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if n == 0 {
+		return nil, ErrReservationNotFound
+	}
+
+	r.Items, err = s.reservationItems(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	q := `UPDATE stock SET reserved = reserved - ? WHERE product_id = ? AND variant_sku = ?`
+	if commit {
+		q = `UPDATE stock SET reserved = reserved - ?, on_hand = on_hand - ? WHERE product_id = ? AND variant_sku = ?`
+	}
+
+	for _, it := range r.Items {
+		args := []interface{}{it.Quantity, it.ProductID, it.VariantSKU}
+		if commit {
+			args = []interface{}{it.Quantity, it.Quantity, it.ProductID, it.VariantSKU}
+		}
+
+		// the stock of purged products is removed, their items are not updated
+		_, err := tx.ExecContext(ctx, s.rebind(q), args...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, s.rebind(`DELETE FROM reservation_items WHERE reservation_id = ?`), id)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// reservationItems returns the items of the reservation with the given id
+func (s *sqlStore) reservationItems(ctx context.Context, tx *sql.Tx, id int) ([]StockItem, error) {
+	rows, err := tx.QueryContext(
+		ctx,
+		s.rebind(`SELECT product_id, variant_sku, quantity FROM reservation_items WHERE reservation_id = ? ORDER BY product_id, variant_sku`+s.d.binaryCollation),
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []StockItem{}
+	for rows.Next() {
+		it := StockItem{}
+		err := rows.Scan(&it.ProductID, &it.VariantSKU, &it.Quantity)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, it)
+	}
+
+	return items, rows.Err()
+}
+
+// getStock returns the stock level of the item using e, sql.ErrNoRows is returned
+// when the item has no stock level
+func (s *sqlStore) getStock(ctx context.Context, e execer, productID int, variantSKU string) (*StockLevel, error) {
+	row := e.QueryRowContext(ctx, s.rebind(`SELECT `+stockColumns+` FROM stock WHERE product_id = ? AND variant_sku = ?`), productID, variantSKU)
+
+	l, err := scanStock(row)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("unable to get the stock of product %d: %w", productID, err)
+	}
+
+	return l, err
+}
+
+// ListPrices returns the prices of the given products which are not deleted
+func (s *sqlStore) ListPrices(ctx context.Context, productIDs ...int) ([]Price, error) {
+	where, args := productIDsIn("pp.product_id", productIDs)
+	rows, err := s.db.QueryContext(
+		ctx,
+		s.rebind(`SELECT pp.product_id, pp.currency, pp.price FROM product_prices pp
+		JOIN products p ON p.id = pp.product_id
+		WHERE p.deleted_on IS NULL`+where+`
+		ORDER BY pp.product_id, pp.currency`),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list prices: %w", err)
+	}
+	defer rows.Close()
+
+	prices := []Price{}
+	for rows.Next() {
+		p := Price{}
+		err := rows.Scan(&p.ProductID, &p.Currency, &p.Price)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list prices: %w", err)
+		}
+
+		prices = append(prices, p)
+	}
+
+	return prices, rows.Err()
+}
+
+// SetPrice sets the price of the product in the currency
+func (s *sqlStore) SetPrice(ctx context.Context, productID int, currency string, price float64) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		err := s.checkProduct(ctx, tx, productID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			s.rebind(`INSERT INTO product_prices (product_id, currency, price) VALUES (?, ?, ?)
+			ON CONFLICT (product_id, currency) DO UPDATE SET price = excluded.price`),
+			productID, currency, price,
+		)
+		if err != nil {
+			return fmt.Errorf("unable to set the %s price of product %d: %w", currency, productID, err)
+		}
+
+		return nil
+	})
+}
+
+// DeletePrice removes the price of the product in the currency
+func (s *sqlStore) DeletePrice(ctx context.Context, productID int, currency string) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		err := s.checkProduct(ctx, tx, productID)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM product_prices WHERE product_id = ? AND currency = ?`), productID, currency)
+		if err != nil {
+			return fmt.Errorf("unable to delete the %s price of product %d: %w", currency, productID, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return ErrPriceNotFound
+		}
+
+		return nil
+	})
+}
+
+// ListRevisions returns the revisions of the product ordered by id
+func (s *sqlStore) ListRevisions(ctx context.Context, productID int) ([]*Revision, error) {
+	revs, err := s.listRevisions(ctx, `product_id = ? ORDER BY id`, productID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the revisions of product %d: %w", productID, err)
+	}
+
+	if len(revs) == 0 {
+		return nil, ErrProductNotFound
+	}
+
+	return revs, nil
+}
+
+// ListRevisionsAsOf returns the latest revision of every product made at or before
+// the given time
+func (s *sqlStore) ListRevisionsAsOf(ctx context.Context, at time.Time) ([]*Revision, error) {
+	revs, err := s.listRevisions(
+		ctx,
+		`id IN (SELECT max(id) FROM product_revisions WHERE revised_on <= ? GROUP BY product_id) ORDER BY product_id`,
+		at.UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the revisions as of %s: %w", at, err)
+	}
+
+	return revs, nil
+}
+
+// listRevisions returns the revisions matching the condition cond
+func (s *sqlStore) listRevisions(ctx context.Context, cond string, args ...interface{}) ([]*Revision, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT `+revisionColumns+` FROM product_revisions WHERE `+cond), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revs := []*Revision{}
+	for rows.Next() {
+		r, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		revs = append(revs, r)
+	}
+
+	return revs, rows.Err()
+}
+
+// record inserts the revision using e and sets its id
+func (s *sqlStore) record(ctx context.Context, e execer, r *Revision) error {
+	changes, err := json.Marshal(r.Changes)
+	if err != nil {
+		return fmt.Errorf("unable to write the changes of product %d: %w", r.ProductID, err)
+	}
+
+	p := r.Product
+	variants, groups, err := marshalVariants(p)
+	if err != nil {
+		return err
+	}
+
+	id, err := s.insert(
+		ctx, e,
+		`INSERT INTO product_revisions (product_id, type, actor, revised_on, changes, name, description, price, sku, variants, option_groups, created_on, updated_on, deleted_on, version)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.ProductID, r.Type, r.Actor, r.RevisedOn, string(changes),
+		p.Name, p.Description, p.Price, p.SKU, variants, groups, p.CreatedOn, p.UpdatedOn, p.DeletedOn, p.Version,
+	)
+	if err != nil {
+		return fmt.Errorf("unable to record the revision of product %d: %w", r.ProductID, err)
+	}
+
+	r.ID = id
+	return nil
+}
+
+// lockProduct returns the product with the given id matching the condition cond and
+// locks it until the end of the transaction
+func (s *sqlStore) lockProduct(ctx context.Context, tx *sql.Tx, id int, cond string) (*Product, error) {
+	row := tx.QueryRowContext(ctx, s.rebind(`SELECT `+productColumns+` FROM products WHERE id = ? AND `+cond+s.d.forUpdate), id)
+
+	p, err := scanProduct(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrProductNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to get product %d: %w", id, err)
+	}
+
+	return p, nil
+}
+
+// checkParent checks that the parent of c exists and is not c or one of its descendants,
+// id is the id of c when it is updated
+func (s *sqlStore) checkParent(ctx context.Context, e execer, c *Category, id int) error {
+	for p := c.ParentID; p != 0; {
+		if p == id {
+			return fmt.Errorf("%w: a category can not be moved below itself", ErrInvalidCategory)
+		}
+
+		parent := sql.NullInt64{}
+		err := e.QueryRowContext(ctx, s.rebind(`SELECT parent_id FROM categories WHERE id = ?`), p).Scan(&parent)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: parent category %d not found", ErrInvalidCategory, p)
+		}
+
+		if err != nil {
+			return fmt.Errorf("unable to check parent category %d: %w", p, err)
+		}
+
+		p = int(parent.Int64)
+	}
+
+	return nil
+}
+
+// checkProduct returns ErrProductNotFound when no product which is not deleted has the given id
+func (s *sqlStore) checkProduct(ctx context.Context, e execer, id int) error {
+	n := 0
+	err := e.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM products WHERE id = ? AND deleted_on IS NULL`), id).Scan(&n)
+	if err != nil {
+		return fmt.Errorf("unable to check product %d: %w", id, err)
+	}
+
+	if n == 0 {
+		return ErrProductNotFound
+	}
+
+	return nil
+}
+
+// checkTag checks that the product and the category of a tag exist
+func (s *sqlStore) checkTag(ctx context.Context, e execer, productID, categoryID int) error {
+	err := s.checkProduct(ctx, e, productID)
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	err = e.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM categories WHERE id = ?`), categoryID).Scan(&n)
+	if err != nil {
+		return fmt.Errorf("unable to check category %d: %w", categoryID, err)
+	}
+
+	if n == 0 {
+		return ErrCategoryNotFound
+	}
+
+	return nil
+}
+
+// execer is implemented by sql.DB and sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// create inserts the product using e, sets its id and records its revision
+func (s *sqlStore) create(ctx context.Context, e execer, p *Product) error {
+	now := storeTime()
+
+	variants, groups, err := marshalVariants(p)
+	if err != nil {
+		return err
+	}
+
+	id, err := s.insert(
+		ctx, e,
+		`INSERT INTO products (name, description, price, sku, variants, option_groups, created_on, updated_on) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.Name, p.Description, p.Price, p.SKU, variants, groups, now, now,
+	)
+	if err != nil {
+		return s.mapError(fmt.Errorf("unable to create product: %w", err))
+	}
+
+	p.ID = id
+	p.CreatedOn, p.UpdatedOn, p.DeletedOn, p.Version = now, now, nil, 1
+	return s.record(ctx, e, newRevision(ctx, RevisionCreated, nil, p))
+}
+
+// insert runs the INSERT statement q using e and returns the id of the new row
+func (s *sqlStore) insert(ctx context.Context, e execer, q string, args ...interface{}) (int, error) {
+	if s.d.returning {
+		id := 0
+		err := e.QueryRowContext(ctx, s.rebind(q+` RETURNING id`), args...).Scan(&id)
+		return id, err
+	}
+
+	res, err := e.ExecContext(ctx, s.rebind(q), args...)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// mapError converts unique constraint violations into ErrProductConflict
+func (s *sqlStore) mapError(err error) error {
+	if s.d.isConflict != nil && s.d.isConflict(err) {
+		return fmt.Errorf("%w: a product with the same SKU already exists", ErrProductConflict)
+	}
+
+	return err
+}
+
+// mapCategoryError converts unique constraint violations into ErrCategoryConflict
+func (s *sqlStore) mapCategoryError(err error) error {
+	if s.d.isConflict != nil && s.d.isConflict(err) {
+		return fmt.Errorf("%w: a category with the same name already exists in the parent", ErrCategoryConflict)
+	}
+
+	return err
+}
+
+// rebind rewrites the ? placeholders of the query for the dialect
+func (s *sqlStore) rebind(q string) string {
+	if !s.d.numbered {
+		return q
+	}
+
+	sb := strings.Builder{}
+	n := 0
+	for _, c := range q {
+		if c != '?' {
+			sb.WriteRune(c)
+			continue
+		}
+
+		n++
+		sb.WriteString("$" + strconv.Itoa(n))
+	}
+
+	return sb.String()
+}
+
+// scanner is implemented by sql.Row and sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanProduct reads the productColumns into a Product
+func scanProduct(s scanner) (*Product, error) {
+	p := &Product{}
+	variants, groups := "", ""
+	deleted := sql.NullTime{}
+
+	err := s.Scan(&p.ID, &p.Name, &p.Description, &p.Price, &p.SKU, &variants, &groups, &p.CreatedOn, &p.UpdatedOn, &deleted, &p.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	err = decodeProduct(p, variants, groups, deleted)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// scanRevision reads the revisionColumns into a Revision
+func scanRevision(s scanner) (*Revision, error) {
+	r := &Revision{Product: &Product{}}
+	p := r.Product
+	changes, variants, groups := "", "", ""
+	deleted := sql.NullTime{}
+
+	err := s.Scan(
+		&r.ID, &r.ProductID, &r.Type, &r.Actor, &r.RevisedOn, &changes,
+		&p.Name, &p.Description, &p.Price, &p.SKU, &variants, &groups, &p.CreatedOn, &p.UpdatedOn, &deleted, &p.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(changes), &r.Changes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the changes of revision %d: %w", r.ID, err)
+	}
+
+	p.ID = r.ProductID
+	r.RevisedOn = r.RevisedOn.UTC()
+
+	err = decodeProduct(p, variants, groups, deleted)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// decodeProduct sets the variants, option groups and deleted time of p from the values
+// they are stored as and normalizes the timestamps of p to UTC
+func decodeProduct(p *Product, variants, groups string, deleted sql.NullTime) error {
+	err := json.Unmarshal([]byte(variants), &p.Variants)
+	if err != nil {
+		return fmt.Errorf("unable to read the variants of product %d: %w", p.ID, err)
+	}
+
+	err = json.Unmarshal([]byte(groups), &p.OptionGroups)
+	if err != nil {
+		return fmt.Errorf("unable to read the option groups of product %d: %w", p.ID, err)
+	}
+
+	// products without variants or options are stored with empty arrays
+	if len(p.Variants) == 0 {
+		p.Variants = nil
+	}
+	if len(p.OptionGroups) == 0 {
+		p.OptionGroups = nil
+	}
+
+	p.CreatedOn = p.CreatedOn.UTC()
+	p.UpdatedOn = p.UpdatedOn.UTC()
+	if deleted.Valid {
+		t := deleted.Time.UTC()
+		p.DeletedOn = &t
+	}
+
+	return nil
+}
+
+// marshalVariants returns the variants and the option groups of the product as the
+// JSON arrays they are stored as
+func marshalVariants(p *Product) (string, string, error) {
+	variants, groups := p.Variants, p.OptionGroups
+	if variants == nil {
+		variants = []Variant{}
+	}
+	if groups == nil {
+		groups = []OptionGroup{}
+	}
+
+	v, err := json.Marshal(variants)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to store the variants of the product: %w", err)
+	}
+
+	g, err := json.Marshal(groups)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to store the option groups of the product: %w", err)
+	}
+
+	return string(v), string(g), nil
+}
+
+// scanCategory reads the categoryColumns into a Category
+func scanCategory(s scanner) (*Category, error) {
+	c := &Category{}
+	parent := sql.NullInt64{}
+
+	err := s.Scan(&c.ID, &c.Name, &parent)
+	if err != nil {
+		return nil, err
+	}
+
+	c.ParentID = int(parent.Int64)
+	return c, nil
+}
+
+// scanStock reads the stockColumns into a StockLevel
+func scanStock(s scanner) (*StockLevel, error) {
+	l := &StockLevel{}
+
+	err := s.Scan(&l.ProductID, &l.VariantSKU, &l.OnHand, &l.Reserved)
+	if err != nil {
+		return nil, err
+	}
+
+	l.Available = l.OnHand - l.Reserved
+	return l, nil
+}
+
+// nullID stores the id 0, meaning no parent, as NULL
+func nullID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+
+	return id
+}
+
+// checkCategoryAffected returns ErrCategoryNotFound when the statement did not change a row
+func checkCategoryAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrCategoryNotFound
+	}
+
+	return nil
+}
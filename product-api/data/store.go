@@ -0,0 +1,150 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// ProductStore persists products, the prices in the store are in the base currency.
+// Deleting a product is a soft delete, deleted products are not returned by Get and
+// can be restored until they are purged.
+//
+// Get, Update, Delete and Restore return ErrProductNotFound when no product has the given id,
+// Create, CreateMany, Update and Restore return ErrProductConflict when the SKU is already used.
+// Every change increments the version of the product, Update and Delete return
+// ErrVersionMismatch when an expected version is given and the product is at another version.
+type ProductStore interface {
+	// List returns the products selected by the options, ErrInvalidListOptions is
+	// returned when the options are not valid
+	List(ctx context.Context, opts ListOptions) (Products, error)
+	// Get returns the product with the given id
+	Get(ctx context.Context, id int) (*Product, error)
+	// GetBySKU returns the product with the given SKU, ErrProductNotFound is returned
+	// when no product has the SKU
+	GetBySKU(ctx context.Context, sku string) (*Product, error)
+	// Create stores a new product and sets its id, timestamps and version
+	Create(ctx context.Context, p *Product) error
+	// CreateMany stores all products and sets their ids, timestamps and versions, when an
+	// error is returned none of the products are stored
+	CreateMany(ctx context.Context, prods Products) error
+	// Update replaces the product with the id of p and sets its UpdatedOn time and
+	// version, the CreatedOn and DeletedOn times of p are ignored. When the version of
+	// p is not zero it is the version the stored product is expected to be at.
+	Update(ctx context.Context, p *Product) error
+	// Delete soft deletes the product with the given id, when version is not zero
+	// it is the version the product is expected to be at
+	Delete(ctx context.Context, id, version int) error
+	// Restore undoes the soft delete of the product with the given id
+	Restore(ctx context.Context, id int) error
+	// Purge permanently removes the products deleted before the given time and
+	// returns the number of removed products
+	Purge(ctx context.Context, before time.Time) (int, error)
+
+	CategoryStore
+	InventoryStore
+	PriceStore
+	HistoryStore
+}
+
+// CategoryStore persists the category tree and the tags which assign products to
+// categories. Tags of deleted products are kept for when the product is restored, but
+// are not returned by ListTags.
+//
+// GetCategory, UpdateCategory, DeleteCategory, TagProduct and UntagProduct return
+// ErrCategoryNotFound when no category has the given id. CreateCategory and UpdateCategory
+// return ErrCategoryConflict when the parent already has a category with the same name
+// and ErrInvalidCategory when the parent does not exist or is the category itself or
+// one of its descendants.
+type CategoryStore interface {
+	// ListCategories returns all categories ordered by id
+	ListCategories(ctx context.Context) (Categories, error)
+	// GetCategory returns the category with the given id
+	GetCategory(ctx context.Context, id int) (*Category, error)
+	// CreateCategory stores a new category and sets its id
+	CreateCategory(ctx context.Context, c *Category) error
+	// UpdateCategory renames the category with the id of c and moves it to its parent
+	UpdateCategory(ctx context.Context, c *Category) error
+	// DeleteCategory removes the category with the given id and its tags, it returns
+	// ErrCategoryConflict when the category has subcategories
+	DeleteCategory(ctx context.Context, id int) error
+	// TagProduct tags the product with the category, tagging a product twice has no
+	// effect. ErrProductNotFound is returned when no product has the given id.
+	TagProduct(ctx context.Context, productID, categoryID int) error
+	// UntagProduct removes the tag of the product, ErrProductNotFound is returned when
+	// no product has the given id
+	UntagProduct(ctx context.Context, productID, categoryID int) error
+	// ListTags returns the tags of the products which are not deleted, ordered by
+	// product and category id
+	ListTags(ctx context.Context) ([]Tag, error)
+}
+
+// InventoryStore persists the stock levels of the products and the reservations of
+// stock. Products with variants have a stock level per variant, identified by the SKU
+// of the variant, other products have a single stock level with an empty variant SKU.
+// The reserved stock of an item is never more than its stock on hand.
+//
+// Reservations which expire are kept until they are released by ExpireReservations,
+// but GetReservation, CommitReservation and ReleaseReservation return
+// ErrReservationNotFound for them.
+type InventoryStore interface {
+	// ListStock returns the stock levels of the given products which are not deleted,
+	// or of all of them when no id is given, ordered by product id and variant SKU
+	ListStock(ctx context.Context, productIDs ...int) (StockLevels, error)
+	// AdjustStock adds delta, which is negative for a decrease, to the stock on hand of
+	// the item and returns its new stock level, the stock level is created when the item
+	// has none. ErrProductNotFound is returned when no product has the given id and
+	// ErrInsufficientStock when the stock on hand would drop below the reserved stock.
+	AdjustStock(ctx context.Context, productID int, variantSKU string, delta int) (*StockLevel, error)
+	// Reserve reserves the stock of the items of the reservation and sets its id, either
+	// all items are reserved or none. The new stock levels of the items are returned in
+	// the order of the items.
+	// ErrInsufficientStock is returned when an item does not have enough available stock
+	// and ErrInvalidStock when an item has no stock level.
+	Reserve(ctx context.Context, r *Reservation) (StockLevels, error)
+	// GetReservation returns the reservation with the given id which has not expired at now
+	GetReservation(ctx context.Context, id int, now time.Time) (*Reservation, error)
+	// CommitReservation removes the reserved items from the stock on hand and removes the
+	// reservation, the committed reservation is returned
+	CommitReservation(ctx context.Context, id int, now time.Time) (*Reservation, error)
+	// ReleaseReservation makes the reserved items available again and removes the
+	// reservation, the released reservation is returned
+	ReleaseReservation(ctx context.Context, id int, now time.Time) (*Reservation, error)
+	// ExpireReservations releases the reservations which expired at or before the given
+	// time and returns them
+	ExpireReservations(ctx context.Context, before time.Time) ([]*Reservation, error)
+}
+
+// PriceStore persists the explicit prices of products in other currencies than the
+// base currency. Prices of deleted products are kept for when the product is restored,
+// but are not returned by ListPrices.
+//
+// SetPrice and DeletePrice return ErrProductNotFound when no product has the given id.
+type PriceStore interface {
+	// ListPrices returns the prices of the given products which are not deleted, or of
+	// all of them when no id is given, ordered by product id and currency
+	ListPrices(ctx context.Context, productIDs ...int) ([]Price, error)
+	// SetPrice sets the price of the product in the currency, replacing an existing price
+	SetPrice(ctx context.Context, productID int, currency string, price float64) error
+	// DeletePrice removes the price of the product in the currency, ErrPriceNotFound is
+	// returned when the product has no price in the currency
+	DeletePrice(ctx context.Context, productID int, currency string) error
+}
+
+// HistoryStore keeps the revisions of the products. Create, CreateMany, Update, Delete
+// and Restore record a revision together with their change, so that either both or
+// neither are stored. The actor of a revision is taken from the context of the change.
+// Revisions are never changed, also not when their product is purged.
+type HistoryStore interface {
+	// ListRevisions returns the revisions of the product ordered by id, ErrProductNotFound
+	// is returned when the product has no revisions
+	ListRevisions(ctx context.Context, productID int) ([]*Revision, error)
+	// ListRevisionsAsOf returns the latest revision of every product made at or before
+	// the given time, ordered by product id
+	ListRevisionsAsOf(ctx context.Context, at time.Time) ([]*Revision, error)
+}
+
+// storeTime returns the current time as stored by the stores, databases keep
+// microseconds so the time is truncated to be the same for all stores
+func storeTime() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
@@ -0,0 +1,659 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testProductStore checks the behaviour every ProductStore must provide, the store
+// must contain the example products
+func testProductStore(t *testing.T, s ProductStore) {
+	ctx := context.Background()
+
+	prods, err := s.List(ctx, ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, prods, 2)
+
+	p := &Product{Name: "Mocha", Price: 3.2, SKU: "abc-def-ghi"}
+	assert.NoError(t, s.Create(ctx, p))
+	assert.Equal(t, 3, p.ID)
+
+	p.Price = 3.5
+	assert.NoError(t, s.Update(ctx, p))
+
+	got, err := s.Get(ctx, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 3.5, got.Price)
+
+	// SKUs are unique
+	err = s.Create(ctx, &Product{Name: "Other", Price: 1, SKU: "abc-def-ghi"})
+	assert.True(t, errors.Is(err, ErrProductConflict), "expected conflict, got %v", err)
+
+	err = s.Update(ctx, &Product{ID: 1, Name: "Latte", Price: 1, SKU: "abc-def-ghi"})
+	assert.True(t, errors.Is(err, ErrProductConflict), "expected conflict, got %v", err)
+
+	// a conflict in a batch stores none of the products
+	err = s.CreateMany(ctx, Products{
+		&Product{Name: "Flat white", Price: 2.8, SKU: "flt-wht-one"},
+		&Product{Name: "Duplicate", Price: 2.8, SKU: "abc-def-ghi"},
+	})
+	assert.True(t, errors.Is(err, ErrProductConflict), "expected conflict, got %v", err)
+
+	prods, err = s.List(ctx, ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, prods, 3)
+
+	batch := Products{
+		&Product{Name: "Flat white", Price: 2.8, SKU: "flt-wht-one"},
+		&Product{Name: "Cortado", Price: 2.6, SKU: "crt-ado-one"},
+	}
+	assert.NoError(t, s.CreateMany(ctx, batch))
+	assert.NotZero(t, batch[0].ID)
+	assert.NotEqual(t, batch[0].ID, batch[1].ID)
+
+	got, err = s.GetBySKU(ctx, "abc-def-ghi")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, got.ID)
+
+	assert.NoError(t, s.Delete(ctx, 3, 0))
+
+	_, err = s.GetBySKU(ctx, "abc-def-ghi")
+	assert.Equal(t, ErrProductNotFound, err)
+
+	_, err = s.Get(ctx, 3)
+	assert.Equal(t, ErrProductNotFound, err)
+	assert.Equal(t, ErrProductNotFound, s.Delete(ctx, 3, 0))
+	assert.Equal(t, ErrProductNotFound, s.Update(ctx, &Product{ID: 3, SKU: "abc-def-ghi"}))
+
+	// variants and option groups are stored with the product
+	p = &Product{
+		Name:  "Americano",
+		Price: 2.1,
+		SKU:   "ame-ric-ano",
+		Variants: []Variant{
+			{Name: "Small", SKU: "ame-ric-sml", Price: 1.9},
+			{Name: "Large", SKU: "ame-ric-lrg", Price: 2.5},
+		},
+		OptionGroups: []OptionGroup{
+			{Name: "Milk", Options: []Option{{Name: "Whole"}, {Name: "Oat", PriceDelta: 0.4}}},
+		},
+	}
+	assert.NoError(t, s.Create(ctx, p))
+
+	got, err = s.Get(ctx, p.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, p.Variants, got.Variants)
+	assert.Equal(t, p.OptionGroups, got.OptionGroups)
+
+	p.Variants, p.OptionGroups = nil, nil
+	assert.NoError(t, s.Update(ctx, p))
+
+	got, err = s.Get(ctx, p.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, got.Variants)
+	assert.Nil(t, got.OptionGroups)
+}
+
+func testProductStoreSoftDelete(t *testing.T, s ProductStore) {
+	ctx := context.Background()
+
+	p := &Product{Name: "Mocha", Price: 3.2, SKU: "abc-def-ghi"}
+	assert.NoError(t, s.Create(ctx, p))
+	assert.False(t, p.CreatedOn.IsZero())
+	assert.Equal(t, p.CreatedOn, p.UpdatedOn)
+	assert.Nil(t, p.DeletedOn)
+
+	created := p.CreatedOn
+
+	// the store sets the timestamps, the values of the product are ignored
+	p.CreatedOn = time.Time{}
+	assert.NoError(t, s.Update(ctx, p))
+
+	got, err := s.Get(ctx, p.ID)
+	assert.NoError(t, err)
+	assert.True(t, got.CreatedOn.Equal(created), "created %s, got %s", created, got.CreatedOn)
+	assert.False(t, got.UpdatedOn.Before(created))
+
+	assert.NoError(t, s.Delete(ctx, p.ID, 0))
+
+	prods, err := s.List(ctx, ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, prods, 2)
+
+	prods, err = s.List(ctx, ListOptions{IncludeDeleted: true})
+	assert.NoError(t, err)
+	assert.Len(t, prods, 3)
+	assert.NotNil(t, prods[2].DeletedOn)
+
+	// a deleted product does not hold its SKU
+	other := &Product{Name: "Other", Price: 1, SKU: "abc-def-ghi"}
+	assert.NoError(t, s.Create(ctx, other))
+
+	err = s.Restore(ctx, p.ID)
+	assert.True(t, errors.Is(err, ErrProductConflict), "expected conflict, got %v", err)
+
+	assert.NoError(t, s.Delete(ctx, other.ID, 0))
+	assert.NoError(t, s.Restore(ctx, p.ID))
+	assert.Equal(t, ErrProductNotFound, s.Restore(ctx, p.ID))
+
+	got, err = s.Get(ctx, p.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, got.DeletedOn)
+
+	// only products deleted before the given time are purged
+	n, err := s.Purge(ctx, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = s.Purge(ctx, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	assert.Equal(t, ErrProductNotFound, s.Restore(ctx, other.ID))
+}
+
+// testProductStoreList checks the sorting, filters and cursors of List, the store
+// must contain the example products
+func testProductStoreList(t *testing.T, s ProductStore) {
+	ctx := context.Background()
+
+	assert.NoError(t, s.CreateMany(ctx, Products{
+		&Product{Name: "Lemonade", Price: 1.5, SKU: "lem-ade-one"},
+		&Product{Name: "Mocha", Price: 3.2, SKU: "moc-cha-one"},
+		&Product{Name: "latte macchiato", Price: 2.45, SKU: "lat-mac-one"},
+	}))
+
+	ids := func(opts ListOptions) []int {
+		prods, err := s.List(ctx, opts)
+		assert.NoError(t, err)
+
+		res := []int{}
+		for _, p := range prods {
+			res = append(res, p.ID)
+		}
+		return res
+	}
+
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, ids(ListOptions{}))
+	assert.Equal(t, []int{5, 4, 3, 2, 1}, ids(ListOptions{Descending: true}))
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, ids(ListOptions{Sort: SortByCreated}))
+
+	// text is ordered by bytes, products with the same value are ordered by id
+	assert.Equal(t, []int{2, 1, 3, 4, 5}, ids(ListOptions{Sort: SortByName}))
+	assert.Equal(t, []int{1, 2, 5, 3, 4}, ids(ListOptions{Sort: SortBySKU}))
+	assert.Equal(t, []int{3, 2, 1, 5, 4}, ids(ListOptions{Sort: SortByPrice}))
+	assert.Equal(t, []int{4, 5, 1, 2, 3}, ids(ListOptions{Sort: SortByPrice, Descending: true}))
+
+	// the name prefix ignores case and treats wildcards as text
+	assert.Equal(t, []int{1, 5}, ids(ListOptions{NamePrefix: "LA"}))
+	assert.Equal(t, []int{}, ids(ListOptions{NamePrefix: "l%"}))
+
+	assert.Equal(t, []int{1, 5}, ids(ListOptions{MinPrice: 2, MaxPrice: 3}))
+	assert.Equal(t, []int{2, 3}, ids(ListOptions{MaxPrice: 2}))
+	assert.Equal(t, []int{1, 4, 5}, ids(ListOptions{MinPrice: 2.45}))
+
+	// following the cursors returns every product once
+	for _, opts := range []ListOptions{
+		{Sort: SortByID},
+		{Sort: SortByName, Descending: true},
+		{Sort: SortByPrice},
+		{Sort: SortByPrice, Descending: true},
+		{Sort: SortByCreated, Descending: true},
+		{Sort: SortBySKU},
+	} {
+		all := ids(opts)
+
+		opts.Limit = 2
+		paged := []int{}
+		for {
+			prods, err := s.List(ctx, opts)
+			assert.NoError(t, err)
+			for _, p := range prods {
+				paged = append(paged, p.ID)
+			}
+
+			if len(prods) < opts.Limit {
+				break
+			}
+			opts.Cursor = newCursor(opts, prods[len(prods)-1])
+		}
+
+		assert.Equal(t, all, paged, "sort %s descending %t", opts.Sort, opts.Descending)
+	}
+
+	_, err := s.List(ctx, ListOptions{Sort: "colour"})
+	assert.True(t, errors.Is(err, ErrInvalidListOptions), "expected invalid options, got %v", err)
+
+	_, err = s.List(ctx, ListOptions{Sort: SortByName, Cursor: newCursor(ListOptions{Sort: SortByPrice}, &Product{ID: 1})})
+	assert.True(t, errors.Is(err, ErrInvalidListOptions), "expected invalid options, got %v", err)
+
+	_, err = s.List(ctx, ListOptions{Cursor: "not a cursor"})
+	assert.True(t, errors.Is(err, ErrInvalidListOptions), "expected invalid options, got %v", err)
+}
+
+// testCategoryStore checks the behaviour every CategoryStore must provide, the store
+// must contain the example products and no categories
+func testCategoryStore(t *testing.T, s ProductStore) {
+	ctx := context.Background()
+
+	coffee := &Category{Name: "Coffee"}
+	assert.NoError(t, s.CreateCategory(ctx, coffee))
+	assert.Equal(t, 1, coffee.ID)
+
+	espresso := &Category{Name: "Espresso drinks", ParentID: coffee.ID}
+	assert.NoError(t, s.CreateCategory(ctx, espresso))
+
+	tea := &Category{Name: "Tea"}
+	assert.NoError(t, s.CreateCategory(ctx, tea))
+
+	// names are unique within the parent
+	err := s.CreateCategory(ctx, &Category{Name: "Coffee"})
+	assert.True(t, errors.Is(err, ErrCategoryConflict), "expected conflict, got %v", err)
+	assert.NoError(t, s.CreateCategory(ctx, &Category{Name: "Coffee", ParentID: tea.ID}))
+
+	err = s.CreateCategory(ctx, &Category{Name: "Other", ParentID: 99})
+	assert.True(t, errors.Is(err, ErrInvalidCategory), "expected invalid category, got %v", err)
+
+	cs, err := s.ListCategories(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, cs, 4)
+	assert.Equal(t, "Espresso drinks", cs[1].Name)
+	assert.Equal(t, coffee.ID, cs[1].ParentID)
+
+	// a category can not be moved below itself
+	err = s.UpdateCategory(ctx, &Category{ID: coffee.ID, Name: "Coffee", ParentID: espresso.ID})
+	assert.True(t, errors.Is(err, ErrInvalidCategory), "expected invalid category, got %v", err)
+
+	err = s.UpdateCategory(ctx, &Category{ID: espresso.ID, Name: "Coffee", ParentID: tea.ID})
+	assert.True(t, errors.Is(err, ErrCategoryConflict), "expected conflict, got %v", err)
+
+	assert.NoError(t, s.UpdateCategory(ctx, &Category{ID: espresso.ID, Name: "Espresso"}))
+	assert.Equal(t, ErrCategoryNotFound, s.UpdateCategory(ctx, &Category{ID: 99, Name: "Other"}))
+
+	got, err := s.GetCategory(ctx, espresso.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, &Category{ID: espresso.ID, Name: "Espresso"}, got)
+
+	_, err = s.GetCategory(ctx, 99)
+	assert.Equal(t, ErrCategoryNotFound, err)
+
+	assert.NoError(t, s.UpdateCategory(ctx, &Category{ID: espresso.ID, Name: "Espresso drinks", ParentID: coffee.ID}))
+
+	// tagging is idempotent
+	assert.NoError(t, s.TagProduct(ctx, 1, coffee.ID))
+	assert.NoError(t, s.TagProduct(ctx, 1, coffee.ID))
+	assert.NoError(t, s.TagProduct(ctx, 2, espresso.ID))
+	assert.NoError(t, s.TagProduct(ctx, 2, tea.ID))
+	assert.Equal(t, ErrProductNotFound, s.TagProduct(ctx, 99, coffee.ID))
+	assert.Equal(t, ErrCategoryNotFound, s.TagProduct(ctx, 1, 99))
+
+	tags, err := s.ListTags(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []Tag{{1, coffee.ID}, {2, espresso.ID}, {2, tea.ID}}, tags)
+
+	prods, err := s.List(ctx, ListOptions{Categories: []int{espresso.ID, tea.ID}})
+	assert.NoError(t, err)
+	assert.Len(t, prods, 1)
+	assert.Equal(t, 2, prods[0].ID)
+
+	assert.NoError(t, s.UntagProduct(ctx, 2, tea.ID))
+	assert.NoError(t, s.UntagProduct(ctx, 2, tea.ID))
+
+	// the tags of deleted products are kept until they are restored or purged
+	assert.NoError(t, s.Delete(ctx, 1, 0))
+
+	tags, err = s.ListTags(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []Tag{{2, espresso.ID}}, tags)
+
+	assert.NoError(t, s.Restore(ctx, 1))
+
+	tags, err = s.ListTags(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []Tag{{1, coffee.ID}, {2, espresso.ID}}, tags)
+
+	// a category with subcategories can not be deleted
+	err = s.DeleteCategory(ctx, coffee.ID)
+	assert.True(t, errors.Is(err, ErrCategoryConflict), "expected conflict, got %v", err)
+
+	assert.NoError(t, s.DeleteCategory(ctx, espresso.ID))
+	assert.Equal(t, ErrCategoryNotFound, s.DeleteCategory(ctx, espresso.ID))
+
+	tags, err = s.ListTags(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []Tag{{1, coffee.ID}}, tags)
+
+	assert.NoError(t, s.Delete(ctx, 1, 0))
+	n, err := s.Purge(ctx, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	assert.NoError(t, s.DeleteCategory(ctx, coffee.ID))
+}
+
+// testInventoryStore checks the behaviour every InventoryStore must provide, the store
+// must contain the example products and no stock
+func testInventoryStore(t *testing.T, s ProductStore) {
+	ctx := context.Background()
+
+	l, err := s.AdjustStock(ctx, 1, "", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, &StockLevel{ProductID: 1, OnHand: 10, Available: 10}, l)
+
+	_, err = s.AdjustStock(ctx, 99, "", 10)
+	assert.Equal(t, ErrProductNotFound, err)
+
+	_, err = s.AdjustStock(ctx, 2, "", -1)
+	assert.True(t, errors.Is(err, ErrInsufficientStock), "expected insufficient stock, got %v", err)
+
+	// a reservation holds all of its items or none
+	now := storeTime()
+	_, err = s.Reserve(ctx, &Reservation{Items: []StockItem{{ProductID: 1, Quantity: 4}, {ProductID: 2, Quantity: 1}}, ExpiresOn: now.Add(time.Hour)})
+	assert.True(t, errors.Is(err, ErrInvalidStock), "expected invalid stock, got %v", err)
+
+	_, err = s.Reserve(ctx, &Reservation{Items: []StockItem{{ProductID: 1, Quantity: 11}}, ExpiresOn: now.Add(time.Hour)})
+	assert.True(t, errors.Is(err, ErrInsufficientStock), "expected insufficient stock, got %v", err)
+
+	r := &Reservation{Items: []StockItem{{ProductID: 1, Quantity: 4}}, ExpiresOn: now.Add(time.Hour)}
+	levels, err := s.Reserve(ctx, r)
+	assert.NoError(t, err)
+	assert.NotZero(t, r.ID)
+	assert.Equal(t, StockLevels{{ProductID: 1, OnHand: 10, Reserved: 4, Available: 6}}, levels)
+
+	got, err := s.GetReservation(ctx, r.ID, now)
+	assert.NoError(t, err)
+	assert.Equal(t, r.Items, got.Items)
+	assert.True(t, r.ExpiresOn.Equal(got.ExpiresOn))
+
+	// reserved stock can not be removed
+	_, err = s.AdjustStock(ctx, 1, "", -7)
+	assert.True(t, errors.Is(err, ErrInsufficientStock), "expected insufficient stock, got %v", err)
+
+	_, err = s.CommitReservation(ctx, r.ID, now)
+	assert.NoError(t, err)
+
+	_, err = s.CommitReservation(ctx, r.ID, now)
+	assert.Equal(t, ErrReservationNotFound, err)
+	_, err = s.ReleaseReservation(ctx, r.ID, now)
+	assert.Equal(t, ErrReservationNotFound, err)
+
+	levels, err = s.ListStock(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, StockLevels{{ProductID: 1, OnHand: 6, Available: 6}}, levels)
+
+	// released and expired reservations return their stock
+	r = &Reservation{Items: []StockItem{{ProductID: 1, Quantity: 2}}, ExpiresOn: now.Add(time.Hour)}
+	_, err = s.Reserve(ctx, r)
+	assert.NoError(t, err)
+
+	_, err = s.ReleaseReservation(ctx, r.ID, now)
+	assert.NoError(t, err)
+
+	expired := &Reservation{Items: []StockItem{{ProductID: 1, Quantity: 3}}, ExpiresOn: now.Add(time.Minute)}
+	_, err = s.Reserve(ctx, expired)
+	assert.NoError(t, err)
+
+	later := now.Add(2 * time.Minute)
+	_, err = s.GetReservation(ctx, expired.ID, later)
+	assert.Equal(t, ErrReservationNotFound, err)
+	_, err = s.CommitReservation(ctx, expired.ID, later)
+	assert.Equal(t, ErrReservationNotFound, err)
+
+	rs, err := s.ExpireReservations(ctx, later)
+	assert.NoError(t, err)
+	if assert.Len(t, rs, 1) {
+		assert.Equal(t, expired.ID, rs[0].ID)
+		assert.Equal(t, expired.Items, rs[0].Items)
+	}
+
+	levels, err = s.ListStock(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, StockLevels{{ProductID: 1, OnHand: 6, Available: 6}}, levels)
+
+	// only the stock of the given products is listed
+	levels, err = s.ListStock(ctx, 1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, StockLevels{{ProductID: 1, OnHand: 6, Available: 6}}, levels)
+	levels, err = s.ListStock(ctx, 2)
+	assert.NoError(t, err)
+	assert.Empty(t, levels)
+
+	// concurrent reservations never reserve more than the available stock
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := s.Reserve(ctx, &Reservation{Items: []StockItem{{ProductID: 1, Quantity: 1}}, ExpiresOn: now.Add(time.Hour)})
+			if err == nil {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+				return
+			}
+
+			assert.True(t, errors.Is(err, ErrInsufficientStock), "expected insufficient stock, got %v", err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 6, reserved)
+
+	// the stock of deleted products is not listed
+	assert.NoError(t, s.Delete(ctx, 1, 0))
+	levels, err = s.ListStock(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, levels)
+}
+
+// testPriceStore checks the behaviour every PriceStore must provide, the store must
+// contain the example products and no prices
+func testPriceStore(t *testing.T, s ProductStore) {
+	ctx := context.Background()
+
+	assert.NoError(t, s.SetPrice(ctx, 2, "USD", 2.5))
+	assert.NoError(t, s.SetPrice(ctx, 1, "USD", 3))
+	assert.NoError(t, s.SetPrice(ctx, 1, "EUR", 2.5))
+
+	// setting a price again replaces it
+	assert.NoError(t, s.SetPrice(ctx, 1, "EUR", 2.7))
+
+	prices, err := s.ListPrices(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []Price{
+		{ProductID: 1, Currency: "EUR", Price: 2.7},
+		{ProductID: 1, Currency: "USD", Price: 3},
+		{ProductID: 2, Currency: "USD", Price: 2.5},
+	}, prices)
+
+	// only the prices of the given products are listed
+	prices, err = s.ListPrices(ctx, 2, 99)
+	assert.NoError(t, err)
+	assert.Equal(t, []Price{{ProductID: 2, Currency: "USD", Price: 2.5}}, prices)
+
+	assert.Equal(t, ErrProductNotFound, s.SetPrice(ctx, 99, "USD", 1))
+	assert.Equal(t, ErrProductNotFound, s.DeletePrice(ctx, 99, "USD"))
+	assert.Equal(t, ErrPriceNotFound, s.DeletePrice(ctx, 2, "EUR"))
+
+	assert.NoError(t, s.DeletePrice(ctx, 1, "USD"))
+	assert.Equal(t, ErrPriceNotFound, s.DeletePrice(ctx, 1, "USD"))
+
+	// the prices of deleted products are not listed and can not be changed
+	assert.NoError(t, s.Delete(ctx, 2, 0))
+	assert.Equal(t, ErrProductNotFound, s.SetPrice(ctx, 2, "EUR", 1))
+
+	prices, err = s.ListPrices(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []Price{{ProductID: 1, Currency: "EUR", Price: 2.7}}, prices)
+}
+
+// testHistoryStore checks the behaviour every HistoryStore must provide, the store must
+// contain the example products
+func testHistoryStore(t *testing.T, s ProductStore) {
+	ctx := WithActor(context.Background(), "alice")
+
+	// the history of the products the store starts with begins with their current state
+	revs, err := s.ListRevisions(ctx, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, revs, 1) {
+		assert.Equal(t, RevisionCreated, revs[0].Type)
+		assert.Equal(t, SystemActor, revs[0].Actor)
+		assert.Equal(t, "Latte", revs[0].Product.Name)
+	}
+
+	_, err = s.ListRevisions(ctx, 99)
+	assert.Equal(t, ErrProductNotFound, err)
+
+	p, err := s.Get(ctx, 1)
+	assert.NoError(t, err)
+	p.Price = 3
+	assert.NoError(t, s.Update(ctx, p))
+
+	// failed changes are not recorded
+	err = s.Update(ctx, &Product{ID: 1, Name: "Latte", Price: 3, SKU: "fjd34"})
+	assert.True(t, errors.Is(err, ErrProductConflict), "expected conflict, got %v", err)
+
+	time.Sleep(time.Millisecond)
+	updated := storeTime()
+	time.Sleep(time.Millisecond)
+
+	assert.NoError(t, s.Delete(WithActor(ctx, "bob"), 1, 0))
+	assert.NoError(t, s.Create(context.Background(), &Product{Name: "Mocha", Price: 3.2, SKU: "abc-def-ghi"}))
+
+	revs, err = s.ListRevisions(ctx, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, revs, 3) {
+		assert.Equal(t, RevisionUpdated, revs[1].Type)
+		assert.Equal(t, "alice", revs[1].Actor)
+		assert.Equal(t, []Change{{Field: "price", Old: json.RawMessage("2.45"), New: json.RawMessage("3")}}, revs[1].Changes)
+		assert.Equal(t, p.UpdatedOn, revs[1].RevisedOn)
+
+		assert.Equal(t, RevisionDeleted, revs[2].Type)
+		assert.Equal(t, "bob", revs[2].Actor)
+		assert.NotNil(t, revs[2].Product.DeletedOn)
+		if assert.Len(t, revs[2].Changes, 1) {
+			assert.Equal(t, "deletedOn", revs[2].Changes[0].Field)
+			assert.Nil(t, revs[2].Changes[0].Old)
+		}
+
+		assert.True(t, revs[0].ID < revs[1].ID && revs[1].ID < revs[2].ID)
+	}
+
+	revs, err = s.ListRevisions(ctx, 3)
+	assert.NoError(t, err)
+	if assert.Len(t, revs, 1) {
+		assert.Equal(t, RevisionCreated, revs[0].Type)
+		assert.Equal(t, AnonymousActor, revs[0].Actor)
+		assert.Equal(t, 3, revs[0].Product.ID)
+	}
+
+	revs, err = s.ListRevisionsAsOf(ctx, updated)
+	assert.NoError(t, err)
+	if assert.Len(t, revs, 2) {
+		assert.Equal(t, 1, revs[0].ProductID)
+		assert.Equal(t, 3.0, revs[0].Product.Price)
+		assert.Nil(t, revs[0].Product.DeletedOn)
+		assert.Equal(t, 2, revs[1].ProductID)
+	}
+
+	revs, err = s.ListRevisionsAsOf(ctx, storeTime())
+	assert.NoError(t, err)
+	if assert.Len(t, revs, 3) {
+		assert.Equal(t, RevisionDeleted, revs[0].Type)
+		assert.Equal(t, 3, revs[2].ProductID)
+	}
+
+	// the history is kept when the product is purged
+	n, err := s.Purge(ctx, storeTime().Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	revs, err = s.ListRevisions(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, revs, 3)
+}
+
+// testVersionStore checks that every ProductStore versions the products and rejects
+// changes made at another version, the store must contain the example products
+func testVersionStore(t *testing.T, s ProductStore) {
+	ctx := context.Background()
+
+	p, err := s.Get(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, p.Version)
+
+	np := &Product{Name: "Mocha", Price: 3.2, SKU: "abc-def-ghi"}
+	assert.NoError(t, s.Create(ctx, np))
+	assert.Equal(t, 1, np.Version)
+
+	// a product read before a change can not be used to overwrite it
+	stale := *p
+	p.Price = 3
+	assert.NoError(t, s.Update(ctx, p))
+	assert.Equal(t, 2, p.Version)
+
+	stale.Price = 4
+	assert.Equal(t, ErrVersionMismatch, s.Update(ctx, &stale))
+	assert.Equal(t, ErrVersionMismatch, s.Delete(ctx, 1, 1))
+
+	// a product without a version is changed whatever its version
+	assert.NoError(t, s.Update(ctx, &Product{ID: 1, Name: "Latte", Price: 2.5, SKU: "abc-def-ghj"}))
+
+	got, err := s.Get(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, got.Version)
+	assert.Equal(t, 2.5, got.Price)
+
+	// a missing product is not found rather than at another version
+	assert.Equal(t, ErrProductNotFound, s.Delete(ctx, 99, 1))
+
+	assert.NoError(t, s.Delete(ctx, 1, 3))
+	assert.NoError(t, s.Restore(ctx, 1))
+
+	got, err = s.Get(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, got.Version)
+
+	// the revisions hold the version of the product after the change
+	revs, err := s.ListRevisions(ctx, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, revs, 5) {
+		for i, r := range revs {
+			assert.Equal(t, i+1, r.Product.Version)
+		}
+	}
+}
+
+// storeSuites are the behaviours every ProductStore is checked for, each suite must be
+// run against a new store containing the example products
+var storeSuites = []struct {
+	name string
+	test func(t *testing.T, s ProductStore)
+}{
+	{"Products", testProductStore},
+	{"SoftDelete", testProductStoreSoftDelete},
+	{"List", testProductStoreList},
+	{"Categories", testCategoryStore},
+	{"Inventory", testInventoryStore},
+	{"Prices", testPriceStore},
+	{"History", testHistoryStore},
+	{"Versions", testVersionStore},
+}
+
+func TestMemoryStore(t *testing.T) {
+	for _, suite := range storeSuites {
+		suite := suite
+		t.Run(suite.name, func(t *testing.T) {
+			suite.test(t, NewMemoryStore(ExampleProducts()))
+		})
+	}
+}
@@ -0,0 +1,607 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/d-vignesh/go-microservice-example/product-api/data"
+)
+
+// media types of the catalogue formats
+const (
+	// CSVType is the media type of a catalogue with a product in every row after the header
+	CSVType = "text/csv"
+	// NDJSONType is the media type of a catalogue with a JSON product on every line
+	NDJSONType = "application/x-ndjson"
+)
+
+// catalogueColumns are the columns of an exported CSV catalogue, variants and option
+// groups are written as JSON. Imports require the sku, name and price columns.
+var catalogueColumns = []string{"id", "sku", "name", "description", "price", "currency", "variants", "optionGroups"}
+
+// maxImportLine is the longest line of an NDJSON import
+const maxImportLine = 1 << 20
+
+// ErrUnsupportedCatalogue is an error message when the format of a catalogue is not supported
+var ErrUnsupportedCatalogue = fmt.Errorf("unsupported catalogue format, use %s or %s", CSVType, NDJSONType)
+
+// ImportRow is the result of importing a row of a catalogue
+// swagger:model
+type ImportRow struct {
+	// line of the row in the imported file
+	Row int `json:"row"`
+
+	// SKU of the product of the row
+	SKU string `json:"sku,omitempty"`
+
+	// what was done with the row, or would be done in a dry run
+	//
+	// enum: created,updated,unchanged,failed
+	Action string `json:"action"`
+
+	// why the row could not be imported
+	Errors []string `json:"errors,omitempty"`
+}
+
+// ImportReport is the result of importing a catalogue
+// swagger:model
+type ImportReport struct {
+	// whether the import was a dry run which did not change any products
+	DryRun bool `json:"dryRun"`
+
+	// the result of every row, in the order of the file
+	Rows []ImportRow `json:"rows"`
+
+	// number of rows with each action
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Failed    int `json:"failed"`
+}
+
+// swagger:route GET /products/export products exportProducts
+// Export the products as CSV or NDJSON, selected with format. The products are streamed
+// in pages so the catalogue is never held in memory, the filters of listProducts apply.
+//
+// produces:
+// - text/csv
+// - application/x-ndjson
+//
+// responses:
+//		200: catalogueResponse
+//		400: errorResponse
+//		404: errorResponse
+
+// Export handles GET requests to download the catalogue
+func (p *Products) Export(rw http.ResponseWriter, r *http.Request) {
+	cur := r.URL.Query().Get("currency")
+
+	opts, err := parseListOptions(r)
+	if err != nil {
+		p.writeProductsError(rw, err)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "csv" && format != "ndjson" {
+		p.writeProductsError(rw, fmt.Errorf("%w: format must be csv or ndjson", data.ErrInvalidListOptions))
+		return
+	}
+
+	opts.Limit = data.MaxListLimit
+
+	// the first page is read before the response is started, so invalid currencies and
+	// options are still reported with their status
+	prods, next, err := p.productDB.GetProducts(r.Context(), cur, opts)
+	if err != nil {
+		p.writeProductsError(rw, err)
+		return
+	}
+
+	var w catalogueWriter
+	if format == "ndjson" {
+		w = newNDJSONWriter(rw)
+		rw.Header().Set("Content-Type", NDJSONType)
+		rw.Header().Set("Content-Disposition", `attachment; filename="products.ndjson"`)
+	} else {
+		w = newCSVWriter(rw)
+		rw.Header().Set("Content-Type", CSVType+"; charset=utf-8")
+		rw.Header().Set("Content-Disposition", `attachment; filename="products.csv"`)
+	}
+
+	p.setRateProvenance(rw, r, cur)
+
+	// downloads of large catalogues take longer than the server write timeout
+	err = http.NewResponseController(rw).SetWriteDeadline(time.Time{})
+	if err != nil {
+		p.l.Error("unable to clear write deadline for export", "error", err)
+	}
+
+	for {
+		for _, prod := range prods {
+			err = w.write(prod)
+			if err != nil {
+				p.l.Error("unable to export product", "id", prod.ID, "error", err)
+				return
+			}
+		}
+
+		w.flush()
+		if f, ok := rw.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		if next == "" {
+			return
+		}
+
+		opts.Cursor = next
+		prods, next, err = p.productDB.GetProducts(r.Context(), cur, opts)
+		if err != nil {
+			// the response has been started, the truncated catalogue can only be logged
+			p.l.Error("unable to export products", "error", err)
+			return
+		}
+	}
+}
+
+// swagger:route POST /products/import products importProducts
+// Import the products of a CSV or NDJSON catalogue, selected with the Content-Type. Every
+// row creates a product or replaces the product with its SKU and is validated like a new
+// product, rows which are not valid are reported and do not stop the import. The rows are
+// read one at a time and the report is sent once the catalogue has been read, so large
+// catalogues are never held in memory. Rows are imported on their own, with dry_run=true
+// nothing is changed.
+//
+// consumes:
+// - text/csv
+// - application/x-ndjson
+//
+// responses:
+//		200: importResponse
+//		400: errorResponse
+//		415: errorResponse
+
+// Import handles POST requests to upload a catalogue
+func (p *Products) Import(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Add("Content-Type", "application/json")
+
+	// catalogues are streamed, they are not kept to be compared with repeats
+	if r.Header.Get(IdempotencyKeyHeader) != "" {
+		rw.WriteHeader(http.StatusBadRequest)
+		data.ToJSON(&GenericError{Message: ErrIdempotencyKeyNotSupported.Error()}, rw)
+		return
+	}
+
+	dryRun := false
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(v)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			data.ToJSON(&GenericError{Message: "dry_run must be true or false"}, rw)
+			return
+		}
+	}
+
+	// uploads of large catalogues take longer than the server read and write timeouts
+	rc := http.NewResponseController(rw)
+	err := rc.SetReadDeadline(time.Time{})
+	if err == nil {
+		err = rc.SetWriteDeadline(time.Time{})
+	}
+	if err != nil {
+		p.l.Error("unable to clear deadlines for import", "error", err)
+	}
+
+	var rows catalogueReader
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mt {
+	case CSVType:
+		cr, err := newCSVReader(r.Body)
+		if err != nil {
+			p.l.Error("unable to read catalogue", "error", err)
+
+			rw.WriteHeader(http.StatusBadRequest)
+			data.ToJSON(&GenericError{Message: err.Error()}, rw)
+			return
+		}
+		rows = cr
+	case NDJSONType, "application/ndjson":
+		rows = newNDJSONReader(r.Body)
+	default:
+		p.l.Error("unsupported catalogue", "content-type", r.Header.Get("Content-Type"))
+
+		rw.WriteHeader(http.StatusUnsupportedMediaType)
+		data.ToJSON(&GenericError{Message: ErrUnsupportedCatalogue.Error()}, rw)
+		return
+	}
+
+	rep, err := newReportWriter(dryRun)
+	if err != nil {
+		p.l.Error("unable to create import report", "error", err)
+
+		rw.WriteHeader(http.StatusInternalServerError)
+		data.ToJSON(&GenericError{Message: err.Error()}, rw)
+		return
+	}
+	defer rep.remove()
+
+	// in a dry run the products of earlier rows are not created, the SKUs are kept to
+	// report later rows with the same SKU as updates
+	seen := map[string]bool{}
+
+	for {
+		prod, line, err := rows.next()
+		if err == io.EOF {
+			break
+		}
+
+		row := ImportRow{Row: line}
+		if prod != nil {
+			row.SKU = prod.SKU
+		}
+
+		// the rest of the catalogue can not be read after an error which is not of a row
+		var rowErr *rowError
+		readErr := err != nil && !errors.As(err, &rowErr)
+
+		switch {
+		case rowErr != nil:
+			row.Action, row.Errors = data.ImportFailed, []string{rowErr.Error()}
+		case readErr:
+			p.l.Error("unable to read catalogue", "error", err)
+			row.Action, row.Errors = data.ImportFailed, []string{err.Error()}
+		default:
+			row.Action, row.Errors = p.importProduct(r, prod, dryRun, seen)
+		}
+
+		err = rep.write(row)
+		if err != nil {
+			p.l.Error("unable to write import report", "error", err)
+
+			rw.WriteHeader(http.StatusInternalServerError)
+			data.ToJSON(&GenericError{Message: err.Error()}, rw)
+			return
+		}
+
+		if readErr {
+			break
+		}
+	}
+
+	err = rep.send(rw)
+	if err != nil {
+		p.l.Error("unable to send import report", "error", err)
+	}
+}
+
+// importProduct validates and imports the product of a row and returns the action taken
+// and the errors of a failed row
+func (p *Products) importProduct(r *http.Request, prod *data.Product, dryRun bool, seen map[string]bool) (string, []string) {
+	errs := p.v.Validate(prod)
+	if len(errs) != 0 {
+		return data.ImportFailed, errs.Errors()
+	}
+
+	action, err := p.productDB.ImportProduct(r.Context(), *prod, dryRun)
+	if err != nil {
+		p.l.Error("unable to import product", "sku", prod.SKU, "error", err)
+		return data.ImportFailed, []string{err.Error()}
+	}
+
+	if dryRun {
+		if seen[prod.SKU] && action == data.ImportCreated {
+			action = data.ImportUpdated
+		}
+		seen[prod.SKU] = true
+	}
+
+	return action, nil
+}
+
+// rowError is an error of a single row of a catalogue, the following rows can be read
+type rowError struct {
+	err error
+}
+
+func (e *rowError) Error() string { return e.err.Error() }
+
+func (e *rowError) Unwrap() error { return e.err }
+
+// catalogueReader reads the products of a catalogue one row at a time
+type catalogueReader interface {
+	// next returns the product of the next row and the line it starts on, io.EOF is
+	// returned after the last row. Rows which are not products return a rowError.
+	next() (*data.Product, int, error)
+}
+
+// csvReader reads the products of a CSV catalogue, columns are matched by the header
+type csvReader struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+// newCSVReader reads the header of the CSV catalogue in r
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the CSV header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, c := range header {
+		columns[strings.TrimSpace(c)] = i
+	}
+
+	for _, c := range []string{"sku", "name", "price"} {
+		if _, ok := columns[c]; !ok {
+			return nil, fmt.Errorf("the CSV header has no %s column", c)
+		}
+	}
+
+	return &csvReader{r: cr, columns: columns}, nil
+}
+
+func (c *csvReader) next() (*data.Product, int, error) {
+	record, err := c.r.Read()
+
+	var perr *csv.ParseError
+	if errors.As(err, &perr) {
+		return nil, perr.StartLine, &rowError{err}
+	}
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	line, _ := c.r.FieldPos(0)
+	value := func(column string) string {
+		i, ok := c.columns[column]
+		if !ok {
+			return ""
+		}
+
+		return strings.TrimSpace(record[i])
+	}
+
+	prod := &data.Product{Name: value("name"), Description: value("description"), SKU: value("sku")}
+
+	if v := value("currency"); v != "" {
+		return prod, line, &rowError{fmt.Errorf("prices must be in the base currency, not %s", v)}
+	}
+
+	if v := value("price"); v != "" {
+		prod.Price, err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			return prod, line, &rowError{fmt.Errorf("price must be a number")}
+		}
+	}
+
+	if v := value("variants"); v != "" {
+		err = json.Unmarshal([]byte(v), &prod.Variants)
+		if err != nil {
+			return prod, line, &rowError{fmt.Errorf("variants must be a JSON array: %w", err)}
+		}
+	}
+
+	if v := value("optionGroups"); v != "" {
+		err = json.Unmarshal([]byte(v), &prod.OptionGroups)
+		if err != nil {
+			return prod, line, &rowError{fmt.Errorf("optionGroups must be a JSON array: %w", err)}
+		}
+	}
+
+	return prod, line, nil
+}
+
+// ndjsonReader reads the products of an NDJSON catalogue, blank lines are skipped
+type ndjsonReader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func newNDJSONReader(r io.Reader) *ndjsonReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxImportLine)
+
+	return &ndjsonReader{s: s}
+}
+
+func (n *ndjsonReader) next() (*data.Product, int, error) {
+	for n.s.Scan() {
+		n.line++
+
+		line := n.s.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+
+		prod := &data.Product{}
+		err := json.Unmarshal(line, prod)
+		if err != nil {
+			return nil, n.line, &rowError{fmt.Errorf("invalid product: %w", err)}
+		}
+
+		if prod.Currency != "" {
+			return prod, n.line, &rowError{fmt.Errorf("prices must be in the base currency, not %s", prod.Currency)}
+		}
+
+		// the id and version are ignored, products are matched by SKU
+		prod.ID, prod.Version = 0, 0
+		return prod, n.line, nil
+	}
+
+	err := n.s.Err()
+	if err == nil {
+		return nil, 0, io.EOF
+	}
+
+	return nil, n.line + 1, fmt.Errorf("unable to read line %d: %w", n.line+1, err)
+}
+
+// catalogueWriter writes the products of an export
+type catalogueWriter interface {
+	write(p *data.Product) error
+	// flush writes the buffered products to the response
+	flush()
+}
+
+// csvWriter writes a CSV catalogue with the catalogueColumns
+type csvWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) write(p *data.Product) error {
+	if !c.header {
+		c.header = true
+
+		err := c.w.Write(catalogueColumns)
+		if err != nil {
+			return err
+		}
+	}
+
+	variants, groups := "", ""
+	if len(p.Variants) > 0 {
+		d, _ := json.Marshal(p.Variants)
+		variants = string(d)
+	}
+	if len(p.OptionGroups) > 0 {
+		d, _ := json.Marshal(p.OptionGroups)
+		groups = string(d)
+	}
+
+	return c.w.Write([]string{
+		strconv.Itoa(p.ID),
+		p.SKU,
+		p.Name,
+		p.Description,
+		strconv.FormatFloat(p.Price, 'f', -1, 64),
+		p.Currency,
+		variants,
+		groups,
+	})
+}
+
+func (c *csvWriter) flush() {
+	// an empty catalogue still has a header
+	if !c.header {
+		c.header = true
+		c.w.Write(catalogueColumns)
+	}
+
+	c.w.Flush()
+}
+
+// ndjsonWriter writes a JSON product on every line
+type ndjsonWriter struct {
+	e *json.Encoder
+}
+
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	return &ndjsonWriter{e: json.NewEncoder(w)}
+}
+
+func (n *ndjsonWriter) write(p *data.Product) error {
+	return n.e.Encode(p)
+}
+
+func (n *ndjsonWriter) flush() {}
+
+// reportWriter writes an ImportReport, the rows are kept in a temporary file so the report
+// of a large import is never held in memory. The rows are only sent once the catalogue has
+// been read. HTTP/1.1 servers stop reading the request once the response
+// is started, so the report can only be sent after the last row.
+type reportWriter struct {
+	f      *os.File
+	w      *bufio.Writer
+	report ImportReport
+	rows   int
+}
+
+func newReportWriter(dryRun bool) (*reportWriter, error) {
+	f, err := os.CreateTemp("", "product-import-*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	return &reportWriter{f: f, w: bufio.NewWriter(f), report: ImportReport{DryRun: dryRun}}, nil
+}
+
+// write adds the row to the report
+func (r *reportWriter) write(row ImportRow) error {
+	switch row.Action {
+	case data.ImportCreated:
+		r.report.Created++
+	case data.ImportUpdated:
+		r.report.Updated++
+	case data.ImportUnchanged:
+		r.report.Unchanged++
+	default:
+		r.report.Failed++
+	}
+
+	d, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	if r.rows > 0 {
+		d = append([]byte(","), d...)
+	}
+	r.rows++
+
+	_, err = r.w.Write(d)
+	return err
+}
+
+// send writes the report with the number of rows with each action to w
+func (r *reportWriter) send(w io.Writer) error {
+	err := r.w.Flush()
+	if err != nil {
+		return err
+	}
+
+	_, err = r.f.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, `{"dryRun":%t,"rows":[`, r.report.DryRun)
+
+	_, err = io.Copy(w, r.f)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(
+		w, `],"created":%d,"updated":%d,"unchanged":%d,"failed":%d}`+"\n",
+		r.report.Created, r.report.Updated, r.report.Unchanged, r.report.Failed,
+	)
+	return err
+}
+
+// remove deletes the temporary file of the report
+func (r *reportWriter) remove() {
+	r.f.Close()
+	os.Remove(r.f.Name())
+}
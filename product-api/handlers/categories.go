@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/d-vignesh/go-microservice-example/product-api/data"
+)
+
+// KeyCategory is a key used for the Category in the context
+type KeyCategory struct{}
+
+// swagger:route GET /categories categories listCategories
+// Returns all categories, parents are referenced by id so clients can build the tree.
+// The product count of a category includes the products of its descendants.
+// responses:
+//		200: categoriesResponse
+
+// ListCategories handles GET requests and returns all categories
+func (p *Products) ListCategories(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Add("Content-Type", "application/json")
+
+	cs, err := p.productDB.GetCategories(r.Context())
+	if err != nil {
+		p.writeCategoryError(rw, err)
+		return
+	}
+
+	err = data.ToJSON(cs, rw)
+	if err != nil {
+		p.l.Error("unable to serialize categories", "error", err)
+	}
+}
+
+// swagger:route GET /categories/{categoryID} categories listSingleCategory
+// Returns a single category with the number of products in it and its descendants
+// responses:
+//		200: categoryResponse
+//		404: errorResponse
+
+// ListSingleCategory handles GET requests and returns a single category
+func (p *Products) ListSingleCategory(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Add("Content-Type", "application/json")
+
+	c, err := p.productDB.GetCategoryByID(r.Context(), getCategoryID(r))
+	if err != nil {
+		p.writeCategoryError(rw, err)
+		return
+	}
+
+	err = data.ToJSON(c, rw)
+	if err != nil {
+		p.l.Error("unable to serialize category", "error", err)
+	}
+}
+
+// swagger:route POST /categories categories createCategory
+// Create a new category, below the parent when a parent id is given
+//
+// responses:
+//		200: categoryResponse
+//		409: errorResponse
+//		422: errorValidation
+
+// CreateCategory handles POST requests to add a new category
+func (p *Products) CreateCategory(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Add("Content-Type", "application/json")
+
+	c := r.Context().Value(KeyCategory{}).(data.Category)
+
+	p.l.Debug("inserting category", "name", c.Name)
+
+	nc, err := p.productDB.AddCategory(r.Context(), c)
+	if err != nil {
+		p.writeCategoryError(rw, err)
+		return
+	}
+
+	err = data.ToJSON(nc, rw)
+	if err != nil {
+		p.l.Error("unable to serialize category", "error", err)
+	}
+}
+
+// swagger:route PUT /categories/{categoryID} categories updateCategory
+// Rename a category or move it to another parent
+//
+// responses:
+//		200: categoryResponse
+//		404: errorResponse
+//		409: errorResponse
+//		422: errorValidation
+
+// UpdateCategory handles PUT requests to update a category
+func (p *Products) UpdateCategory(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Add("Content-Type", "application/json")
+
+	c := r.Context().Value(KeyCategory{}).(data.Category)
+	c.ID = getCategoryID(r)
+
+	p.l.Debug("updating category", "id", c.ID)
+
+	nc, err := p.productDB.UpdateCategory(r.Context(), c)
+	if err != nil {
+		p.writeCategoryError(rw, err)
+		return
+	}
+
+	err = data.ToJSON(nc, rw)
+	if err != nil {
+		p.l.Error("unable to serialize category", "error", err)
+	}
+}
+
+// swagger:route DELETE /categories/{categoryID} categories deleteCategory
+// Delete a category without subcategories, the products in it are untagged
+//
+// responses:
+//		204: noContentResponse
+//		404: errorResponse
+//		409: errorResponse
+
+// DeleteCategory handles DELETE requests to remove a category
+func (p *Products) DeleteCategory(rw http.ResponseWriter, r *http.Request) {
+	id := getCategoryID(r)
+
+	p.l.Debug("deleting category", "id", id)
+
+	err := p.productDB.DeleteCategory(r.Context(), id)
+	if err != nil {
+		p.writeCategoryError(rw, err)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// swagger:route GET /products/{id}/categories categories listProductCategories
+// Returns the categories the product is tagged with
+// responses:
+//		200: categoriesResponse
+//		404: errorResponse
+
+// ListProductCategories handles GET requests and returns the categories of a product
+func (p *Products) ListProductCategories(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Add("Content-Type", "application/json")
+
+	cs, err := p.productDB.GetProductCategories(r.Context(), getProductID(r))
+	if err != nil {
+		p.writeCategoryError(rw, err)
+		return
+	}
+
+	err = data.ToJSON(cs, rw)
+	if err != nil {
+		p.l.Error("unable to serialize categories", "error", err)
+	}
+}
+
+// swagger:route PUT /products/{id}/categories/{categoryID} categories tagProduct
+// Tag the product with the category, a product can be tagged with many categories
+//
+// responses:
+//		204: noContentResponse
+//		404: errorResponse
+
+// TagProduct handles PUT requests to tag a product with a category
+func (p *Products) TagProduct(rw http.ResponseWriter, r *http.Request) {
+	err := p.productDB.TagProduct(r.Context(), getProductID(r), getCategoryID(r))
+	if err != nil {
+		p.writeCategoryError(rw, err)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// swagger:route DELETE /products/{id}/categories/{categoryID} categories untagProduct
+// Remove the category from the product
+//
+// responses:
+//		204: noContentResponse
+//		404: errorResponse
+
+// UntagProduct handles DELETE requests to remove a category from a product
+func (p *Products) UntagProduct(rw http.ResponseWriter, r *http.Request) {
+	err := p.productDB.UntagProduct(r.Context(), getProductID(r), getCategoryID(r))
+	if err != nil {
+		p.writeCategoryError(rw, err)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// writeCategoryError writes the error returned by a category operation
+func (p *Products) writeCategoryError(rw http.ResponseWriter, err error) {
+	p.l.Error("unable to handle category request", "error", err)
+
+	switch {
+	case errors.Is(err, data.ErrCategoryNotFound), errors.Is(err, data.ErrProductNotFound):
+		rw.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, data.ErrCategoryConflict):
+		rw.WriteHeader(http.StatusConflict)
+	case errors.Is(err, data.ErrInvalidCategory):
+		rw.WriteHeader(http.StatusUnprocessableEntity)
+	default:
+		rw.WriteHeader(http.StatusInternalServerError)
+	}
+
+	data.ToJSON(&GenericError{Message: err.Error()}, rw)
+}
+
+// getCategoryID returns the category ID from the URL
+// Panics if it cannot convert the ID to an integer
+// this should never happen as the router ensures that
+// this is a valid number
+func getCategoryID(r *http.Request) int {
+	id, err := strconv.Atoi(mux.Vars(r)["categoryID"])
+	if err != nil {
+		panic(err)
+	}
+
+	return id
+}
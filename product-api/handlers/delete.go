@@ -1,17 +1,20 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/d-vignesh/go-microservice-example/product-api/data"
 )
 
 // swagger:route DELETE /products/{id} products deleteProduct
-// Delete the product with given ID
+// Delete the product with given ID, deleted products can be restored until they are purged
 //
 // responses:
 //		201: noContentResponse
 //		404: errorResponse
+//		412: errorResponse
+//		428: errorResponse
 //		501: errorResponse
 
 // Delete handles DELETE request and removes item from database
@@ -20,8 +23,14 @@ func (p *Products) Delete(rw http.ResponseWriter, r *http.Request) {
 
 	p.l.Debug("deleting record id", id)
 
-	err := p.productDB.DeleteProduct(id)
-	if err == data.ErrProductNotFound {
+	version, err := p.expectedVersion(r, id)
+	if err != nil {
+		p.writePreconditionError(rw, err)
+		return
+	}
+
+	err = p.productDB.DeleteProduct(r.Context(), id, version)
+	if errors.Is(err, data.ErrProductNotFound) {
 		p.l.Error("product with given id does not exist")
 
 		rw.WriteHeader(http.StatusNotFound)
@@ -29,6 +38,11 @@ func (p *Products) Delete(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if errors.Is(err, data.ErrVersionMismatch) {
+		p.writePreconditionError(rw, err)
+		return
+	}
+
 	if err != nil {
 		p.l.Error("unable to delete record", "error", err)
 
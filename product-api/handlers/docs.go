@@ -43,6 +43,15 @@ type productsResponseWrapper struct {
 	// all current products
 	// in: body
 	Body []data.Product
+
+	// Provenance of the exchange rate used to convert the prices,
+	// only set when a currency is requested
+	// in: header
+	RateProvenance string `json:"X-Rate-Provenance"`
+
+	// URL of the next page of products, only set when more products follow
+	// in: header
+	Link string `json:"Link"`
 }
 
 // Data structure representing a single product
@@ -51,6 +60,114 @@ type productResponseWrapper struct {
 	// newly created product
 	// in: body
 	Body data.Product
+
+	// Provenance of the exchange rate used to convert the price,
+	// only set when a currency is requested
+	// in: header
+	RateProvenance string `json:"X-Rate-Provenance"`
+
+	// Strong ETag of the version of the product, sent as If-Match to change
+	// the product only when it is still at this version. It does not change with
+	// the currency, the exchange rates or the stock, so it must not be sent as
+	// If-None-Match to cache the product
+	// in: header
+	ETag string `json:"ETag"`
+}
+
+// A list of categories
+// swagger:response categoriesResponse
+type categoriesResponseWrapper struct {
+	// all categories
+	// in: body
+	Body []data.Category
+}
+
+// Data structure representing a single category
+// swagger:response categoryResponse
+type categoryResponseWrapper struct {
+	// the category
+	// in: body
+	Body data.Category
+}
+
+// The stock levels of a product
+// swagger:response stockLevelsResponse
+type stockLevelsResponseWrapper struct {
+	// stock levels of the product and its variants
+	// in: body
+	Body []data.StockLevel
+}
+
+// Data structure representing the stock of a product or variant
+// swagger:response stockLevelResponse
+type stockLevelResponseWrapper struct {
+	// the stock level
+	// in: body
+	Body data.StockLevel
+}
+
+// Data structure representing a reservation of stock
+// swagger:response reservationResponse
+type reservationResponseWrapper struct {
+	// the reservation
+	// in: body
+	Body data.Reservation
+}
+
+// The revisions of a product
+// swagger:response historyResponse
+type historyResponseWrapper struct {
+	// revisions of the product from the oldest to the latest
+	// in: body
+	Body []data.Revision
+}
+
+// The native prices of a product
+// swagger:response pricesResponse
+type pricesResponseWrapper struct {
+	// native prices of the product ordered by currency
+	// in: body
+	Body []data.Price
+}
+
+// Data structure representing the native price of a product in a currency
+// swagger:response priceResponse
+type priceResponseWrapper struct {
+	// the price
+	// in: body
+	Body data.Price
+}
+
+// A stream of Server-Sent Events, products events contain all products,
+// product events a single created, updated or restored product or a product whose
+// availability changed, and deleted events
+// the id of a deleted product
+// swagger:response productStreamResponse
+type productStreamResponseWrapper struct {
+	// stream of events
+	// in: body
+	Body []data.Product
+}
+
+// A catalogue of products, a CSV file with the columns id, sku, name, description,
+// price, currency, variants and optionGroups or a JSON product on every line
+// swagger:response catalogueResponse
+type catalogueResponseWrapper struct {
+	// the products
+	// in: body
+	Body string
+
+	// Name of the file the catalogue is saved as
+	// in: header
+	ContentDisposition string `json:"Content-Disposition"`
+}
+
+// The result of every row of an import
+// swagger:response importResponse
+type importResponseWrapper struct {
+	// the report of the import
+	// in: body
+	Body ImportReport
 }
 
 // no content is returned by this API endpoint
@@ -58,6 +175,14 @@ type productResponseWrapper struct {
 type noContentResponseWrapper struct {
 }
 
+// no content is returned, the ETag is the new version of the product
+// swagger:response versionResponse
+type versionResponseWrapper struct {
+	// Strong ETag of the new version of the product
+	// in: header
+	ETag string `json:"ETag"`
+}
+
 // swagger:parameters updateProduct createProduct
 type productParamsWrapper struct {
 	// Product data structure to update or create.
@@ -67,7 +192,81 @@ type productParamsWrapper struct {
 	Body data.Product
 }
 
-// swagger:parameters listSingleProduct deleteProduct
+// swagger:parameters patchProduct
+type productPatchParamsWrapper struct {
+	// A JSON Merge Patch object such as {"price": 2.5}, or a JSON Patch array of
+	// operations such as [{"op": "replace", "path": "/price", "value": 2.5}]
+	// in: body
+	// required: true
+	Body interface{}
+}
+
+// swagger:parameters createCategory updateCategory
+type categoryParamsWrapper struct {
+	// Category data structure to update or create.
+	// Note: the id and productCount fields are ignored by update and create operations
+	// in: body
+	// required: true
+	Body data.Category
+}
+
+// swagger:parameters adjustStock
+type stockAdjustmentParamsWrapper struct {
+	// Change of the stock of the product, or of one of its variants
+	// in: body
+	// required: true
+	Body data.StockAdjustment
+}
+
+// swagger:parameters createReservation
+type reservationParamsWrapper struct {
+	// Items to reserve.
+	// Note: the id and expiresOn fields are ignored
+	// in: body
+	// required: true
+	Body data.Reservation
+
+	// Time the items are reserved for, such as 10m, at most 24h, default 15m
+	// in: query
+	// required: false
+	TTL string `json:"ttl"`
+}
+
+// swagger:parameters setPrice
+type priceParamsWrapper struct {
+	// Native price of the product.
+	// Note: the productId and currency fields are ignored
+	// in: body
+	// required: true
+	Body data.Price
+}
+
+// swagger:parameters setPrice deletePrice
+type currencyParamsWrapper struct {
+	// the currency of the price, such as USD or a custom currency such as BEANS
+	// in: path
+	// required: true
+	// pattern: [A-Z][A-Z0-9]{2,9}
+	Currency string `json:"currency"`
+}
+
+// swagger:parameters listSingleReservation commitReservation releaseReservation
+type reservationIDParamsWrapper struct {
+	// the ID of the reservation for which the operation relates
+	// in: path
+	// required: true
+	ReservationID int `json:"reservationID"`
+}
+
+// swagger:parameters listSingleCategory updateCategory deleteCategory tagProduct untagProduct
+type categoryIDParamsWrapper struct {
+	// the ID of the category for which the operation relates
+	// in: path
+	// required: true
+	CategoryID int `json:"categoryID"`
+}
+
+// swagger:parameters listSingleProduct patchProduct deleteProduct restoreProduct listProductCategories tagProduct untagProduct listStock adjustStock listPrices setPrice deletePrice listProductHistory
 type productIDParamsWrapper struct {
 	// the ID of the product for which the operation relates
 	// in: path
@@ -75,11 +274,179 @@ type productIDParamsWrapper struct {
 	ID int `json:"id"`
 }
 
-// swagger:parameters listProducts listSingleProduct
+// swagger:parameters createProduct updateProduct patchProduct deleteProduct restoreProduct
+type actorParam struct {
+	// Who makes the change, recorded in the history of the product for requests with
+	// the admin token as bearer token, at most 100 characters
+	// in: header
+	// required: false
+	Actor string `json:"X-Actor"`
+}
+
+// swagger:parameters createProduct updateProduct patchProduct deleteProduct restoreProduct createCategory updateCategory deleteCategory tagProduct untagProduct adjustStock createReservation commitReservation releaseReservation setPrice deletePrice
+type idempotencyKeyParam struct {
+	// Key chosen by the client to retry the request safely, repeats of the request
+	// with the same key get the response of the first request instead of being handled
+	// again. The key can not be reused for a different request.
+	// in: header
+	// required: false
+	IdempotencyKey string `json:"Idempotency-Key"`
+}
+
+// swagger:parameters updateProduct patchProduct deleteProduct
+type ifMatchParam struct {
+	// ETag of the version the product must be at to be changed, or * for any
+	// version. Required when the server is started with -require-if-match.
+	// in: header
+	// required: false
+	IfMatch string `json:"If-Match"`
+}
+
+// swagger:parameters listProducts listSingleProduct exportProducts
+type asOfParam struct {
+	// Return the products as they were at the time, an RFC 3339 time such as
+	// 2021-03-01T12:00:00Z. Availability, rates and native prices are current.
+	// in: query
+	// required: false
+	AsOf string `json:"as_of"`
+}
+
+// swagger:parameters streamProducts
+type lastEventIDParam struct {
+	// ID of the last event received, the stream resumes after this event
+	// in: header
+	// required: false
+	LastEventID string `json:"Last-Event-ID"`
+}
+
+// swagger:parameters listProducts listSingleProduct streamProducts searchProducts exportProducts
 type productQueryParam struct {
 	// Currency used when returning the price of the product,
 	// when not specified currency is returned in GBP.
 	// in: query
 	// required: false
 	Currency string 
-}
\ No newline at end of file
+}
+
+// swagger:parameters listProducts
+type includeDeletedParam struct {
+	// Include the deleted products, requires the admin token as bearer token
+	// in: query
+	// required: false
+	IncludeDeleted bool `json:"include_deleted"`
+}
+
+// swagger:parameters listProducts
+type listProductsParams struct {
+	// Field the products are sorted by: id, name, price, created or sku,
+	// prefix the field with - to sort in descending order. Products are sorted by
+	// their base price, not by their native prices
+	// in: query
+	// required: false
+	Sort string `json:"sort"`
+
+	// Only return the products whose name starts with the prefix, ignoring case
+	// in: query
+	// required: false
+	Name string `json:"name"`
+
+	// Only return the products with at least this price in the requested currency,
+	// native prices are not used and the price converted from the base price is compared
+	// in: query
+	// required: false
+	MinPrice float64 `json:"min_price"`
+
+	// Only return the products with at most this price in the requested currency,
+	// native prices are not used and the price converted from the base price is compared
+	// in: query
+	// required: false
+	MaxPrice float64 `json:"max_price"`
+
+	// Maximum number of products returned, at most 100
+	// in: query
+	// required: false
+	// minimum: 1
+	// maximum: 100
+	Limit int64 `json:"limit"`
+
+	// Cursor of the page to return, taken from the Link header of the previous page
+	// in: query
+	// required: false
+	Cursor string `json:"cursor"`
+
+	// Only return the products tagged with the category or one of its descendants,
+	// can be repeated to return the products of any of the categories
+	// in: query
+	// required: false
+	// collection format: multi
+	Category []int64 `json:"category"`
+}
+
+// swagger:parameters exportProducts
+type exportProductsParams struct {
+	// Format of the catalogue, csv or ndjson
+	// in: query
+	// required: false
+	// enum: csv,ndjson
+	Format string `json:"format"`
+
+	// Field the products are sorted by: id, name, price, created or sku,
+	// prefix the field with - to sort in descending order. Products are sorted by
+	// their base price, not by their native prices
+	// in: query
+	// required: false
+	Sort string `json:"sort"`
+
+	// Only export the products whose name starts with the prefix, ignoring case
+	// in: query
+	// required: false
+	Name string `json:"name"`
+
+	// Only export the products with at least this price in the requested currency,
+	// native prices are not used and the price converted from the base price is compared
+	// in: query
+	// required: false
+	MinPrice float64 `json:"min_price"`
+
+	// Only export the products with at most this price in the requested currency,
+	// native prices are not used and the price converted from the base price is compared
+	// in: query
+	// required: false
+	MaxPrice float64 `json:"max_price"`
+
+	// Only export the products tagged with the category or one of its descendants,
+	// can be repeated to export the products of any of the categories
+	// in: query
+	// required: false
+	// collection format: multi
+	Category []int64 `json:"category"`
+}
+
+// swagger:parameters importProducts
+type importProductsParams struct {
+	// Check and report the rows without changing any products
+	// in: query
+	// required: false
+	DryRun bool `json:"dry_run"`
+
+	// The catalogue, a CSV file with a header naming at least the sku, name and price
+	// columns, or a JSON product on every line. Prices are in the base currency.
+	// in: body
+	// required: true
+	Body string
+}
+
+// swagger:parameters searchProducts
+type searchProductsParams struct {
+	// Words to search for in the name and description of the products
+	// in: query
+	// required: true
+	Q string `json:"q"`
+
+	// Maximum number of products returned, at most 100
+	// in: query
+	// required: false
+	// minimum: 1
+	// maximum: 100
+	Limit int64 `json:"limit"`
+}
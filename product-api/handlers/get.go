@@ -1,15 +1,24 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/d-vignesh/go-microservice-example/product-api/data"
 )
 
 // swagger:route GET /products products listProducts
-// Returns a list of products from the database.
+// Returns a list of products from the database. The products are returned in pages
+// when a limit is given, the Link header contains the URL of the next page. With as_of
+// the products are returned as they were at the time.
 // responses:
-//		200: productResponse
+//		200: productsResponse
+//		400: errorResponse
+//		403: errorResponse
+//		404: errorResponse
 
 // ListAll handles GET requests and returns all current products
 func (p *Products) ListAll(rw http.ResponseWriter, r *http.Request) {
@@ -18,23 +27,125 @@ func (p *Products) ListAll(rw http.ResponseWriter, r *http.Request) {
 
 	cur := r.URL.Query().Get("currency")
 
-	prods, err := p.productDB.GetProducts(cur)
+	opts, err := parseListOptions(r)
 	if err != nil {
-		rw.WriteHeader(http.StatusInternalServerError)
-		data.ToJSON(&GenericError{Message: err.Error()}, rw)
+		p.writeProductsError(rw, err)
 		return
 	}
 
+	if r.URL.Query().Get("include_deleted") == "true" {
+		if !p.isAdmin(r) {
+			p.l.Error("include_deleted requested without admin token")
+
+			rw.WriteHeader(http.StatusForbidden)
+			data.ToJSON(&GenericError{Message: "listing deleted products requires an admin token"}, rw)
+			return
+		}
+
+		opts.IncludeDeleted = true
+	}
+
+	prods, next, err := p.productDB.GetProducts(r.Context(), cur, opts)
+	if err != nil {
+		p.writeProductsError(rw, err)
+		return
+	}
+
+	if next != "" {
+		q := r.URL.Query()
+		q.Set("cursor", next)
+		rw.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, q.Encode()))
+	}
+
+	p.setRateProvenance(rw, r, cur)
+
 	err = data.ToJSON(prods, rw)
 	if err != nil {
 		p.l.Error("unable to serializing product", "error", err)
 	}
 }
 
+// writeProductsError writes the error returned when fetching the products
+func (p *Products) writeProductsError(rw http.ResponseWriter, err error) {
+	p.l.Error("unable to fetch products", "error", err)
+
+	switch {
+	case errors.Is(err, data.ErrInvalidCurrency),
+		errors.Is(err, data.ErrInvalidListOptions),
+		errors.Is(err, data.ErrInvalidSearch):
+		rw.WriteHeader(http.StatusBadRequest)
+	case errors.Is(err, data.ErrCategoryNotFound):
+		rw.WriteHeader(http.StatusNotFound)
+	default:
+		rw.WriteHeader(http.StatusInternalServerError)
+	}
+
+	data.ToJSON(&GenericError{Message: err.Error()}, rw)
+}
+
+// parseListOptions reads the sorting, filter and paging options and the as_of time from
+// the query string, a sort field prefixed with - sorts in descending order and category
+// can be repeated
+func parseListOptions(r *http.Request) (data.ListOptions, error) {
+	q := r.URL.Query()
+	opts := data.ListOptions{
+		NamePrefix: q.Get("name"),
+		Cursor: q.Get("cursor"),
+	}
+
+	sort := q.Get("sort")
+	if strings.HasPrefix(sort, "-") {
+		sort = sort[1:]
+		opts.Descending = true
+	}
+	opts.Sort = data.SortField(sort)
+
+	var err error
+	if v := q.Get("limit"); v != "" {
+		opts.Limit, err = strconv.Atoi(v)
+		if err != nil {
+			return opts, fmt.Errorf("%w: limit must be a number", data.ErrInvalidListOptions)
+		}
+	}
+
+	if v := q.Get("min_price"); v != "" {
+		opts.MinPrice, err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			return opts, fmt.Errorf("%w: min_price must be a number", data.ErrInvalidListOptions)
+		}
+	}
+
+	if v := q.Get("max_price"); v != "" {
+		opts.MaxPrice, err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			return opts, fmt.Errorf("%w: max_price must be a number", data.ErrInvalidListOptions)
+		}
+	}
+
+	asOf, err := parseAsOf(r)
+	if err != nil {
+		return opts, fmt.Errorf("%w: %s", data.ErrInvalidListOptions, err)
+	}
+	opts.AsOf = asOf
+
+	for _, v := range q["category"] {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, fmt.Errorf("%w: category must be a category id", data.ErrInvalidListOptions)
+		}
+
+		opts.Categories = append(opts.Categories, id)
+	}
+
+	return opts, nil
+}
+
 // swagger:route GET /products/{id} products listSingleProduct
-// Returns a single requested product or error is product not found
+// Returns a single requested product or error is product not found, with as_of the
+// product is returned as it was at the time
 // responses:
 //		200: productResponse
+//		400: errorResponse
 //		404: errorResponse
 
 func (p *Products) ListSingle(rw http.ResponseWriter, r *http.Request) {
@@ -46,12 +157,32 @@ func (p *Products) ListSingle(rw http.ResponseWriter, r *http.Request) {
 
 	p.l.Debug("got record", "id", id)
 
-	prod, err := p.productDB.GetProductByID(id, cur)
+	asOf, err := parseAsOf(r)
+	if err != nil {
+		p.l.Error("invalid as_of time", "error", err)
 
-	switch err {
-	case nil :
+		rw.WriteHeader(http.StatusBadRequest)
+		data.ToJSON(&GenericError{Message: err.Error()}, rw)
+		return
+	}
+
+	var prod *data.Product
+	if asOf.IsZero() {
+		prod, err = p.productDB.GetProductByID(r.Context(), id, cur)
+	} else {
+		prod, err = p.productDB.GetProductAsOf(r.Context(), id, asOf, cur)
+	}
 
-	case data.ErrProductNotFound:
+	switch {
+	case err == nil :
+
+	case errors.Is(err, data.ErrInvalidCurrency):
+		p.l.Error("unable to fetch product", "error", err)
+
+		rw.WriteHeader(http.StatusBadRequest)
+		data.ToJSON(&GenericError{Message: err.Error()}, rw)
+		return
+	case errors.Is(err, data.ErrProductNotFound):
 		p.l.Error("unable to fetch product", "error", err)
 
 		rw.WriteHeader(http.StatusNotFound)
@@ -65,6 +196,9 @@ func (p *Products) ListSingle(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	p.setRateProvenance(rw, r, cur)
+	setETag(rw, prod)
+
 	err = data.ToJSON(prod, rw)
 	if err != nil {
 		p.l.Error("unable to serialize product", "error", err)
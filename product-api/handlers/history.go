@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/d-vignesh/go-microservice-example/product-api/data"
+)
+
+// ActorHeader is the request header naming who makes a change, it is recorded in the
+// history of the changed products for requests with the admin token
+const ActorHeader = "X-Actor"
+
+// AdminActor is recorded for the changes of requests with the admin token and no X-Actor header
+const AdminActor = "admin"
+
+// maxActorLength is the longest actor recorded in the history
+const maxActorLength = 100
+
+// ErrInvalidActor is an error message when the X-Actor header is too long
+var ErrInvalidActor = fmt.Errorf("the %s header must have at most %d characters", ActorHeader, maxActorLength)
+
+// swagger:route GET /products/{id}/history products listProductHistory
+// Returns the revisions of the product from the oldest to the latest, each with the
+// actor, the time and the changed fields. The history of deleted products is kept.
+// responses:
+//		200: historyResponse
+//		404: errorResponse
+
+// ListHistory handles GET requests and returns the history of a product
+func (p *Products) ListHistory(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Add("Content-Type", "application/json")
+
+	id := getProductID(r)
+
+	revs, err := p.productDB.GetHistory(r.Context(), id)
+	switch {
+	case err == nil:
+
+	case errors.Is(err, data.ErrProductNotFound):
+		p.l.Error("product with given id has no history", "id", id)
+
+		rw.WriteHeader(http.StatusNotFound)
+		data.ToJSON(&GenericError{Message: err.Error()}, rw)
+		return
+	default:
+		p.l.Error("unable to fetch product history", "error", err)
+
+		rw.WriteHeader(http.StatusInternalServerError)
+		data.ToJSON(&GenericError{Message: err.Error()}, rw)
+		return
+	}
+
+	err = data.ToJSON(revs, rw)
+	if err != nil {
+		p.l.Error("unable to serialize product history", "error", err)
+	}
+}
+
+// parseAsOf reads the as_of query parameter as an RFC 3339 time, the zero time is
+// returned when it is not set
+func parseAsOf(r *http.Request) (time.Time, error) {
+	v := r.URL.Query().Get("as_of")
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("as_of must be an RFC 3339 time such as 2021-03-01T12:00:00Z")
+	}
+
+	return t, nil
+}
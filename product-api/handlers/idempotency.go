@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/d-vignesh/go-microservice-example/product-api/data"
+)
+
+// IdempotencyKeyHeader is the request header with a key chosen by the client, requests
+// repeated with the same key are not handled again and get the response of the first
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader is set on the responses which are replayed for a repeated request
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// DefaultIdempotencyTTL is the time the response of a request with an Idempotency-Key is
+// replayed for repeats of the request
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// maxIdempotencyKey is the longest Idempotency-Key accepted
+const maxIdempotencyKey = 255
+
+// limits of the responses kept for Idempotency-Keys
+const (
+	// maxIdempotentBody is the largest body of a request with an Idempotency-Key
+	maxIdempotentBody = 1 << 20
+	// maxIdempotentResponse is the largest response kept, requests with larger responses
+	// are handled again when they are repeated
+	maxIdempotentResponse = 64 << 10
+	// maxIdempotencyKeys is the number of keys kept, the oldest keys are forgotten when
+	// more keys are used
+	maxIdempotencyKeys = 10000
+)
+
+// ErrInvalidIdempotencyKey is an error message when the Idempotency-Key header is not valid
+var ErrInvalidIdempotencyKey = fmt.Errorf("invalid Idempotency-Key, it must have 1 to %d characters", maxIdempotencyKey)
+
+// ErrIdempotentBodyTooLarge is an error message when the body of a request with an
+// Idempotency-Key is too large to be compared with repeats
+var ErrIdempotentBodyTooLarge = fmt.Errorf("the body of a request with an Idempotency-Key must be at most %d bytes", maxIdempotentBody)
+
+// ErrIdempotencyKeyNotSupported is an error message when an Idempotency-Key is sent to an
+// endpoint which streams its request
+var ErrIdempotencyKeyNotSupported = fmt.Errorf("the Idempotency-Key header is not supported, imports match products by SKU and can be repeated")
+
+// ErrIdempotencyKeyReused is an error message when an Idempotency-Key is sent with a
+// different request than the one it was first used for
+var ErrIdempotencyKeyReused = fmt.Errorf("the Idempotency-Key has been used for a different request")
+
+// ErrIdempotencyKeyInUse is an error message when a request is repeated while the request
+// first sent with its Idempotency-Key is still handled
+var ErrIdempotencyKeyInUse = fmt.Errorf("a request with the Idempotency-Key is being handled, retry later")
+
+// idempotentMethods are the methods of the requests which are only handled once per
+// Idempotency-Key
+var idempotentMethods = map[string]bool{
+	http.MethodPost:   true,
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// idempotentResponse is the response of the first request sent with an Idempotency-Key
+type idempotentResponse struct {
+	// fingerprint of the request, repeats must have the same fingerprint
+	fingerprint [sha256.Size]byte
+	expires     time.Time
+
+	// done is false while the request is handled
+	done   bool
+	status int
+	header http.Header
+	body   []byte
+}
+
+// idempotencyKeys are the responses of the requests sent with an Idempotency-Key, they
+// are forgotten once they expire
+type idempotencyKeys struct {
+	ttl     time.Duration
+	maxKeys int
+	now     func() time.Time
+
+	mu        sync.Mutex
+	responses map[string]*idempotentResponse
+	// order has the responses in the order they expire, which is the order they were stored
+	order []idempotentKey
+}
+
+// idempotentKey is a key and the response stored for it
+type idempotentKey struct {
+	key string
+	res *idempotentResponse
+}
+
+func newIdempotencyKeys(ttl time.Duration) *idempotencyKeys {
+	return &idempotencyKeys{ttl: ttl, maxKeys: maxIdempotencyKeys, now: time.Now, responses: map[string]*idempotentResponse{}}
+}
+
+// begin returns the response stored for the key, or stores a new response which is not
+// done when the key has not been used. The stored response is returned with
+// ErrIdempotencyKeyReused when it has a different fingerprint.
+func (k *idempotencyKeys) begin(key string, fingerprint [sha256.Size]byte) (*idempotentResponse, bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := k.now()
+	k.expire(now)
+
+	res, ok := k.responses[key]
+	if ok {
+		if res.fingerprint != fingerprint {
+			return res, false, ErrIdempotencyKeyReused
+		}
+
+		if !res.done {
+			return res, false, ErrIdempotencyKeyInUse
+		}
+
+		return res, false, nil
+	}
+
+	// the oldest keys are forgotten, so that clients using many keys can not exhaust memory
+	for len(k.responses) >= k.maxKeys {
+		k.forgetOldest()
+	}
+
+	res = &idempotentResponse{fingerprint: fingerprint, expires: now.Add(k.ttl)}
+	k.responses[key] = res
+	k.order = append(k.order, idempotentKey{key: key, res: res})
+
+	return res, true, nil
+}
+
+// finish stores the response of the request which began with the key. Server errors
+// and responses which are too large are not stored, so the request can be repeated.
+func (k *idempotencyKeys) finish(key string, res *idempotentResponse, status int, header http.Header, body []byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	// the key expired while the request was handled
+	if k.responses[key] != res {
+		return
+	}
+
+	if status >= http.StatusInternalServerError || len(body) > maxIdempotentResponse {
+		delete(k.responses, key)
+		return
+	}
+
+	res.done, res.status, res.header, res.body = true, status, header, body
+}
+
+// expire forgets the responses which expired at the time
+func (k *idempotencyKeys) expire(now time.Time) {
+	n := 0
+	for ; n < len(k.order) && !now.Before(k.order[n].res.expires); n++ {
+		// keys deleted after a server error may have been used again
+		if o := k.order[n]; k.responses[o.key] == o.res {
+			delete(k.responses, o.key)
+		}
+	}
+
+	k.order = k.order[n:]
+}
+
+// forgetOldest forgets the response stored first
+func (k *idempotencyKeys) forgetOldest() {
+	o := k.order[0]
+	if k.responses[o.key] == o.res {
+		delete(k.responses, o.key)
+	}
+
+	k.order = k.order[1:]
+}
+
+// idempotentResponseWriter writes the response and keeps a copy, so that it can be
+// replayed for repeats of the request
+type idempotentResponseWriter struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (w *idempotentResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+		w.header = w.ResponseWriter.Header().Clone()
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *idempotentResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	// the copy stops once the response is too large to be kept
+	if w.body.Len() <= maxIdempotentResponse {
+		w.body.Write(b)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// response returns the status and headers of the response, a handler which writes
+// nothing responds with 200
+func (w *idempotentResponseWriter) response() (int, http.Header) {
+	if w.status == 0 {
+		return http.StatusOK, w.ResponseWriter.Header().Clone()
+	}
+
+	return w.status, w.header
+}
+
+// Unwrap returns the response writer, so that http.ResponseController can reach it
+func (w *idempotentResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// SetIdempotencyTTL sets the time the response of a request with an Idempotency-Key is
+// replayed for repeats, zero disables the Idempotency-Key header. It must be called before
+// the handler is used.
+func (p *Products) SetIdempotencyTTL(ttl time.Duration) {
+	p.idempotency = newIdempotencyKeys(ttl)
+}
+
+// MiddlewareIdempotency handles the requests changing data with an Idempotency-Key header
+// once, repeats of the request with the same key get the response of the first request
+// until it expires. The key can not be used for a different request, and repeats sent
+// while the first request is handled are rejected. Keys are scoped to the caller, so
+// callers can not replay the responses of others. The body of the request is read
+// before it is handled, the middleware must not be used for streamed requests.
+func (p *Products) MiddlewareIdempotency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" || !idempotentMethods[r.Method] || p.idempotency.ttl <= 0 {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		if len(key) > maxIdempotencyKey {
+			p.l.Error("invalid idempotency key", "length", len(key))
+
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(http.StatusBadRequest)
+			data.ToJSON(&GenericError{Message: ErrInvalidIdempotencyKey.Error()}, rw)
+			return
+		}
+
+		// the body is read first to compare the request with the one first sent with the key
+		body, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, maxIdempotentBody))
+		if err != nil {
+			p.l.Error("unable to read request", "error", err)
+
+			rw.Header().Set("Content-Type", "application/json")
+
+			var mbe *http.MaxBytesError
+			if errors.As(err, &mbe) {
+				rw.WriteHeader(http.StatusRequestEntityTooLarge)
+				data.ToJSON(&GenericError{Message: ErrIdempotentBodyTooLarge.Error()}, rw)
+				return
+			}
+
+			rw.WriteHeader(http.StatusBadRequest)
+			data.ToJSON(&GenericError{Message: err.Error()}, rw)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		scoped := idempotencyScope(r, key)
+		res, first, err := p.idempotency.begin(scoped, requestFingerprint(r, body))
+		if err != nil {
+			p.writeIdempotencyError(rw, err)
+			return
+		}
+
+		if !first {
+			p.l.Debug("replaying response", "key", key)
+
+			for h, v := range res.header {
+				rw.Header()[h] = v
+			}
+			rw.Header().Set(IdempotentReplayedHeader, "true")
+			rw.WriteHeader(res.status)
+			rw.Write(res.body)
+			return
+		}
+
+		// the key is released when the handler panics, so that the request can be repeated
+		handled := false
+		defer func() {
+			if !handled {
+				p.idempotency.finish(scoped, res, http.StatusInternalServerError, nil, nil)
+			}
+		}()
+
+		w := &idempotentResponseWriter{ResponseWriter: rw}
+		next.ServeHTTP(w, r)
+		handled = true
+
+		status, header := w.response()
+		p.idempotency.finish(scoped, res, status, header, w.body.Bytes())
+	})
+}
+
+// idempotencyScope returns the key scoped to the caller of the request, callers are told
+// apart by their Authorization header or, without one, by their address
+func idempotencyScope(r *http.Request, key string) string {
+	caller := r.Header.Get("Authorization")
+	if caller == "" {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		caller = "addr " + host
+	}
+
+	sum := sha256.Sum256([]byte(caller + "\x00" + key))
+	return string(sum[:])
+}
+
+// requestFingerprint returns the hash of the parts of the request which change its
+// response: the method, the URL, the headers read by the handlers and the body
+func requestFingerprint(r *http.Request, body []byte) [sha256.Size]byte {
+	h := sha256.New()
+	for _, s := range []string{r.Method, r.URL.RequestURI(), r.Header.Get("Content-Type"), r.Header.Get("If-Match"), r.Header.Get(ActorHeader)} {
+		fmt.Fprintf(h, "%d:%s", len(s), s)
+	}
+	h.Write(body)
+
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// writeIdempotencyError writes the response for a request which can not be handled as
+// its Idempotency-Key is in use
+func (p *Products) writeIdempotencyError(rw http.ResponseWriter, err error) {
+	p.l.Error("unable to use idempotency key", "error", err)
+
+	rw.Header().Set("Content-Type", "application/json")
+	switch {
+	case errors.Is(err, ErrIdempotencyKeyReused):
+		rw.WriteHeader(http.StatusUnprocessableEntity)
+	case errors.Is(err, ErrIdempotencyKeyInUse):
+		rw.Header().Set("Retry-After", "1")
+		rw.WriteHeader(http.StatusConflict)
+	}
+
+	data.ToJSON(&GenericError{Message: err.Error()}, rw)
+}
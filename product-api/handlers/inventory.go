@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/d-vignesh/go-microservice-example/product-api/data"
+)
+
+// KeyStockAdjustment is a key used for the StockAdjustment in the context
+type KeyStockAdjustment struct{}
+
+// KeyReservation is a key used for the Reservation in the context
+type KeyReservation struct{}
+
+// swagger:route GET /products/{id}/stock inventory listStock
+// Returns the stock levels of the product, products with variants have a stock level
+// per variant. Products without stock levels are not tracked and always available.
+// responses:
+//		200: stockLevelsResponse
+//		404: errorResponse
+
+// ListStock handles GET requests and returns the stock levels of a product
+func (p *Products) ListStock(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Add("Content-Type", "application/json")
+
+	levels, err := p.productDB.GetStock(r.Context(), getProductID(r))
+	if err != nil {
+		p.writeStockError(rw, err)
+		return
+	}
+
+	err = data.ToJSON(levels, rw)
+	if err != nil {
+		p.l.Error("unable to serialize stock levels", "error", err)
+	}
+}
+
+// swagger:route POST /products/{id}/stock inventory adjustStock
+// Add items to or remove items from the stock of the product, reserved items can not
+// be removed
+//
+// responses:
+//		200: stockLevelResponse
+//		404: errorResponse
+//		409: errorResponse
+//		422: errorValidation
+
+// AdjustStock handles POST requests to change the stock of a product
+func (p *Products) AdjustStock(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Add("Content-Type", "application/json")
+
+	id := getProductID(r)
+	a := r.Context().Value(KeyStockAdjustment{}).(data.StockAdjustment)
+
+	p.l.Debug("adjusting stock", "id", id, "variant", a.VariantSKU, "delta", a.Delta)
+
+	l, err := p.productDB.AdjustStock(r.Context(), id, a.VariantSKU, a.Delta)
+	if err != nil {
+		p.writeStockError(rw, err)
+		return
+	}
+
+	err = data.ToJSON(l, rw)
+	if err != nil {
+		p.l.Error("unable to serialize stock level", "error", err)
+	}
+}
+
+// swagger:route POST /reservations inventory createReservation
+// Reserve the items until the reservation is committed, released or expires, either
+// all items are reserved or none
+//
+// responses:
+//		200: reservationResponse
+//		400: errorResponse
+//		409: errorResponse
+//		422: errorValidation
+
+// CreateReservation handles POST requests to reserve stock
+func (p *Products) CreateReservation(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Add("Content-Type", "application/json")
+
+	res := r.Context().Value(KeyReservation{}).(data.Reservation)
+
+	ttl := time.Duration(0)
+	if v := r.URL.Query().Get("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			p.l.Error("invalid reservation ttl", "ttl", v, "error", err)
+
+			rw.WriteHeader(http.StatusBadRequest)
+			data.ToJSON(&GenericError{Message: fmt.Sprintf("invalid ttl %q, must be a duration such as 10m", v)}, rw)
+			return
+		}
+
+		ttl = d
+	}
+
+	nr, err := p.productDB.ReserveStock(r.Context(), res.Items, ttl)
+	if err != nil {
+		p.writeStockError(rw, err)
+		return
+	}
+
+	err = data.ToJSON(nr, rw)
+	if err != nil {
+		p.l.Error("unable to serialize reservation", "error", err)
+	}
+}
+
+// swagger:route GET /reservations/{reservationID} inventory listSingleReservation
+// Returns a reservation which has not been committed, released or expired
+// responses:
+//		200: reservationResponse
+//		404: errorResponse
+
+// ListSingleReservation handles GET requests and returns a single reservation
+func (p *Products) ListSingleReservation(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Add("Content-Type", "application/json")
+
+	res, err := p.productDB.GetReservation(r.Context(), getReservationID(r))
+	if err != nil {
+		p.writeStockError(rw, err)
+		return
+	}
+
+	err = data.ToJSON(res, rw)
+	if err != nil {
+		p.l.Error("unable to serialize reservation", "error", err)
+	}
+}
+
+// swagger:route POST /reservations/{reservationID}/commit inventory commitReservation
+// Commit the reservation, the reserved items are removed from the stock
+//
+// responses:
+//		204: noContentResponse
+//		404: errorResponse
+
+// CommitReservation handles POST requests to commit a reservation
+func (p *Products) CommitReservation(rw http.ResponseWriter, r *http.Request) {
+	err := p.productDB.CommitReservation(r.Context(), getReservationID(r))
+	if err != nil {
+		p.writeStockError(rw, err)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// swagger:route DELETE /reservations/{reservationID} inventory releaseReservation
+// Release the reservation, the reserved items are available again
+//
+// responses:
+//		204: noContentResponse
+//		404: errorResponse
+
+// ReleaseReservation handles DELETE requests to release a reservation
+func (p *Products) ReleaseReservation(rw http.ResponseWriter, r *http.Request) {
+	err := p.productDB.ReleaseReservation(r.Context(), getReservationID(r))
+	if err != nil {
+		p.writeStockError(rw, err)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// writeStockError writes the error returned by a stock operation
+func (p *Products) writeStockError(rw http.ResponseWriter, err error) {
+	p.l.Error("unable to handle stock request", "error", err)
+
+	switch {
+	case errors.Is(err, data.ErrProductNotFound), errors.Is(err, data.ErrReservationNotFound):
+		rw.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, data.ErrInsufficientStock):
+		rw.WriteHeader(http.StatusConflict)
+	case errors.Is(err, data.ErrInvalidStock):
+		rw.WriteHeader(http.StatusUnprocessableEntity)
+	default:
+		rw.WriteHeader(http.StatusInternalServerError)
+	}
+
+	data.ToJSON(&GenericError{Message: err.Error()}, rw)
+}
+
+// getReservationID returns the reservation ID from the URL
+// Panics if it cannot convert the ID to an integer
+// this should never happen as the router ensures that
+// this is a valid number
+func getReservationID(r *http.Request) int {
+	id, err := strconv.Atoi(mux.Vars(r)["reservationID"])
+	if err != nil {
+		panic(err)
+	}
+
+	return id
+}
@@ -2,29 +2,57 @@ package handlers
 
 import (
 	"context"
+	"crypto/subtle"
 	"net/http"
+	"strings"
 
 	"github.com/d-vignesh/go-microservice-example/product-api/data"
 )
 
 // MiddlewareValidateProduct validates the product in the request and calls next if ok
 func (p *Products) MiddlewareValidateProduct(next http.Handler) http.Handler {
+	return validateBody[data.Product](p, "product", KeyProduct{}, next)
+}
+
+// MiddlewareValidateCategory validates the category in the request and calls next if ok
+func (p *Products) MiddlewareValidateCategory(next http.Handler) http.Handler {
+	return validateBody[data.Category](p, "category", KeyCategory{}, next)
+}
+
+// MiddlewareValidateStockAdjustment validates the stock adjustment in the request and calls next if ok
+func (p *Products) MiddlewareValidateStockAdjustment(next http.Handler) http.Handler {
+	return validateBody[data.StockAdjustment](p, "stock adjustment", KeyStockAdjustment{}, next)
+}
+
+// MiddlewareValidateReservation validates the reservation in the request and calls next if ok
+func (p *Products) MiddlewareValidateReservation(next http.Handler) http.Handler {
+	return validateBody[data.Reservation](p, "reservation", KeyReservation{}, next)
+}
+
+// MiddlewareValidatePrice validates the price in the request and calls next if ok
+func (p *Products) MiddlewareValidatePrice(next http.Handler) http.Handler {
+	return validateBody[data.Price](p, "price", KeyPrice{}, next)
+}
+
+// validateBody decodes the JSON body of the request into a new T, validates it and adds
+// it to the context under the key before calling next. name is the kind of value in
+// the log messages.
+func validateBody[T any](p *Products, name string, key interface{}, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
-		prod := &data.Product{}
+		v := new(T)
 
-		err := data.FromJSON(prod, r.Body)
+		err := data.FromJSON(v, r.Body)
 		if err != nil {
-			p.l.Error("unable to deserialize product", "error", err)
+			p.l.Error("unable to deserialize "+name, "error", err)
 
 			rw.WriteHeader(http.StatusBadRequest)
 			data.ToJSON(&GenericError{Message: err.Error()}, rw)
 			return
 		}
 
-		// validate the product
-		errs := p.v.Validate(prod)
+		errs := p.v.Validate(v)
 		if len(errs) != 0 {
-			p.l.Error("error in validating product", "error", errs)
+			p.l.Error("error in validating "+name, "error", errs)
 
 			// return the validation messages as an array
 			rw.WriteHeader(http.StatusUnprocessableEntity)
@@ -32,11 +60,47 @@ func (p *Products) MiddlewareValidateProduct(next http.Handler) http.Handler {
 			return
 		}
 
-		// add the product to the context
-		ctx := context.WithValue(r.Context(), KeyProduct{}, *prod)
-		r = r.WithContext(ctx)
+		// call the next handler, which can be another middleware in the chain, or the final handler
+		ctx := context.WithValue(r.Context(), key, *v)
+		next.ServeHTTP(rw, r.WithContext(ctx))
+	})
+}
+
+// MiddlewareActor records the author of the changes made by the request. Only requests
+// with the admin token are authenticated, they are recorded as the actor named by the
+// X-Actor header or as the admin. The header of other requests is ignored, as anyone
+// could name any actor, and their changes are recorded as anonymous.
+func (p *Products) MiddlewareActor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if !p.isAdmin(r) {
+			next.ServeHTTP(rw, r)
+			return
+		}
 
-		// call the next handler, which can be another middleware in the chain, or the final header.
-		next.ServeHTTP(rw, r)
+		actor := strings.TrimSpace(r.Header.Get(ActorHeader))
+		if len(actor) > maxActorLength {
+			p.l.Error("invalid actor", "length", len(actor))
+
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(http.StatusBadRequest)
+			data.ToJSON(&GenericError{Message: ErrInvalidActor.Error()}, rw)
+			return
+		}
+
+		if actor == "" {
+			actor = AdminActor
+		}
+
+		next.ServeHTTP(rw, r.WithContext(data.WithActor(r.Context(), actor)))
 	})
-}
\ No newline at end of file
+}
+
+// isAdmin returns true when the request carries the admin token as bearer token,
+// no request is an admin when the token is not configured
+func (p *Products) isAdmin(r *http.Request) bool {
+	if p.adminToken == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+p.adminToken)) == 1
+}
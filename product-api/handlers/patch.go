@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	jsonpatch "github.com/evanphx/json-patch"
+
+	"github.com/d-vignesh/go-microservice-example/product-api/data"
+)
+
+// media types of the patch documents accepted by Patch
+const (
+	// MergePatchType is the media type of a JSON Merge Patch (RFC 7386)
+	MergePatchType = "application/merge-patch+json"
+	// JSONPatchType is the media type of a JSON Patch (RFC 6902)
+	JSONPatchType = "application/json-patch+json"
+)
+
+// maxPatchAttempts is the number of times a patch without If-Match is applied when the
+// product is changed by another request while it is patched
+const maxPatchAttempts = 3
+
+// ErrUnsupportedPatch is an error message when the Content-Type of a patch is not supported
+var ErrUnsupportedPatch = fmt.Errorf("unsupported patch, the Content-Type must be %s or %s", MergePatchType, JSONPatchType)
+
+// ErrInvalidPatch is an error message when the patch document is malformed
+var ErrInvalidPatch = fmt.Errorf("invalid patch")
+
+// ErrPatchTestFailed is an error message when a test operation of a JSON Patch fails
+var ErrPatchTestFailed = fmt.Errorf("patch test failed")
+
+// ErrPatchNotApplicable is an error message when a patch can not be applied to the product
+// or does not result in a product
+var ErrPatchNotApplicable = fmt.Errorf("patch can not be applied to the product")
+
+// patchFuncs apply a patch document of the media type to a JSON document
+var patchFuncs = map[string]func(doc, patch []byte) ([]byte, error){
+	MergePatchType: mergePatch,
+	JSONPatchType:  jsonPatch,
+}
+
+// swagger:route PATCH /products/{id} products patchProduct
+// Change some fields of a product with a JSON Merge Patch (application/merge-patch+json) or
+// a JSON Patch (application/json-patch+json), the patched product is validated like an updated product
+//
+// consumes:
+// - application/merge-patch+json
+// - application/json-patch+json
+//
+// responses:
+//		204: versionResponse
+//		400: errorResponse
+//		404: errorResponse
+//		409: errorResponse
+//		412: errorResponse
+//		415: errorResponse
+//		422: errorValidation
+//		428: errorResponse
+
+// Patch handles PATCH requests to change some fields of a product
+func (p *Products) Patch(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Add("Content-Type", "application/json")
+
+	id := getProductID(r)
+	p.l.Debug("patching record id", id)
+
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	apply, ok := patchFuncs[mt]
+	if !ok {
+		p.l.Error("unsupported patch", "content-type", r.Header.Get("Content-Type"))
+
+		rw.Header().Set("Accept-Patch", MergePatchType+", "+JSONPatchType)
+		rw.WriteHeader(http.StatusUnsupportedMediaType)
+		data.ToJSON(&GenericError{Message: ErrUnsupportedPatch.Error()}, rw)
+		return
+	}
+
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		p.l.Error("unable to read patch", "error", err)
+
+		rw.WriteHeader(http.StatusBadRequest)
+		data.ToJSON(&GenericError{Message: err.Error()}, rw)
+		return
+	}
+
+	expected, err := p.expectedVersion(r, id)
+	if err != nil {
+		p.writePreconditionError(rw, err)
+		return
+	}
+
+	// the product is updated at the version the patch was applied to, so changes made
+	// in between are never overwritten. Without If-Match the patch is applied again to
+	// the changed product.
+	for attempt := 1; ; attempt++ {
+		prod, err := p.patchedProduct(r, id, expected, patch, apply)
+		if err != nil {
+			p.writePatchError(rw, err)
+			return
+		}
+
+		errs := p.v.Validate(prod)
+		if len(errs) != 0 {
+			p.l.Error("error in validating patched product", "error", errs)
+
+			rw.WriteHeader(http.StatusUnprocessableEntity)
+			data.ToJSON(&ValidationError{Messages: errs.Errors()}, rw)
+			return
+		}
+
+		err = p.productDB.UpdateProduct(r.Context(), prod)
+		if errors.Is(err, data.ErrVersionMismatch) && expected == 0 && attempt < maxPatchAttempts {
+			p.l.Debug("product changed while patching, retrying", "id", id)
+			continue
+		}
+
+		if err != nil {
+			p.writePatchError(rw, err)
+			return
+		}
+
+		setETag(rw, prod)
+		rw.WriteHeader(http.StatusNoContent)
+		return
+	}
+}
+
+// patchedProduct returns the product with the given id with the patch applied, the version
+// of the returned product is the version the patch was applied to. When version is not
+// zero the product must be at the version.
+func (p *Products) patchedProduct(r *http.Request, id, version int, patch []byte, apply func(doc, patch []byte) ([]byte, error)) (*data.Product, error) {
+	cur, err := p.productDB.GetProductByID(r.Context(), id, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if version != 0 && version != cur.Version {
+		return nil, data.ErrVersionMismatch
+	}
+
+	doc, err := json.Marshal(cur)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err = apply(doc, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	prod := &data.Product{}
+	err = json.Unmarshal(doc, prod)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrPatchNotApplicable, err)
+	}
+
+	// the id and version are not changed by patches, as with updates
+	prod.ID, prod.Version = id, cur.Version
+	return prod, nil
+}
+
+// mergePatch applies a JSON Merge Patch to doc
+func mergePatch(doc, patch []byte) ([]byte, error) {
+	res, err := jsonpatch.MergePatch(doc, patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPatch, err)
+	}
+
+	return res, nil
+}
+
+// jsonPatch applies a JSON Patch to doc
+func jsonPatch(doc, patch []byte) ([]byte, error) {
+	ops, err := jsonpatch.DecodePatch(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPatch, err)
+	}
+
+	res, err := ops.Apply(doc)
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		return nil, fmt.Errorf("%w: %s", ErrPatchTestFailed, err)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrPatchNotApplicable, err)
+	}
+
+	return res, nil
+}
+
+// writePatchError writes the response for an error of patching a product
+func (p *Products) writePatchError(rw http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, data.ErrVersionMismatch):
+		p.writePreconditionError(rw, err)
+		return
+	case errors.Is(err, data.ErrProductNotFound):
+		rw.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, ErrInvalidPatch):
+		rw.WriteHeader(http.StatusBadRequest)
+	case errors.Is(err, ErrPatchTestFailed), errors.Is(err, data.ErrProductConflict):
+		rw.WriteHeader(http.StatusConflict)
+	case errors.Is(err, ErrPatchNotApplicable):
+		p.l.Error("unable to patch product", "error", err)
+
+		// unprocessable patches are reported like products which fail validation
+		rw.WriteHeader(http.StatusUnprocessableEntity)
+		data.ToJSON(&ValidationError{Messages: []string{err.Error()}}, rw)
+		return
+	default:
+		rw.WriteHeader(http.StatusInternalServerError)
+	}
+
+	p.l.Error("unable to patch product", "error", err)
+	data.ToJSON(&GenericError{Message: err.Error()}, rw)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/d-vignesh/go-microservice-example/product-api/data"
@@ -11,6 +12,7 @@ import (
 //
 // responses:
 // 		200: productResponse
+//		409: errorResponse
 //		422: errorValidation
 //		501: errorResponse
 
@@ -20,5 +22,20 @@ func (p *Products) Create(rw http.ResponseWriter, r *http.Request) {
 	prod := r.Context().Value(KeyProduct{}).(data.Product)
 
 	p.l.Debug("Inserting product: %#v\n", prod)
-	p.productDB.AddProduct(prod)
+	err := p.productDB.AddProduct(r.Context(), prod)
+	if errors.Is(err, data.ErrProductConflict) {
+		p.l.Error("unable to add product", "error", err)
+
+		rw.WriteHeader(http.StatusConflict)
+		data.ToJSON(&GenericError{Message: err.Error()}, rw)
+		return
+	}
+
+	if err != nil {
+		p.l.Error("unable to add product", "error", err)
+
+		rw.WriteHeader(http.StatusInternalServerError)
+		data.ToJSON(&GenericError{Message: err.Error()}, rw)
+		return
+	}
 }
\ No newline at end of file
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/d-vignesh/go-microservice-example/product-api/data"
+)
+
+// KeyPrice is a key used for the Price in the context
+type KeyPrice struct{}
+
+// swagger:route GET /products/{id}/prices prices listPrices
+// Returns the native prices of the product, in these currencies the native price is
+// returned instead of converting the price of the product
+// responses:
+//		200: pricesResponse
+//		404: errorResponse
+
+// ListPrices handles GET requests and returns the native prices of a product
+func (p *Products) ListPrices(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Add("Content-Type", "application/json")
+
+	prices, err := p.productDB.GetPrices(r.Context(), getProductID(r))
+	if err != nil {
+		p.writePriceError(rw, err)
+		return
+	}
+
+	err = data.ToJSON(prices, rw)
+	if err != nil {
+		p.l.Error("unable to serialize prices", "error", err)
+	}
+}
+
+// swagger:route PUT /products/{id}/prices/{currency} prices setPrice
+// Set the native price of the product in the currency, the currency must be supported
+// by the currency service. Products with variants or options can not have native prices.
+//
+// responses:
+//		200: priceResponse
+//		400: errorResponse
+//		404: errorResponse
+//		409: errorResponse
+//		422: errorValidation
+
+// SetPrice handles PUT requests to set the native price of a product
+func (p *Products) SetPrice(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Add("Content-Type", "application/json")
+
+	id := getProductID(r)
+	currency := mux.Vars(r)["currency"]
+	pr := r.Context().Value(KeyPrice{}).(data.Price)
+
+	p.l.Debug("setting price", "id", id, "currency", currency, "price", pr.Price)
+
+	np, err := p.productDB.SetPrice(r.Context(), id, currency, pr.Price)
+	if err != nil {
+		p.writePriceError(rw, err)
+		return
+	}
+
+	err = data.ToJSON(np, rw)
+	if err != nil {
+		p.l.Error("unable to serialize price", "error", err)
+	}
+}
+
+// swagger:route DELETE /products/{id}/prices/{currency} prices deletePrice
+// Remove the native price of the product in the currency, afterwards the price of the
+// product is converted into the currency
+//
+// responses:
+//		204: noContentResponse
+//		404: errorResponse
+
+// DeletePrice handles DELETE requests to remove the native price of a product
+func (p *Products) DeletePrice(rw http.ResponseWriter, r *http.Request) {
+	id := getProductID(r)
+	currency := mux.Vars(r)["currency"]
+
+	p.l.Debug("deleting price", "id", id, "currency", currency)
+
+	err := p.productDB.DeletePrice(r.Context(), id, currency)
+	if err != nil {
+		p.writePriceError(rw, err)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// writePriceError writes the error returned by a price operation
+func (p *Products) writePriceError(rw http.ResponseWriter, err error) {
+	p.l.Error("unable to handle price request", "error", err)
+
+	switch {
+	case errors.Is(err, data.ErrProductNotFound), errors.Is(err, data.ErrPriceNotFound):
+		rw.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, data.ErrInvalidCurrency):
+		rw.WriteHeader(http.StatusBadRequest)
+	case errors.Is(err, data.ErrPriceHasVariants):
+		rw.WriteHeader(http.StatusConflict)
+	default:
+		rw.WriteHeader(http.StatusInternalServerError)
+	}
+
+	data.ToJSON(&GenericError{Message: err.Error()}, rw)
+}
@@ -1,17 +1,55 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
 	"strconv"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/hashicorp/go-hclog"
 
 	"github.com/d-vignesh/go-microservice-example/product-api/data"
+	protos "github.com/d-vignesh/go-microservice-example/currency/protos/currency"
 )
 
 
+// ProductService is the product data used by the handlers, it is implemented by data.ProductsDB
+type ProductService interface {
+	GetProducts(ctx context.Context, currency string, opts data.ListOptions) (data.Products, string, error)
+	GetProductByID(ctx context.Context, id int, currency string) (*data.Product, error)
+	SearchProducts(ctx context.Context, query, currency string, limit int) (data.Products, error)
+	AddProduct(ctx context.Context, p data.Product) error
+	UpdateProduct(ctx context.Context, p *data.Product) error
+	DeleteProduct(ctx context.Context, id, version int) error
+	RestoreProduct(ctx context.Context, id int) (*data.Product, error)
+	ImportProduct(ctx context.Context, p data.Product, dryRun bool) (string, error)
+	GetCategories(ctx context.Context) (data.Categories, error)
+	GetCategoryByID(ctx context.Context, id int) (*data.Category, error)
+	AddCategory(ctx context.Context, c data.Category) (*data.Category, error)
+	UpdateCategory(ctx context.Context, c data.Category) (*data.Category, error)
+	DeleteCategory(ctx context.Context, id int) error
+	TagProduct(ctx context.Context, productID, categoryID int) error
+	UntagProduct(ctx context.Context, productID, categoryID int) error
+	GetProductCategories(ctx context.Context, productID int) (data.Categories, error)
+	GetStock(ctx context.Context, productID int) (data.StockLevels, error)
+	AdjustStock(ctx context.Context, productID int, variantSKU string, delta int) (*data.StockLevel, error)
+	ReserveStock(ctx context.Context, items []data.StockItem, ttl time.Duration) (*data.Reservation, error)
+	GetReservation(ctx context.Context, id int) (*data.Reservation, error)
+	CommitReservation(ctx context.Context, id int) error
+	ReleaseReservation(ctx context.Context, id int) error
+	GetPrices(ctx context.Context, productID int) ([]data.Price, error)
+	SetPrice(ctx context.Context, productID int, currency string, price float64) (*data.Price, error)
+	DeletePrice(ctx context.Context, productID int, currency string) error
+	GetHistory(ctx context.Context, productID int) ([]*data.Revision, error)
+	GetProductAsOf(ctx context.Context, id int, at time.Time, currency string) (*data.Product, error)
+	RateMetadata(ctx context.Context, currency string) *protos.RateMetadata
+	CheckCurrency(ctx context.Context, currency string) error
+	Events() *data.Events
+}
+
 // KeyProduct is a key used for the Product in the context
 type KeyProduct struct{}
 
@@ -19,12 +57,24 @@ type KeyProduct struct{}
 type Products struct {
 	l hclog.Logger 
 	v *data.Validation
-	productDB *data.ProductsDB
+	productDB ProductService
+	adminToken string
+	requireIfMatch bool
+	idempotency *idempotencyKeys
+	closeStreams chan struct{}
+	closeOnce sync.Once
 }
 
-// NewProducts returns a new product handler with given logger, validator and currencyClient
-func NewProducts(l hclog.Logger, v *data.Validation, pdb *data.ProductsDB) *Products {
-	return &Products{l, v, pdb}
+// NewProducts returns a new product handler with given logger, validator and product service,
+// requests with the adminToken as bearer token can use the admin only features
+func NewProducts(l hclog.Logger, v *data.Validation, pdb ProductService, adminToken string) *Products {
+	return &Products{l: l, v: v, productDB: pdb, adminToken: adminToken, idempotency: newIdempotencyKeys(DefaultIdempotencyTTL), closeStreams: make(chan struct{})}
+}
+
+// CloseStreams ends all open product streams, it is called when the server shuts down
+// as the streams would otherwise keep the server running
+func (p *Products) CloseStreams() {
+	p.closeOnce.Do(func() { close(p.closeStreams) })
 }
 
 // ErrInvalidProductPath is an error message when the product path is not valid
@@ -57,3 +107,31 @@ func getProductID(r *http.Request) int {
 	return id
 }
 
+// RateProvenanceHeader is the response header which describes the exchange rate used
+// to convert the prices in the response
+const RateProvenanceHeader = "X-Rate-Provenance"
+
+// setRateProvenance adds the provenance of the exchange rate for the given currency to the
+// response headers, nothing is added when prices are returned in the base currency
+func (p *Products) setRateProvenance(rw http.ResponseWriter, r *http.Request, currency string) {
+	if currency == "" {
+		return
+	}
+
+	md := p.productDB.RateMetadata(r.Context(), currency)
+	if md == nil {
+		return
+	}
+
+	rw.Header().Set(
+		RateProvenanceHeader,
+		fmt.Sprintf(
+			"source=%s; effective=%s; fetched=%s; version=%d; stale=%t",
+			md.GetSource(),
+			md.GetEffectiveDate().AsTime().Format("2006-01-02"),
+			md.GetFetchedAt().AsTime().Format(time.RFC3339),
+			md.GetSnapshotVersion(),
+			md.GetStale(),
+		),
+	)
+}
@@ -0,0 +1,1247 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/d-vignesh/go-microservice-example/currency/client"
+	protos "github.com/d-vignesh/go-microservice-example/currency/protos/currency"
+	"github.com/d-vignesh/go-microservice-example/product-api/data"
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubProducts is a ProductService returning fixed products
+type stubProducts struct {
+	prods   data.Products
+	deleted []int
+	opts    data.ListOptions
+	next    string
+	query   string
+
+	categories data.Categories
+	tags       []data.Tag
+
+	// stock is the available stock of every product
+	stock        int
+	reservations []*data.Reservation
+	ttl          time.Duration
+
+	prices []data.Price
+
+	// actor is the actor of the last added product
+	actor string
+	// added is the number of added products
+	added int
+	asOf  time.Time
+
+	// currency is the currency of the last listing
+	currency string
+	// events are returned by Events, a new broker is returned when it is nil
+	events *data.Events
+}
+
+func (s *stubProducts) GetProducts(ctx context.Context, currency string, opts data.ListOptions) (data.Products, string, error) {
+	if currency == "XXX" {
+		return nil, "", data.ErrInvalidCurrency
+	}
+
+	s.opts, s.currency = opts, currency
+	return s.prods, s.next, nil
+}
+
+func (s *stubProducts) GetProductByID(ctx context.Context, id int, currency string) (*data.Product, error) {
+	for _, p := range s.prods {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+
+	return nil, data.ErrProductNotFound
+}
+
+func (s *stubProducts) SearchProducts(ctx context.Context, query, currency string, limit int) (data.Products, error) {
+	if query == "" {
+		return nil, data.ErrInvalidSearch
+	}
+
+	if currency == "XXX" {
+		return nil, data.ErrInvalidCurrency
+	}
+
+	s.query = query
+	return s.prods, nil
+}
+
+func (s *stubProducts) AddProduct(ctx context.Context, p data.Product) error {
+	s.actor = data.ActorFromContext(ctx)
+	s.added++
+	return nil
+}
+
+func (s *stubProducts) UpdateProduct(ctx context.Context, p *data.Product) error {
+	for i, old := range s.prods {
+		if old.ID != p.ID {
+			continue
+		}
+
+		if p.Version != 0 && p.Version != old.Version {
+			return data.ErrVersionMismatch
+		}
+
+		p.Version = old.Version + 1
+		np := *p
+		s.prods[i] = &np
+		return nil
+	}
+
+	return data.ErrProductNotFound
+}
+
+func (s *stubProducts) DeleteProduct(ctx context.Context, id, version int) error {
+	p, err := s.GetProductByID(ctx, id, "")
+	if err != nil {
+		return err
+	}
+
+	if version != 0 && version != p.Version {
+		return data.ErrVersionMismatch
+	}
+
+	s.deleted = append(s.deleted, id)
+	return nil
+}
+
+func (s *stubProducts) ImportProduct(ctx context.Context, p data.Product, dryRun bool) (string, error) {
+	for i, old := range s.prods {
+		if old.SKU != p.SKU {
+			continue
+		}
+
+		if !dryRun {
+			p.ID = old.ID
+			s.prods[i] = &p
+		}
+		return data.ImportUpdated, nil
+	}
+
+	if !dryRun {
+		p.ID = len(s.prods) + 1
+		s.prods = append(s.prods, &p)
+	}
+	return data.ImportCreated, nil
+}
+
+func (s *stubProducts) RestoreProduct(ctx context.Context, id int) (*data.Product, error) {
+	for i, d := range s.deleted {
+		if d == id {
+			s.deleted = append(s.deleted[:i], s.deleted[i+1:]...)
+			return s.GetProductByID(ctx, id, "")
+		}
+	}
+
+	return nil, data.ErrProductNotFound
+}
+
+func (s *stubProducts) GetCategories(ctx context.Context) (data.Categories, error) {
+	return s.categories, nil
+}
+
+func (s *stubProducts) GetCategoryByID(ctx context.Context, id int) (*data.Category, error) {
+	for _, c := range s.categories {
+		if c.ID == id {
+			return c, nil
+		}
+	}
+
+	return nil, data.ErrCategoryNotFound
+}
+
+func (s *stubProducts) AddCategory(ctx context.Context, c data.Category) (*data.Category, error) {
+	if c.ParentID != 0 {
+		if _, err := s.GetCategoryByID(ctx, c.ParentID); err != nil {
+			return nil, data.ErrInvalidCategory
+		}
+	}
+
+	c.ID = len(s.categories) + 1
+	s.categories = append(s.categories, &c)
+	return &c, nil
+}
+
+func (s *stubProducts) UpdateCategory(ctx context.Context, c data.Category) (*data.Category, error) {
+	return &c, nil
+}
+
+func (s *stubProducts) DeleteCategory(ctx context.Context, id int) error { return nil }
+
+func (s *stubProducts) TagProduct(ctx context.Context, productID, categoryID int) error {
+	if _, err := s.GetProductByID(ctx, productID, ""); err != nil {
+		return err
+	}
+
+	if _, err := s.GetCategoryByID(ctx, categoryID); err != nil {
+		return err
+	}
+
+	s.tags = append(s.tags, data.Tag{ProductID: productID, CategoryID: categoryID})
+	return nil
+}
+
+func (s *stubProducts) UntagProduct(ctx context.Context, productID, categoryID int) error {
+	return nil
+}
+
+func (s *stubProducts) GetProductCategories(ctx context.Context, productID int) (data.Categories, error) {
+	return s.categories, nil
+}
+
+func (s *stubProducts) GetStock(ctx context.Context, productID int) (data.StockLevels, error) {
+	if _, err := s.GetProductByID(ctx, productID, ""); err != nil {
+		return nil, err
+	}
+
+	return data.StockLevels{{ProductID: productID, OnHand: s.stock, Available: s.stock}}, nil
+}
+
+func (s *stubProducts) AdjustStock(ctx context.Context, productID int, variantSKU string, delta int) (*data.StockLevel, error) {
+	if _, err := s.GetProductByID(ctx, productID, ""); err != nil {
+		return nil, err
+	}
+
+	if s.stock+delta < 0 {
+		return nil, data.ErrInsufficientStock
+	}
+
+	s.stock += delta
+	return &data.StockLevel{ProductID: productID, OnHand: s.stock, Available: s.stock}, nil
+}
+
+func (s *stubProducts) ReserveStock(ctx context.Context, items []data.StockItem, ttl time.Duration) (*data.Reservation, error) {
+	for _, it := range items {
+		if it.Quantity > s.stock {
+			return nil, data.ErrInsufficientStock
+		}
+	}
+
+	s.ttl = ttl
+	r := &data.Reservation{ID: len(s.reservations) + 1, Items: items}
+	s.reservations = append(s.reservations, r)
+	return r, nil
+}
+
+func (s *stubProducts) GetReservation(ctx context.Context, id int) (*data.Reservation, error) {
+	if id < 1 || id > len(s.reservations) || s.reservations[id-1] == nil {
+		return nil, data.ErrReservationNotFound
+	}
+
+	return s.reservations[id-1], nil
+}
+
+func (s *stubProducts) CommitReservation(ctx context.Context, id int) error {
+	return s.ReleaseReservation(ctx, id)
+}
+
+func (s *stubProducts) ReleaseReservation(ctx context.Context, id int) error {
+	if _, err := s.GetReservation(ctx, id); err != nil {
+		return err
+	}
+
+	s.reservations[id-1] = nil
+	return nil
+}
+
+func (s *stubProducts) GetPrices(ctx context.Context, productID int) ([]data.Price, error) {
+	if _, err := s.GetProductByID(ctx, productID, ""); err != nil {
+		return nil, err
+	}
+
+	return s.prices, nil
+}
+
+func (s *stubProducts) SetPrice(ctx context.Context, productID int, currency string, price float64) (*data.Price, error) {
+	if _, err := s.GetProductByID(ctx, productID, ""); err != nil {
+		return nil, err
+	}
+
+	if currency == "XXX" {
+		return nil, data.ErrInvalidCurrency
+	}
+
+	s.prices = append(s.prices, data.Price{ProductID: productID, Currency: currency, Price: price})
+	return &s.prices[len(s.prices)-1], nil
+}
+
+func (s *stubProducts) DeletePrice(ctx context.Context, productID int, currency string) error {
+	for i, pr := range s.prices {
+		if pr.ProductID == productID && pr.Currency == currency {
+			s.prices = append(s.prices[:i], s.prices[i+1:]...)
+			return nil
+		}
+	}
+
+	return data.ErrPriceNotFound
+}
+
+func (s *stubProducts) GetHistory(ctx context.Context, productID int) ([]*data.Revision, error) {
+	p, err := s.GetProductByID(ctx, productID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return []*data.Revision{{ID: 1, ProductID: productID, Type: data.RevisionCreated, Actor: data.SystemActor, Product: p}}, nil
+}
+
+func (s *stubProducts) GetProductAsOf(ctx context.Context, id int, at time.Time, currency string) (*data.Product, error) {
+	s.asOf = at
+	return s.GetProductByID(ctx, id, currency)
+}
+
+func (s *stubProducts) RateMetadata(ctx context.Context, currency string) *protos.RateMetadata {
+	return nil
+}
+
+func (s *stubProducts) CheckCurrency(ctx context.Context, currency string) error {
+	if currency == "XXX" {
+		return data.ErrInvalidCurrency
+	}
+
+	return nil
+}
+
+func (s *stubProducts) Events() *data.Events {
+	if s.events != nil {
+		return s.events
+	}
+
+	return data.NewEvents(1)
+}
+
+func newTestRouter(ps ProductService) *mux.Router {
+	ph := NewProducts(hclog.NewNullLogger(), data.NewValidation(), ps, "secret")
+
+	sm := mux.NewRouter()
+	sm.Use(ph.MiddlewareActor)
+	sm.HandleFunc("/products", ph.ListAll).Methods(http.MethodGet)
+	sm.Handle("/products", ph.MiddlewareIdempotency(ph.MiddlewareValidateProduct(http.HandlerFunc(ph.Create)))).Methods(http.MethodPost)
+	sm.HandleFunc("/products/search", ph.Search).Methods(http.MethodGet)
+	sm.HandleFunc("/products/export", ph.Export).Methods(http.MethodGet)
+	sm.HandleFunc("/products/import", ph.Import).Methods(http.MethodPost)
+	sm.HandleFunc("/products/{id:[0-9]+}", ph.ListSingle).Methods(http.MethodGet)
+	sm.Handle("/products/{id:[0-9]+}", ph.MiddlewareValidateProduct(http.HandlerFunc(ph.Update))).Methods(http.MethodPut)
+	sm.HandleFunc("/products/{id:[0-9]+}", ph.Patch).Methods(http.MethodPatch)
+	sm.HandleFunc("/products/{id:[0-9]+}", ph.Delete).Methods(http.MethodDelete)
+	sm.HandleFunc("/products/{id:[0-9]+}/restore", ph.Restore).Methods(http.MethodPost)
+	sm.HandleFunc("/products/{id:[0-9]+}/history", ph.ListHistory).Methods(http.MethodGet)
+	sm.Handle("/categories", ph.MiddlewareValidateCategory(http.HandlerFunc(ph.CreateCategory))).Methods(http.MethodPost)
+	sm.HandleFunc("/categories/{categoryID:[0-9]+}", ph.ListSingleCategory).Methods(http.MethodGet)
+	sm.HandleFunc("/products/{id:[0-9]+}/categories/{categoryID:[0-9]+}", ph.TagProduct).Methods(http.MethodPut)
+	sm.Handle("/products/{id:[0-9]+}/stock", ph.MiddlewareValidateStockAdjustment(http.HandlerFunc(ph.AdjustStock))).Methods(http.MethodPost)
+	sm.Handle("/reservations", ph.MiddlewareValidateReservation(http.HandlerFunc(ph.CreateReservation))).Methods(http.MethodPost)
+	sm.HandleFunc("/reservations/{reservationID:[0-9]+}/commit", ph.CommitReservation).Methods(http.MethodPost)
+	sm.HandleFunc("/products/{id:[0-9]+}/prices", ph.ListPrices).Methods(http.MethodGet)
+	sm.Handle("/products/{id:[0-9]+}/prices/{currency:[A-Z][A-Z0-9]{2,9}}", ph.MiddlewareValidatePrice(http.HandlerFunc(ph.SetPrice))).Methods(http.MethodPut)
+	sm.HandleFunc("/products/{id:[0-9]+}/prices/{currency:[A-Z][A-Z0-9]{2,9}}", ph.DeletePrice).Methods(http.MethodDelete)
+
+	return sm
+}
+
+func TestListAllReturnsProducts(t *testing.T) {
+	sm := newTestRouter(&stubProducts{prods: data.Products{&data.Product{ID: 1, Name: "Latte", Price: 2.45}}})
+
+	rw := httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/products", nil))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	prods := data.Products{}
+	assert.NoError(t, data.FromJSON(&prods, rw.Body))
+	assert.Len(t, prods, 1)
+	assert.Equal(t, "Latte", prods[0].Name)
+}
+
+func TestListAllInvalidCurrencyReturnsBadRequest(t *testing.T) {
+	sm := newTestRouter(&stubProducts{})
+
+	rw := httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/products?currency=XXX", nil))
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestListSingleMissingProductReturnsNotFound(t *testing.T) {
+	sm := newTestRouter(&stubProducts{})
+
+	rw := httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/products/3", nil))
+
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func TestDeleteRemovesProduct(t *testing.T) {
+	s := &stubProducts{prods: data.Products{&data.Product{ID: 1}}}
+	sm := newTestRouter(s)
+
+	rw := httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodDelete, "/products/1", nil))
+
+	assert.Equal(t, http.StatusNoContent, rw.Code)
+	assert.Equal(t, []int{1}, s.deleted)
+}
+
+func TestListAllIncludeDeletedRequiresAdmin(t *testing.T) {
+	s := &stubProducts{}
+	sm := newTestRouter(s)
+
+	rw := httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/products?include_deleted=true", nil))
+
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+
+	r := httptest.NewRequest(http.MethodGet, "/products?include_deleted=true", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, r)
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.True(t, s.opts.IncludeDeleted)
+}
+
+func TestRestoreReturnsRestoredProduct(t *testing.T) {
+	s := &stubProducts{prods: data.Products{&data.Product{ID: 1, Name: "Latte"}}}
+	sm := newTestRouter(s)
+
+	rw := httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/products/1/restore", nil))
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodDelete, "/products/1", nil))
+	assert.Equal(t, http.StatusNoContent, rw.Code)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/products/1/restore", nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	p := &data.Product{}
+	assert.NoError(t, data.FromJSON(p, rw.Body))
+	assert.Equal(t, "Latte", p.Name)
+}
+
+func TestListAllParsesListOptions(t *testing.T) {
+	s := &stubProducts{next: "abc"}
+	sm := newTestRouter(s)
+
+	rw := httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/products?sort=-price&name=la&min_price=1&max_price=2.5&limit=10", nil))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, data.ListOptions{Sort: data.SortByPrice, Descending: true, NamePrefix: "la", MinPrice: 1, MaxPrice: 2.5, Limit: 10}, s.opts)
+	assert.Equal(t, `</products?cursor=abc&limit=10&max_price=2.5&min_price=1&name=la&sort=-price>; rel="next"`, rw.Header().Get("Link"))
+}
+
+func TestListAllInvalidListOptionsReturnsBadRequest(t *testing.T) {
+	sm := newTestRouter(&stubProducts{})
+
+	for _, q := range []string{"limit=abc", "min_price=abc", "max_price=abc"} {
+		rw := httptest.NewRecorder()
+		sm.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/products?"+q, nil))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code, q)
+	}
+}
+
+func TestSearchReturnsMatchingProducts(t *testing.T) {
+	s := &stubProducts{prods: data.Products{&data.Product{ID: 1, Name: "Latte"}}}
+	sm := newTestRouter(s)
+
+	rw := httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/products/search?q=milky", nil))
+
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "milky", s.query)
+
+	prods := data.Products{}
+	assert.NoError(t, data.FromJSON(&prods, rw.Body))
+	assert.Len(t, prods, 1)
+
+	for _, q := range []string{"", "?q=milky&limit=abc", "?q=milky&currency=XXX"} {
+		rw = httptest.NewRecorder()
+		sm.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/products/search"+q, nil))
+
+		assert.Equal(t, http.StatusBadRequest, rw.Code, q)
+	}
+}
+
+func TestCreateCategoryAndTagProduct(t *testing.T) {
+	s := &stubProducts{prods: data.Products{&data.Product{ID: 1, Name: "Latte"}}}
+	sm := newTestRouter(s)
+
+	rw := httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/categories", strings.NewReader(`{"name": "Coffee"}`)))
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	c := &data.Category{}
+	assert.NoError(t, data.FromJSON(c, rw.Body))
+	assert.Equal(t, 1, c.ID)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/categories", strings.NewReader(`{"name": ""}`)))
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/categories", strings.NewReader(`{"name": "Espresso drinks", "parentId": 9}`)))
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodPut, "/products/1/categories/1", nil))
+	assert.Equal(t, http.StatusNoContent, rw.Code)
+	assert.Equal(t, []data.Tag{{ProductID: 1, CategoryID: 1}}, s.tags)
+
+	for _, path := range []string{"/products/2/categories/1", "/products/1/categories/2"} {
+		rw = httptest.NewRecorder()
+		sm.ServeHTTP(rw, httptest.NewRequest(http.MethodPut, path, nil))
+		assert.Equal(t, http.StatusNotFound, rw.Code, path)
+	}
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/categories/2", nil))
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func TestListAllByCategory(t *testing.T) {
+	s := &stubProducts{}
+	sm := newTestRouter(s)
+
+	rw := httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/products?category=1&category=3", nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, []int{1, 3}, s.opts.Categories)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/products?category=coffee", nil))
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestAdjustStockAndReserve(t *testing.T) {
+	s := &stubProducts{prods: data.Products{&data.Product{ID: 1, Name: "Latte"}}}
+	sm := newTestRouter(s)
+
+	rw := httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/products/1/stock", strings.NewReader(`{"delta": 2}`)))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, 2, s.stock)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/products/1/stock", strings.NewReader(`{"delta": 0}`)))
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/products/2/stock", strings.NewReader(`{"delta": 2}`)))
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/reservations", strings.NewReader(`{"items": [{"productId": 1, "quantity": 3}]}`)))
+	assert.Equal(t, http.StatusConflict, rw.Code)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/reservations", strings.NewReader(`{"items": []}`)))
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/reservations?ttl=soon", strings.NewReader(`{"items": [{"productId": 1, "quantity": 1}]}`)))
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/reservations?ttl=10m", strings.NewReader(`{"items": [{"productId": 1, "quantity": 2}]}`)))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, 10*time.Minute, s.ttl)
+
+	r := &data.Reservation{}
+	assert.NoError(t, data.FromJSON(r, rw.Body))
+	assert.Equal(t, 1, r.ID)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/reservations/1/commit", nil))
+	assert.Equal(t, http.StatusNoContent, rw.Code)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/reservations/1/commit", nil))
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func TestSetAndDeletePrices(t *testing.T) {
+	s := &stubProducts{prods: data.Products{&data.Product{ID: 1, Name: "Latte"}}}
+	sm := newTestRouter(s)
+
+	rw := httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodPut, "/products/1/prices/USD", strings.NewReader(`{"price": 3.5}`)))
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	pr := &data.Price{}
+	assert.NoError(t, data.FromJSON(pr, rw.Body))
+	assert.Equal(t, &data.Price{ProductID: 1, Currency: "USD", Price: 3.5}, pr)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodPut, "/products/1/prices/EUR", strings.NewReader(`{"price": 0}`)))
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodPut, "/products/1/prices/XXX", strings.NewReader(`{"price": 1}`)))
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+	// custom currencies of the currency service can be priced too
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodPut, "/products/1/prices/BEANS", strings.NewReader(`{"price": 350}`)))
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodDelete, "/products/1/prices/BEANS", nil))
+	assert.Equal(t, http.StatusNoContent, rw.Code)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodPut, "/products/2/prices/EUR", strings.NewReader(`{"price": 1}`)))
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/products/1/prices", nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	prices := []data.Price{}
+	assert.NoError(t, data.FromJSON(&prices, rw.Body))
+	assert.Len(t, prices, 1)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodDelete, "/products/1/prices/USD", nil))
+	assert.Equal(t, http.StatusNoContent, rw.Code)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodDelete, "/products/1/prices/USD", nil))
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func TestHistoryAndAsOfReads(t *testing.T) {
+	s := &stubProducts{prods: data.Products{&data.Product{ID: 1, Name: "Latte"}}}
+	sm := newTestRouter(s)
+
+	create := func(actor, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(`{"name": "Mocha", "price": 3.2, "sku": "abc-def-ghi"}`))
+		if actor != "" {
+			req.Header.Set(ActorHeader, actor)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		rw := httptest.NewRecorder()
+		sm.ServeHTTP(rw, req)
+		return rw
+	}
+
+	rw := create("alice", "secret")
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "alice", s.actor)
+
+	create("", "secret")
+	assert.Equal(t, AdminActor, s.actor)
+
+	// the actor is only recorded for authenticated requests
+	create("alice", "")
+	assert.Equal(t, data.AnonymousActor, s.actor)
+
+	create("", "")
+	assert.Equal(t, data.AnonymousActor, s.actor)
+
+	rw = create(strings.Repeat("a", maxActorLength+1), "secret")
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/products/1/history", nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	revs := []*data.Revision{}
+	assert.NoError(t, data.FromJSON(&revs, rw.Body))
+	assert.Len(t, revs, 1)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/products/2/history", nil))
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/products/1?as_of=2021-03-01T12:00:00Z", nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC), s.asOf)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/products/1?as_of=yesterday", nil))
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/products?as_of=2021-03-01T12:00:00%2B01:00", nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.True(t, s.opts.AsOf.Equal(time.Date(2021, 3, 1, 11, 0, 0, 0, time.UTC)))
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/products?as_of=yesterday", nil))
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestIfMatchPreventsLostUpdates(t *testing.T) {
+	s := &stubProducts{prods: data.Products{
+		&data.Product{ID: 1, Name: "Latte", Version: 3},
+		&data.Product{ID: 2, Name: "Espresso", Version: 1},
+	}}
+	sm := newTestRouter(s)
+
+	rw := httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/products/1", nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, `"3"`, rw.Header().Get("ETag"))
+
+	// updated is the ETag returned by the last update
+	updated := ""
+	update := func(ifMatch string) int {
+		req := httptest.NewRequest(http.MethodPut, "/products/1", strings.NewReader(`{"name": "Latte", "price": 2.5, "sku": "abc-def-ghi"}`))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+
+		rw := httptest.NewRecorder()
+		sm.ServeHTTP(rw, req)
+		updated = rw.Header().Get("ETag")
+		return rw.Code
+	}
+
+	assert.Equal(t, http.StatusNoContent, update(`"3"`))
+	assert.Equal(t, 4, s.prods[0].Version)
+	assert.Equal(t, `"4"`, updated)
+
+	// the ETag read before the update is stale
+	assert.Equal(t, http.StatusPreconditionFailed, update(`"3"`))
+	assert.Equal(t, http.StatusPreconditionFailed, update(`W/"4"`))
+	assert.Equal(t, http.StatusPreconditionFailed, update(`"2", "3"`))
+	assert.Equal(t, http.StatusNoContent, update(`"3", "4"`))
+	assert.Equal(t, http.StatusNoContent, update(`*`))
+	assert.Equal(t, http.StatusNoContent, update(""))
+	assert.Equal(t, `"7"`, updated)
+
+	req := httptest.NewRequest(http.MethodDelete, "/products/2", nil)
+	req.Header.Set("If-Match", `"2"`)
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusPreconditionFailed, rw.Code)
+	assert.Empty(t, s.deleted)
+
+	req.Header.Set("If-Match", `"1"`)
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusNoContent, rw.Code)
+	assert.Equal(t, []int{2}, s.deleted)
+}
+
+func TestIfMatchCanBeRequired(t *testing.T) {
+	ph := NewProducts(hclog.NewNullLogger(), data.NewValidation(), &stubProducts{prods: data.Products{&data.Product{ID: 1, Name: "Latte", Version: 1}}}, "")
+	ph.SetRequireIfMatch(true)
+
+	sm := mux.NewRouter()
+	sm.HandleFunc("/products/{id:[0-9]+}", ph.Delete).Methods(http.MethodDelete)
+
+	rw := httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodDelete, "/products/1", nil))
+	assert.Equal(t, http.StatusPreconditionRequired, rw.Code)
+
+	req := httptest.NewRequest(http.MethodDelete, "/products/1", nil)
+	req.Header.Set("If-Match", `"1"`)
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusNoContent, rw.Code)
+}
+
+func TestPatchProduct(t *testing.T) {
+	s := &stubProducts{prods: data.Products{&data.Product{ID: 1, Name: "Latte", Price: 2.45, SKU: "abc-def-ghi", Version: 1}}}
+	sm := newTestRouter(s)
+
+	patch := func(id, contentType, ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/products/"+id, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+
+		rw := httptest.NewRecorder()
+		sm.ServeHTTP(rw, req)
+		return rw
+	}
+
+	rw := patch("1", MergePatchType, "", `{"price": 2.5}`)
+	assert.Equal(t, http.StatusNoContent, rw.Code)
+	assert.Equal(t, `"2"`, rw.Header().Get("ETag"))
+	assert.Equal(t, 2.5, s.prods[0].Price)
+	assert.Equal(t, "Latte", s.prods[0].Name)
+
+	rw = patch("1", JSONPatchType, `"2"`, `[{"op": "test", "path": "/version", "value": 2}, {"op": "replace", "path": "/name", "value": "Flat white"}]`)
+	assert.Equal(t, http.StatusNoContent, rw.Code)
+	assert.Equal(t, "Flat white", s.prods[0].Name)
+	assert.Equal(t, 2.5, s.prods[0].Price)
+
+	// the patched product is validated
+	rw = patch("1", MergePatchType, "", `{"price": null}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+
+	rw = patch("1", JSONPatchType, "", `[{"op": "remove", "path": "/colour"}]`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+
+	rw = patch("1", JSONPatchType, "", `[{"op": "test", "path": "/name", "value": "Latte"}]`)
+	assert.Equal(t, http.StatusConflict, rw.Code)
+
+	rw = patch("1", JSONPatchType, "", `{"price": 3}`)
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+	rw = patch("1", "application/json", "", `{"price": 3}`)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rw.Code)
+	assert.Contains(t, rw.Header().Get("Accept-Patch"), MergePatchType)
+
+	rw = patch("1", MergePatchType, `"2"`, `{"price": 3}`)
+	assert.Equal(t, http.StatusPreconditionFailed, rw.Code)
+
+	rw = patch("2", MergePatchType, "", `{"price": 3}`)
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+
+	assert.Equal(t, 3, s.prods[0].Version)
+	assert.Equal(t, 2.5, s.prods[0].Price)
+}
+
+// racingProducts changes the product before it is first updated, as a concurrent
+// request would
+type racingProducts struct {
+	*stubProducts
+	raced bool
+}
+
+func (s *racingProducts) UpdateProduct(ctx context.Context, p *data.Product) error {
+	if !s.raced {
+		s.raced = true
+		s.stubProducts.UpdateProduct(ctx, &data.Product{ID: p.ID, Name: "Flat white", Price: 2.8, SKU: "abc-def-ghi"})
+	}
+
+	return s.stubProducts.UpdateProduct(ctx, p)
+}
+
+func TestPatchIsReappliedToConcurrentChanges(t *testing.T) {
+	s := &racingProducts{stubProducts: &stubProducts{prods: data.Products{&data.Product{ID: 1, Name: "Latte", Price: 2.45, SKU: "abc-def-ghi", Version: 1}}}}
+	sm := newTestRouter(s)
+
+	req := httptest.NewRequest(http.MethodPatch, "/products/1", strings.NewReader(`{"price": 3}`))
+	req.Header.Set("Content-Type", MergePatchType)
+
+	rw := httptest.NewRecorder()
+	sm.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusNoContent, rw.Code)
+	assert.Equal(t, `"3"`, rw.Header().Get("ETag"))
+	assert.Equal(t, "Flat white", s.prods[0].Name)
+	assert.Equal(t, 3.0, s.prods[0].Price)
+
+	// with If-Match the concurrent change is reported instead
+	s.raced = false
+	req = httptest.NewRequest(http.MethodPatch, "/products/1", strings.NewReader(`{"price": 3.5}`))
+	req.Header.Set("Content-Type", MergePatchType)
+	req.Header.Set("If-Match", `"3"`)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusPreconditionFailed, rw.Code)
+	assert.Equal(t, 2.8, s.prods[0].Price)
+}
+
+func TestExportAndImportCatalogue(t *testing.T) {
+	ctx := context.Background()
+	db := data.NewProductsDB(data.NewMemoryStore(data.ExampleProducts()), client.NewFake(), hclog.NewNullLogger())
+
+	// more products than fit in a page
+	for i := 0; i < 149; i++ {
+		sku := fmt.Sprintf("imp-ort-%c%c", 'a'+i/26, 'a'+i%26)
+		assert.NoError(t, db.AddProduct(ctx, data.Product{Name: "Product " + sku, Price: 1.5, SKU: sku}))
+	}
+
+	sm := newTestRouter(db)
+
+	rw := httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/products/export", nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", rw.Header().Get("Content-Type"))
+	catalogue := rw.Body.String()
+
+	records, err := csv.NewReader(strings.NewReader(catalogue)).ReadAll()
+	assert.NoError(t, err)
+	if assert.Len(t, records, 152) {
+		assert.Equal(t, catalogueColumns, records[0])
+		assert.Equal(t, []string{"1", "abc323", "Latte", "Frothy milky coffee", "2.45", "", "", ""}, records[1])
+	}
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/products/export?format=ndjson&name=latte", nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, NDJSONType, rw.Header().Get("Content-Type"))
+	assert.Equal(t, 1, strings.Count(rw.Body.String(), "\n"))
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/products/export?format=xml", nil))
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/products/export?currency=XXX", nil))
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+	// the export is imported into a catalogue which only has the example products
+	target := data.NewProductsDB(data.NewMemoryStore(data.ExampleProducts()), client.NewFake(), hclog.NewNullLogger())
+	sm = newTestRouter(target)
+
+	importCatalogue := func(url string) ImportReport {
+		req := httptest.NewRequest(http.MethodPost, url, strings.NewReader(catalogue))
+		req.Header.Set("Content-Type", CSVType)
+
+		rw := httptest.NewRecorder()
+		sm.ServeHTTP(rw, req)
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		rep := ImportReport{}
+		assert.NoError(t, data.FromJSON(&rep, rw.Body))
+		return rep
+	}
+
+	// the SKUs of the example products do not pass the validation of new products
+	rep := importCatalogue("/products/import?dry_run=true")
+	assert.True(t, rep.DryRun)
+	assert.Equal(t, 149, rep.Created)
+	assert.Equal(t, 2, rep.Failed)
+	assert.Len(t, rep.Rows, 151)
+
+	prods, _, err := target.GetProducts(ctx, "", data.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, prods, 2)
+
+	rep = importCatalogue("/products/import")
+	assert.False(t, rep.DryRun)
+	assert.Equal(t, 149, rep.Created)
+	assert.Equal(t, 2, rep.Failed)
+
+	prods, _, err = target.GetProducts(ctx, "", data.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, prods, 151)
+}
+
+func TestImportReportsRowErrors(t *testing.T) {
+	s := &stubProducts{prods: data.Products{&data.Product{ID: 1, Name: "Latte", Price: 2.45, SKU: "abc-def-ghi"}}}
+	sm := newTestRouter(s)
+
+	importCatalogue := func(contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/products/import", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+
+		rw := httptest.NewRecorder()
+		sm.ServeHTTP(rw, req)
+		return rw
+	}
+
+	rw := importCatalogue(CSVType, `sku,name,price,currency
+abc-def-ghi,Latte,2.5,
+mcc-cha-one,,3.2,
+flt-wht-one,Flat white,cheap,
+crt-ado-one,Cortado,2.6,USD
+"esp-res-one,Espresso,1.9,
+`)
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	rep := ImportReport{}
+	assert.NoError(t, data.FromJSON(&rep, rw.Body))
+	assert.Equal(t, 1, rep.Updated)
+	assert.Equal(t, 4, rep.Failed)
+	if assert.Len(t, rep.Rows, 5) {
+		assert.Equal(t, ImportRow{Row: 2, SKU: "abc-def-ghi", Action: data.ImportUpdated}, rep.Rows[0])
+		assert.Equal(t, 3, rep.Rows[1].Row)
+		assert.Contains(t, rep.Rows[1].Errors[0], "Name")
+		assert.Equal(t, []string{"price must be a number"}, rep.Rows[2].Errors)
+		assert.Contains(t, rep.Rows[3].Errors[0], "base currency")
+		assert.Equal(t, 6, rep.Rows[4].Row)
+	}
+	assert.Equal(t, 2.5, s.prods[0].Price)
+
+	rw = importCatalogue(NDJSONType, `{"name": "Mocha", "price": 3.2, "sku": "mcc-cha-one"}
+
+{"name": "Mocha"
+{"name": "Mocha", "price": 3.2, "sku": "mocha"}
+`)
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	rep = ImportReport{}
+	assert.NoError(t, data.FromJSON(&rep, rw.Body))
+	assert.Equal(t, 1, rep.Created)
+	assert.Equal(t, 2, rep.Failed)
+	if assert.Len(t, rep.Rows, 3) {
+		assert.Equal(t, ImportRow{Row: 1, SKU: "mcc-cha-one", Action: data.ImportCreated}, rep.Rows[0])
+		assert.Equal(t, 3, rep.Rows[1].Row)
+		assert.Equal(t, 4, rep.Rows[2].Row)
+	}
+	assert.Len(t, s.prods, 2)
+
+	rw = importCatalogue(CSVType, "name,price\nLatte,2.5\n")
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+	rw = importCatalogue("application/json", "[]")
+	assert.Equal(t, http.StatusUnsupportedMediaType, rw.Code)
+}
+
+func TestImportLargeCatalogueOverHTTP(t *testing.T) {
+	db := data.NewProductsDB(data.NewMemoryStore(data.Products{}), client.NewFake(), hclog.NewNullLogger())
+	srv := httptest.NewServer(newTestRouter(db))
+	defer srv.Close()
+
+	// the report of the rows is larger than the response buffer of the server, which must
+	// not stop reading the catalogue
+	catalogue := &strings.Builder{}
+	catalogue.WriteString("sku,name,price\n")
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(catalogue, "big-imp-%c%c%c,Product %d,1.5\n", 'a'+i/676, 'a'+i/26%26, 'a'+i%26, i)
+	}
+
+	resp, err := http.Post(srv.URL+"/products/import", CSVType, strings.NewReader(catalogue.String()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	rep := ImportReport{}
+	assert.NoError(t, data.FromJSON(&rep, resp.Body))
+	assert.Equal(t, 2000, rep.Created)
+	assert.Equal(t, 0, rep.Failed)
+	assert.Len(t, rep.Rows, 2000)
+
+	prods, _, err := db.GetProducts(context.Background(), "", data.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, prods, 2000)
+}
+
+func TestIdempotencyKeyReplaysResponse(t *testing.T) {
+	s := &stubProducts{}
+	ph := NewProducts(hclog.NewNullLogger(), data.NewValidation(), s, "")
+	now := time.Now()
+	ph.idempotency.now = func() time.Time { return now }
+
+	sm := mux.NewRouter()
+	sm.Use(ph.MiddlewareIdempotency)
+	sm.Handle("/products", ph.MiddlewareValidateProduct(http.HandlerFunc(ph.Create))).Methods(http.MethodPost)
+
+	create := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+
+		rw := httptest.NewRecorder()
+		sm.ServeHTTP(rw, req)
+		return rw
+	}
+
+	latte := `{"name": "Latte", "price": 2.45, "sku": "abc-def-ghi"}`
+	rw := create("k1", latte)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Empty(t, rw.Header().Get(IdempotentReplayedHeader))
+
+	rw = create("k1", latte)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "true", rw.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, 1, s.added)
+
+	rw = create("k1", `{"name": "Mocha", "price": 3.2, "sku": "abc-def-ghi"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+	assert.Equal(t, 1, s.added)
+
+	// invalid products are replayed like any other response
+	rw = create("k2", `{"name": "Latte"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+	replay := create("k2", `{"name": "Latte"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, replay.Code)
+	assert.Equal(t, rw.Body.String(), replay.Body.String())
+
+	rw = create(strings.Repeat("k", 256), latte)
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+	create("", latte)
+	create("", latte)
+	assert.Equal(t, 3, s.added)
+
+	// the response is forgotten once it expires
+	now = now.Add(DefaultIdempotencyTTL)
+	rw = create("k1", latte)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Empty(t, rw.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, 4, s.added)
+}
+
+// blockingProducts adds products only once they are released, so that requests can be
+// sent while a product is added
+type blockingProducts struct {
+	*stubProducts
+	adding  chan struct{}
+	release chan error
+}
+
+func (s *blockingProducts) AddProduct(ctx context.Context, p data.Product) error {
+	s.adding <- struct{}{}
+	err := <-s.release
+	if err != nil {
+		return err
+	}
+
+	return s.stubProducts.AddProduct(ctx, p)
+}
+
+func TestIdempotencyKeyRejectsConcurrentRepeats(t *testing.T) {
+	s := &blockingProducts{stubProducts: &stubProducts{}, adding: make(chan struct{}), release: make(chan error)}
+	sm := newTestRouter(s)
+
+	create := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(`{"name": "Latte", "price": 2.45, "sku": "abc-def-ghi"}`))
+		req.Header.Set(IdempotencyKeyHeader, "k1")
+
+		rw := httptest.NewRecorder()
+		sm.ServeHTTP(rw, req)
+		return rw
+	}
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- create() }()
+	<-s.adding
+
+	rw := create()
+	assert.Equal(t, http.StatusConflict, rw.Code)
+	assert.NotEmpty(t, rw.Header().Get("Retry-After"))
+
+	// server errors are not replayed, the request can be repeated
+	s.release <- fmt.Errorf("database unavailable")
+	assert.Equal(t, http.StatusInternalServerError, (<-first).Code)
+
+	go func() { first <- create() }()
+	<-s.adding
+	s.release <- nil
+	assert.Equal(t, http.StatusOK, (<-first).Code)
+
+	rw = create()
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "true", rw.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, 1, s.added)
+}
+
+func TestIdempotencyKeyLimits(t *testing.T) {
+	s := &stubProducts{}
+	ph := NewProducts(hclog.NewNullLogger(), data.NewValidation(), s, "")
+	ph.idempotency.maxKeys = 2
+
+	sm := mux.NewRouter()
+	sm.Handle("/products", ph.MiddlewareIdempotency(ph.MiddlewareValidateProduct(http.HandlerFunc(ph.Create)))).Methods(http.MethodPost)
+	sm.HandleFunc("/products/import", ph.Import).Methods(http.MethodPost)
+
+	create := func(key, caller, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, key)
+		if caller != "" {
+			req.Header.Set("Authorization", "Bearer "+caller)
+		}
+
+		rw := httptest.NewRecorder()
+		sm.ServeHTTP(rw, req)
+		return rw
+	}
+
+	latte := `{"name": "Latte", "price": 2.45, "sku": "abc-def-ghi"}`
+
+	// keys are scoped to the caller
+	create("k1", "alice", latte)
+	rw := create("k1", "bob", `{"name": "Mocha", "price": 3.2, "sku": "abc-def-ghi"}`)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Empty(t, rw.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, 2, s.added)
+
+	rw = create("k1", "alice", latte)
+	assert.Equal(t, "true", rw.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, 2, s.added)
+
+	// the oldest key is forgotten once the limit is reached
+	create("k2", "alice", latte)
+	rw = create("k1", "alice", latte)
+	assert.Empty(t, rw.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, 4, s.added)
+
+	rw = create("k3", "alice", `{"name": "`+strings.Repeat("a", maxIdempotentBody)+`"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rw.Code)
+	assert.Equal(t, 4, s.added)
+
+	req := httptest.NewRequest(http.MethodPost, "/products/import", strings.NewReader("sku,name,price\n"))
+	req.Header.Set("Content-Type", CSVType)
+	req.Header.Set(IdempotencyKeyHeader, "k4")
+	rw = httptest.NewRecorder()
+	sm.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestStreamNormalisesTheCurrency(t *testing.T) {
+	s := &stubProducts{prods: data.Products{&data.Product{ID: 1, Name: "Latte"}}, events: data.NewEvents(10)}
+	ph := NewProducts(hclog.NewNullLogger(), data.NewValidation(), s, "secret")
+	defer ph.CloseStreams()
+
+	srv := httptest.NewServer(http.HandlerFunc(ph.Stream))
+	defer srv.Close()
+
+	// an invalid currency is rejected when resuming, although the products are not read
+	s.events.Publish(data.Event{Type: data.EventProductUpdated, ProductID: 1})
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"?currency=XXX", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+
+	resp, err = http.Get(srv.URL + "?currency=usd")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+
+	events := make(chan string)
+	go func() {
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			if strings.HasPrefix(sc.Text(), "event: ") {
+				events <- strings.TrimPrefix(sc.Text(), "event: ")
+			}
+		}
+		close(events)
+	}()
+
+	next := func() string {
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(5 * time.Second):
+			return "timeout"
+		}
+	}
+
+	assert.Equal(t, "products", next())
+	assert.Equal(t, "USD", s.currency)
+
+	// rate events carry the upper case code
+	s.events.Publish(data.Event{Type: data.EventRateChanged, Currency: "USD"})
+	assert.Equal(t, "products", next())
+}
@@ -1,18 +1,23 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/d-vignesh/go-microservice-example/product-api/data"
 )
 
 // swagger:route PUT /products products updateProduct
-// Update a product details
+// Update a product details, the ETag header of the response is the strong ETag of the
+// new version of the product
 //
 // responses:
-//		201: noContentResponse
+//		204: noContentResponse
 //		404: errorResponse
+//		409: errorResponse
+//		412: errorResponse
 //		422: errorValidation
+//		428: errorResponse
 
 // Update handles PUT request to update products
 func (p *Products) Update(rw http.ResponseWriter, r *http.Request) {
@@ -23,8 +28,16 @@ func (p *Products) Update(rw http.ResponseWriter, r *http.Request) {
 	prod.ID = getProductID(r)
 	p.l.Debug("updating record id", prod.ID)
 
-	err := p.productDB.UpdateProduct(prod)
-	if err == data.ErrProductNotFound {
+	// the version of the product is only taken from the If-Match header
+	version, err := p.expectedVersion(r, prod.ID)
+	if err != nil {
+		p.writePreconditionError(rw, err)
+		return
+	}
+	prod.Version = version
+
+	err = p.productDB.UpdateProduct(r.Context(), &prod)
+	if errors.Is(err, data.ErrProductNotFound) {
 		p.l.Error("product not found", err)
 
 		rw.WriteHeader(http.StatusNotFound)
@@ -32,6 +45,28 @@ func (p *Products) Update(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// write the noContent success header
+	if errors.Is(err, data.ErrVersionMismatch) {
+		p.writePreconditionError(rw, err)
+		return
+	}
+
+	if errors.Is(err, data.ErrProductConflict) {
+		p.l.Error("unable to update product", "error", err)
+
+		rw.WriteHeader(http.StatusConflict)
+		data.ToJSON(&GenericError{Message: err.Error()}, rw)
+		return
+	}
+
+	if err != nil {
+		p.l.Error("unable to update product", "error", err)
+
+		rw.WriteHeader(http.StatusInternalServerError)
+		data.ToJSON(&GenericError{Message: err.Error()}, rw)
+		return
+	}
+
+	// write the noContent success header with the ETag of the new version
+	setETag(rw, &prod)
 	rw.WriteHeader(http.StatusNoContent)
 }
\ No newline at end of file
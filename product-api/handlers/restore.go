@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/d-vignesh/go-microservice-example/product-api/data"
+)
+
+// swagger:route POST /products/{id}/restore products restoreProduct
+// Restore a deleted product
+//
+// responses:
+//		200: productResponse
+//		404: errorResponse
+//		409: errorResponse
+//		501: errorResponse
+
+// Restore handles POST requests to restore a deleted product
+func (p *Products) Restore(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Add("Content-Type", "application/json")
+
+	id := getProductID(r)
+
+	p.l.Debug("restoring record id", id)
+
+	prod, err := p.productDB.RestoreProduct(r.Context(), id)
+
+	switch {
+	case err == nil:
+
+	case errors.Is(err, data.ErrProductNotFound):
+		p.l.Error("deleted product with given id does not exist", "id", id)
+
+		rw.WriteHeader(http.StatusNotFound)
+		data.ToJSON(&GenericError{Message: "deleted product not found"}, rw)
+		return
+	case errors.Is(err, data.ErrProductConflict):
+		p.l.Error("unable to restore product", "error", err)
+
+		rw.WriteHeader(http.StatusConflict)
+		data.ToJSON(&GenericError{Message: err.Error()}, rw)
+		return
+	default:
+		p.l.Error("unable to restore product", "error", err)
+
+		rw.WriteHeader(http.StatusInternalServerError)
+		data.ToJSON(&GenericError{Message: err.Error()}, rw)
+		return
+	}
+
+	setETag(rw, prod)
+
+	err = data.ToJSON(prod, rw)
+	if err != nil {
+		p.l.Error("unable to serialize product", "error", err)
+	}
+}
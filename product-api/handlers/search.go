@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/d-vignesh/go-microservice-example/product-api/data"
+)
+
+// swagger:route GET /products/search products searchProducts
+// Returns the products matching the query ordered by relevance. The name and
+// description of the products are searched, words match when they have the same
+// stem, start with the query word or differ by a typo.
+// responses:
+//		200: productsResponse
+//		400: errorResponse
+
+// Search handles GET requests and returns the products matching the query
+func (p *Products) Search(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Add("Content-Type", "application/json")
+
+	q := r.URL.Query().Get("q")
+	cur := r.URL.Query().Get("currency")
+
+	p.l.Debug("search products", "query", q)
+
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil {
+			p.writeProductsError(rw, fmt.Errorf("%w: limit must be a number", data.ErrInvalidSearch))
+			return
+		}
+	}
+
+	prods, err := p.productDB.SearchProducts(r.Context(), q, cur, limit)
+	if err != nil {
+		p.writeProductsError(rw, err)
+		return
+	}
+
+	p.setRateProvenance(rw, r, cur)
+
+	err = data.ToJSON(prods, rw)
+	if err != nil {
+		p.l.Error("unable to serializing product", "error", err)
+	}
+}
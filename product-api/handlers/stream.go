@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/d-vignesh/go-microservice-example/product-api/data"
+)
+
+// heartbeatInterval is how often a comment is sent to keep idle streams open
+const heartbeatInterval = 15 * time.Second
+
+// swagger:route GET /products/stream products streamProducts
+// Streams the products as Server-Sent Events. A products event containing all products
+// is sent first and whenever the exchange rate of the requested currency changes,
+// product and deleted events are sent when a product or its availability changes. Clients can resume
+// with the Last-Event-ID header, streams which fall behind are closed for the client to resume.
+//
+// produces:
+// - text/event-stream
+//
+// responses:
+//		200: productStreamResponse
+//		400: errorResponse
+
+// Stream handles GET requests and streams product changes as Server-Sent Events
+func (p *Products) Stream(rw http.ResponseWriter, r *http.Request) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		rw.WriteHeader(http.StatusInternalServerError)
+		data.ToJSON(&GenericError{Message: "streaming is not supported"}, rw)
+		return
+	}
+
+	// rate events carry the upper case code of the currency
+	cur := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("currency")))
+	lastID, _ := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+
+	// subscribe before reading the products so no change is missed
+	replay, resumed, latest, events, cancel := p.productDB.Events().Subscribe(lastID)
+	defer cancel()
+
+	s := &eventStream{ctx: r.Context(), rw: rw, flusher: flusher, currency: cur, p: p}
+
+	if !resumed {
+		// fetch the products before the stream is started so an invalid currency
+		// is returned to the client as an error
+		prods, _, err := p.productDB.GetProducts(r.Context(), cur, data.ListOptions{})
+		if err != nil {
+			p.writeProductsError(rw, err)
+			return
+		}
+
+		s.start()
+
+		err = s.send("products", latest, prods)
+		if err != nil {
+			return
+		}
+	} else {
+		// the products are not read when resuming, the currency is checked on its own
+		err := p.productDB.CheckCurrency(r.Context(), cur)
+		if err != nil {
+			p.writeProductsError(rw, err)
+			return
+		}
+
+		p.l.Debug("resuming product stream", "last_event_id", lastID, "events", len(replay))
+		s.start()
+
+		for _, ev := range replay {
+			err := s.handle(ev)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	// streams are long lived, remove the server write timeout for this request
+	err := http.NewResponseController(rw).SetWriteDeadline(time.Time{})
+	if err != nil {
+		p.l.Error("unable to clear write deadline for stream", "error", err)
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			p.l.Debug("client has closed product stream")
+			return
+		case <-p.closeStreams:
+			return
+		case <-heartbeat.C:
+			_, err := fmt.Fprint(rw, ": heartbeat\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case ev, ok := <-events:
+			if !ok {
+				// the stream missed events, the client reconnects and resumes with the
+				// Last-Event-ID of the last event it received
+				p.l.Info("product stream fell behind, closing it")
+				return
+			}
+
+			err := s.handle(ev)
+			if err != nil {
+				p.l.Error("unable to send product event", "error", err)
+				return
+			}
+		}
+	}
+}
+
+// eventStream writes Server-Sent Events for a single client
+type eventStream struct {
+	ctx      context.Context
+	rw       http.ResponseWriter
+	flusher  http.Flusher
+	currency string
+	p        *Products
+}
+
+// start writes the headers of the stream
+func (s *eventStream) start() {
+	s.rw.Header().Set("Content-Type", "text/event-stream")
+	s.rw.Header().Set("Cache-Control", "no-cache")
+	s.rw.Header().Set("Connection", "keep-alive")
+	s.rw.WriteHeader(http.StatusOK)
+	s.flusher.Flush()
+}
+
+// handle converts the event into the Server-Sent Event for the client, events
+// which do not affect the requested currency are skipped
+func (s *eventStream) handle(ev data.Event) error {
+	switch ev.Type {
+	case data.EventRateChanged:
+		if ev.Currency != s.currency {
+			return nil
+		}
+
+		prods, _, err := s.p.productDB.GetProducts(s.ctx, s.currency, data.ListOptions{})
+		if err != nil {
+			return err
+		}
+
+		return s.send("products", ev.ID, prods)
+	case data.EventProductCreated, data.EventProductUpdated, data.EventProductRestored, data.EventStockChanged:
+		prod, err := s.p.productDB.GetProductByID(s.ctx, ev.ProductID, s.currency)
+		if errors.Is(err, data.ErrProductNotFound) {
+			// the product has been deleted since, the delete event follows
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return s.send("product", ev.ID, prod)
+	case data.EventProductDeleted:
+		return s.send("deleted", ev.ID, map[string]int{"id": ev.ProductID})
+	}
+
+	return nil
+}
+
+// send writes a single event to the client
+func (s *eventStream) send(event string, id uint64, i interface{}) error {
+	d, err := json.Marshal(i)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(s.rw, "id: %d\nevent: %s\ndata: %s\n\n", id, event, d)
+	if err != nil {
+		return err
+	}
+
+	s.flusher.Flush()
+	return nil
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/d-vignesh/go-microservice-example/product-api/data"
+)
+
+// ErrPreconditionRequired is an error message when a product is changed without an
+// If-Match header while the header is required
+var ErrPreconditionRequired = fmt.Errorf("the If-Match header is required, set it to the ETag of the product")
+
+// ErrPreconditionFailed is an error message when the If-Match header does not match the
+// ETag of the product, as the product was changed since it was read
+var ErrPreconditionFailed = fmt.Errorf("the product has been changed, the If-Match header does not match its ETag")
+
+// SetRequireIfMatch sets whether requests changing a product must have an If-Match header,
+// it must be called before the handler is used
+func (p *Products) SetRequireIfMatch(require bool) {
+	p.requireIfMatch = require
+}
+
+// etag returns the strong ETag of the version of a product. It only identifies the stored
+// version for If-Match, the representations in other currencies and with other stock
+// levels have the same ETag, so it must not be used to validate cached responses.
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// setETag sets the ETag header to the version of the product
+func setETag(rw http.ResponseWriter, prod *data.Product) {
+	rw.Header().Set("ETag", etag(prod.Version))
+}
+
+// expectedVersion returns the version the product with the given id must be at to be
+// changed by the request, zero when any version can be changed. The versions are
+// compared by the store, the product is only read when If-Match lists several ETags.
+func (p *Products) expectedVersion(r *http.Request, id int) (int, error) {
+	values := r.Header.Values("If-Match")
+	if len(values) == 0 {
+		if p.requireIfMatch {
+			return 0, ErrPreconditionRequired
+		}
+
+		return 0, nil
+	}
+
+	versions := []int{}
+	for _, tag := range strings.Split(strings.Join(values, ","), ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return 0, nil
+		}
+
+		// weak ETags never match as If-Match uses the strong comparison
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			continue
+		}
+
+		v, err := strconv.Atoi(tag[1 : len(tag)-1])
+		if err == nil && v > 0 {
+			versions = append(versions, v)
+		}
+	}
+
+	switch len(versions) {
+	case 0:
+		return 0, ErrPreconditionFailed
+	case 1:
+		return versions[0], nil
+	}
+
+	prod, err := p.productDB.GetProductByID(r.Context(), id, "")
+	if err != nil {
+		return 0, err
+	}
+
+	for _, v := range versions {
+		if v == prod.Version {
+			return v, nil
+		}
+	}
+
+	return 0, ErrPreconditionFailed
+}
+
+// writePreconditionError writes the response for an error of expectedVersion or for a
+// product which is not at the expected version
+func (p *Products) writePreconditionError(rw http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrPreconditionRequired):
+		p.l.Error("missing If-Match header", "error", err)
+
+		rw.WriteHeader(http.StatusPreconditionRequired)
+		data.ToJSON(&GenericError{Message: err.Error()}, rw)
+	case errors.Is(err, ErrPreconditionFailed), errors.Is(err, data.ErrVersionMismatch):
+		p.l.Error("product version does not match", "error", err)
+
+		rw.WriteHeader(http.StatusPreconditionFailed)
+		data.ToJSON(&GenericError{Message: ErrPreconditionFailed.Error()}, rw)
+	case errors.Is(err, data.ErrProductNotFound):
+		p.l.Error("product not found", "error", err)
+
+		rw.WriteHeader(http.StatusNotFound)
+		data.ToJSON(&GenericError{Message: err.Error()}, rw)
+	default:
+		p.l.Error("unable to check product version", "error", err)
+
+		rw.WriteHeader(http.StatusInternalServerError)
+		data.ToJSON(&GenericError{Message: err.Error()}, rw)
+	}
+}
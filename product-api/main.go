@@ -1,6 +1,8 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"net/http"
 	"log"
 	"os"
@@ -10,57 +12,155 @@ import (
 
 	"github.com/d-vignesh/go-microservice-example/product-api/handlers"
 	"github.com/d-vignesh/go-microservice-example/product-api/data"
-	protos "github.com/d-vignesh/go-microservice-example/currency/protos/currency"
+	"github.com/d-vignesh/go-microservice-example/currency/client"
 
 	"github.com/gorilla/mux"
 	gohandlers "github.com/gorilla/handlers"
 	"github.com/go-openapi/runtime/middleware"
-	"google.golang.org/grpc"
 	"github.com/hashicorp/go-hclog"
 )
 
+var store = flag.String("store", "memory", "Product store to use: memory, sqlite or postgres")
+var dbPath = flag.String("db-path", "products.db", "File of the SQLite product database")
+var dbDSN = flag.String("db-dsn", os.Getenv("PRODUCT_API_POSTGRES_DSN"), "Connection string of the PostgreSQL product database")
+var adminToken = flag.String("admin-token", "", "Bearer token required to list deleted products and to record the X-Actor of changes")
+var deletedRetention = flag.Duration("deleted-retention", 30*24*time.Hour, "Time deleted products can be restored before they are purged")
+var lowStockThreshold = flag.Int("low-stock-threshold", data.DefaultLowStockThreshold, "Available stock at or below which a product is reported as low on stock")
+var requireIfMatch = flag.Bool("require-if-match", false, "Require an If-Match header with the ETag of the product to update or delete it")
+var idempotencyTTL = flag.Duration("idempotency-ttl", handlers.DefaultIdempotencyTTL, "Time the response of a request with an Idempotency-Key is replayed for repeats, 0 ignores the header")
 
 func main() {
+	flag.Parse()
+
 	l := hclog.Default()
 	v := data.NewValidation()
 
-	conn, err := grpc.Dial("localhost:9092", grpc.WithInsecure())
+	// create currency client, it keeps the rates up to date and reconnects
+	// when the currency service is unavailable
+	cc, err := client.New("localhost:9092", l.Named("currency"))
 	if err != nil {
 		panic(err)
 	}
-	defer conn.Close()
+	defer cc.Close()
 
-	// create currency client
-	cc := protos.NewCurrencyClient(conn)
+	ps, closeStore, err := newStore(l)
+	if err != nil {
+		l.Error("unable to create product store", "error", err)
+		os.Exit(1)
+	}
+	defer closeStore()
 
 	// create a database instance
-	db := data.NewProductsDB(cc, l)
+	db := data.NewProductsDB(ps, cc, l)
+	db.SetLowStockThreshold(*lowStockThreshold)
+	db.MonitorPurge(*deletedRetention, time.Hour)
+	db.MonitorReservations(time.Minute)
 
 	// create the product handler
-	ph := handlers.NewProducts(l, v, db)
+	ph := handlers.NewProducts(l, v, db, *adminToken)
+	ph.SetRequireIfMatch(*requireIfMatch)
+	ph.SetIdempotencyTTL(*idempotencyTTL)
 
 	// create a new serve mux and register the handler
 	sm := mux.NewRouter()
 
+	// record the actor of every request in the history of the products it changes
+	sm.Use(ph.MiddlewareActor)
+
 	// handlers for API
 	getR := sm.Methods(http.MethodGet).Subrouter()
 	getR.HandleFunc("/products", ph.ListAll).Queries("currency", "{[A-Z]{3}}")
 	getR.HandleFunc("/products", ph.ListAll)
 
+	getR.HandleFunc("/products/stream", ph.Stream)
+	getR.HandleFunc("/products/search", ph.Search)
+	getR.HandleFunc("/products/export", ph.Export)
+
 	getR.HandleFunc("/products/{id:[0-9]+}", ph.ListSingle).Queries("currency", "{[A-Z]{3}}")
 	getR.HandleFunc("/products/{id:[0-9]+}", ph.ListSingle)
+	getR.HandleFunc("/products/{id:[0-9]+}/history", ph.ListHistory)
 
+	// the requests changing data are handled once per Idempotency-Key, so that clients can
+	// retry them, imports are streamed and match products by SKU so they are not included
 	putR := sm.Methods(http.MethodPut).Subrouter()
+	putR.Use(ph.MiddlewareIdempotency)
 	putR.HandleFunc("/products/{id:[0-9]+}", ph.Update)
 	putR.Use(ph.MiddlewareValidateProduct)
 
+	// patches are validated once they are applied to the product
+	patchR := sm.Methods(http.MethodPatch).Subrouter()
+	patchR.Use(ph.MiddlewareIdempotency)
+	patchR.HandleFunc("/products/{id:[0-9]+}", ph.Patch)
+
 	postR := sm.Methods(http.MethodPost).Subrouter()
+	postR.Use(ph.MiddlewareIdempotency)
 	postR.HandleFunc("/products", ph.Create)
 	postR.Use(ph.MiddlewareValidateProduct)
 
+	restoreR := sm.Methods(http.MethodPost).Subrouter()
+	restoreR.Use(ph.MiddlewareIdempotency)
+	restoreR.HandleFunc("/products/{id:[0-9]+}/restore", ph.Restore)
+
+	// the rows of an import are validated as they are read
+	importR := sm.Methods(http.MethodPost).Subrouter()
+	importR.HandleFunc("/products/import", ph.Import)
+
 	deleteR := sm.Methods(http.MethodDelete).Subrouter()
+	deleteR.Use(ph.MiddlewareIdempotency)
 	deleteR.HandleFunc("/products/{id:[0-9]+}", ph.Delete)
 
+	// handlers for the categories and the tags of the products
+	getR.HandleFunc("/categories", ph.ListCategories)
+	getR.HandleFunc("/categories/{categoryID:[0-9]+}", ph.ListSingleCategory)
+	getR.HandleFunc("/products/{id:[0-9]+}/categories", ph.ListProductCategories)
+
+	postCategoryR := sm.Methods(http.MethodPost).Subrouter()
+	postCategoryR.Use(ph.MiddlewareIdempotency)
+	postCategoryR.HandleFunc("/categories", ph.CreateCategory)
+	postCategoryR.Use(ph.MiddlewareValidateCategory)
+
+	putCategoryR := sm.Methods(http.MethodPut).Subrouter()
+	putCategoryR.Use(ph.MiddlewareIdempotency)
+	putCategoryR.HandleFunc("/categories/{categoryID:[0-9]+}", ph.UpdateCategory)
+	putCategoryR.Use(ph.MiddlewareValidateCategory)
+
+	tagR := sm.Methods(http.MethodPut).Subrouter()
+	tagR.Use(ph.MiddlewareIdempotency)
+	tagR.HandleFunc("/products/{id:[0-9]+}/categories/{categoryID:[0-9]+}", ph.TagProduct)
+
+	deleteR.HandleFunc("/categories/{categoryID:[0-9]+}", ph.DeleteCategory)
+	deleteR.HandleFunc("/products/{id:[0-9]+}/categories/{categoryID:[0-9]+}", ph.UntagProduct)
+
+	// handlers for the stock of the products and its reservations
+	getR.HandleFunc("/products/{id:[0-9]+}/stock", ph.ListStock)
+	getR.HandleFunc("/reservations/{reservationID:[0-9]+}", ph.ListSingleReservation)
+
+	stockR := sm.Methods(http.MethodPost).Subrouter()
+	stockR.Use(ph.MiddlewareIdempotency)
+	stockR.HandleFunc("/products/{id:[0-9]+}/stock", ph.AdjustStock)
+	stockR.Use(ph.MiddlewareValidateStockAdjustment)
+
+	reserveR := sm.Methods(http.MethodPost).Subrouter()
+	reserveR.Use(ph.MiddlewareIdempotency)
+	reserveR.HandleFunc("/reservations", ph.CreateReservation)
+	reserveR.Use(ph.MiddlewareValidateReservation)
+
+	commitR := sm.Methods(http.MethodPost).Subrouter()
+	commitR.Use(ph.MiddlewareIdempotency)
+	commitR.HandleFunc("/reservations/{reservationID:[0-9]+}/commit", ph.CommitReservation)
+	deleteR.HandleFunc("/reservations/{reservationID:[0-9]+}", ph.ReleaseReservation)
+
+	// handlers for the native prices of the products, the currency is an ISO 4217 code or
+	// the code of a custom currency of the currency service such as BEANS
+	getR.HandleFunc("/products/{id:[0-9]+}/prices", ph.ListPrices)
+
+	priceR := sm.Methods(http.MethodPut).Subrouter()
+	priceR.Use(ph.MiddlewareIdempotency)
+	priceR.HandleFunc("/products/{id:[0-9]+}/prices/{currency:[A-Z][A-Z0-9]{2,9}}", ph.SetPrice)
+	priceR.Use(ph.MiddlewareValidatePrice)
+
+	deleteR.HandleFunc("/products/{id:[0-9]+}/prices/{currency:[A-Z][A-Z0-9]{2,9}}", ph.DeletePrice)
+
 	// handler for documentation
 	opts := middleware.RedocOpts{SpecURL: "/swagger.yaml"}
 	sh := middleware.Redoc(opts, nil)
@@ -70,7 +170,12 @@ func main() {
 
 
 	// CORS
-	ch := gohandlers.CORS(gohandlers.AllowedOrigins([]string{"*"}))
+	ch := gohandlers.CORS(
+		gohandlers.AllowedOrigins([]string{"*"}),
+		gohandlers.AllowedMethods([]string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}),
+		gohandlers.AllowedHeaders([]string{"Content-Type", "Authorization", "If-Match", "Last-Event-ID", handlers.ActorHeader, handlers.IdempotencyKeyHeader}),
+		gohandlers.ExposedHeaders([]string{handlers.RateProvenanceHeader, "Link", "ETag", handlers.IdempotentReplayedHeader}),
+	)
 
 	// create a server
 	s := http.Server{
@@ -82,6 +187,9 @@ func main() {
 		IdleTimeout:  120 * time.Second,
 	}
 
+	// product streams are long lived, end them when the server shuts down
+	s.RegisterOnShutdown(ph.CloseStreams)
+
 	// start the server
 	go func() {
 		l.Info("Starting server on port 9090")
@@ -103,6 +211,32 @@ func main() {
 	log.Println("got signal :", sig)
 
 	//gracefully shutdown the server, waiting max 30 seconds for current operations to complete
-	ctx, _ := context.WithTimeout(context.Background(), 30 * time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30 * time.Second)
+	defer cancel()
 	s.Shutdown(ctx)
-}	
\ No newline at end of file
+}
+
+// newStore creates the product store selected by the store flag, the returned function
+// releases the resources of the store
+func newStore(l hclog.Logger) (data.ProductStore, func() error, error) {
+	switch *store {
+	case "memory":
+		return data.NewMemoryStore(data.ExampleProducts()), func() error { return nil }, nil
+	case "sqlite":
+		s, err := data.NewSQLiteStore(context.Background(), *dbPath, l)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return s, s.Close, nil
+	case "postgres":
+		s, err := data.NewPostgresStore(context.Background(), *dbDSN, data.DefaultPoolConfig, l)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return s, s.Close, nil
+	}
+
+	return nil, nil, fmt.Errorf("unknown store %q, must be memory, sqlite or postgres", *store)
+}
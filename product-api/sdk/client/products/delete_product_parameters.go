@@ -61,6 +61,13 @@ for the delete product operation typically these are written to a http.Request
 */
 type DeleteProductParams struct {
 
+	/*IfMatch
+	  ETag of the version the product must be at to be changed, or * for any
+	version. Required when the server is started with -require-if-match.
+
+	*/
+	IfMatch *string
+
 	/*ID
 	  the ID of the product for which the operation relates
 
@@ -105,6 +112,17 @@ func (o *DeleteProductParams) SetHTTPClient(client *http.Client) {
 	o.HTTPClient = client
 }
 
+// WithIfMatch adds the ifMatch to the delete product params
+func (o *DeleteProductParams) WithIfMatch(ifMatch *string) *DeleteProductParams {
+	o.SetIfMatch(ifMatch)
+	return o
+}
+
+// SetIfMatch adds the ifMatch to the delete product params
+func (o *DeleteProductParams) SetIfMatch(ifMatch *string) {
+	o.IfMatch = ifMatch
+}
+
 // WithID adds the id to the delete product params
 func (o *DeleteProductParams) WithID(id int64) *DeleteProductParams {
 	o.SetID(id)
@@ -124,6 +142,15 @@ func (o *DeleteProductParams) WriteToRequest(r runtime.ClientRequest, reg strfmt
 	}
 	var res []error
 
+	if o.IfMatch != nil {
+
+		// header param If-Match
+		if err := r.SetHeaderParam("If-Match", *o.IfMatch); err != nil {
+			return err
+		}
+
+	}
+
 	// path param id
 	if err := r.SetPathParam("id", swag.FormatInt64(o.ID)); err != nil {
 		return err
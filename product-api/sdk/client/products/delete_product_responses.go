@@ -35,6 +35,18 @@ func (o *DeleteProductReader) ReadResponse(response runtime.ClientResponse, cons
 			return nil, err
 		}
 		return nil, result
+	case 412:
+		result := NewDeleteProductPreconditionFailed()
+		if err := result.readResponse(response, consumer, o.formats); err != nil {
+			return nil, err
+		}
+		return nil, result
+	case 428:
+		result := NewDeleteProductPreconditionRequired()
+		if err := result.readResponse(response, consumer, o.formats); err != nil {
+			return nil, err
+		}
+		return nil, result
 	case 501:
 		result := NewDeleteProductNotImplemented()
 		if err := result.readResponse(response, consumer, o.formats); err != nil {
@@ -101,6 +113,72 @@ func (o *DeleteProductNotFound) readResponse(response runtime.ClientResponse, co
 	return nil
 }
 
+// NewDeleteProductPreconditionFailed creates a DeleteProductPreconditionFailed with default headers values
+func NewDeleteProductPreconditionFailed() *DeleteProductPreconditionFailed {
+	return &DeleteProductPreconditionFailed{}
+}
+
+/*DeleteProductPreconditionFailed handles this case with default header values.
+
+Generic error message returned as a string
+*/
+type DeleteProductPreconditionFailed struct {
+	Payload *models.GenericError
+}
+
+func (o *DeleteProductPreconditionFailed) Error() string {
+	return fmt.Sprintf("[DELETE /products/{id}][%d] deleteProductPreconditionFailed  %+v", 412, o.Payload)
+}
+
+func (o *DeleteProductPreconditionFailed) GetPayload() *models.GenericError {
+	return o.Payload
+}
+
+func (o *DeleteProductPreconditionFailed) readResponse(response runtime.ClientResponse, consumer runtime.Consumer, formats strfmt.Registry) error {
+
+	o.Payload = new(models.GenericError)
+
+	// response payload
+	if err := consumer.Consume(response.Body(), o.Payload); err != nil && err != io.EOF {
+		return err
+	}
+
+	return nil
+}
+
+// NewDeleteProductPreconditionRequired creates a DeleteProductPreconditionRequired with default headers values
+func NewDeleteProductPreconditionRequired() *DeleteProductPreconditionRequired {
+	return &DeleteProductPreconditionRequired{}
+}
+
+/*DeleteProductPreconditionRequired handles this case with default header values.
+
+Generic error message returned as a string
+*/
+type DeleteProductPreconditionRequired struct {
+	Payload *models.GenericError
+}
+
+func (o *DeleteProductPreconditionRequired) Error() string {
+	return fmt.Sprintf("[DELETE /products/{id}][%d] deleteProductPreconditionRequired  %+v", 428, o.Payload)
+}
+
+func (o *DeleteProductPreconditionRequired) GetPayload() *models.GenericError {
+	return o.Payload
+}
+
+func (o *DeleteProductPreconditionRequired) readResponse(response runtime.ClientResponse, consumer runtime.Consumer, formats strfmt.Registry) error {
+
+	o.Payload = new(models.GenericError)
+
+	// response payload
+	if err := consumer.Consume(response.Body(), o.Payload); err != nil && err != io.EOF {
+		return err
+	}
+
+	return nil
+}
+
 // NewDeleteProductNotImplemented creates a DeleteProductNotImplemented with default headers values
 func NewDeleteProductNotImplemented() *DeleteProductNotImplemented {
 	return &DeleteProductNotImplemented{}
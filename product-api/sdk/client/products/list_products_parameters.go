@@ -14,6 +14,7 @@ import (
 	"github.com/go-openapi/runtime"
 	cr "github.com/go-openapi/runtime/client"
 	"github.com/go-openapi/strfmt"
+	"github.com/go-openapi/swag"
 )
 
 // NewListProductsParams creates a new ListProductsParams object
@@ -59,6 +60,58 @@ func NewListProductsParamsWithHTTPClient(client *http.Client) *ListProductsParam
 for the list products operation typically these are written to a http.Request
 */
 type ListProductsParams struct {
+
+	/*Category
+	  Only return the products tagged with the category or one of its descendants,
+	can be repeated to return the products of any of the categories
+
+	*/
+	Category []int64
+
+	/*Currency
+	  Currency used when returning the price of the product,
+	when not specified currency is returned in GBP.
+
+	*/
+	Currency *string
+
+	/*Cursor
+	  Cursor of the page to return, taken from the Link header of the previous page
+
+	*/
+	Cursor *string
+
+	/*Limit
+	  Maximum number of products returned, at most 100
+
+	*/
+	Limit *int64
+
+	/*MaxPrice
+	  Only return the products with at most this price in the requested currency
+
+	*/
+	MaxPrice *float64
+
+	/*MinPrice
+	  Only return the products with at least this price in the requested currency
+
+	*/
+	MinPrice *float64
+
+	/*Name
+	  Only return the products whose name starts with the prefix, ignoring case
+
+	*/
+	Name *string
+
+	/*Sort
+	  Field the products are sorted by: id, name, price, created or sku,
+	prefix the field with - to sort in descending order
+
+	*/
+	Sort *string
+
 	timeout    time.Duration
 	Context    context.Context
 	HTTPClient *http.Client
@@ -97,6 +150,94 @@ func (o *ListProductsParams) SetHTTPClient(client *http.Client) {
 	o.HTTPClient = client
 }
 
+// WithCategory adds the category to the list products params
+func (o *ListProductsParams) WithCategory(category []int64) *ListProductsParams {
+	o.SetCategory(category)
+	return o
+}
+
+// SetCategory adds the category to the list products params
+func (o *ListProductsParams) SetCategory(category []int64) {
+	o.Category = category
+}
+
+// WithCurrency adds the currency to the list products params
+func (o *ListProductsParams) WithCurrency(currency *string) *ListProductsParams {
+	o.SetCurrency(currency)
+	return o
+}
+
+// SetCurrency adds the currency to the list products params
+func (o *ListProductsParams) SetCurrency(currency *string) {
+	o.Currency = currency
+}
+
+// WithCursor adds the cursor to the list products params
+func (o *ListProductsParams) WithCursor(cursor *string) *ListProductsParams {
+	o.SetCursor(cursor)
+	return o
+}
+
+// SetCursor adds the cursor to the list products params
+func (o *ListProductsParams) SetCursor(cursor *string) {
+	o.Cursor = cursor
+}
+
+// WithLimit adds the limit to the list products params
+func (o *ListProductsParams) WithLimit(limit *int64) *ListProductsParams {
+	o.SetLimit(limit)
+	return o
+}
+
+// SetLimit adds the limit to the list products params
+func (o *ListProductsParams) SetLimit(limit *int64) {
+	o.Limit = limit
+}
+
+// WithMaxPrice adds the maxPrice to the list products params
+func (o *ListProductsParams) WithMaxPrice(maxPrice *float64) *ListProductsParams {
+	o.SetMaxPrice(maxPrice)
+	return o
+}
+
+// SetMaxPrice adds the maxPrice to the list products params
+func (o *ListProductsParams) SetMaxPrice(maxPrice *float64) {
+	o.MaxPrice = maxPrice
+}
+
+// WithMinPrice adds the minPrice to the list products params
+func (o *ListProductsParams) WithMinPrice(minPrice *float64) *ListProductsParams {
+	o.SetMinPrice(minPrice)
+	return o
+}
+
+// SetMinPrice adds the minPrice to the list products params
+func (o *ListProductsParams) SetMinPrice(minPrice *float64) {
+	o.MinPrice = minPrice
+}
+
+// WithName adds the name to the list products params
+func (o *ListProductsParams) WithName(name *string) *ListProductsParams {
+	o.SetName(name)
+	return o
+}
+
+// SetName adds the name to the list products params
+func (o *ListProductsParams) SetName(name *string) {
+	o.Name = name
+}
+
+// WithSort adds the sort to the list products params
+func (o *ListProductsParams) WithSort(sort *string) *ListProductsParams {
+	o.SetSort(sort)
+	return o
+}
+
+// SetSort adds the sort to the list products params
+func (o *ListProductsParams) SetSort(sort *string) {
+	o.Sort = sort
+}
+
 // WriteToRequest writes these params to a swagger request
 func (o *ListProductsParams) WriteToRequest(r runtime.ClientRequest, reg strfmt.Registry) error {
 
@@ -105,6 +246,129 @@ func (o *ListProductsParams) WriteToRequest(r runtime.ClientRequest, reg strfmt.
 	}
 	var res []error
 
+	var valuesCategory []string
+	for _, v := range o.Category {
+		valuesCategory = append(valuesCategory, swag.FormatInt64(v))
+	}
+
+	joinedCategory := swag.JoinByFormat(valuesCategory, "multi")
+	// query array param category
+	if err := r.SetQueryParam("category", joinedCategory...); err != nil {
+		return err
+	}
+
+	if o.Currency != nil {
+
+		// query param Currency
+		var qrCurrency string
+		if o.Currency != nil {
+			qrCurrency = *o.Currency
+		}
+		qCurrency := qrCurrency
+		if qCurrency != "" {
+			if err := r.SetQueryParam("Currency", qCurrency); err != nil {
+				return err
+			}
+		}
+
+	}
+
+	if o.Cursor != nil {
+
+		// query param cursor
+		var qrCursor string
+		if o.Cursor != nil {
+			qrCursor = *o.Cursor
+		}
+		qCursor := qrCursor
+		if qCursor != "" {
+			if err := r.SetQueryParam("cursor", qCursor); err != nil {
+				return err
+			}
+		}
+
+	}
+
+	if o.Limit != nil {
+
+		// query param limit
+		var qrLimit int64
+		if o.Limit != nil {
+			qrLimit = *o.Limit
+		}
+		qLimit := swag.FormatInt64(qrLimit)
+		if qLimit != "" {
+			if err := r.SetQueryParam("limit", qLimit); err != nil {
+				return err
+			}
+		}
+
+	}
+
+	if o.MaxPrice != nil {
+
+		// query param max_price
+		var qrMaxPrice float64
+		if o.MaxPrice != nil {
+			qrMaxPrice = *o.MaxPrice
+		}
+		qMaxPrice := swag.FormatFloat64(qrMaxPrice)
+		if qMaxPrice != "" {
+			if err := r.SetQueryParam("max_price", qMaxPrice); err != nil {
+				return err
+			}
+		}
+
+	}
+
+	if o.MinPrice != nil {
+
+		// query param min_price
+		var qrMinPrice float64
+		if o.MinPrice != nil {
+			qrMinPrice = *o.MinPrice
+		}
+		qMinPrice := swag.FormatFloat64(qrMinPrice)
+		if qMinPrice != "" {
+			if err := r.SetQueryParam("min_price", qMinPrice); err != nil {
+				return err
+			}
+		}
+
+	}
+
+	if o.Name != nil {
+
+		// query param name
+		var qrName string
+		if o.Name != nil {
+			qrName = *o.Name
+		}
+		qName := qrName
+		if qName != "" {
+			if err := r.SetQueryParam("name", qName); err != nil {
+				return err
+			}
+		}
+
+	}
+
+	if o.Sort != nil {
+
+		// query param sort
+		var qrSort string
+		if o.Sort != nil {
+			qrSort = *o.Sort
+		}
+		qSort := qrSort
+		if qSort != "" {
+			if err := r.SetQueryParam("sort", qSort); err != nil {
+				return err
+			}
+		}
+
+	}
+
 	if len(res) > 0 {
 		return errors.CompositeValidationError(res...)
 	}
@@ -29,6 +29,18 @@ func (o *ListProductsReader) ReadResponse(response runtime.ClientResponse, consu
 			return nil, err
 		}
 		return result, nil
+	case 400:
+		result := NewListProductsBadRequest()
+		if err := result.readResponse(response, consumer, o.formats); err != nil {
+			return nil, err
+		}
+		return nil, result
+	case 403:
+		result := NewListProductsForbidden()
+		if err := result.readResponse(response, consumer, o.formats); err != nil {
+			return nil, err
+		}
+		return nil, result
 
 	default:
 		return nil, runtime.NewAPIError("response status code does not match any response statuses defined for this endpoint in the swagger spec", response, response.Code())
@@ -42,23 +54,101 @@ func NewListProductsOK() *ListProductsOK {
 
 /*ListProductsOK handles this case with default header values.
 
-Data structure representing a single product
+A list of products
 */
 type ListProductsOK struct {
-	Payload *models.Product
+	/*URL of the next page of products, only set when more products follow
+	 */
+	Link string
+	/*Provenance of the exchange rate used to convert the prices,
+	only set when a currency is requested
+	*/
+	XRateProvenance string
+
+	Payload []*models.Product
 }
 
 func (o *ListProductsOK) Error() string {
 	return fmt.Sprintf("[GET /products][%d] listProductsOK  %+v", 200, o.Payload)
 }
 
-func (o *ListProductsOK) GetPayload() *models.Product {
+func (o *ListProductsOK) GetPayload() []*models.Product {
 	return o.Payload
 }
 
 func (o *ListProductsOK) readResponse(response runtime.ClientResponse, consumer runtime.Consumer, formats strfmt.Registry) error {
 
-	o.Payload = new(models.Product)
+	// response header Link
+	o.Link = response.GetHeader("Link")
+
+	// response header X-Rate-Provenance
+	o.XRateProvenance = response.GetHeader("X-Rate-Provenance")
+
+	// response payload
+	if err := consumer.Consume(response.Body(), &o.Payload); err != nil && err != io.EOF {
+		return err
+	}
+
+	return nil
+}
+
+// NewListProductsBadRequest creates a ListProductsBadRequest with default headers values
+func NewListProductsBadRequest() *ListProductsBadRequest {
+	return &ListProductsBadRequest{}
+}
+
+/*ListProductsBadRequest handles this case with default header values.
+
+Generic error message returned as a string
+*/
+type ListProductsBadRequest struct {
+	Payload *models.GenericError
+}
+
+func (o *ListProductsBadRequest) Error() string {
+	return fmt.Sprintf("[GET /products][%d] listProductsBadRequest  %+v", 400, o.Payload)
+}
+
+func (o *ListProductsBadRequest) GetPayload() *models.GenericError {
+	return o.Payload
+}
+
+func (o *ListProductsBadRequest) readResponse(response runtime.ClientResponse, consumer runtime.Consumer, formats strfmt.Registry) error {
+
+	o.Payload = new(models.GenericError)
+
+	// response payload
+	if err := consumer.Consume(response.Body(), o.Payload); err != nil && err != io.EOF {
+		return err
+	}
+
+	return nil
+}
+
+// NewListProductsForbidden creates a ListProductsForbidden with default headers values
+func NewListProductsForbidden() *ListProductsForbidden {
+	return &ListProductsForbidden{}
+}
+
+/*ListProductsForbidden handles this case with default header values.
+
+Generic error message returned as a string
+*/
+type ListProductsForbidden struct {
+	Payload *models.GenericError
+}
+
+func (o *ListProductsForbidden) Error() string {
+	return fmt.Sprintf("[GET /products][%d] listProductsForbidden  %+v", 403, o.Payload)
+}
+
+func (o *ListProductsForbidden) GetPayload() *models.GenericError {
+	return o.Payload
+}
+
+func (o *ListProductsForbidden) readResponse(response runtime.ClientResponse, consumer runtime.Consumer, formats strfmt.Registry) error {
+
+	o.Payload = new(models.GenericError)
 
 	// response payload
 	if err := consumer.Consume(response.Body(), o.Payload); err != nil && err != io.EOF {
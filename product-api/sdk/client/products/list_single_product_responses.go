@@ -51,6 +51,11 @@ func NewListSingleProductOK() *ListSingleProductOK {
 Data structure representing a single product
 */
 type ListSingleProductOK struct {
+	/*Strong ETag of the version of the product, sent as If-Match to change
+	the product only when it is still at this version
+	*/
+	ETag string
+
 	Payload *models.Product
 }
 
@@ -64,6 +69,9 @@ func (o *ListSingleProductOK) GetPayload() *models.Product {
 
 func (o *ListSingleProductOK) readResponse(response runtime.ClientResponse, consumer runtime.Consumer, formats strfmt.Registry) error {
 
+	// response header ETag
+	o.ETag = response.GetHeader("ETag")
+
 	o.Payload = new(models.Product)
 
 	// response payload
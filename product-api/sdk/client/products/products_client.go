@@ -35,6 +35,8 @@ type ClientService interface {
 
 	ListSingleProduct(params *ListSingleProductParams) (*ListSingleProductOK, error)
 
+	SearchProducts(params *SearchProductsParams) (*SearchProductsOK, error)
+
 	UpdateProduct(params *UpdateProductParams) (*UpdateProductCreated, error)
 
 	SetTransport(transport runtime.ClientTransport)
@@ -176,6 +178,42 @@ func (a *Client) ListSingleProduct(params *ListSingleProductParams) (*ListSingle
 	panic(msg)
 }
 
+/*
+  SearchProducts Returns the products matching the query ordered by relevance. The name and
+  description of the products are searched, words match when they have the same
+  stem, start with the query word or differ by a typo.
+*/
+func (a *Client) SearchProducts(params *SearchProductsParams) (*SearchProductsOK, error) {
+	// TODO: Validate the params before sending
+	if params == nil {
+		params = NewSearchProductsParams()
+	}
+
+	result, err := a.transport.Submit(&runtime.ClientOperation{
+		ID:                 "searchProducts",
+		Method:             "GET",
+		PathPattern:        "/products/search",
+		ProducesMediaTypes: []string{"application/json"},
+		ConsumesMediaTypes: []string{"application/json"},
+		Schemes:            []string{"http"},
+		Params:             params,
+		Reader:             &SearchProductsReader{formats: a.formats},
+		Context:            params.Context,
+		Client:             params.HTTPClient,
+	})
+	if err != nil {
+		return nil, err
+	}
+	success, ok := result.(*SearchProductsOK)
+	if ok {
+		return success, nil
+	}
+	// unexpected success response
+	// safeguard: normally, absent a default response, unknown success responses return an error above: so this is a codegen issue
+	msg := fmt.Sprintf("unexpected success response for searchProducts: API contract not enforced by server. Client expected to get an error, but got: %T", result)
+	panic(msg)
+}
+
 /*
   UpdateProduct Update a product details
 */
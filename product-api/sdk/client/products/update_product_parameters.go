@@ -69,6 +69,13 @@ type UpdateProductParams struct {
 	*/
 	Body *models.Product
 
+	/*IfMatch
+	  ETag of the version the product must be at to be changed, or * for any
+	version. Required when the server is started with -require-if-match.
+
+	*/
+	IfMatch *string
+
 	timeout    time.Duration
 	Context    context.Context
 	HTTPClient *http.Client
@@ -118,6 +125,17 @@ func (o *UpdateProductParams) SetBody(body *models.Product) {
 	o.Body = body
 }
 
+// WithIfMatch adds the ifMatch to the update product params
+func (o *UpdateProductParams) WithIfMatch(ifMatch *string) *UpdateProductParams {
+	o.SetIfMatch(ifMatch)
+	return o
+}
+
+// SetIfMatch adds the ifMatch to the update product params
+func (o *UpdateProductParams) SetIfMatch(ifMatch *string) {
+	o.IfMatch = ifMatch
+}
+
 // WriteToRequest writes these params to a swagger request
 func (o *UpdateProductParams) WriteToRequest(r runtime.ClientRequest, reg strfmt.Registry) error {
 
@@ -132,6 +150,15 @@ func (o *UpdateProductParams) WriteToRequest(r runtime.ClientRequest, reg strfmt
 		}
 	}
 
+	if o.IfMatch != nil {
+
+		// header param If-Match
+		if err := r.SetHeaderParam("If-Match", *o.IfMatch); err != nil {
+			return err
+		}
+
+	}
+
 	if len(res) > 0 {
 		return errors.CompositeValidationError(res...)
 	}
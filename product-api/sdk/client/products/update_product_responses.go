@@ -35,12 +35,24 @@ func (o *UpdateProductReader) ReadResponse(response runtime.ClientResponse, cons
 			return nil, err
 		}
 		return nil, result
+	case 412:
+		result := NewUpdateProductPreconditionFailed()
+		if err := result.readResponse(response, consumer, o.formats); err != nil {
+			return nil, err
+		}
+		return nil, result
 	case 422:
 		result := NewUpdateProductUnprocessableEntity()
 		if err := result.readResponse(response, consumer, o.formats); err != nil {
 			return nil, err
 		}
 		return nil, result
+	case 428:
+		result := NewUpdateProductPreconditionRequired()
+		if err := result.readResponse(response, consumer, o.formats); err != nil {
+			return nil, err
+		}
+		return nil, result
 
 	default:
 		return nil, runtime.NewAPIError("response status code does not match any response statuses defined for this endpoint in the swagger spec", response, response.Code())
@@ -101,6 +113,39 @@ func (o *UpdateProductNotFound) readResponse(response runtime.ClientResponse, co
 	return nil
 }
 
+// NewUpdateProductPreconditionFailed creates a UpdateProductPreconditionFailed with default headers values
+func NewUpdateProductPreconditionFailed() *UpdateProductPreconditionFailed {
+	return &UpdateProductPreconditionFailed{}
+}
+
+/*UpdateProductPreconditionFailed handles this case with default header values.
+
+Generic error message returned as a string
+*/
+type UpdateProductPreconditionFailed struct {
+	Payload *models.GenericError
+}
+
+func (o *UpdateProductPreconditionFailed) Error() string {
+	return fmt.Sprintf("[PUT /products][%d] updateProductPreconditionFailed  %+v", 412, o.Payload)
+}
+
+func (o *UpdateProductPreconditionFailed) GetPayload() *models.GenericError {
+	return o.Payload
+}
+
+func (o *UpdateProductPreconditionFailed) readResponse(response runtime.ClientResponse, consumer runtime.Consumer, formats strfmt.Registry) error {
+
+	o.Payload = new(models.GenericError)
+
+	// response payload
+	if err := consumer.Consume(response.Body(), o.Payload); err != nil && err != io.EOF {
+		return err
+	}
+
+	return nil
+}
+
 // NewUpdateProductUnprocessableEntity creates a UpdateProductUnprocessableEntity with default headers values
 func NewUpdateProductUnprocessableEntity() *UpdateProductUnprocessableEntity {
 	return &UpdateProductUnprocessableEntity{}
@@ -133,3 +178,36 @@ func (o *UpdateProductUnprocessableEntity) readResponse(response runtime.ClientR
 
 	return nil
 }
+
+// NewUpdateProductPreconditionRequired creates a UpdateProductPreconditionRequired with default headers values
+func NewUpdateProductPreconditionRequired() *UpdateProductPreconditionRequired {
+	return &UpdateProductPreconditionRequired{}
+}
+
+/*UpdateProductPreconditionRequired handles this case with default header values.
+
+Generic error message returned as a string
+*/
+type UpdateProductPreconditionRequired struct {
+	Payload *models.GenericError
+}
+
+func (o *UpdateProductPreconditionRequired) Error() string {
+	return fmt.Sprintf("[PUT /products][%d] updateProductPreconditionRequired  %+v", 428, o.Payload)
+}
+
+func (o *UpdateProductPreconditionRequired) GetPayload() *models.GenericError {
+	return o.Payload
+}
+
+func (o *UpdateProductPreconditionRequired) readResponse(response runtime.ClientResponse, consumer runtime.Consumer, formats strfmt.Registry) error {
+
+	o.Payload = new(models.GenericError)
+
+	// response payload
+	if err := consumer.Consume(response.Body(), o.Payload); err != nil && err != io.EOF {
+		return err
+	}
+
+	return nil
+}
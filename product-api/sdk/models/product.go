@@ -40,6 +40,11 @@ type Product struct {
 	// Required: true
 	// Pattern: [a-z]+-[a-z]+-[a-z]+
 	SKU *string `json:"sku"`
+
+	// version of the product, set to 1 by the store when the product is created and
+	// incremented with every change. It is returned as the ETag of the product.
+	// Read Only: true
+	Version int64 `json:"version,omitempty"`
 }
 
 // Validate validates this product
@@ -1,19 +1,47 @@
 import React from 'react';
 import Table from 'react-bootstrap/Table'
-import axios from 'axios'
 import DropdownButton from 'react-bootstrap/DropdownButton'
 import Dropdown from 'react-bootstrap/Dropdown'
 
 class CoffeeList extends React.Component {
 
+    // readData opens a stream of product events for the selected currency, the server sends
+    // all products when the stream starts and whenever the exchange rate changes
     readData() {
         const self = this;
-        axios.get(window.global.api_location+`${this.state.currencyType !== 'EUR' ?`/products?currency=${this.state.currencyType}`:'/products'}`).then(function(response) {
-            console.log(response.data);
-            self.setState({products: response.data});
-        }).catch(function (error){
-            console.log(error);
+        this.closeStream();
+
+        const url = window.global.api_location+`${this.state.currencyType !== 'EUR' ?`/products/stream?currency=${this.state.currencyType}`:'/products/stream'}`;
+        this.events = new EventSource(url);
+
+        this.events.addEventListener('products', function(e) {
+            self.setState({products: JSON.parse(e.data)});
+        });
+
+        this.events.addEventListener('product', function(e) {
+            const product = JSON.parse(e.data);
+            const products = self.state.products.filter(p => p.id !== product.id);
+            products.push(product);
+            products.sort((a, b) => a.id - b.id);
+            self.setState({products: products});
+        });
+
+        this.events.addEventListener('deleted', function(e) {
+            const deleted = JSON.parse(e.data);
+            self.setState({products: self.state.products.filter(p => p.id !== deleted.id)});
         });
+
+        this.events.onerror = function(error) {
+            // the browser reconnects and resumes the stream with the last event id
+            console.log(error);
+        };
+    }
+
+    closeStream() {
+        if (this.events) {
+            this.events.close();
+            this.events = null;
+        }
     }
 
     getProducts() {
@@ -34,11 +62,15 @@ class CoffeeList extends React.Component {
     componentDidMount() {
         this.readData();
     }
+    componentWillUnmount() {
+        this.closeStream();
+    }
     constructor(props) {
         super(props);
         this.state = {products: [], currencyType: "EUR"};
 
         this.readData = this.readData.bind(this)
+        this.closeStream = this.closeStream.bind(this)
     }
 
     handleOnChange = (event) => {